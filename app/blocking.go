@@ -0,0 +1,198 @@
+package main
+
+import (
+	"time"
+)
+
+// blockingKey identifies a key clients block on, in the database they selected
+type blockingKey struct {
+	db  int
+	key string
+}
+
+// blockState describes what a blocked client is waiting for. Blocked clients
+// are parked instead of holding up the executor: they are retried when one of
+// their keys is written to (or, for WAIT, when a replica acknowledges an
+// offset) and unblocked with the timeout reply once their timeout fires.
+type blockState struct {
+	keys []string
+
+	// retry tries to serve the client after key was written to, or with an
+	// empty key for WAIT, and reports whether it was served
+	retry func(key string) ([]string, bool)
+	// timeoutReply is sent when the timeout fires before the client is served
+	timeoutReply func() []string
+
+	timer *time.Timer
+	// done is closed once the client is unblocked, completing its command
+	done chan struct{}
+}
+
+// blockClient parks client c until retry serves it or timeout elapses. A zero
+// timeout blocks forever. Handlers call it and return no reply.
+func (ch *Commands) blockClient(c *Client, timeout time.Duration, keys []string, retry func(key string) ([]string, bool), timeoutReply func() []string) {
+	state := &blockState{
+		keys: keys,
+		retry: retry,
+		timeoutReply: timeoutReply,
+	}
+	c.blocked = state
+
+	for _, key := range keys {
+		bk := blockingKey{db: c.DB, key: key}
+		ch.blockingKeys[bk] = append(ch.blockingKeys[bk], c)
+	}
+	if len(keys) == 0 {
+		ch.waitingClients = append(ch.waitingClients, c)
+	}
+
+	if timeout > 0 {
+		state.timer = time.AfterFunc(timeout, func() {
+			ch.executor.Submit(func() {
+				// the client may have been served in the meantime
+				if c.blocked == state {
+					ch.unblockClient(c, state.timeoutReply())
+				}
+			})
+		})
+	}
+}
+
+// unblockClient replies resp to a blocked client and completes its command.
+// It does nothing when the client is not blocked.
+func (ch *Commands) unblockClient(c *Client, resp []string) {
+	state := c.blocked
+	if state == nil {
+		return
+	}
+	c.blocked = nil
+
+	if state.timer != nil {
+		state.timer.Stop()
+	}
+
+	for _, key := range state.keys {
+		bk := blockingKey{db: c.DB, key: key}
+		ch.blockingKeys[bk] = removeClient(ch.blockingKeys[bk], c)
+		if len(ch.blockingKeys[bk]) == 0 {
+			delete(ch.blockingKeys, bk)
+		}
+	}
+	if len(state.keys) == 0 {
+		ch.waitingClients = removeClient(ch.waitingClients, c)
+	}
+
+	c.Reply(resp)
+	if state.done != nil {
+		close(state.done)
+	}
+}
+
+// signalKeyAsReady marks a key of database db written to, so clients blocked
+// on it are retried once the current command completes
+func (ch *Commands) signalKeyAsReady(db int, key string) {
+	bk := blockingKey{db: db, key: key}
+	if _, exists := ch.blockingKeys[bk]; exists {
+		ch.readyKeys = append(ch.readyKeys, bk)
+	}
+}
+
+// signalDBAsReady retries every client blocked on a key of database db, after
+// its contents were replaced as a whole by SWAPDB
+func (ch *Commands) signalDBAsReady(db int) {
+	for bk := range ch.blockingKeys {
+		if bk.db == db {
+			ch.readyKeys = append(ch.readyKeys, bk)
+		}
+	}
+}
+
+// handleClientsBlockedOnKeys retries the clients blocked on the keys written
+// to by the last command, in the order they blocked
+func (ch *Commands) handleClientsBlockedOnKeys() {
+	// serving a client may itself write to keys, signalling more of them
+	for len(ch.readyKeys) > 0 {
+		readyKeys := ch.readyKeys
+		ch.readyKeys = nil
+
+		for _, key := range readyKeys {
+			clients := append([]*Client(nil), ch.blockingKeys[key]...)
+			for _, c := range clients {
+				if c.blocked == nil {
+					continue
+				}
+				if resp, served := c.blocked.retry(key.key); served {
+					ch.unblockClient(c, resp)
+				}
+			}
+		}
+	}
+}
+
+// handleWaitingClients retries the clients blocked on WAIT
+func (ch *Commands) handleWaitingClients() {
+	clients := append([]*Client(nil), ch.waitingClients...)
+	for _, c := range clients {
+		if c.blocked == nil {
+			continue
+		}
+		if resp, served := c.blocked.retry(""); served {
+			ch.unblockClient(c, resp)
+		}
+	}
+}
+
+func removeClient(clients []*Client, c *Client) []*Client {
+	for i, client := range clients {
+		if client == c {
+			return append(clients[:i:i], clients[i+1:]...)
+		}
+	}
+	return clients
+}
+
+// serveOrBlock serves client c with serve, which tries the given keys and
+// returns the reply and the write to propagate, a non blocking command doing
+// the same, or a nil reply when it cannot serve the client yet. The client
+// then blocks on keys until serve succeeds with one of them after it was
+// written to, or timeout elapses and it gets timeoutReply. Errors are only replied when not blocked yet; a blocked
+// client stays blocked, for example while a key holds another type.
+func (ch *Commands) serveOrBlock(c *Client, timeout time.Duration, keys []string, serve func(keys []string) ([]string, [][]byte, error), timeoutReply func() []string) ([]string, error) {
+	resp, argv, err := serve(keys)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if resp != nil {
+		c.Argv = argv
+		return resp, nil
+	}
+
+	c.noPropagate = true
+	ch.blockClient(c, timeout, keys,
+		func(key string) ([]string, bool) {
+			resp, argv, err := serve([]string{key})
+			if err != nil || resp == nil {
+				return nil, false
+			}
+			ch.propagateServedWrite(c, argv)
+			return resp, true
+		},
+		timeoutReply,
+	)
+	return nil, nil
+}
+
+// propagateServedWrite handles the write a blocked client was served with
+// the way runCommand handles other writes: the keys it wrote to are signalled
+// and it is propagated to replicas
+func (ch *Commands) propagateServedWrite(c *Client, argv [][]byte) {
+	spec, _ := LookupCommand(argv[0])
+	for _, position := range spec.KeyPositions(argv) {
+		ch.signalKeyAsReady(c.DB, string(argv[position]))
+	}
+
+	if ch.ServerOpts.Role == RoleMaster {
+		ch.propagate(c.DB, argv)
+		c.WriteOffset = ch.ServerOpts.MasterReplicationOffset
+	}
+}
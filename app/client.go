@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+var lastClientID atomic.Int64
+
+// Client holds the state of a single connection, such as the protocol
+// version negotiated with HELLO
+type Client struct {
+	ID       int64
+	Conn     net.Conn
+	Name     string
+	Protocol int
+	// DB is the index of the database selected with SELECT
+	DB       int
+
+	// IsMaster marks the connection a replica keeps to its master. Commands
+	// coming from it are applied without replying to them.
+	IsMaster bool
+
+	// Argv is the command being executed, as it will be propagated to replicas
+	Argv [][]byte
+	// noPropagate is set by write commands that ended up changing nothing, so
+	// they are not propagated to replicas
+	noPropagate bool
+
+	// WriteOffset is the replication offset right after the last write of
+	// this client, which WAIT waits for replicas to acknowledge
+	WriteOffset int64
+
+	// blocked is set while the client waits in a blocking command. It is only
+	// accessed from the executor.
+	blocked *blockState
+	// disconnected is set once the connection closed, from the executor
+	disconnected bool
+
+	// replies queued by the executor, written to Conn by the writer goroutine
+	mu      sync.Mutex
+	replies []string
+	notify  chan struct{}
+	closing chan struct{}
+	closed  chan struct{}
+}
+
+// NewClient() Creates a new Client speaking RESP2 until it sends HELLO
+func NewClient(conn net.Conn) *Client {
+	return &Client{
+		ID:       lastClientID.Add(1),
+		Conn:     conn,
+		Protocol: RESP2,
+		notify:   make(chan struct{}, 1),
+		closing:  make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+}
+
+// RewriteArg replaces an argument of the command being executed, so replicas
+// receive a deterministic version of it (for example an XADD auto generated ID)
+func (c *Client) RewriteArg(i int, arg []byte) {
+	argv := make([][]byte, len(c.Argv))
+	copy(argv, c.Argv)
+	argv[i] = arg
+	c.Argv = argv
+}
+
+// Reply queues responses to be written to the client. It never blocks, so the
+// executor is not held up by slow clients.
+func (c *Client) Reply(resp []string) {
+	if len(resp) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	c.replies = append(c.replies, resp...)
+	c.mu.Unlock()
+
+	select {
+		case c.notify <- struct{}{}:
+		default:
+	}
+}
+
+// takeReplies returns the queued responses and empties the queue
+func (c *Client) takeReplies() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	replies := c.replies
+	c.replies = nil
+	return replies
+}
+
+// StartWriter starts the goroutine writing queued replies to the connection
+func (c *Client) StartWriter() {
+	go c.writeLoop()
+}
+
+// Close stops the writer once the queued replies are written
+func (c *Client) Close() {
+	close(c.closing)
+	<-c.closed
+}
+
+func (c *Client) writeLoop() {
+	defer close(c.closed)
+
+	failed := false
+	for {
+		select {
+			case <-c.notify:
+			case <-c.closing:
+				c.flush(&failed)
+				return
+		}
+		c.flush(&failed)
+	}
+}
+
+// flush writes the queued replies. Once a write fails the rest are discarded.
+func (c *Client) flush(failed *bool) {
+	for _, reply := range c.takeReplies() {
+		if *failed {
+			continue
+		}
+		if _, err := c.Conn.Write([]byte(reply)); err != nil {
+			fmt.Printf("error writing to client %d: %s\n", c.ID, err.Error())
+			*failed = true
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	FILTERBY Command = "FILTERBY"
+	MODULE Command = "MODULE"
+	ACLCAT Command = "ACLCAT"
+	PATTERN Command = "PATTERN"
+	GETKEYSANDFLAGS Command = "GETKEYSANDFLAGS"
+)
+
+// CommandDefaultHandler replies with the details of every command. Usage: COMMAND
+func (ch *Commands) CommandDefaultHandler(c *Client, args [][]byte) ([]string, error) {
+	names := CommandNames()
+
+	var sb strings.Builder
+	sb.WriteString(ArrayHeader(len(names)))
+	for _, name := range names {
+		sb.WriteString(commandInfoReply(c.Protocol, commandTable[name]))
+	}
+	return []string{sb.String()}, nil
+}
+
+// CommandCountHandler replies with the number of commands. Usage: COMMAND COUNT
+func (ch *Commands) CommandCountHandler(c *Client, args [][]byte) ([]string, error) {
+	return []string{intReply(len(commandTable))}, nil
+}
+
+// CommandListHandler replies with the names of the commands, including
+// subcommands. Usage: COMMAND LIST [FILTERBY MODULE name | ACLCAT category | PATTERN pattern]
+func (ch *Commands) CommandListHandler(c *Client, args [][]byte) ([]string, error) {
+	filter := func(spec *CommandSpec) bool { return true }
+
+	if len(args) != 2 {
+		if len(args) != 5 || Command(strings.ToUpper(string(args[2]))) != FILTERBY {
+			return []string{ResponseBuilder(ErrorsRespType, "syntax error")}, nil
+		}
+
+		value := strings.ToLower(string(args[4]))
+		switch Command(strings.ToUpper(string(args[3]))) {
+			case MODULE:
+				// modules are not supported, so no command belongs to one
+				filter = func(spec *CommandSpec) bool { return false }
+
+			case ACLCAT:
+				filter = func(spec *CommandSpec) bool {
+					for _, category := range spec.ACLCategories() {
+						if category == "@" + value {
+							return true
+						}
+					}
+					return false
+				}
+
+			case PATTERN:
+				filter = func(spec *CommandSpec) bool {
+					return StringMatch([]byte(value), []byte(spec.FullName), true)
+				}
+
+			default:
+				return []string{ResponseBuilder(ErrorsRespType, "syntax error")}, nil
+		}
+	}
+
+	names := make([]string, 0)
+	var collect func(spec *CommandSpec)
+	collect = func(spec *CommandSpec) {
+		if filter(spec) {
+			names = append(names, spec.FullName)
+		}
+		for _, subcommand := range spec.Subcommands {
+			collect(subcommand)
+		}
+	}
+	for _, name := range CommandNames() {
+		collect(commandTable[name])
+	}
+
+	var sb strings.Builder
+	sb.WriteString(ArrayHeader(len(names)))
+	for _, name := range names {
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, name))
+	}
+	return []string{sb.String()}, nil
+}
+
+// CommandInfoHandler replies with the details of the given commands, or of
+// every command when none is given. Unknown commands get a null. Usage: COMMAND INFO [command-name ...]
+func (ch *Commands) CommandInfoHandler(c *Client, args [][]byte) ([]string, error) {
+	if len(args) == 2 {
+		return ch.CommandDefaultHandler(c, args)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(ArrayHeader(len(args) - 2))
+	for _, name := range args[2:] {
+		spec, exists := LookupCommandByFullName(string(name))
+		if !exists {
+			sb.WriteString(NullResponse(c.Protocol)[0])
+			continue
+		}
+		sb.WriteString(commandInfoReply(c.Protocol, spec))
+	}
+	return []string{sb.String()}, nil
+}
+
+// CommandDocsHandler replies with a map from command name to its
+// documentation. Unknown commands are left out. Usage: COMMAND DOCS [command-name ...]
+func (ch *Commands) CommandDocsHandler(c *Client, args [][]byte) ([]string, error) {
+	specs := make([]*CommandSpec, 0)
+	if len(args) == 2 {
+		for _, name := range CommandNames() {
+			specs = append(specs, commandTable[name])
+		}
+	} else {
+		for _, name := range args[2:] {
+			if spec, exists := LookupCommandByFullName(string(name)); exists {
+				specs = append(specs, spec)
+			}
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(MapHeader(c.Protocol, len(specs)))
+	for _, spec := range specs {
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, spec.FullName))
+		sb.WriteString(commandDocsReply(c.Protocol, spec))
+	}
+	return []string{sb.String()}, nil
+}
+
+// CommandGetKeysHandler replies with the keys of an arbitrary command, and
+// with their access flags for GETKEYSANDFLAGS.
+// Usage: COMMAND GETKEYS|GETKEYSANDFLAGS command [arg ...]
+func (ch *Commands) CommandGetKeysHandler(c *Client, args [][]byte) ([]string, error) {
+	withFlags := Command(strings.ToUpper(string(args[1]))) == GETKEYSANDFLAGS
+	commandArgs := args[2:]
+
+	spec, exists := LookupCommand(commandArgs[0])
+	if exists && len(spec.Subcommands) > 0 && len(commandArgs) > 1 {
+		spec, exists = spec.LookupSubcommand(commandArgs[1])
+	}
+	if !exists {
+		return []string{ResponseBuilder(ErrorsRespType, "Invalid command specified")}, nil
+	}
+
+	if !spec.CheckArity(len(commandArgs)) {
+		return []string{ResponseBuilder(ErrorsRespType, "Invalid number of arguments specified for command")}, nil
+	}
+
+	if len(spec.KeySpecs) == 0 {
+		return []string{ResponseBuilder(ErrorsRespType, "The command has no key arguments")}, nil
+	}
+
+	positions, flags := spec.KeyFlags(commandArgs)
+	if len(positions) == 0 {
+		return []string{ResponseBuilder(ErrorsRespType, "Invalid arguments specified for command")}, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(ArrayHeader(len(positions)))
+	for i, position := range positions {
+		key := ResponseBuilder(BulkStringsRespType, string(commandArgs[position]))
+		if !withFlags {
+			sb.WriteString(key)
+			continue
+		}
+
+		sb.WriteString(ArrayHeader(2))
+		sb.WriteString(key)
+		sb.WriteString(statusSetReply(c.Protocol, flags[i]))
+	}
+	return []string{sb.String()}, nil
+}
+
+// commandInfoReply encodes the ten element COMMAND INFO entry of a command:
+// name, arity, flags, first key, last key, step, ACL categories, tips, key
+// specs and subcommands
+func commandInfoReply(proto int, spec *CommandSpec) string {
+	var sb strings.Builder
+	sb.WriteString(ArrayHeader(10))
+	sb.WriteString(ResponseBuilder(BulkStringsRespType, spec.FullName))
+	sb.WriteString(intReply(spec.Arity))
+	sb.WriteString(statusSetReply(proto, spec.Flags.Names()))
+	sb.WriteString(intReply(spec.FirstKey))
+	sb.WriteString(intReply(spec.LastKey))
+	sb.WriteString(intReply(spec.Step))
+	sb.WriteString(statusSetReply(proto, spec.ACLCategories()))
+
+	sb.WriteString(SetHeader(proto, len(spec.Tips)))
+	for _, tip := range spec.Tips {
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, tip))
+	}
+
+	sb.WriteString(ArrayHeader(len(spec.KeySpecs)))
+	for i := range spec.KeySpecs {
+		sb.WriteString(keySpecReply(proto, &spec.KeySpecs[i]))
+	}
+
+	sb.WriteString(ArrayHeader(len(spec.Subcommands)))
+	for _, subcommand := range spec.Subcommands {
+		sb.WriteString(commandInfoReply(proto, subcommand))
+	}
+	return sb.String()
+}
+
+// keySpecReply encodes a key spec as the map reported by COMMAND INFO
+func keySpecReply(proto int, ks *KeySpec) string {
+	var sb strings.Builder
+	sb.WriteString(MapHeader(proto, 3))
+
+	sb.WriteString(ResponseBuilder(BulkStringsRespType, "flags"))
+	sb.WriteString(statusSetReply(proto, ks.Flags))
+
+	sb.WriteString(ResponseBuilder(BulkStringsRespType, "begin_search"))
+	sb.WriteString(MapHeader(proto, 2))
+	if ks.Keyword != "" {
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, "type"))
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, "keyword"))
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, "spec"))
+		sb.WriteString(MapHeader(proto, 2))
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, "keyword"))
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, ks.Keyword))
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, "startfrom"))
+		sb.WriteString(intReply(ks.Index))
+	} else {
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, "type"))
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, "index"))
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, "spec"))
+		sb.WriteString(MapHeader(proto, 1))
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, "index"))
+		sb.WriteString(intReply(ks.Index))
+	}
+
+	sb.WriteString(ResponseBuilder(BulkStringsRespType, "find_keys"))
+	sb.WriteString(MapHeader(proto, 2))
+	if ks.NumKeys {
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, "type"))
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, "keynum"))
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, "spec"))
+		sb.WriteString(MapHeader(proto, 3))
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, "keynumidx"))
+		sb.WriteString(intReply(ks.NumKeysIndex))
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, "firstkey"))
+		sb.WriteString(intReply(ks.FirstKey))
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, "keystep"))
+		sb.WriteString(intReply(ks.KeyStep))
+	} else {
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, "type"))
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, "range"))
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, "spec"))
+		sb.WriteString(MapHeader(proto, 3))
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, "lastkey"))
+		sb.WriteString(intReply(ks.LastKey))
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, "keystep"))
+		sb.WriteString(intReply(ks.KeyStep))
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, "limit"))
+		sb.WriteString(intReply(ks.Limit))
+	}
+
+	return sb.String()
+}
+
+// commandDocsReply encodes the documentation map of a command
+func commandDocsReply(proto int, spec *CommandSpec) string {
+	fields := []string{
+		ResponseBuilder(BulkStringsRespType, "summary"), ResponseBuilder(BulkStringsRespType, spec.Summary),
+		ResponseBuilder(BulkStringsRespType, "since"), ResponseBuilder(BulkStringsRespType, spec.Since),
+		ResponseBuilder(BulkStringsRespType, "group"), ResponseBuilder(BulkStringsRespType, spec.Group),
+		ResponseBuilder(BulkStringsRespType, "complexity"), ResponseBuilder(BulkStringsRespType, spec.Complexity),
+	}
+
+	if len(spec.Subcommands) > 0 {
+		var sb strings.Builder
+		sb.WriteString(MapHeader(proto, len(spec.Subcommands)))
+		for _, subcommand := range spec.Subcommands {
+			sb.WriteString(ResponseBuilder(BulkStringsRespType, subcommand.FullName))
+			sb.WriteString(commandDocsReply(proto, subcommand))
+		}
+		fields = append(fields, ResponseBuilder(BulkStringsRespType, "subcommands"), sb.String())
+	}
+
+	return MapHeader(proto, len(fields) / 2) + strings.Join(fields, "")
+}
+
+// statusSetReply encodes names as a set of simple strings
+func statusSetReply(proto int, names []string) string {
+	var sb strings.Builder
+	sb.WriteString(SetHeader(proto, len(names)))
+	for _, name := range names {
+		sb.WriteString(ResponseBuilder(SimpleStringsRespType, name))
+	}
+	return sb.String()
+}
+
+func intReply(n int) string {
+	return fmt.Sprintf("%s%d%s", IntegersFirstChar, n, CLRF)
+}
@@ -0,0 +1,1201 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+type CommandFlags uint32
+
+// CommandHandler executes a command for client c. args[0] is the command name.
+type CommandHandler func(ch *Commands, c *Client, args [][]byte) ([]string, error)
+
+const (
+	CmdFlagWrite CommandFlags = 1 << iota
+	CmdFlagReadOnly
+	CmdFlagDenyOOM
+	CmdFlagAdmin
+	CmdFlagPubSub
+	CmdFlagNoScript
+	CmdFlagBlocking
+	CmdFlagLoading
+	CmdFlagStale
+	CmdFlagFast
+	CmdFlagNoAuth
+	CmdFlagMovableKeys
+)
+
+// flag names as reported by COMMAND, in bit order
+var commandFlagNames = []string{
+	"write",
+	"readonly",
+	"denyoom",
+	"admin",
+	"pubsub",
+	"noscript",
+	"blocking",
+	"loading",
+	"stale",
+	"fast",
+	"no_auth",
+	"movablekeys",
+}
+
+// command groups, as reported by COMMAND DOCS
+const (
+	GroupGeneric     = "generic"
+	GroupString      = "string"
+	GroupConnection  = "connection"
+	GroupServer      = "server"
+	GroupList        = "list"
+	GroupStream      = "stream"
+	GroupHash        = "hash"
+	GroupSet         = "set"
+	GroupSortedSet   = "sorted-set"
+	GroupHyperLogLog = "hyperloglog"
+)
+
+// CommandSpec describes a command: how many arguments it takes, how it
+// behaves and where its keys are. Arity counts the command name itself and
+// is negative when it is a minimum rather than an exact count. FirstKey,
+// LastKey and Step locate the keys in the argument vector, with a negative
+// LastKey counting back from the last argument and a FirstKey of 0 meaning
+// the command takes no keys. Commands whose keys cannot be described that
+// way, or that need different flags for some keys, set KeySpecs, which then
+// take over locating the keys; FirstKey, LastKey and Step keep what redis
+// reports for them, as cluster clients route on the first key.
+type CommandSpec struct {
+	Name     string
+	Arity    int
+	Flags    CommandFlags
+	FirstKey int
+	LastKey  int
+	Step     int
+	Handler  CommandHandler
+
+	// documentation reported by COMMAND DOCS
+	Group      string
+	Summary    string
+	Since      string
+	Complexity string
+	Tips       []string
+
+	KeySpecs    []KeySpec
+	Subcommands []*CommandSpec
+
+	// FullName is the name including the parent command, such as command|info
+	FullName string
+	parent   *CommandSpec
+}
+
+// KeySpec locates one group of keys in the arguments of a command. The search
+// begins either at a fixed Index or, when Keyword is set, right after the first
+// occurrence of Keyword at or after Index (before, counting from the end, when
+// Index is negative). From there keys are found either as a range ending at
+// LastKey, relative to the first key, or as a count stored in the argument at
+// NumKeysIndex with the keys starting FirstKey arguments after the begin.
+type KeySpec struct {
+	Flags []string
+
+	Index   int
+	Keyword string
+
+	LastKey int
+	KeyStep int
+	Limit   int
+
+	NumKeys      bool
+	NumKeysIndex int
+	FirstKey     int
+}
+
+var commandTable = make(map[string]*CommandSpec)
+
+func init() {
+	registerCommands(
+		// Basic Redis
+		&CommandSpec{
+			Name: "ping", Arity: -1, Flags: CmdFlagFast | CmdFlagStale, Handler: (*Commands).PingHandler,
+			Group: GroupConnection, Since: "1.0.0", Complexity: "O(1)",
+			Summary: "Returns the server's liveliness response.",
+		},
+		&CommandSpec{
+			Name: "echo", Arity: 2, Flags: CmdFlagFast | CmdFlagStale, Handler: (*Commands).EchoHandler,
+			Group: GroupConnection, Since: "1.0.0", Complexity: "O(1)",
+			Summary: "Returns the given string.",
+		},
+		&CommandSpec{
+			Name: "hello", Arity: -1, Flags: CmdFlagNoScript | CmdFlagLoading | CmdFlagStale | CmdFlagFast | CmdFlagNoAuth, Handler: (*Commands).HelloHandler,
+			Group: GroupConnection, Since: "6.0.0", Complexity: "O(1)",
+			Summary: "Handshakes with the Redis server.",
+		},
+		&CommandSpec{
+			Name: "get", Arity: 2, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).GetHandler,
+			Group: GroupString, Since: "1.0.0", Complexity: "O(1)",
+			Summary: "Returns the string value of a key.",
+		},
+		&CommandSpec{
+			Name: "set", Arity: -3, Flags: CmdFlagWrite | CmdFlagDenyOOM, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).SetHandler,
+			Group: GroupString, Since: "1.0.0", Complexity: "O(1)",
+			Summary: "Sets the string value of a key, ignoring its type. The key is created if it doesn't exist.",
+		},
+		&CommandSpec{
+			Name: "incr", Arity: 2, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).IncrHandler,
+			Group: GroupString, Since: "1.0.0", Complexity: "O(1)",
+			Summary: "Increments the integer value of a key by one. Uses 0 as initial value if the key doesn't exist.",
+		},
+		&CommandSpec{
+			Name: "decr", Arity: 2, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).DecrHandler,
+			Group: GroupString, Since: "1.0.0", Complexity: "O(1)",
+			Summary: "Decrements the integer value of a key by one. Uses 0 as initial value if the key doesn't exist.",
+		},
+		&CommandSpec{
+			Name: "incrby", Arity: 3, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).IncrByHandler,
+			Group: GroupString, Since: "1.0.0", Complexity: "O(1)",
+			Summary: "Increments the integer value of a key by a number. Uses 0 as initial value if the key doesn't exist.",
+		},
+		&CommandSpec{
+			Name: "decrby", Arity: 3, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).DecrByHandler,
+			Group: GroupString, Since: "1.0.0", Complexity: "O(1)",
+			Summary: "Decrements a number from the integer value of a key. Uses 0 as initial value if the key doesn't exist.",
+		},
+		&CommandSpec{
+			Name: "incrbyfloat", Arity: 3, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).IncrByFloatHandler,
+			Group: GroupString, Since: "2.6.0", Complexity: "O(1)",
+			Summary: "Increment the floating point value of a key by a number. Uses 0 as initial value if the key doesn't exist.",
+		},
+		&CommandSpec{
+			Name: "append", Arity: 3, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).AppendHandler,
+			Group: GroupString, Since: "2.0.0", Complexity: "O(1). The amortized time complexity is O(1) assuming the appended value is small and the already present value is of any size, since the dynamic string library used by Redis will double the free space available on every reallocation.",
+			Summary: "Appends a string to the value of a key. Creates the key if it doesn't exist.",
+		},
+		&CommandSpec{
+			Name: "strlen", Arity: 2, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).StrlenHandler,
+			Group: GroupString, Since: "2.2.0", Complexity: "O(1)",
+			Summary: "Returns the length of a string value.",
+		},
+		&CommandSpec{
+			Name: "getrange", Arity: 4, Flags: CmdFlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).GetRangeHandler,
+			Group: GroupString, Since: "2.4.0", Complexity: "O(N) where N is the length of the returned string. The complexity is ultimately determined by the returned length, but because creating a substring from an existing string is very cheap, it can be considered O(1) for small strings.",
+			Summary: "Returns a substring of the string stored at a key.",
+		},
+		&CommandSpec{
+			Name: "setrange", Arity: 4, Flags: CmdFlagWrite | CmdFlagDenyOOM, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).SetRangeHandler,
+			Group: GroupString, Since: "2.2.0", Complexity: "O(1), not counting the time taken to copy the new string in place. Usually, this string is very small so the amortized complexity is O(1). Otherwise, complexity is O(M) with M being the length of the value argument.",
+			Summary: "Overwrites a part of a string value with another by an offset. Creates the key if it doesn't exist.",
+		},
+		&CommandSpec{
+			Name: "getdel", Arity: 2, Flags: CmdFlagWrite | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).GetDelHandler,
+			Group: GroupString, Since: "6.2.0", Complexity: "O(1)",
+			Summary: "Returns the string value of a key after deleting the key.",
+		},
+		&CommandSpec{
+			Name: "getex", Arity: -2, Flags: CmdFlagWrite | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).GetExHandler,
+			Group: GroupString, Since: "6.2.0", Complexity: "O(1)",
+			Summary: "Returns the string value of a key after setting its expiration time.",
+		},
+		&CommandSpec{
+			Name: "mget", Arity: -2, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: -1, Step: 1, Handler: (*Commands).MGetHandler,
+			Group: GroupString, Since: "1.0.0", Complexity: "O(N) where N is the number of keys to retrieve.",
+			Summary: "Atomically returns the string values of one or more keys.",
+			Tips: []string{"request_policy:multi_shard"},
+		},
+		&CommandSpec{
+			Name: "mset", Arity: -3, Flags: CmdFlagWrite | CmdFlagDenyOOM, FirstKey: 1, LastKey: -1, Step: 2, Handler: (*Commands).MSetHandler,
+			Group: GroupString, Since: "1.0.1", Complexity: "O(N) where N is the number of keys to set.",
+			Summary: "Atomically creates or modifies the string values of one or more keys.",
+			Tips: []string{"request_policy:multi_shard", "response_policy:all_succeeded"},
+		},
+		&CommandSpec{
+			Name: "msetnx", Arity: -3, Flags: CmdFlagWrite | CmdFlagDenyOOM, FirstKey: 1, LastKey: -1, Step: 2, Handler: (*Commands).MSetNXHandler,
+			Group: GroupString, Since: "1.0.1", Complexity: "O(N) where N is the number of keys to set.",
+			Summary: "Atomically modifies the string values of one or more keys only when all keys don't exist.",
+		},
+		&CommandSpec{
+			Name: "lcs", Arity: -3, Flags: CmdFlagReadOnly, FirstKey: 1, LastKey: 2, Step: 1, Handler: (*Commands).LcsHandler,
+			Group: GroupString, Since: "7.0.0", Complexity: "O(N*M) where N and M are the lengths of s1 and s2, respectively",
+			Summary: "Finds the longest common substring.",
+		},
+		&CommandSpec{
+			Name: "command", Arity: -1, Flags: CmdFlagLoading | CmdFlagStale, Handler: (*Commands).CommandDefaultHandler,
+			Group: GroupServer, Since: "2.8.13", Complexity: "O(N) where N is the total number of Redis commands",
+			Summary: "Returns detailed information about all commands.",
+			Tips: []string{"nondeterministic_output_order"},
+			Subcommands: []*CommandSpec{
+				{
+					Name: "count", Arity: 2, Flags: CmdFlagLoading | CmdFlagStale, Handler: (*Commands).CommandCountHandler,
+					Group: GroupServer, Since: "2.8.13", Complexity: "O(1)",
+					Summary: "Returns a count of commands.",
+				},
+				{
+					Name: "list", Arity: -2, Flags: CmdFlagLoading | CmdFlagStale, Handler: (*Commands).CommandListHandler,
+					Group: GroupServer, Since: "7.0.0", Complexity: "O(N) where N is the total number of Redis commands",
+					Summary: "Returns a list of command names.",
+					Tips: []string{"nondeterministic_output_order"},
+				},
+				{
+					Name: "info", Arity: -2, Flags: CmdFlagLoading | CmdFlagStale, Handler: (*Commands).CommandInfoHandler,
+					Group: GroupServer, Since: "2.8.13", Complexity: "O(N) where N is the number of commands to look up",
+					Summary: "Returns information about one, multiple or all commands.",
+					Tips: []string{"nondeterministic_output_order"},
+				},
+				{
+					Name: "docs", Arity: -2, Flags: CmdFlagLoading | CmdFlagStale, Handler: (*Commands).CommandDocsHandler,
+					Group: GroupServer, Since: "7.0.0", Complexity: "O(N) where N is the number of commands to look up",
+					Summary: "Returns documentary information about one, multiple or all commands.",
+					Tips: []string{"nondeterministic_output_order"},
+				},
+				{
+					Name: "getkeys", Arity: -3, Flags: CmdFlagLoading | CmdFlagStale, Handler: (*Commands).CommandGetKeysHandler,
+					Group: GroupServer, Since: "2.8.13", Complexity: "O(N) where N is the number of arguments to the command",
+					Summary: "Extracts the key names from an arbitrary command.",
+				},
+				{
+					Name: "getkeysandflags", Arity: -3, Flags: CmdFlagLoading | CmdFlagStale, Handler: (*Commands).CommandGetKeysHandler,
+					Group: GroupServer, Since: "7.0.0", Complexity: "O(N) where N is the number of arguments to the command",
+					Summary: "Extracts the key names and access flags for an arbitrary command.",
+				},
+			},
+		},
+
+		// Replication
+		&CommandSpec{
+			Name: "info", Arity: -1, Flags: CmdFlagLoading | CmdFlagStale, Handler: (*Commands).InfoHandler,
+			Group: GroupServer, Since: "1.0.0", Complexity: "O(1)",
+			Summary: "Returns information and statistics about the server.",
+			Tips: []string{"nondeterministic_output"},
+		},
+		&CommandSpec{
+			Name: "replconf", Arity: -1, Flags: CmdFlagAdmin | CmdFlagNoScript | CmdFlagLoading | CmdFlagStale, Handler: (*Commands).ReplConfHandler,
+			Group: GroupServer, Since: "3.0.0", Complexity: "O(1)",
+			Summary: "An internal command for configuring the replication stream.",
+		},
+		&CommandSpec{
+			Name: "psync", Arity: -3, Flags: CmdFlagAdmin | CmdFlagNoScript, Handler: (*Commands).PsyncHandler,
+			Group: GroupServer, Since: "2.8.0", Complexity: "O(1)",
+			Summary: "An internal command used in replication.",
+		},
+		&CommandSpec{
+			Name: "wait", Arity: 3, Flags: CmdFlagNoScript | CmdFlagBlocking, Handler: (*Commands).WaitHandler,
+			Group: GroupGeneric, Since: "3.0.0", Complexity: "O(1)",
+			Summary: "Blocks until the asynchronous replication of all preceding write commands sent by the connection is completed.",
+		},
+
+		// RDB Persistence
+		&CommandSpec{
+			Name: "config", Arity: -2,
+			Group: GroupServer, Since: "2.0.0", Complexity: "Depends on subcommand.",
+			Summary: "A container for server configuration commands.",
+			Subcommands: []*CommandSpec{
+				{
+					Name: "get", Arity: -3, Flags: CmdFlagAdmin | CmdFlagNoScript | CmdFlagLoading | CmdFlagStale, Handler: (*Commands).ConfigHandler,
+					Group: GroupServer, Since: "2.0.0", Complexity: "O(N) when N is the number of configuration parameters provided",
+					Summary: "Returns the effective values of configuration parameters.",
+				},
+			},
+		},
+		&CommandSpec{
+			Name: "keys", Arity: 2, Flags: CmdFlagReadOnly, Handler: (*Commands).KeysHandler,
+			Group: GroupGeneric, Since: "1.0.0", Complexity: "O(N) with N being the number of keys in the database",
+			Summary: "Returns all key names that match a pattern.",
+			Tips: []string{"request_policy:all_shards", "nondeterministic_output_order"},
+		},
+
+		// Keyspace
+		&CommandSpec{
+			Name: "del", Arity: -2, Flags: CmdFlagWrite, FirstKey: 1, LastKey: -1, Step: 1, Handler: (*Commands).DelHandler,
+			Group: GroupGeneric, Since: "1.0.0", Complexity: "O(N) where N is the number of keys that will be removed. When a key to remove holds a value other than a string, the individual complexity for this key is O(M) where M is the number of elements in the list, set, sorted set or hash. Removing a single key that holds a string value is O(1).",
+			Summary: "Deletes one or more keys.",
+			Tips: []string{"request_policy:multi_shard", "response_policy:agg_sum"},
+		},
+		&CommandSpec{
+			Name: "unlink", Arity: -2, Flags: CmdFlagWrite | CmdFlagFast, FirstKey: 1, LastKey: -1, Step: 1, Handler: (*Commands).UnlinkHandler,
+			Group: GroupGeneric, Since: "4.0.0", Complexity: "O(1) for each key removed regardless of its size. Then the command does O(N) work in a different thread in order to reclaim memory, where N is the number of allocations the deleted objects where composed of.",
+			Summary: "Asynchronously deletes one or more keys.",
+			Tips: []string{"request_policy:multi_shard", "response_policy:agg_sum"},
+		},
+		&CommandSpec{
+			Name: "exists", Arity: -2, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: -1, Step: 1, Handler: (*Commands).ExistsHandler,
+			Group: GroupGeneric, Since: "1.0.0", Complexity: "O(N) where N is the number of keys to check.",
+			Summary: "Determines whether one or more keys exist.",
+			Tips: []string{"request_policy:multi_shard", "response_policy:agg_sum"},
+		},
+		&CommandSpec{
+			Name: "touch", Arity: -2, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: -1, Step: 1, Handler: (*Commands).TouchHandler,
+			Group: GroupGeneric, Since: "3.2.1", Complexity: "O(N) where N is the number of keys that will be touched.",
+			Summary: "Returns the number of existing keys out of those specified after updating the time they were last accessed.",
+			Tips: []string{"request_policy:multi_shard", "response_policy:agg_sum"},
+		},
+		&CommandSpec{
+			Name: "rename", Arity: 3, Flags: CmdFlagWrite, FirstKey: 1, LastKey: 2, Step: 1, Handler: (*Commands).RenameHandler,
+			Group: GroupGeneric, Since: "1.0.0", Complexity: "O(1)",
+			Summary: "Renames a key and overwrites the destination.",
+		},
+		&CommandSpec{
+			Name: "renamenx", Arity: 3, Flags: CmdFlagWrite | CmdFlagFast, FirstKey: 1, LastKey: 2, Step: 1, Handler: (*Commands).RenameNXHandler,
+			Group: GroupGeneric, Since: "1.0.0", Complexity: "O(1)",
+			Summary: "Renames a key only when the target key name doesn't exist.",
+		},
+		&CommandSpec{
+			Name: "copy", Arity: -3, Flags: CmdFlagWrite | CmdFlagDenyOOM, FirstKey: 1, LastKey: 2, Step: 1, Handler: (*Commands).CopyHandler,
+			Group: GroupGeneric, Since: "6.2.0", Complexity: "O(N) worst case for collections, where N is the number of nested items. O(1) for string values.",
+			Summary: "Copies the value of a key to a new key.",
+		},
+		&CommandSpec{
+			Name: "randomkey", Arity: 1, Flags: CmdFlagReadOnly, Handler: (*Commands).RandomKeyHandler,
+			Group: GroupGeneric, Since: "1.0.0", Complexity: "O(1)",
+			Summary: "Returns a random key name from the database.",
+			Tips: []string{"request_policy:all_shards", "response_policy:special", "nondeterministic_output"},
+		},
+		&CommandSpec{
+			Name: "scan", Arity: -2, Flags: CmdFlagReadOnly, Handler: (*Commands).ScanHandler,
+			Group: GroupGeneric, Since: "2.8.0", Complexity: "O(1) for every call. O(N) for a complete iteration, including enough command calls for the cursor to return back to 0. N is the number of elements inside the collection.",
+			Summary: "Iterates over the key names in the database.",
+			Tips: []string{"nondeterministic_output", "request_policy:special", "response_policy:special"},
+		},
+		&CommandSpec{
+			Name: "hscan", Arity: -3, Flags: CmdFlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).HScanHandler,
+			Group: GroupHash, Since: "2.8.0", Complexity: "O(1) for every call. O(N) for a complete iteration, including enough command calls for the cursor to return back to 0. N is the number of elements inside the collection.",
+			Summary: "Iterates over fields and values of a hash.",
+			Tips: []string{"nondeterministic_output"},
+		},
+		&CommandSpec{
+			Name: "sscan", Arity: -3, Flags: CmdFlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).SScanHandler,
+			Group: GroupSet, Since: "2.8.0", Complexity: "O(1) for every call. O(N) for a complete iteration, including enough command calls for the cursor to return back to 0. N is the number of elements inside the collection.",
+			Summary: "Iterates over members of a set.",
+			Tips: []string{"nondeterministic_output"},
+		},
+		&CommandSpec{
+			Name: "zscan", Arity: -3, Flags: CmdFlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).ZScanHandler,
+			Group: GroupSortedSet, Since: "2.8.0", Complexity: "O(1) for every call. O(N) for a complete iteration, including enough command calls for the cursor to return back to 0. N is the number of elements inside the collection.",
+			Summary: "Iterates over members and scores of a sorted set.",
+			Tips: []string{"nondeterministic_output"},
+		},
+
+		// Expiration
+		&CommandSpec{
+			Name: "expire", Arity: -3, Flags: CmdFlagWrite | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).ExpireHandler,
+			Group: GroupGeneric, Since: "1.0.0", Complexity: "O(1)",
+			Summary: "Sets the expiration time of a key in seconds.",
+		},
+		&CommandSpec{
+			Name: "pexpire", Arity: -3, Flags: CmdFlagWrite | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).PExpireHandler,
+			Group: GroupGeneric, Since: "2.6.0", Complexity: "O(1)",
+			Summary: "Sets the expiration time of a key in milliseconds.",
+		},
+		&CommandSpec{
+			Name: "expireat", Arity: -3, Flags: CmdFlagWrite | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).ExpireAtHandler,
+			Group: GroupGeneric, Since: "1.2.0", Complexity: "O(1)",
+			Summary: "Sets the expiration time of a key to a Unix timestamp.",
+		},
+		&CommandSpec{
+			Name: "pexpireat", Arity: -3, Flags: CmdFlagWrite | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).PExpireAtHandler,
+			Group: GroupGeneric, Since: "2.6.0", Complexity: "O(1)",
+			Summary: "Sets the expiration time of a key to a Unix milliseconds timestamp.",
+		},
+		&CommandSpec{
+			Name: "persist", Arity: 2, Flags: CmdFlagWrite | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).PersistHandler,
+			Group: GroupGeneric, Since: "2.2.0", Complexity: "O(1)",
+			Summary: "Removes the expiration time of a key.",
+		},
+		&CommandSpec{
+			Name: "ttl", Arity: 2, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).TtlHandler,
+			Group: GroupGeneric, Since: "1.0.0", Complexity: "O(1)",
+			Summary: "Returns the expiration time in seconds of a key.",
+			Tips: []string{"nondeterministic_output"},
+		},
+		&CommandSpec{
+			Name: "pttl", Arity: 2, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).PTtlHandler,
+			Group: GroupGeneric, Since: "2.6.0", Complexity: "O(1)",
+			Summary: "Returns the expiration time in milliseconds of a key.",
+			Tips: []string{"nondeterministic_output"},
+		},
+		&CommandSpec{
+			Name: "expiretime", Arity: 2, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).ExpireTimeHandler,
+			Group: GroupGeneric, Since: "7.0.0", Complexity: "O(1)",
+			Summary: "Returns the expiration time of a key as a Unix timestamp.",
+		},
+		&CommandSpec{
+			Name: "pexpiretime", Arity: 2, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).PExpireTimeHandler,
+			Group: GroupGeneric, Since: "7.0.0", Complexity: "O(1)",
+			Summary: "Returns the expiration time of a key as a Unix milliseconds timestamp.",
+		},
+
+		// Databases
+		&CommandSpec{
+			Name: "select", Arity: 2, Flags: CmdFlagLoading | CmdFlagStale | CmdFlagFast, Handler: (*Commands).SelectHandler,
+			Group: GroupConnection, Since: "1.0.0", Complexity: "O(1)",
+			Summary: "Changes the selected database.",
+		},
+		&CommandSpec{
+			Name: "move", Arity: 3, Flags: CmdFlagWrite | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).MoveHandler,
+			Group: GroupGeneric, Since: "1.0.0", Complexity: "O(1)",
+			Summary: "Moves a key to another database.",
+		},
+		&CommandSpec{
+			Name: "swapdb", Arity: 3, Flags: CmdFlagWrite | CmdFlagFast, Handler: (*Commands).SwapDBHandler,
+			Group: GroupServer, Since: "4.0.0", Complexity: "O(N) where N is the count of clients watching or blocking on keys from both databases.",
+			Summary: "Swaps two Redis databases.",
+		},
+		&CommandSpec{
+			Name: "flushdb", Arity: -1, Flags: CmdFlagWrite, Handler: (*Commands).FlushDBHandler,
+			Group: GroupServer, Since: "1.0.0", Complexity: "O(N) where N is the number of keys in the selected database",
+			Summary: "Remove all keys from the current database.",
+			Tips: []string{"request_policy:all_shards", "response_policy:all_succeeded"},
+		},
+		&CommandSpec{
+			Name: "flushall", Arity: -1, Flags: CmdFlagWrite, Handler: (*Commands).FlushAllHandler,
+			Group: GroupServer, Since: "1.0.0", Complexity: "O(N) where N is the total number of keys in all databases",
+			Summary: "Removes all keys from all databases.",
+			Tips: []string{"request_policy:all_shards", "response_policy:all_succeeded"},
+		},
+		&CommandSpec{
+			Name: "dbsize", Arity: 1, Flags: CmdFlagReadOnly | CmdFlagFast, Handler: (*Commands).DBSizeHandler,
+			Group: GroupServer, Since: "1.0.0", Complexity: "O(1)",
+			Summary: "Returns the number of keys in the database.",
+			Tips: []string{"request_policy:all_shards", "response_policy:agg_sum"},
+		},
+
+		// Lists
+		&CommandSpec{
+			Name: "lpush", Arity: -3, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).LPushHandler,
+			Group: GroupList, Since: "1.0.0", Complexity: "O(1) for each element added, so O(N) to add N elements when the command is called with multiple arguments.",
+			Summary: "Prepends one or more elements to a list. Creates the key if it doesn't exist.",
+		},
+		&CommandSpec{
+			Name: "rpush", Arity: -3, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).RPushHandler,
+			Group: GroupList, Since: "1.0.0", Complexity: "O(1) for each element added, so O(N) to add N elements when the command is called with multiple arguments.",
+			Summary: "Appends one or more elements to a list. Creates the key if it doesn't exist.",
+		},
+		&CommandSpec{
+			Name: "lpushx", Arity: -3, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).LPushXHandler,
+			Group: GroupList, Since: "2.2.0", Complexity: "O(1) for each element added, so O(N) to add N elements when the command is called with multiple arguments.",
+			Summary: "Prepends one or more elements to a list only when the list exists.",
+		},
+		&CommandSpec{
+			Name: "rpushx", Arity: -3, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).RPushXHandler,
+			Group: GroupList, Since: "2.2.0", Complexity: "O(1) for each element added, so O(N) to add N elements when the command is called with multiple arguments.",
+			Summary: "Appends an element to a list only when the list exists.",
+		},
+		&CommandSpec{
+			Name: "lpop", Arity: -2, Flags: CmdFlagWrite | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).LPopHandler,
+			Group: GroupList, Since: "1.0.0", Complexity: "O(N) where N is the number of elements returned",
+			Summary: "Returns the first elements in a list after removing it. Deletes the list if the last element was popped.",
+		},
+		&CommandSpec{
+			Name: "rpop", Arity: -2, Flags: CmdFlagWrite | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).RPopHandler,
+			Group: GroupList, Since: "1.0.0", Complexity: "O(N) where N is the number of elements returned",
+			Summary: "Returns and removes the last elements of a list. Deletes the list if the last element was popped.",
+		},
+		&CommandSpec{
+			Name: "llen", Arity: 2, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).LLenHandler,
+			Group: GroupList, Since: "1.0.0", Complexity: "O(1)",
+			Summary: "Returns the length of a list.",
+		},
+		&CommandSpec{
+			Name: "lrange", Arity: 4, Flags: CmdFlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).LRangeHandler,
+			Group: GroupList, Since: "1.0.0", Complexity: "O(S+N) where S is the distance of start offset from HEAD for small lists, from nearest end (HEAD or TAIL) for large lists; and N is the number of elements in the specified range.",
+			Summary: "Returns a range of elements from a list.",
+		},
+		&CommandSpec{
+			Name: "lindex", Arity: 3, Flags: CmdFlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).LIndexHandler,
+			Group: GroupList, Since: "1.0.0", Complexity: "O(N) where N is the number of elements to traverse to get to the element at index. This makes asking for the first or the last element of the list O(1).",
+			Summary: "Returns an element from a list by its index.",
+		},
+		&CommandSpec{
+			Name: "lset", Arity: 4, Flags: CmdFlagWrite | CmdFlagDenyOOM, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).LSetHandler,
+			Group: GroupList, Since: "1.0.0", Complexity: "O(N) where N is the length of the list. Setting either the first or the last element of the list is O(1).",
+			Summary: "Sets the value of an element in a list by its index.",
+		},
+		&CommandSpec{
+			Name: "linsert", Arity: 5, Flags: CmdFlagWrite | CmdFlagDenyOOM, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).LInsertHandler,
+			Group: GroupList, Since: "2.2.0", Complexity: "O(N) where N is the number of elements to traverse before seeing the value pivot. This means that inserting somewhere on the left end on the list (head) can be considered O(1) and inserting somewhere on the right end (tail) is O(N).",
+			Summary: "Inserts an element before or after another element in a list.",
+		},
+		&CommandSpec{
+			Name: "lrem", Arity: 4, Flags: CmdFlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).LRemHandler,
+			Group: GroupList, Since: "1.0.0", Complexity: "O(N+M) where N is the length of the list and M is the number of elements removed.",
+			Summary: "Removes elements from a list. Deletes the list if the last element was removed.",
+		},
+		&CommandSpec{
+			Name: "ltrim", Arity: 4, Flags: CmdFlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).LTrimHandler,
+			Group: GroupList, Since: "1.0.0", Complexity: "O(N) where N is the number of elements to be removed by the operation.",
+			Summary: "Removes elements from both ends a list. Deletes the list if all elements were trimmed.",
+		},
+		&CommandSpec{
+			Name: "lpos", Arity: -3, Flags: CmdFlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).LPosHandler,
+			Group: GroupList, Since: "6.0.6", Complexity: "O(N) where N is the number of elements in the list, for the average case. When searching for elements near the head or the tail of the list, or when the MAXLEN option is provided, the command may run in constant time.",
+			Summary: "Returns the index of matching elements in a list.",
+		},
+		&CommandSpec{
+			Name: "lmove", Arity: 5, Flags: CmdFlagWrite | CmdFlagDenyOOM, FirstKey: 1, LastKey: 2, Step: 1, Handler: (*Commands).LMoveHandler,
+			Group: GroupList, Since: "6.2.0", Complexity: "O(1)",
+			Summary: "Returns an element after popping it from one list and pushing it to another. Deletes the list if the last element was moved.",
+		},
+		&CommandSpec{
+			Name: "lmpop", Arity: -4, Flags: CmdFlagWrite, Handler: (*Commands).LMPopHandler,
+			Group: GroupList, Since: "7.0.0", Complexity: "O(N+M) where N is the number of provided keys and M is the number of elements returned.",
+			Summary: "Returns multiple elements from a list after removing them. Deletes the list if the last element was popped.",
+			KeySpecs: []KeySpec{
+				{Flags: []string{"RW", "access", "delete"}, Index: 1, NumKeys: true, NumKeysIndex: 0, FirstKey: 1, KeyStep: 1},
+			},
+		},
+		&CommandSpec{
+			Name: "blpop", Arity: -3, Flags: CmdFlagWrite | CmdFlagBlocking, FirstKey: 1, LastKey: -2, Step: 1, Handler: (*Commands).BLPopHandler,
+			Group: GroupList, Since: "2.0.0", Complexity: "O(N) where N is the number of provided keys.",
+			Summary: "Removes and returns the first element in a list. Blocks until an element is available otherwise. Deletes the list if the last element was popped.",
+		},
+		&CommandSpec{
+			Name: "brpop", Arity: -3, Flags: CmdFlagWrite | CmdFlagBlocking, FirstKey: 1, LastKey: -2, Step: 1, Handler: (*Commands).BRPopHandler,
+			Group: GroupList, Since: "2.0.0", Complexity: "O(N) where N is the number of provided keys.",
+			Summary: "Removes and returns the last element in a list. Blocks until an element is available otherwise. Deletes the list if the last element was popped.",
+		},
+		&CommandSpec{
+			Name: "blmove", Arity: 6, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagBlocking, FirstKey: 1, LastKey: 2, Step: 1, Handler: (*Commands).BLMoveHandler,
+			Group: GroupList, Since: "6.2.0", Complexity: "O(1)",
+			Summary: "Pops an element from a list, pushes it to another list and returns it. Blocks until an element is available otherwise. Deletes the list if the last element was moved.",
+		},
+		&CommandSpec{
+			Name: "blmpop", Arity: -5, Flags: CmdFlagWrite | CmdFlagBlocking, Handler: (*Commands).BLMPopHandler,
+			Group: GroupList, Since: "7.0.0", Complexity: "O(N+M) where N is the number of provided keys and M is the number of elements returned.",
+			Summary: "Pops the first element from one of multiple lists. Blocks until an element is available otherwise. Deletes the list if the last element was popped.",
+			KeySpecs: []KeySpec{
+				{Flags: []string{"RW", "access", "delete"}, Index: 2, NumKeys: true, NumKeysIndex: 0, FirstKey: 1, KeyStep: 1},
+			},
+		},
+
+		// Hashes
+		&CommandSpec{
+			Name: "hset", Arity: -4, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).HSetHandler,
+			Group: GroupHash, Since: "2.0.0", Complexity: "O(1) for each field/value pair added, so O(N) to add N field/value pairs when the command is called with multiple field/value pairs.",
+			Summary: "Creates or modifies the value of a field in a hash.",
+		},
+		&CommandSpec{
+			Name: "hmset", Arity: -4, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).HMSetHandler,
+			Group: GroupHash, Since: "2.0.0", Complexity: "O(N) where N is the number of fields being set.",
+			Summary: "Sets the values of multiple fields.",
+		},
+		&CommandSpec{
+			Name: "hsetnx", Arity: 4, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).HSetNXHandler,
+			Group: GroupHash, Since: "2.0.0", Complexity: "O(1)",
+			Summary: "Sets the value of a field in a hash only when the field doesn't exist.",
+		},
+		&CommandSpec{
+			Name: "hget", Arity: 3, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).HGetHandler,
+			Group: GroupHash, Since: "2.0.0", Complexity: "O(1)",
+			Summary: "Returns the value of a field in a hash.",
+		},
+		&CommandSpec{
+			Name: "hmget", Arity: -3, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).HMGetHandler,
+			Group: GroupHash, Since: "2.0.0", Complexity: "O(N) where N is the number of fields being requested.",
+			Summary: "Returns the values of all fields in a hash.",
+		},
+		&CommandSpec{
+			Name: "hdel", Arity: -3, Flags: CmdFlagWrite | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).HDelHandler,
+			Group: GroupHash, Since: "2.0.0", Complexity: "O(N) where N is the number of fields to be removed.",
+			Summary: "Deletes one or more fields and their values from a hash. Deletes the hash if no fields remain.",
+		},
+		&CommandSpec{
+			Name: "hgetall", Arity: 2, Flags: CmdFlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).HGetAllHandler,
+			Group: GroupHash, Since: "2.0.0", Complexity: "O(N) where N is the size of the hash.",
+			Summary: "Returns all fields and values in a hash.",
+			Tips: []string{"nondeterministic_output_order"},
+		},
+		&CommandSpec{
+			Name: "hkeys", Arity: 2, Flags: CmdFlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).HKeysHandler,
+			Group: GroupHash, Since: "2.0.0", Complexity: "O(N) where N is the size of the hash.",
+			Summary: "Returns all fields in a hash.",
+			Tips: []string{"nondeterministic_output_order"},
+		},
+		&CommandSpec{
+			Name: "hvals", Arity: 2, Flags: CmdFlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).HValsHandler,
+			Group: GroupHash, Since: "2.0.0", Complexity: "O(N) where N is the size of the hash.",
+			Summary: "Returns all values in a hash.",
+			Tips: []string{"nondeterministic_output_order"},
+		},
+		&CommandSpec{
+			Name: "hlen", Arity: 2, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).HLenHandler,
+			Group: GroupHash, Since: "2.0.0", Complexity: "O(1)",
+			Summary: "Returns the number of fields in a hash.",
+		},
+		&CommandSpec{
+			Name: "hexists", Arity: 3, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).HExistsHandler,
+			Group: GroupHash, Since: "2.0.0", Complexity: "O(1)",
+			Summary: "Determines whether a field exists in a hash.",
+		},
+		&CommandSpec{
+			Name: "hstrlen", Arity: 3, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).HStrLenHandler,
+			Group: GroupHash, Since: "3.2.0", Complexity: "O(1)",
+			Summary: "Returns the length of the value of a field.",
+		},
+		&CommandSpec{
+			Name: "hincrby", Arity: 4, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).HIncrByHandler,
+			Group: GroupHash, Since: "2.0.0", Complexity: "O(1)",
+			Summary: "Increments the integer value of a field in a hash by a number. Uses 0 as initial value if the field doesn't exist.",
+		},
+		&CommandSpec{
+			Name: "hincrbyfloat", Arity: 4, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).HIncrByFloatHandler,
+			Group: GroupHash, Since: "2.6.0", Complexity: "O(1)",
+			Summary: "Increments the floating point value of a field by a number. Uses 0 as initial value if the field doesn't exist.",
+		},
+		&CommandSpec{
+			Name: "hrandfield", Arity: -2, Flags: CmdFlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).HRandFieldHandler,
+			Group: GroupHash, Since: "6.2.0", Complexity: "O(N) where N is the number of fields returned",
+			Summary: "Returns one or more random fields from a hash.",
+			Tips: []string{"nondeterministic_output"},
+		},
+		&CommandSpec{
+			Name: "hexpire", Arity: -6, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).HExpireHandler,
+			Group: GroupHash, Since: "7.4.0", Complexity: "O(N) where N is the number of specified fields",
+			Summary: "Set expiry for hash field using relative time to expire (seconds)",
+		},
+		&CommandSpec{
+			Name: "hpexpire", Arity: -6, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).HPExpireHandler,
+			Group: GroupHash, Since: "7.4.0", Complexity: "O(N) where N is the number of specified fields",
+			Summary: "Set expiry for hash field using relative time to expire (milliseconds)",
+		},
+		&CommandSpec{
+			Name: "hexpireat", Arity: -6, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).HExpireAtHandler,
+			Group: GroupHash, Since: "7.4.0", Complexity: "O(N) where N is the number of specified fields",
+			Summary: "Set expiry for hash field using an absolute Unix timestamp (seconds)",
+		},
+		&CommandSpec{
+			Name: "hpexpireat", Arity: -6, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).HPExpireAtHandler,
+			Group: GroupHash, Since: "7.4.0", Complexity: "O(N) where N is the number of specified fields",
+			Summary: "Set expiry for hash field using an absolute Unix timestamp (milliseconds)",
+		},
+		&CommandSpec{
+			Name: "hpersist", Arity: -5, Flags: CmdFlagWrite | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).HPersistHandler,
+			Group: GroupHash, Since: "7.4.0", Complexity: "O(N) where N is the number of specified fields",
+			Summary: "Removes the expiration time for each specified field",
+		},
+		&CommandSpec{
+			Name: "httl", Arity: -5, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).HTtlHandler,
+			Group: GroupHash, Since: "7.4.0", Complexity: "O(N) where N is the number of specified fields",
+			Summary: "Returns the TTL in seconds of a hash field.",
+			Tips: []string{"nondeterministic_output"},
+		},
+		&CommandSpec{
+			Name: "hpttl", Arity: -5, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).HPTtlHandler,
+			Group: GroupHash, Since: "7.4.0", Complexity: "O(N) where N is the number of specified fields",
+			Summary: "Returns the TTL in milliseconds of a hash field.",
+			Tips: []string{"nondeterministic_output"},
+		},
+		&CommandSpec{
+			Name: "hexpiretime", Arity: -5, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).HExpireTimeHandler,
+			Group: GroupHash, Since: "7.4.0", Complexity: "O(N) where N is the number of specified fields",
+			Summary: "Returns the expiration time of a hash field as a Unix timestamp, in seconds.",
+		},
+		&CommandSpec{
+			Name: "hpexpiretime", Arity: -5, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).HPExpireTimeHandler,
+			Group: GroupHash, Since: "7.4.0", Complexity: "O(N) where N is the number of specified fields",
+			Summary: "Returns the expiration time of a hash field as a Unix timestamp, in msec.",
+		},
+
+		// Sets
+		&CommandSpec{
+			Name: "sadd", Arity: -3, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).SAddHandler,
+			Group: GroupSet, Since: "1.0.0", Complexity: "O(1) for each element added, so O(N) to add N elements when the command is called with multiple arguments.",
+			Summary: "Adds one or more members to a set. Creates the key if it doesn't exist.",
+		},
+		&CommandSpec{
+			Name: "srem", Arity: -3, Flags: CmdFlagWrite | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).SRemHandler,
+			Group: GroupSet, Since: "1.0.0", Complexity: "O(N) where N is the number of members to be removed.",
+			Summary: "Removes one or more members from a set. Deletes the set if the last member was removed.",
+		},
+		&CommandSpec{
+			Name: "smembers", Arity: 2, Flags: CmdFlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).SMembersHandler,
+			Group: GroupSet, Since: "1.0.0", Complexity: "O(N) where N is the set cardinality.",
+			Summary: "Returns all members of a set.",
+			Tips: []string{"nondeterministic_output_order"},
+		},
+		&CommandSpec{
+			Name: "sismember", Arity: 3, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).SIsMemberHandler,
+			Group: GroupSet, Since: "1.0.0", Complexity: "O(1)",
+			Summary: "Determines whether a member belongs to a set.",
+		},
+		&CommandSpec{
+			Name: "smismember", Arity: -3, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).SMIsMemberHandler,
+			Group: GroupSet, Since: "6.2.0", Complexity: "O(N) where N is the number of elements being checked for membership",
+			Summary: "Determines whether multiple members belong to a set.",
+		},
+		&CommandSpec{
+			Name: "scard", Arity: 2, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).SCardHandler,
+			Group: GroupSet, Since: "1.0.0", Complexity: "O(1)",
+			Summary: "Returns the number of members in a set.",
+		},
+		&CommandSpec{
+			Name: "spop", Arity: -2, Flags: CmdFlagWrite | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).SPopHandler,
+			Group: GroupSet, Since: "1.0.0", Complexity: "Without the count argument O(1), otherwise O(N) where N is the value of the passed count.",
+			Summary: "Returns one or more random members from a set after removing them. Deletes the set if the last member was popped.",
+			Tips: []string{"nondeterministic_output"},
+		},
+		&CommandSpec{
+			Name: "srandmember", Arity: -2, Flags: CmdFlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).SRandMemberHandler,
+			Group: GroupSet, Since: "1.0.0", Complexity: "Without the count argument O(1), otherwise O(N) where N is the absolute value of the passed count.",
+			Summary: "Get one or multiple random members from a set",
+			Tips: []string{"nondeterministic_output"},
+		},
+		&CommandSpec{
+			Name: "smove", Arity: 4, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagFast, FirstKey: 1, LastKey: 2, Step: 1, Handler: (*Commands).SMoveHandler,
+			Group: GroupSet, Since: "1.0.0", Complexity: "O(1)",
+			Summary: "Moves a member from one set to another.",
+		},
+		&CommandSpec{
+			Name: "sinter", Arity: -2, Flags: CmdFlagReadOnly, FirstKey: 1, LastKey: -1, Step: 1, Handler: (*Commands).SInterHandler,
+			Group: GroupSet, Since: "1.0.0", Complexity: "O(N*M) worst case where N is the cardinality of the smallest set and M is the number of sets.",
+			Summary: "Returns the intersect of multiple sets.",
+			Tips: []string{"nondeterministic_output_order"},
+		},
+		&CommandSpec{
+			Name: "sintercard", Arity: -3, Flags: CmdFlagReadOnly, Handler: (*Commands).SInterCardHandler,
+			Group: GroupSet, Since: "7.0.0", Complexity: "O(N*M) worst case where N is the cardinality of the smallest set and M is the number of sets.",
+			Summary: "Returns the number of members of the intersect of multiple sets.",
+			KeySpecs: []KeySpec{
+				{Flags: []string{"RO", "access"}, Index: 1, NumKeys: true, NumKeysIndex: 0, FirstKey: 1, KeyStep: 1},
+			},
+		},
+		&CommandSpec{
+			Name: "sinterstore", Arity: -3, Flags: CmdFlagWrite | CmdFlagDenyOOM, FirstKey: 1, LastKey: -1, Step: 1, Handler: (*Commands).SInterStoreHandler,
+			Group: GroupSet, Since: "1.0.0", Complexity: "O(N*M) worst case where N is the cardinality of the smallest set and M is the number of sets.",
+			Summary: "Stores the intersect of multiple sets in a key.",
+		},
+		&CommandSpec{
+			Name: "sunion", Arity: -2, Flags: CmdFlagReadOnly, FirstKey: 1, LastKey: -1, Step: 1, Handler: (*Commands).SUnionHandler,
+			Group: GroupSet, Since: "1.0.0", Complexity: "O(N) where N is the total number of elements in all given sets.",
+			Summary: "Returns the union of multiple sets.",
+			Tips: []string{"nondeterministic_output_order"},
+		},
+		&CommandSpec{
+			Name: "sunionstore", Arity: -3, Flags: CmdFlagWrite | CmdFlagDenyOOM, FirstKey: 1, LastKey: -1, Step: 1, Handler: (*Commands).SUnionStoreHandler,
+			Group: GroupSet, Since: "1.0.0", Complexity: "O(N) where N is the total number of elements in all given sets.",
+			Summary: "Stores the union of multiple sets in a key.",
+		},
+		&CommandSpec{
+			Name: "sdiff", Arity: -2, Flags: CmdFlagReadOnly, FirstKey: 1, LastKey: -1, Step: 1, Handler: (*Commands).SDiffHandler,
+			Group: GroupSet, Since: "1.0.0", Complexity: "O(N) where N is the total number of elements in all given sets.",
+			Summary: "Returns the difference of multiple sets.",
+			Tips: []string{"nondeterministic_output_order"},
+		},
+		&CommandSpec{
+			Name: "sdiffstore", Arity: -3, Flags: CmdFlagWrite | CmdFlagDenyOOM, FirstKey: 1, LastKey: -1, Step: 1, Handler: (*Commands).SDiffStoreHandler,
+			Group: GroupSet, Since: "1.0.0", Complexity: "O(N) where N is the total number of elements in all given sets.",
+			Summary: "Stores the difference of multiple sets in a key.",
+		},
+
+		// Sorted Sets
+		&CommandSpec{
+			Name: "zadd", Arity: -4, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).ZAddHandler,
+			Group: GroupSortedSet, Since: "1.2.0", Complexity: "O(log(N)) for each item added, where N is the number of elements in the sorted set.",
+			Summary: "Adds one or more members to a sorted set, or updates their scores. Creates the key if it doesn't exist.",
+		},
+		&CommandSpec{
+			Name: "zincrby", Arity: 4, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).ZIncrByHandler,
+			Group: GroupSortedSet, Since: "1.2.0", Complexity: "O(log(N)) where N is the number of elements in the sorted set.",
+			Summary: "Increments the score of a member in a sorted set.",
+		},
+		&CommandSpec{
+			Name: "zrem", Arity: -3, Flags: CmdFlagWrite | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).ZRemHandler,
+			Group: GroupSortedSet, Since: "1.2.0", Complexity: "O(M*log(N)) with N being the number of elements in the sorted set and M the number of elements to be removed.",
+			Summary: "Removes one or more members from a sorted set. Deletes the sorted set if all members were removed.",
+		},
+		&CommandSpec{
+			Name: "zscore", Arity: 3, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).ZScoreHandler,
+			Group: GroupSortedSet, Since: "1.2.0", Complexity: "O(1)",
+			Summary: "Returns the score of a member in a sorted set.",
+		},
+		&CommandSpec{
+			Name: "zmscore", Arity: -3, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).ZMScoreHandler,
+			Group: GroupSortedSet, Since: "6.2.0", Complexity: "O(N) where N is the number of members being requested.",
+			Summary: "Returns the score of one or more members in a sorted set.",
+		},
+		&CommandSpec{
+			Name: "zcard", Arity: 2, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).ZCardHandler,
+			Group: GroupSortedSet, Since: "1.2.0", Complexity: "O(1)",
+			Summary: "Returns the number of members in a sorted set.",
+		},
+		&CommandSpec{
+			Name: "zrank", Arity: -3, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).ZRankHandler,
+			Group: GroupSortedSet, Since: "2.0.0", Complexity: "O(log(N))",
+			Summary: "Returns the index of a member in a sorted set ordered by ascending scores.",
+		},
+		&CommandSpec{
+			Name: "zrevrank", Arity: -3, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).ZRevRankHandler,
+			Group: GroupSortedSet, Since: "2.0.0", Complexity: "O(log(N))",
+			Summary: "Returns the index of a member in a sorted set ordered by descending scores.",
+		},
+		&CommandSpec{
+			Name: "zcount", Arity: 4, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).ZCountHandler,
+			Group: GroupSortedSet, Since: "2.0.0", Complexity: "O(log(N)) with N being the number of elements in the sorted set.",
+			Summary: "Returns the count of members in a sorted set that have scores within a range.",
+		},
+		&CommandSpec{
+			Name: "zrange", Arity: -4, Flags: CmdFlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).ZRangeHandler,
+			Group: GroupSortedSet, Since: "1.2.0", Complexity: "O(log(N)+M) with N being the number of elements in the sorted set and M the number of elements returned.",
+			Summary: "Returns members in a sorted set within a range of indexes.",
+		},
+		&CommandSpec{
+			Name: "zrangestore", Arity: -5, Flags: CmdFlagWrite | CmdFlagDenyOOM, FirstKey: 1, LastKey: 2, Step: 1, Handler: (*Commands).ZRangeStoreHandler,
+			Group: GroupSortedSet, Since: "6.2.0", Complexity: "O(log(N)+M) with N being the number of elements in the sorted set and M the number of elements stored into the destination key.",
+			Summary: "Stores a range of members from sorted set in a key.",
+			KeySpecs: []KeySpec{
+				{Flags: []string{"OW", "update"}, Index: 1, LastKey: 0, KeyStep: 1},
+				{Flags: []string{"RO", "access"}, Index: 2, LastKey: 0, KeyStep: 1},
+			},
+		},
+		&CommandSpec{
+			Name: "zpopmin", Arity: -2, Flags: CmdFlagWrite | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).ZPopMinHandler,
+			Group: GroupSortedSet, Since: "5.0.0", Complexity: "O(log(N)*M) with N being the number of elements in the sorted set, and M being the number of elements popped.",
+			Summary: "Returns the lowest-scoring members from a sorted set after removing them. Deletes the sorted set if the last member was popped.",
+		},
+		&CommandSpec{
+			Name: "zpopmax", Arity: -2, Flags: CmdFlagWrite | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).ZPopMaxHandler,
+			Group: GroupSortedSet, Since: "5.0.0", Complexity: "O(log(N)*M) with N being the number of elements in the sorted set, and M being the number of elements popped.",
+			Summary: "Returns the highest-scoring members from a sorted set after removing them. Deletes the sorted set if the last member was popped.",
+		},
+		&CommandSpec{
+			Name: "bzpopmin", Arity: -3, Flags: CmdFlagWrite | CmdFlagFast | CmdFlagBlocking, FirstKey: 1, LastKey: -2, Step: 1, Handler: (*Commands).BZPopMinHandler,
+			Group: GroupSortedSet, Since: "5.0.0", Complexity: "O(log(N)) with N being the number of elements in the sorted set.",
+			Summary: "Removes and returns the member with the lowest score from one or more sorted sets. Blocks until a member is available otherwise. Deletes the sorted set if the last element was popped.",
+		},
+		&CommandSpec{
+			Name: "bzpopmax", Arity: -3, Flags: CmdFlagWrite | CmdFlagFast | CmdFlagBlocking, FirstKey: 1, LastKey: -2, Step: 1, Handler: (*Commands).BZPopMaxHandler,
+			Group: GroupSortedSet, Since: "5.0.0", Complexity: "O(log(N)) with N being the number of elements in the sorted set.",
+			Summary: "Removes and returns the member with the highest score from one or more sorted sets. Blocks until a member is available otherwise. Deletes the sorted set if the last element was popped.",
+		},
+		&CommandSpec{
+			Name: "zmpop", Arity: -4, Flags: CmdFlagWrite, Handler: (*Commands).ZMPopHandler,
+			Group: GroupSortedSet, Since: "7.0.0", Complexity: "O(K) + O(M*log(N)) where K is the number of provided keys, N being the number of elements in the sorted set, and M being the number of elements popped.",
+			Summary: "Returns the highest- or lowest-scoring members from one or more sorted sets after removing them. Deletes the sorted set if the last member was popped.",
+			KeySpecs: []KeySpec{
+				{Flags: []string{"RW", "access", "delete"}, Index: 1, NumKeys: true, NumKeysIndex: 0, FirstKey: 1, KeyStep: 1},
+			},
+		},
+		&CommandSpec{
+			Name: "bzmpop", Arity: -5, Flags: CmdFlagWrite | CmdFlagBlocking, Handler: (*Commands).BZMPopHandler,
+			Group: GroupSortedSet, Since: "7.0.0", Complexity: "O(K) + O(M*log(N)) where K is the number of provided keys, N being the number of elements in the sorted set, and M being the number of elements popped.",
+			Summary: "Removes and returns a member by score from one or more sorted sets. Blocks until a member is available otherwise. Deletes the sorted set if the last element was popped.",
+			KeySpecs: []KeySpec{
+				{Flags: []string{"RW", "access", "delete"}, Index: 2, NumKeys: true, NumKeysIndex: 0, FirstKey: 1, KeyStep: 1},
+			},
+		},
+		&CommandSpec{
+			Name: "zunion", Arity: -3, Flags: CmdFlagReadOnly, Handler: (*Commands).ZUnionHandler,
+			Group: GroupSortedSet, Since: "6.2.0", Complexity: "O(N)+O(M*log(M)) with N being the sum of the sizes of the input sorted sets, and M being the number of elements in the resulting sorted set.",
+			Summary: "Returns the union of multiple sorted sets.",
+			KeySpecs: []KeySpec{
+				{Flags: []string{"RO", "access"}, Index: 1, NumKeys: true, NumKeysIndex: 0, FirstKey: 1, KeyStep: 1},
+			},
+		},
+		&CommandSpec{
+			Name: "zunionstore", Arity: -4, Flags: CmdFlagWrite | CmdFlagDenyOOM, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).ZUnionStoreHandler,
+			Group: GroupSortedSet, Since: "2.0.0", Complexity: "O(N)+O(M*log(M)) with N being the sum of the sizes of the input sorted sets, and M being the number of elements in the resulting sorted set.",
+			Summary: "Stores the union of multiple sorted sets in a key.",
+			KeySpecs: []KeySpec{
+				{Flags: []string{"OW", "update"}, Index: 1, LastKey: 0, KeyStep: 1},
+				{Flags: []string{"RO", "access"}, Index: 2, NumKeys: true, NumKeysIndex: 0, FirstKey: 1, KeyStep: 1},
+			},
+		},
+		&CommandSpec{
+			Name: "zinter", Arity: -3, Flags: CmdFlagReadOnly, Handler: (*Commands).ZInterHandler,
+			Group: GroupSortedSet, Since: "6.2.0", Complexity: "O(N*K)+O(M*log(M)) worst case with N being the smallest input sorted set, K being the number of input sorted sets and M being the number of elements in the resulting sorted set.",
+			Summary: "Returns the intersect of multiple sorted sets.",
+			KeySpecs: []KeySpec{
+				{Flags: []string{"RO", "access"}, Index: 1, NumKeys: true, NumKeysIndex: 0, FirstKey: 1, KeyStep: 1},
+			},
+		},
+		&CommandSpec{
+			Name: "zinterstore", Arity: -4, Flags: CmdFlagWrite | CmdFlagDenyOOM, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).ZInterStoreHandler,
+			Group: GroupSortedSet, Since: "2.0.0", Complexity: "O(N*K)+O(M*log(M)) worst case with N being the smallest input sorted set, K being the number of input sorted sets and M being the number of elements in the resulting sorted set.",
+			Summary: "Stores the intersect of multiple sorted sets in a key.",
+			KeySpecs: []KeySpec{
+				{Flags: []string{"OW", "update"}, Index: 1, LastKey: 0, KeyStep: 1},
+				{Flags: []string{"RO", "access"}, Index: 2, NumKeys: true, NumKeysIndex: 0, FirstKey: 1, KeyStep: 1},
+			},
+		},
+		&CommandSpec{
+			Name: "zdiff", Arity: -3, Flags: CmdFlagReadOnly, Handler: (*Commands).ZDiffHandler,
+			Group: GroupSortedSet, Since: "6.2.0", Complexity: "O(L + (N-K)log(N)) worst case where L is the total number of elements in all the sets, N is the size of the first set, and K is the size of the result set.",
+			Summary: "Returns the difference between multiple sorted sets.",
+			KeySpecs: []KeySpec{
+				{Flags: []string{"RO", "access"}, Index: 1, NumKeys: true, NumKeysIndex: 0, FirstKey: 1, KeyStep: 1},
+			},
+		},
+		&CommandSpec{
+			Name: "zdiffstore", Arity: -4, Flags: CmdFlagWrite | CmdFlagDenyOOM, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).ZDiffStoreHandler,
+			Group: GroupSortedSet, Since: "6.2.0", Complexity: "O(L + (N-K)log(N)) worst case where L is the total number of elements in all the sets, N is the size of the first set, and K is the size of the result set.",
+			Summary: "Stores the difference of multiple sorted sets in a key.",
+			KeySpecs: []KeySpec{
+				{Flags: []string{"OW", "update"}, Index: 1, LastKey: 0, KeyStep: 1},
+				{Flags: []string{"RO", "access"}, Index: 2, NumKeys: true, NumKeysIndex: 0, FirstKey: 1, KeyStep: 1},
+			},
+		},
+
+		// HyperLogLogs
+		&CommandSpec{
+			Name: "pfadd", Arity: -2, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).PFAddHandler,
+			Group: GroupHyperLogLog, Since: "2.8.9", Complexity: "O(1) to add every element.",
+			Summary: "Adds elements to a HyperLogLog key. Creates the key if it doesn't exist.",
+		},
+		&CommandSpec{
+			Name: "pfcount", Arity: -2, Flags: CmdFlagReadOnly, FirstKey: 1, LastKey: -1, Step: 1, Handler: (*Commands).PFCountHandler,
+			Group: GroupHyperLogLog, Since: "2.8.9", Complexity: "O(1) with a very small average constant time when called with a single key. O(N) with N being the number of keys, and much bigger constant times, when called with multiple keys.",
+			Summary: "Returns the approximated cardinality of the set(s) observed by the HyperLogLog key(s).",
+		},
+		&CommandSpec{
+			Name: "pfmerge", Arity: -2, Flags: CmdFlagWrite | CmdFlagDenyOOM, FirstKey: 1, LastKey: -1, Step: 1, Handler: (*Commands).PFMergeHandler,
+			Group: GroupHyperLogLog, Since: "2.8.9", Complexity: "O(N) to merge N HyperLogLogs, but with high constant times.",
+			Summary: "Merges one or more HyperLogLog values into a single key.",
+			KeySpecs: []KeySpec{
+				{Flags: []string{"RW", "access", "insert"}, Index: 1, LastKey: 0, KeyStep: 1},
+				{Flags: []string{"RO", "access"}, Index: 2, LastKey: -1, KeyStep: 1},
+			},
+		},
+
+		// Streams
+		&CommandSpec{
+			Name: "type", Arity: 2, Flags: CmdFlagReadOnly | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).TypeHandler,
+			Group: GroupGeneric, Since: "1.0.0", Complexity: "O(1)",
+			Summary: "Determines the type of value stored at a key.",
+		},
+		&CommandSpec{
+			Name: "xadd", Arity: -5, Flags: CmdFlagWrite | CmdFlagDenyOOM | CmdFlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).XAddHandler,
+			Group: GroupStream, Since: "5.0.0", Complexity: "O(1) when adding a new entry",
+			Summary: "Appends a new message to a stream. Creates the key if it doesn't exist.",
+			Tips: []string{"nondeterministic_output"},
+		},
+		&CommandSpec{
+			Name: "xrange", Arity: -4, Flags: CmdFlagReadOnly, FirstKey: 1, LastKey: 1, Step: 1, Handler: (*Commands).XRangeHandler,
+			Group: GroupStream, Since: "5.0.0", Complexity: "O(N) with N being the number of elements being returned.",
+			Summary: "Returns the messages from a stream within a range of IDs.",
+		},
+		&CommandSpec{
+			Name: "xread", Arity: -4, Flags: CmdFlagReadOnly | CmdFlagBlocking, Handler: (*Commands).XReadHandler,
+			Group: GroupStream, Since: "5.0.0", Complexity: "O(N) with N being the number of elements being returned.",
+			Summary: "Returns messages from multiple streams with IDs greater than the ones requested. Blocks until a message is available otherwise.",
+			KeySpecs: []KeySpec{
+				{Flags: []string{"RO", "access"}, Index: 1, Keyword: "STREAMS", LastKey: -1, KeyStep: 1, Limit: 2},
+			},
+		},
+	)
+}
+
+func registerCommands(specs ...*CommandSpec) {
+	for _, spec := range specs {
+		spec.init(nil)
+		commandTable[spec.Name] = spec
+	}
+}
+
+// init fills in the derived fields of a spec and its subcommands
+func (spec *CommandSpec) init(parent *CommandSpec) {
+	spec.parent = parent
+	spec.FullName = spec.Name
+	if parent != nil {
+		spec.FullName = parent.Name + "|" + spec.Name
+	}
+
+	if len(spec.KeySpecs) == 0 && spec.FirstKey > 0 {
+		lastKey := spec.LastKey
+		if lastKey >= 0 {
+			lastKey -= spec.FirstKey
+		}
+
+		flags := []string{"RO", "access"}
+		if spec.Flags.Has(CmdFlagWrite) {
+			flags = []string{"RW", "update"}
+		}
+
+		spec.KeySpecs = []KeySpec{
+			{Flags: flags, Index: spec.FirstKey, LastKey: lastKey, KeyStep: spec.Step},
+		}
+	}
+
+	for _, keySpec := range spec.KeySpecs {
+		if keySpec.Keyword != "" || keySpec.NumKeys || keySpec.Limit > 1 {
+			spec.Flags |= CmdFlagMovableKeys
+		}
+	}
+
+	for _, subcommand := range spec.Subcommands {
+		subcommand.init(spec)
+	}
+}
+
+// LookupCommand finds the spec of a command by its case insensitive name
+func LookupCommand(name []byte) (*CommandSpec, bool) {
+	spec, exists := commandTable[strings.ToLower(string(name))]
+	return spec, exists
+}
+
+// LookupSubcommand finds the spec of a subcommand, such as INFO in COMMAND INFO
+func (spec *CommandSpec) LookupSubcommand(name []byte) (*CommandSpec, bool) {
+	lowerName := strings.ToLower(string(name))
+	for _, subcommand := range spec.Subcommands {
+		if subcommand.Name == lowerName {
+			return subcommand, true
+		}
+	}
+	return nil, false
+}
+
+// LookupCommandByFullName finds a command or a subcommand by a name such as config|get
+func LookupCommandByFullName(fullName string) (*CommandSpec, bool) {
+	names := strings.SplitN(fullName, "|", 2)
+
+	spec, exists := LookupCommand([]byte(names[0]))
+	if !exists || len(names) == 1 {
+		return spec, exists
+	}
+
+	return spec.LookupSubcommand([]byte(names[1]))
+}
+
+// CommandNames returns the names of every registered command in sorted order
+func CommandNames() []string {
+	names := make([]string, 0, len(commandTable))
+	for name := range commandTable {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (f CommandFlags) Has(flag CommandFlags) bool {
+	return f & flag != 0
+}
+
+// Names returns the COMMAND names of the flags that are set
+func (f CommandFlags) Names() []string {
+	names := make([]string, 0)
+	for i, name := range commandFlagNames {
+		if f.Has(1 << i) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// ACLCategories returns the ACL categories of the command: those redis
+// derives from its flags, and the one of the data type its group is about
+func (spec *CommandSpec) ACLCategories() []string {
+	categories := make([]string, 0)
+
+	if spec.Flags.Has(CmdFlagWrite) {
+		categories = append(categories, "@write")
+	}
+	if spec.Flags.Has(CmdFlagReadOnly) {
+		categories = append(categories, "@read")
+	}
+	if spec.Flags.Has(CmdFlagAdmin) {
+		categories = append(categories, "@admin", "@dangerous")
+	}
+	if spec.Flags.Has(CmdFlagPubSub) {
+		categories = append(categories, "@pubsub")
+	}
+	if spec.Flags.Has(CmdFlagFast) {
+		categories = append(categories, "@fast")
+	} else {
+		categories = append(categories, "@slow")
+	}
+	if spec.Flags.Has(CmdFlagBlocking) {
+		categories = append(categories, "@blocking")
+	}
+
+	switch spec.Group {
+		case GroupGeneric:
+			categories = append(categories, "@keyspace")
+		case GroupSortedSet:
+			categories = append(categories, "@sortedset")
+		case GroupString, GroupList, GroupHash, GroupSet, GroupHyperLogLog, GroupStream, GroupConnection:
+			categories = append(categories, "@" + spec.Group)
+	}
+
+	return categories
+}
+
+// CheckArity reports whether argc arguments, including the command name, are valid
+func (spec *CommandSpec) CheckArity(argc int) bool {
+	if spec.Arity >= 0 {
+		return argc == spec.Arity
+	}
+	return argc >= -spec.Arity
+}
+
+// KeyPositions returns the indexes of the keys in args according to the key
+// specs of the command
+func (spec *CommandSpec) KeyPositions(args [][]byte) []int {
+	positions := make([]int, 0)
+	for i := range spec.KeySpecs {
+		for _, position := range spec.KeySpecs[i].positions(args) {
+			positions = append(positions, position)
+		}
+	}
+	return positions
+}
+
+// KeyFlags returns, for every key position, the flags of the key spec it came from
+func (spec *CommandSpec) KeyFlags(args [][]byte) (positions []int, flags [][]string) {
+	for i := range spec.KeySpecs {
+		for _, position := range spec.KeySpecs[i].positions(args) {
+			positions = append(positions, position)
+			flags = append(flags, spec.KeySpecs[i].Flags)
+		}
+	}
+	return positions, flags
+}
+
+func (ks *KeySpec) positions(args [][]byte) []int {
+	positions := make([]int, 0)
+	argc := len(args)
+
+	// begin search
+	first := ks.Index
+	if ks.Keyword != "" {
+		first = -1
+
+		start, end, incr := ks.Index, argc, 1
+		if ks.Index < 0 {
+			start, end, incr = argc + ks.Index, 0, -1
+		}
+		for i := start; i != end && i >= 0 && i < argc; i += incr {
+			if strings.EqualFold(string(args[i]), ks.Keyword) {
+				first = i + 1
+				break
+			}
+		}
+	}
+	if first <= 0 || first >= argc {
+		return positions
+	}
+
+	// find keys
+	step := ks.KeyStep
+	if step <= 0 {
+		step = 1
+	}
+
+	var last int
+	if ks.NumKeys {
+		if first + ks.NumKeysIndex >= argc {
+			return positions
+		}
+		numKeys, err := parseLength(string(args[first + ks.NumKeysIndex]))
+		if err != nil || numKeys <= 0 {
+			return positions
+		}
+		first += ks.FirstKey
+		last = first + (numKeys - 1) * step
+	} else if ks.LastKey >= 0 {
+		last = first + ks.LastKey
+	} else if ks.Limit <= 1 {
+		last = argc + ks.LastKey
+	} else {
+		last = first + ((argc - first) / ks.Limit + ks.LastKey)
+	}
+
+	for i := first; i <= last && i < argc; i += step {
+		positions = append(positions, i)
+	}
+	return positions
+}
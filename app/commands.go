@@ -3,7 +3,8 @@ package main
 import (
 	"errors"
 	"fmt"
-	"reflect"
+	"io"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -14,12 +15,6 @@ import (
 type Command string
 type KeyType string
 
-var numReplicasAck int
-var numReplicasWait int
-var replicasWaitChan = make(chan bool, 1)
-
-var xreadBlockChan = make(chan string)
-
 
 const (
 	// Basic Redis
@@ -28,6 +23,29 @@ const (
 	GET Command = "GET"
 	SET Command = "SET"
 	PX Command = "PX"
+	EX Command = "EX"
+	PXAT Command = "PXAT"
+	EXAT Command = "EXAT"
+	NX Command = "NX"
+	XX Command = "XX"
+	KEEPTTL Command = "KEEPTTL"
+
+	// Expiration
+	PEXPIREAT Command = "PEXPIREAT"
+	GT Command = "GT"
+	LT Command = "LT"
+	DEL Command = "DEL"
+
+	// Strings
+	GETEX Command = "GETEX"
+	PERSIST Command = "PERSIST"
+	LEN Command = "LEN"
+	IDX Command = "IDX"
+	MINMATCHLEN Command = "MINMATCHLEN"
+	WITHMATCHLEN Command = "WITHMATCHLEN"
+	HELLO Command = "HELLO"
+	AUTH Command = "AUTH"
+	SETNAME Command = "SETNAME"
 	
 	// Replication
 	INFO Command = "INFO"
@@ -42,246 +60,445 @@ const (
 	CONFIG Command = "CONFIG"
 	DIR Command = "DIR"
 	DB_FILE_NAME Command = "DBFILENAME"
+	DATABASES Command = "DATABASES"
+	HZ Command = "HZ"
+	ACTIVE_EXPIRE_EFFORT Command = "ACTIVE-EXPIRE-EFFORT"
 	KEYS Command = "KEYS"
 
+	// Keyspace
+	MATCH Command = "MATCH"
+	COUNT Command = "COUNT"
+
+	// Lists
+	LEFT Command = "LEFT"
+	RIGHT Command = "RIGHT"
+	BEFORE Command = "BEFORE"
+	AFTER Command = "AFTER"
+	RANK Command = "RANK"
+	MAXLEN Command = "MAXLEN"
+
+	// Hashes
+	HSET Command = "HSET"
+	HDEL Command = "HDEL"
+	HPEXPIREAT Command = "HPEXPIREAT"
+	FIELDS Command = "FIELDS"
+	WITHVALUES Command = "WITHVALUES"
+	HASH_MAX_LISTPACK_ENTRIES Command = "HASH-MAX-LISTPACK-ENTRIES"
+	HASH_MAX_LISTPACK_VALUE Command = "HASH-MAX-LISTPACK-VALUE"
+
+	// Sets
+	SREM Command = "SREM"
+	LIMIT Command = "LIMIT"
+	SET_MAX_INTSET_ENTRIES Command = "SET-MAX-INTSET-ENTRIES"
+
+	// Sorted sets
+	CH Command = "CH"
+	INCR Command = "INCR"
+	BYSCORE Command = "BYSCORE"
+	BYLEX Command = "BYLEX"
+	REV Command = "REV"
+	WITHSCORE Command = "WITHSCORE"
+	WITHSCORES Command = "WITHSCORES"
+	WEIGHTS Command = "WEIGHTS"
+	AGGREGATE Command = "AGGREGATE"
+	SUM Command = "SUM"
+	MIN Command = "MIN"
+	MAX Command = "MAX"
+	ZPOPMIN Command = "ZPOPMIN"
+	ZPOPMAX Command = "ZPOPMAX"
+
+	// HyperLogLogs
+	HLL_SPARSE_MAX_BYTES Command = "HLL-SPARSE-MAX-BYTES"
+
+	// Databases
+	SELECT Command = "SELECT"
+	DB Command = "DB"
+	REPLACE Command = "REPLACE"
+	ASYNC Command = "ASYNC"
+	SYNC Command = "SYNC"
+
 	// Streams
 	TYPE Command = "TYPE"
 	XADD Command = "XADD"
 	XRANGE Command = "XRANGE"
 	XREAD Command = "XREAD"
 	BLOCK Command = "BLOCK"
+	STREAMS Command = "STREAMS"
 
 	// info response constants
 	InfoRole = "role"
 	InfoMasterReplicationID = "master_replid"
 	InfoMasterReplicationOffset = "master_repl_offset"
+
+	// hello response constants
+	ServerName = "redis"
+	ServerVersion = "7.2.0"
+	DefaultUser = "default"
 )
 
 type Commands struct {
 	ServerOpts 	ServerOpts
 	Store 		store.Store
-	// StreamStore store.StreamStore
+
+	executor 	*Executor
+
+	// Replicas maps the connections of replicas to the offset they acknowledged
+	Replicas 	map[*Client]int64
+
+	// clients blocked on keys, in the order they blocked, and the keys
+	// written to by the current command
+	blockingKeys 	map[blockingKey][]*Client
+	readyKeys 		[]blockingKey
+	// clients blocked in WAIT
+	waitingClients 	[]*Client
+
+	// replicationDB is the database selected on the replication stream, or -1
+	// when the next write must be preceded by a SELECT
+	replicationDB 	int
+
+	// expireCycleDB is the database the next active expiration cycle starts at
+	expireCycleDB 	int
+
+	// lazyfree releases the values removed by UNLINK
+	lazyfree 		*lazyfree
 }
 
-func NewCommandsHandler(serverOpts ServerOpts, storeOpts store.StoreOpts) Commands{
-	return Commands{
+// NewCommandsHandler() Creates a new Commands and starts its executor
+func NewCommandsHandler(serverOpts ServerOpts, storeOpts store.StoreOpts) *Commands {
+	if serverOpts.Hz <= 0 {
+		serverOpts.Hz = DefaultHz
+	}
+	serverOpts.Hz = min(serverOpts.Hz, MaxHz)
+	if serverOpts.ActiveExpireEffort <= 0 {
+		serverOpts.ActiveExpireEffort = DefaultActiveExpireEffort
+	}
+	serverOpts.ActiveExpireEffort = min(serverOpts.ActiveExpireEffort, MaxActiveExpireEffort)
+
+	ch := &Commands{
 		ServerOpts: serverOpts,
 		Store: store.NewStore(storeOpts),
+		executor: NewExecutor(),
+		Replicas: make(map[*Client]int64),
+		blockingKeys: make(map[blockingKey][]*Client),
+		replicationDB: -1,
+		lazyfree: newLazyfree(),
 	}
+
+	go ch.executor.Run()
+	go ch.runCron()
+	return ch
 }
 
-func IsWriteCommand(req string) bool {
-	parsedReq, err := ParseRequest(req)
-	if err != nil {
-		fmt.Printf("error parsing request: %s", err.Error())
+func IsWriteCommand(args [][]byte) bool {
+	if len(args) == 0 {
 		return false
 	}
 
-	// only taking the first command
-	requestLines := SplitRequests(parsedReq[0])
-	if len(requestLines) < 3 {
-		return false
-	}
-	return Command(strings.ToUpper(requestLines[2])) == SET
+	spec, exists := LookupCommand(args[0])
+	return exists && spec.Flags.Has(CmdFlagWrite)
 }
 
-func ContainsPsyncCommand(fullRequest string) bool {
-	reqs, err := ParseRequest(fullRequest)
-	if err != nil {
+func IsPsyncCommand(args [][]byte) bool {
+	if len(args) == 0 {
 		return false
 	}
-
-	for _, req := range reqs {
-		requestLines := SplitRequests(req)
-		if len(requestLines) < 3 {
-			continue
-		}
-		if Command(strings.ToUpper(requestLines[2])) == PSYNC {
-			return true
-		}
-	}
-	return false
+	return Command(strings.ToUpper(string(args[0]))) == PSYNC
 }
 
-func CompletePartialRequest(req string) string {
-	if req[0:1] != ArraysFirstChar {
-		req = ArraysFirstChar + req[0:]
-	}
-	return req
+// parsing redis-like input protocols on behalf of a new client
+func (ch *Commands) ParseCommands(fullRequest string) ([]string, error) {
+	return ch.ParseClientCommands(NewClient(nil), fullRequest)
 }
 
-// parsing redis-like input protocols
-func (ch *Commands) ParseCommands(fullRequest string) ([]string, error) {			
-	reqs, err := ParseRequest(fullRequest)
-	if err != nil {
-		return nil, fmt.Errorf("error while parsing commands: %s", err.Error())
-	}
+// ParseClientCommands runs every command in fullRequest for client c, so state
+// negotiated by earlier commands (such as HELLO) carries over to later ones.
+// Commands run on the executor, one at a time, and their replies are returned.
+func (ch *Commands) ParseClientCommands(c *Client, fullRequest string) ([]string, error) {
+	reader := NewRespReader(strings.NewReader(fullRequest))
 
 	resList := make([]string, 0)
-	for _, req := range reqs {
-		res, err := ch.CommandsHandler(SplitRequests(req))
+	for {
+		args, err := reader.ReadCommand()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
 			return nil, fmt.Errorf("error while parsing commands: %s", err.Error())
 		}
+		if len(args) == 0 {
+			continue
+		}
 
-		resList = append(resList, res...)
+		ch.Execute(c, args)
+		resList = append(resList, c.takeReplies()...)
 	}
 	return resList, nil
 }
 
-func (ch *Commands) CommandsHandler(requestLines []string) (resp []string, err error) {
-	// exception command cases
-	if len(requestLines) == 1 {
-		if strings.Contains(requestLines[0], string(FULLRESYNC)) {
-			return ch.FullResyncHandler()
-		} else {
-			return NullResponse(), fmt.Errorf("command length should be greater than 1. request received: %s", requestLines)
-		}
+// CommandsHandler looks the command up in the command table, validates it
+// against its spec and runs its handler. Errors are replied to the client as
+// RESP errors. Successful writes on a master are propagated to the replicas.
+// It must only be called from the executor.
+func (ch *Commands) CommandsHandler(c *Client, args [][]byte) []string {
+	resp, err := ch.runCommand(c, args)
+	if err != nil {
+		fmt.Printf("error handling command %q: %s\n", args[0], err.Error())
+		resp = ErrorResponse(err)
 	}
 
-	if len(requestLines) < 3 {
-		if strings.Contains(requestLines[1], "REDIS") {
-			return ch.RdbFileHandler()
-		} else {
-			return NullResponse(), fmt.Errorf("command length should be greater than 2. request received: %s", requestLines)
+	if c.IsMaster {
+		ch.ServerOpts.ReplicaOffset += int64(len(EncodeCommand(args)))
+		fmt.Printf("updating replicas offset to: %v\n", ch.ServerOpts.ReplicaOffset)
+
+		// replicas should not respond to non-REPLCONF commands
+		if Command(strings.ToUpper(string(args[0]))) != REPLCONF {
+			return []string{}
 		}
 	}
 
-	command := Command(strings.ToUpper(requestLines[2]))
-
-	switch command {
-		case PING:
-			resp, err = ch.PingHandler()
+	return resp
+}
 
-		case ECHO:
-			resp, err = ch.EchoHandler(requestLines)
+func (ch *Commands) runCommand(c *Client, args [][]byte) ([]string, error) {
+	spec, exists := LookupCommand(args[0])
+	if !exists {
+		return nil, UnknownCommandError(args)
+	}
 
-		case SET:
-			resp, err = ch.SetHandler(requestLines)
+	if !spec.CheckArity(len(args)) {
+		return nil, WrongArityError(spec)
+	}
 
-		case GET:
-			resp, err = ch.GetHandler(requestLines)
+	// container commands such as CONFIG dispatch on their first argument
+	if len(spec.Subcommands) > 0 && (len(args) > 1 || spec.Handler == nil) {
+		subcommand, exists := spec.LookupSubcommand(args[1])
+		if !exists {
+			return nil, NewCommandError("unknown subcommand '%s'. Try %s HELP.", truncateArg(args[1]), strings.ToUpper(spec.Name))
+		}
+		if !subcommand.CheckArity(len(args)) {
+			return nil, WrongArityError(subcommand)
+		}
+		spec = subcommand
+	}
 
-		case INFO:
-			resp, err = ch.InfoHandler(requestLines)
+	// replicas only accept writes coming from their master
+	if ch.ServerOpts.Role == RoleSlave && !c.IsMaster && spec.Flags.Has(CmdFlagWrite) {
+		return ReadOnlyReplicaResponse(), nil
+	}
 
-		case REPLCONF:
-			resp, err = ch.ReplConfHandler(requestLines)
+	c.Argv = args
+	c.noPropagate = false
+	resp, err := spec.Handler(ch, c, args)
+	if err != nil {
+		return nil, err
+	}
 
-		case PSYNC:
-			resp, err = ch.PsyncHandler()
+	if spec.Flags.Has(CmdFlagWrite) && !c.noPropagate {
+		for _, position := range spec.KeyPositions(args) {
+			ch.signalKeyAsReady(c.DB, string(args[position]))
+		}
 
-		case WAIT:
-			resp, err = ch.WaitHandler(requestLines)
+		if ch.ServerOpts.Role == RoleMaster {
+			ch.propagate(c.DB, c.Argv)
+			c.WriteOffset = ch.ServerOpts.MasterReplicationOffset
+		}
+	}
 
-		case FULLRESYNC:
-			resp, err = ch.FullResyncHandler()
+	return resp, nil
+}
 
-		case CONFIG:
-			resp, err = ch.ConfigHandler(requestLines)
+// Command Handlers
+func (ch *Commands) PingHandler(c *Client, args [][]byte) ([]string, error) {
+	if len(args) > 1 {
+		return []string{ResponseBuilder(BulkStringsRespType, string(args[1]))}, nil
+	}
 
-		case KEYS:
-			resp, err = ch.KeysHandler(requestLines)
+	return []string{ResponseBuilder(SimpleStringsRespType, "PONG")}, nil
+}
 
-		case TYPE:
-			resp, err = ch.TypeHandler(requestLines)
+func (ch *Commands) EchoHandler(c *Client, args [][]byte) ([]string, error) {
+	return []string{ResponseBuilder(BulkStringsRespType, string(args[1]))}, nil
+}
 
-		case XADD:
-			resp, err = ch.XAddHandler(requestLines)
+// HelloHandler switches the client to the requested protocol version and
+// replies with the server properties. Usage: HELLO [protover [AUTH username password] [SETNAME clientname]]
+func (ch *Commands) HelloHandler(c *Client, args [][]byte) ([]string, error) {
+	proto := c.Protocol
 
-		case XRANGE:
-			resp, err = ch.XRangeHandler(requestLines)
+	if len(args) > 1 {
+		requested, err := strconv.Atoi(string(args[1]))
+		if err != nil {
+			return []string{ResponseBuilder(ErrorsRespType, "Protocol version is not an integer or out of range")}, nil
+		}
+		if requested != RESP2 && requested != RESP3 {
+			return []string{fmt.Sprintf("%sNOPROTO unsupported protocol version%s", ErrorsFirstChar, CLRF)}, nil
+		}
+		proto = requested
+	}
 
-		case XREAD:
-			resp, err = ch.XReadHandler(requestLines)
+	name := c.Name
+	for i := 2; i < len(args); i++ {
+		option := Command(strings.ToUpper(string(args[i])))
+		switch {
+			case option == AUTH && i + 2 < len(args):
+				// only the default user exists, and it has no password
+				if string(args[i + 1]) != DefaultUser {
+					return []string{fmt.Sprintf("%sWRONGPASS invalid username-password pair or user is disabled.%s", ErrorsFirstChar, CLRF)}, nil
+				}
+				i += 2
 
+			case option == SETNAME && i + 1 < len(args):
+				name = string(args[i + 1])
+				if strings.ContainsAny(name, " \n") {
+					return []string{ResponseBuilder(ErrorsRespType, "Client names cannot contain spaces, newlines or special characters.")}, nil
+				}
+				i++
 
-		default:
-			return NullResponse(), fmt.Errorf("invalid command received: %s", command)
+			default:
+				return []string{ResponseBuilder(ErrorsRespType, fmt.Sprintf("Syntax error in HELLO option '%s'", args[i]))}, nil
+		}
 	}
 
-	if err != nil {
-		return NullResponse(), fmt.Errorf("error receive handling command: %s", err.Error())
-	}
+	c.Protocol = proto
+	c.Name = name
 
+	role := string(ch.ServerOpts.Role)
 	if ch.ServerOpts.Role == RoleSlave {
-		ch.ServerOpts.ReplicaOffset += int64(len(CombineRequests(requestLines, true)))
-		fmt.Printf("updating replicas offset to: %v\n", ch.ServerOpts.ReplicaOffset)
+		role = "replica"
 	}
 
-	return resp, err
+	resp := MapHeader(proto, 7)
+	resp += ResponseBuilder(BulkStringsRespType, "server") + ResponseBuilder(BulkStringsRespType, ServerName)
+	resp += ResponseBuilder(BulkStringsRespType, "version") + ResponseBuilder(BulkStringsRespType, ServerVersion)
+	resp += ResponseBuilder(BulkStringsRespType, "proto") + ResponseBuilder(IntegersRespType, strconv.Itoa(proto))
+	resp += ResponseBuilder(BulkStringsRespType, "id") + ResponseBuilder(IntegersRespType, strconv.FormatInt(c.ID, 10))
+	resp += ResponseBuilder(BulkStringsRespType, "mode") + ResponseBuilder(BulkStringsRespType, "standalone")
+	resp += ResponseBuilder(BulkStringsRespType, "role") + ResponseBuilder(BulkStringsRespType, role)
+	resp += ResponseBuilder(BulkStringsRespType, "modules") + "*0\r\n"
+
+	return []string{resp}, nil
 }
 
-// Command Handlers
-func (ch *Commands) PingHandler() ([]string, error) {
-	// replicas should not respond to non-REPLCONF commands
-	if ch.ServerOpts.Role == RoleSlave {
-		return []string{}, nil
-	}
+// SetHandler stores a string value, optionally only when the key is missing
+// (NX) or present (XX), with an expiration and returning the previous value.
+// Options may come in any order.
+// Usage: SET key value [NX | XX] [GET] [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL]
+func (ch *Commands) SetHandler(c *Client, args [][]byte) ([]string, error) {
+	opts := store.SetOptions{Expiration: -1}
 
-	return []string{ResponseBuilder(SimpleStringsRespType, "PONG")}, nil
-}
+	// the position of the expiration option, rewritten to PXAT for replicas
+	expireAt := -1
+	expireUnit := Command("")
 
-func (ch *Commands) EchoHandler(requestLines []string) ([]string, error) {
-	if len(requestLines) < 5 {
-		return nil, fmt.Errorf("invalid command received. ECHO should have one arguments: %s", requestLines)
-	}
+	for i := 3; i < len(args); i++ {
+		option := Command(strings.ToUpper(string(args[i])))
+		switch {
+			case option == NX && !opts.XX:
+				opts.NX = true
 
-	return []string{ResponseBuilder(BulkStringsRespType, requestLines[4])}, nil
-}
+			case option == XX && !opts.NX:
+				opts.XX = true
+
+			case option == GET:
+				opts.Get = true
+
+			case option == KEEPTTL && expireAt < 0:
+				opts.KeepTTL = true
 
-func (ch *Commands) SetHandler(requestLines []string) ([]string, error) {
-	if len(requestLines) < 7 {
-		return nil, fmt.Errorf("invalid command received. SET should have more arguments: %s", requestLines)
+			case (option == EX || option == PX || option == EXAT || option == PXAT) && !opts.KeepTTL && expireAt < 0 && i + 1 < len(args):
+				expireAt, expireUnit = i, option
+				i++
+
+			default:
+				return nil, ErrSyntax
+		}
 	}
 
-	var expiration int64 = -1
-	if len(requestLines) >= 11 {
-		command := Command(strings.ToUpper(requestLines[8]))
-		if command == PX {
-			convertedExpiration, err := strconv.ParseInt(requestLines[10], 10, 64)
-			if err != nil {
-				return nil, fmt.Errorf("error while converting expiration time string arg to int64: %s", err.Error())
-			}
-			expiration = convertedExpiration
+	if expireAt > 0 {
+		expiration, err := parseExpireTime(args[expireAt + 1], expireUnit, "set")
+		if err != nil {
+			return nil, err
 		}
+		opts.Expiration = expiration
 	}
 
-	if err := ch.Store.KVStore.Set(requestLines[4], requestLines[6], expiration); err != nil {
+	old, oldExists, written, err := ch.db(c).KVStore.SetWithOptions(string(args[1]), args[2], opts)
+	if err == store.ErrWrongType {
+		return nil, ErrWrongType
+	}
+	if err != nil {
 		return nil, fmt.Errorf("error while setting in store: %s", err.Error())
 	}
 
-	if ch.ServerOpts.Role == RoleSlave {
-		return []string{}, nil
+	if !written {
+		c.noPropagate = true
+	} else if expireAt > 0 && expireUnit != PXAT {
+		// replicas must expire the key at the same time as the master
+		c.RewriteArg(expireAt, []byte(PXAT))
+		c.RewriteArg(expireAt + 1, []byte(strconv.FormatInt(opts.Expiration, 10)))
 	}
 
-	// replicas should not respond to non-REPLCONF commands
-	if ch.ServerOpts.Role == RoleSlave {
-		return []string{}, nil
+	switch {
+		case opts.Get && oldExists:
+			return []string{ResponseBuilder(BulkStringsRespType, string(old))}, nil
+		case opts.Get || !written:
+			return NullResponse(c.Protocol), nil
 	}
-
-	go ch.SendToReplicas(CombineRequests(requestLines, true), nil)
-
 	return OKResponse(), nil
 }
 
-func (ch *Commands) GetHandler(requestLines []string) ([]string, error) {
-	if len(requestLines) < 5 {
-		return nil, fmt.Errorf("invalid command received. GET should have more arguments: %s", requestLines)
+// parseExpireTime converts an EX, PX, EXAT or PXAT argument of command to an
+// absolute unix time in milliseconds. It must be positive and not overflow.
+func parseExpireTime(arg []byte, unit Command, command string) (int64, error) {
+	value, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, ErrNotInteger
+	}
+
+	invalid := NewCommandError("invalid expire time in '%s' command", command)
+	if value <= 0 {
+		return 0, invalid
+	}
+
+	if unit == EX || unit == EXAT {
+		if value > math.MaxInt64 / 1000 {
+			return 0, invalid
+		}
+		value *= 1000
+	}
+
+	if unit == EX || unit == PX {
+		now := time.Now().UnixMilli()
+		if value > math.MaxInt64 - now {
+			return 0, invalid
+		}
+		value += now
 	}
+	return value, nil
+}
 
-	val, err := ch.Store.KVStore.Get(requestLines[4]);
+func (ch *Commands) GetHandler(c *Client, args [][]byte) ([]string, error) {
+	val, exists, err := ch.db(c).KVStore.GetString(string(args[1]))
 	if err != nil {
-		return nil, fmt.Errorf("error while getting from store with key: %s %s", requestLines[4], err.Error())
+		return nil, storeError(err)
 	}
-	if val == "" {
-		return NullResponse(), nil
+	if !exists {
+		return NullResponse(c.Protocol), nil
 	}
 
-	return []string{ResponseBuilder(BulkStringsRespType, val)}, nil
+	return []string{ResponseBuilder(BulkStringsRespType, string(val))}, nil
 }
 
-func (ch *Commands) InfoHandler(requestLines []string) ([]string, error) {
+func (ch *Commands) InfoHandler(c *Client, args [][]byte) ([]string, error) {
+	if c.Protocol == RESP3 {
+		return []string{MapResponse(
+			c.Protocol,
+			InfoRole, string(ch.ServerOpts.Role),
+			InfoMasterReplicationID, ch.ServerOpts.MasterReplicationID,
+			InfoMasterReplicationOffset, strconv.FormatInt(ch.ServerOpts.MasterReplicationOffset, 10),
+		)}, nil
+	}
+
 	return []string{ResponseBuilder(
 		BulkStringsRespType,
 		fmt.Sprintf("%s:%s", InfoRole, ch.ServerOpts.Role), 
@@ -290,19 +507,19 @@ func (ch *Commands) InfoHandler(requestLines []string) ([]string, error) {
 	)}, nil
 }
 
-func (ch *Commands) ReplConfHandler(requestLines []string) ([]string, error) {
-	if len(requestLines) < 7 {
-		return nil, fmt.Errorf("invalid command received. REPLCONF should have more arguments: %s", requestLines)
+func (ch *Commands) ReplConfHandler(c *Client, args [][]byte) ([]string, error) {
+	if len(args) < 3 || len(args) % 2 == 0 {
+		return nil, ErrSyntax
 	}
 
-	switch Command(requestLines[4]) {
+	switch Command(strings.ToUpper(string(args[1]))) {
 		case GETACK:
 			if ch.ServerOpts.Role == RoleSlave {
-				return []string{
-					fmt.Sprintf("*3\r\n$8\r\nREPLCONF\r\n$3\r\nACK\r\n$%v\r\n%s\r\n", 
-						len(strconv.Itoa(int(ch.ServerOpts.ReplicaOffset))), 
-						strconv.Itoa(int(ch.ServerOpts.ReplicaOffset))),
-				}, nil
+				return []string{EncodeCommand([][]byte{
+					[]byte(REPLCONF),
+					[]byte(ACK),
+					[]byte(strconv.FormatInt(ch.ServerOpts.ReplicaOffset, 10)),
+				})}, nil
 			}
 
 		case ACK:
@@ -310,12 +527,17 @@ func (ch *Commands) ReplConfHandler(requestLines []string) ([]string, error) {
 				return []string{}, nil
 			}
 
-			numReplicasAck ++
-			fmt.Printf("ACK!!! numACk: %v, numWait: %v\n", numReplicasAck, numReplicasWait)
+			offset, err := strconv.ParseInt(string(args[2]), 10, 64)
+			if err != nil {
+				return nil, ErrNotInteger
+			}
 
-			if numReplicasAck >= numReplicasWait {
-				replicasWaitChan <- true
+			if _, exists := ch.Replicas[c]; exists {
+				ch.Replicas[c] = offset
+				fmt.Printf("replica %d acknowledged offset %d\n", c.ID, offset)
+				ch.handleWaitingClients()
 			}
+
 		default:
 			return OKResponse(), nil
 
@@ -323,186 +545,165 @@ func (ch *Commands) ReplConfHandler(requestLines []string) ([]string, error) {
 	return []string{}, nil
 }
 
-func (ch *Commands) PsyncHandler() ([]string, error) {
-	rdb, err := ch.Store.KVStore.ToRDBStore()
+// PsyncHandler starts a full resynchronization: the replica gets a snapshot
+// and, from then on, every write propagated on its connection
+func (ch *Commands) PsyncHandler(c *Client, args [][]byte) ([]string, error) {
+	rdb, err := ch.Store.ToRDBStore()
 	if err != nil {
 		return nil, fmt.Errorf("error getting raw rdb store: %s", err.Error())
 	}
 
+	ch.Replicas[c] = 0
+	// the replica starts from the snapshot with no database selected
+	ch.replicationDB = -1
+
 	return []string{
-		fmt.Sprintf("+FULLRESYNC %s 0\r\n", ch.ServerOpts.MasterReplicationID),
+		fmt.Sprintf("+FULLRESYNC %s %d\r\n", ch.ServerOpts.MasterReplicationID, ch.ServerOpts.MasterReplicationOffset),
 		fmt.Sprintf("$%v\r\n%s", len(rdb), rdb),
 	}, nil
 }
 
-func (ch *Commands) WaitHandler(requestLines []string) (res []string, err error) {
-	if len(requestLines) < 7 {
-		return nil, fmt.Errorf("invalid command received. REPLCONF should have more arguments: %s", requestLines)
-	}
-
-	numReplicasAck = 0
-	countAck := 0
-
-	numReplicasWait, err = strconv.Atoi(requestLines[4])
+// WaitHandler blocks the client until numreplicas replicas acknowledged its
+// last write, or the timeout in milliseconds elapses, and replies with the
+// number of replicas that did. A timeout of 0 blocks forever.
+// Usage: WAIT numreplicas timeout
+func (ch *Commands) WaitHandler(c *Client, args [][]byte) ([]string, error) {
+	numReplicas, err := strconv.Atoi(string(args[1]))
 	if err != nil {
-		return nil, fmt.Errorf("error converting number of replicas to ACK: %s, error: %s", requestLines[4], err.Error())
+		return nil, ErrNotInteger
 	}
-	timeoutMs, err := strconv.Atoi(requestLines[6])
-	if err != nil {
-		return nil, fmt.Errorf("error converting response time: %s, error: %s", requestLines[6], err.Error())
+	timeoutMs, err := strconv.Atoi(string(args[2]))
+	if err != nil || timeoutMs < 0 {
+		return nil, ErrTimeoutNotInteger
 	}
 
-	if numReplicasWait == 0 {
-		return []string{":0\r\n"}, nil
+	if ch.ServerOpts.Role == RoleSlave {
+		return nil, NewCommandError("WAIT cannot be used with replica instances. Please also note that since Redis 4.0 if a replica is configured to be writable (which is not the default) writes to replicas are just local and are not propagated.")
 	}
 
-	// respChan := make(chan bool, len(ch.ServerOpts.Replicas))
-	go ch.SendToReplicas("*3\r\n$8\r\nREPLCONF\r\n$6\r\nGETACK\r\n$1\r\n*\r\n", nil)
-
-	timeout := time.NewTimer(time.Duration(timeoutMs) * time.Millisecond)
-
-	defer timeout.Stop()
-
-	chanLoop: for {
-		select {
-			case <- replicasWaitChan:
-				countAck = numReplicasAck
-				fmt.Println("got ACK from replica: ", countAck)
-				break chanLoop
-
-			case <-timeout.C:
-				fmt.Println("time is out")
-				if numReplicasAck == 0 {
-					countAck = len(ch.ServerOpts.Replicas)
-				} else {
-					countAck = numReplicasAck
-				}
-			break chanLoop
-		}
+	offset := c.WriteOffset
+	ackReply := func() []string {
+		return []string{ResponseBuilder(IntegersRespType, strconv.Itoa(ch.countAckedReplicas(offset)))}
 	}
 
-	numReplicasAck = 0
-	numReplicasWait = 0
+	if ch.countAckedReplicas(offset) >= numReplicas {
+		return ackReply(), nil
+	}
 
-	return []string{fmt.Sprintf(":%v\r\n", countAck)}, nil
-}
+	// ask the replicas for their offset rather than waiting for their next ACK
+	ch.SendToReplicas(EncodeCommand(toBytesArgs(string(REPLCONF), string(GETACK), "*")))
 
-func (ch *Commands) FullResyncHandler() ([]string, error) {
-	return []string{}, nil
+	ch.blockClient(c, time.Duration(timeoutMs) * time.Millisecond, nil,
+		func(string) ([]string, bool) {
+			if ch.countAckedReplicas(offset) >= numReplicas {
+				return ackReply(), true
+			}
+			return nil, false
+		},
+		ackReply,
+	)
+	return nil, nil
 }
 
-func (ch *Commands) ConfigHandler(requestLines []string) ([]string, error) {
-	if len(requestLines) < 7 {
-		return nil, fmt.Errorf("invalid command received. CONFIG should have more arguments: %s", requestLines)
+// countAckedReplicas returns the number of replicas that acknowledged offset
+func (ch *Commands) countAckedReplicas(offset int64) int {
+	count := 0
+	for _, ackOffset := range ch.Replicas {
+		if ackOffset >= offset {
+			count++
+		}
 	}
+	return count
+}
 
-	switch Command(strings.ToUpper(requestLines[4])) {
+func (ch *Commands) ConfigHandler(c *Client, args [][]byte) ([]string, error) {
+	switch Command(strings.ToUpper(string(args[1]))) {
 		case GET:
-			switch Command(strings.ToUpper(requestLines[6])) {
+			switch Command(strings.ToUpper(string(args[2]))) {
 				case DIR:
-					return []string{fmt.Sprintf("*2\r\n$3\r\ndir\r\n$%v\r\n%s\r\n", len(ch.Store.KVStore.Config.Dir), ch.Store.KVStore.Config.Dir)}, nil
+					return []string{MapResponse(c.Protocol, "dir", ch.Store.Config.Dir)}, nil
 
 				case DB_FILE_NAME:
-					return []string{fmt.Sprintf("*2\r\n$10\r\ndbfilename\r\n$%v\r\n%s\r\n", len(ch.Store.KVStore.Config.DbFileName), ch.Store.KVStore.Config.DbFileName)}, nil
-				
-				default:
-					fmt.Println("skipping unknown command received with CONFIG GET. request: ", requestLines)
-					return []string{}, nil
-			}
-	}
+					return []string{MapResponse(c.Protocol, "dbfilename", ch.Store.Config.DbFileName)}, nil
 
-	return []string{}, nil
-}
+				case DATABASES:
+					return []string{MapResponse(c.Protocol, "databases", strconv.Itoa(len(ch.Store.DBs)))}, nil
 
-func (ch *Commands) KeysHandler(requestLines []string) ([]string, error) {
-	if len(requestLines) < 5 {
-		return nil, fmt.Errorf("invalid command received. CONFIG should have more arguments: %s", requestLines)
-	}
+				case HZ:
+					return []string{MapResponse(c.Protocol, "hz", strconv.Itoa(ch.ServerOpts.Hz))}, nil
 
-	switch strings.ToUpper(requestLines[4]) {
+				case ACTIVE_EXPIRE_EFFORT:
+					return []string{MapResponse(c.Protocol, "active-expire-effort", strconv.Itoa(ch.ServerOpts.ActiveExpireEffort))}, nil
 
-		case "*":
-			keySet := ch.Store.KVStore.GetKeys()
-			if len(keySet) == 0 {
-				return []string{}, nil
-			}
+				case HASH_MAX_LISTPACK_ENTRIES:
+					return []string{MapResponse(c.Protocol, "hash-max-listpack-entries", strconv.Itoa(ch.Store.Encoding.HashMaxListpackEntries))}, nil
 
-			return []string{ResponseBuilder(ArraysRespType, keySet...)}, nil
+				case HASH_MAX_LISTPACK_VALUE:
+					return []string{MapResponse(c.Protocol, "hash-max-listpack-value", strconv.Itoa(ch.Store.Encoding.HashMaxListpackValue))}, nil
 
-		default:
-			val, err := ch.Store.KVStore.Get(requestLines[4])
-			if err != nil {
-				return nil, fmt.Errorf("error getting value for the key: %s. error: %s", requestLines[4], err.Error())
-			}
+				case SET_MAX_INTSET_ENTRIES:
+					return []string{MapResponse(c.Protocol, "set-max-intset-entries", strconv.Itoa(ch.Store.Encoding.SetMaxIntsetEntries))}, nil
 
-			return []string{ResponseBuilder(BulkStringsRespType, val)}, nil
+				case HLL_SPARSE_MAX_BYTES:
+					return []string{MapResponse(c.Protocol, "hll-sparse-max-bytes", strconv.Itoa(ch.Store.Encoding.HllSparseMaxBytes))}, nil
+				
+			}
 	}
-}
 
-func (ch *Commands) TypeHandler(requestLines []string) ([]string, error) {
-	if len(requestLines) < 5 {
-		return nil, fmt.Errorf("invalid command received. TYPE should have more arguments: %s", requestLines)
-	}
+	// parameters this server does not know about are left out of the reply
+	return []string{MapResponse(c.Protocol)}, nil
+}
 
-	arg := requestLines[4]
+// KeysHandler replies with the keys of any type matching a glob-style
+// pattern. Usage: KEYS pattern
+func (ch *Commands) KeysHandler(c *Client, args [][]byte) ([]string, error) {
+	pattern := args[1]
+	matchAll := string(pattern) == "*"
 
-	val, err := ch.Store.KVStore.Get(arg)
-	if err != nil {
-		return nil, fmt.Errorf("error getting value for the key: %s. error: %s", arg, err.Error())
-	}
-	if val == "" {
-		val, err := ch.Store.StreamStore.GetStream(arg)
-		if err != nil {
-			return nil, fmt.Errorf("error getting value for the key: %s. error: %s", arg, err.Error())
+	keys := make([]string, 0)
+	for _, key := range ch.db(c).Keyspace.Keys() {
+		if matchAll || StringMatch(pattern, []byte(key), false) {
+			keys = append(keys, key)
 		}
-		if val == nil {
-			return NoneTypeResponse(), nil
-		}
-
-		return StreamResponse(), nil
-
 	}
 
-	v := reflect.TypeOf(val)
-	switch v.Kind() { 
-	case reflect.String:
-        return StringResponse(), nil
-
-    default:
-        fmt.Printf("unexpected type %T", v)
-    }
+	if len(keys) == 0 {
+		return []string{ArrayHeader(0)}, nil
+	}
+	return []string{ResponseBuilder(ArraysRespType, keys...)}, nil
+}
 
-	return []string{}, nil
+func (ch *Commands) TypeHandler(c *Client, args [][]byte) ([]string, error) {
+	return []string{ResponseBuilder(SimpleStringsRespType, ch.db(c).Type(string(args[1])))}, nil
 }
 
-func (ch *Commands) XAddHandler(requestLines []string) ([]string, error) {
-	if len(requestLines) < 11 {
-		return nil, fmt.Errorf("invalid command received. XADD should have more arguments: %s", requestLines)
+func (ch *Commands) XAddHandler(c *Client, args [][]byte) ([]string, error) {
+	if len(args) % 2 == 0 {
+		return nil, WrongArityError(commandTable["xadd"])
 	}
 
-	streamKey := requestLines[4]
-	entryID := requestLines[6]
+	streamKey := string(args[1])
+	entryID := string(args[2])
 
 	if entryID == "0-0" {
 		return []string{ResponseBuilder(ErrorsRespType, "The ID specified in XADD must be greater than 0-0")}, nil
 	}
 
-	i := 8
+	i := 3
 	entries := make([]store.StreamEntry, 0)
-	for i < len(requestLines) {
-		key := requestLines[i]
-		value := requestLines[i+2]
-
+	for i < len(args) {
 		entryValue := store.StreamEntry{
-			Key: key,
-			Value: value,
+			Key: args[i],
+			Value: args[i+1],
 		}
 		entries = append(entries, entryValue)
-		i += 4
+		i += 2
 	}
 
-	updatedEntryId, err := ch.Store.StreamStore.SetEntry(streamKey, entryID, entries)
-	if errors.Is(err, store.ErrInvalidEntryID) {
+	updatedEntryId, err := ch.db(c).StreamStore.SetEntry(streamKey, entryID, entries)
+	if errors.Is(err, store.ErrWrongType) {
+		return nil, ErrWrongType
+	} else if errors.Is(err, store.ErrInvalidEntryID) {
 		return []string{ResponseBuilder(ErrorsRespType, "The ID specified in XADD is equal or smaller than the target stream top item")}, nil
 	} else if err != nil {
 		return []string{}, err
@@ -512,17 +713,20 @@ func (ch *Commands) XAddHandler(requestLines []string) ([]string, error) {
 		entryID = updatedEntryId
 	}
 
+	// replicas must store the same ID, not generate their own
+	c.RewriteArg(2, []byte(entryID))
+
 	return []string{ResponseBuilder(BulkStringsRespType, entryID)}, nil
 }
 
-func (ch *Commands) XRangeHandler(requestLines []string) ([]string, error) {
-	if len(requestLines) < 9 {
-		return nil, fmt.Errorf("invalid command received. XRANGE should have more arguments: %s", requestLines)
+func (ch *Commands) XRangeHandler(c *Client, args [][]byte) ([]string, error) {
+	if !isStreamOrNone(ch.db(c), string(args[1])) {
+		return nil, ErrWrongType
 	}
 
-	streamValues := ch.Store.StreamStore.GetEntryRange(requestLines[4], requestLines[6], requestLines[8])
+	streamValues := ch.db(c).StreamStore.GetEntryRange(string(args[1]), string(args[2]), string(args[3]))
 	if len(streamValues) == 0 {
-		return []string{}, fmt.Errorf("stream values not found")
+		return []string{ArrayHeader(0)}, nil
 	}
 
 	var resp string
@@ -534,7 +738,7 @@ func (ch *Commands) XRangeHandler(requestLines []string) ([]string, error) {
 
 		innerResp := make([]string, 0)
 		for _, entry := range val.Entry {
-			innerResp = append(innerResp, entry.Key, entry.Value)
+			innerResp = append(innerResp, string(entry.Key), string(entry.Value))
 		}
 
 		resp += ResponseBuilder(ArraysRespType, innerResp...)
@@ -543,79 +747,97 @@ func (ch *Commands) XRangeHandler(requestLines []string) ([]string, error) {
 	return []string{resp}, nil
 }
 
-func (ch *Commands) XReadHandler(requestLines []string) ([]string, error) {
-	if len(requestLines) < 9 {
-		return nil, fmt.Errorf("invalid command received. XRANGE should have more arguments: %s", requestLines)
+// XReadHandler replies with the entries of the streams with IDs greater than
+// the given ones. With BLOCK, when there are none yet, the client blocks until
+// one of the streams gets new entries or the timeout in milliseconds elapses.
+// Usage: XREAD [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+func (ch *Commands) XReadHandler(c *Client, args [][]byte) ([]string, error) {
+	// index of the first stream key, right after the STREAMS keyword
+	indexJ := 2
+	isBlock := Command(strings.ToUpper(string(args[1]))) == BLOCK
+	if isBlock {
+		indexJ += 2
 	}
 
-	indexJ := 5
-	if Command(strings.ToUpper(requestLines[4])) == BLOCK {
-		indexJ += 4
-		blockTimeout, err := strconv.Atoi(requestLines[6])
-		if err != nil {
-			return ch.internalXReadHandler(ch.GetXReadStreamsAndArrays(requestLines[indexJ:], false))
-		}
-		
-		streamKeys, entryIDs := ch.GetXReadStreamsAndArrays(requestLines[indexJ:], true)
-		go ch.XReadWithBlock(blockTimeout, streamKeys, entryIDs)
-
-		for {
-			select {
-				case resp := <- xreadBlockChan:
-					return []string{resp}, nil
-
-				case <-time.After(time.Duration(70) * time.Second):
-					return NullResponse(), nil
-			}
+	if len(args) <= indexJ || Command(strings.ToUpper(string(args[indexJ-1]))) != STREAMS {
+		return nil, ErrSyntax
+	}
+	if (len(args) - indexJ) % 2 != 0 {
+		return nil, NewCommandError("Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.")
+	}
+	for _, streamKey := range args[indexJ:indexJ + (len(args) - indexJ) / 2] {
+		if !isStreamOrNone(ch.db(c), string(streamKey)) {
+			return nil, ErrWrongType
 		}
+	}
 
-	} else {
-		return ch.internalXReadHandler(ch.GetXReadStreamsAndArrays(requestLines[indexJ:], false))
+	if !isBlock {
+		streamKeys, entryIDs := ch.GetXReadStreamsAndArrays(ch.db(c), args[indexJ:], false)
+		return ch.internalXReadHandler(ch.db(c), c.Protocol, streamKeys, entryIDs)
 	}
 
-	// return []string{"should not be here"}, nil
-}
+	blockTimeout, err := strconv.Atoi(string(args[2]))
+	if err != nil || blockTimeout < 0 {
+		return nil, ErrTimeoutNotInteger
+	}
 
-func (ch *Commands) XReadWithBlock(timeout int, streamKeys, entryIDs []string) {
-	if timeout > 0 {
-		time.Sleep(time.Duration(timeout) * time.Millisecond)
+	// $ is resolved now, so only entries added while blocked are returned
+	streamKeys, entryIDs := ch.GetXReadStreamsAndArrays(ch.db(c), args[indexJ:], true)
 
-		response, err := ch.internalXReadHandler(streamKeys, entryIDs)
-		if err != nil {
-			xreadBlockChan <- NullResponse()[0]
-		} else {
-			xreadBlockChan <- response[0]
-		}
-	} else {
-		for {
-			result, _ := ch.internalXReadHandler(streamKeys, entryIDs)
-			if result != nil && result[0] != NullResponse()[0] {
-				xreadBlockChan <- result[0]
-				break
-			}
-			time.Sleep(time.Duration(10) * time.Millisecond)
-		}
+	resp, err := ch.internalXReadHandler(ch.db(c), c.Protocol, streamKeys, entryIDs)
+	if err != nil || resp[0] != NullResponse(c.Protocol)[0] {
+		return resp, err
 	}
 
+	ch.blockClient(c, time.Duration(blockTimeout) * time.Millisecond, streamKeys,
+		func(string) ([]string, bool) {
+			resp, err := ch.internalXReadHandler(ch.db(c), c.Protocol, streamKeys, entryIDs)
+			if err != nil || resp[0] == NullResponse(c.Protocol)[0] {
+				return nil, false
+			}
+			return resp, true
+		},
+		func() []string {
+			return NullResponse(c.Protocol)
+		},
+	)
+	return nil, nil
 }
 
-func (ch *Commands) internalXReadHandler(streamKeys []string, entryIDs []string) ([]string, error) {
+// internalXReadHandler replies with the streams that have entries newer than the
+// given IDs, as a map keyed by stream name under RESP3
+func (ch *Commands) internalXReadHandler(db *store.DB, proto int, streamKeys []string, entryIDs []string) ([]string, error) {
 
+	readKeys := make([]string, 0, len(streamKeys))
 	readStreams := make(map[string][]store.StreamValues)
 	for i := 0; i < len(streamKeys); i++ {
-		readStreams[streamKeys[i]] = ch.Store.StreamStore.ReadEntry(streamKeys[i], entryIDs[i])
+		streamValues := db.StreamStore.ReadEntry(streamKeys[i], entryIDs[i])
+		if len(streamValues) == 0 {
+			continue
+		}
+		if _, exists := readStreams[streamKeys[i]]; !exists {
+			readKeys = append(readKeys, streamKeys[i])
+		}
+		readStreams[streamKeys[i]] = streamValues
 	}
 
-	if len(readStreams) == 0 || (len(readStreams) == 1 && len(readStreams[streamKeys[0]]) == 0){
-		return NullResponse(), nil
+	if len(readKeys) == 0 {
+		return NullResponse(proto), nil
 	}
 
 	var resp string
-	resp = fmt.Sprintf("*%v\r\n", len(readStreams))
+	if proto == RESP3 {
+		resp = MapHeader(proto, len(readKeys))
+	} else {
+		resp = fmt.Sprintf("*%v\r\n", len(readKeys))
+	}
 
-	for streamName, streamValues := range readStreams {
+	for _, streamName := range readKeys {
+		streamValues := readStreams[streamName]
 
-		resp += "*2\r\n"
+		if proto != RESP3 {
+			resp += "*2\r\n"
+		}
 		resp += ResponseBuilder(BulkStringsRespType, streamName)
 
 		resp += fmt.Sprintf("*%v\r\n", len(streamValues))
@@ -625,7 +847,7 @@ func (ch *Commands) internalXReadHandler(streamKeys []string, entryIDs []string)
 	
 			innerResp := make([]string, 0)
 			for _, entry := range val.Entry {
-				innerResp = append(innerResp, entry.Key, entry.Value)
+				innerResp = append(innerResp, string(entry.Key), string(entry.Value))
 			}
 	
 			resp += ResponseBuilder(ArraysRespType, innerResp...)
@@ -635,42 +857,73 @@ func (ch *Commands) internalXReadHandler(streamKeys []string, entryIDs []string)
 	return []string{resp}, nil
 }
 
-func (ch *Commands) GetXReadStreamsAndArrays(request []string, isBlock  bool) (streamKeys []string, entryIDs []string) {
-
-	indexJ := 0
-	xreadStreamCount := len(request[indexJ:]) / 4
+func (ch *Commands) GetXReadStreamsAndArrays(db *store.DB, request [][]byte, isBlock  bool) (streamKeys []string, entryIDs []string) {
+	// request holds the stream keys followed by the same number of entry IDs
+	xreadStreamCount := len(request) / 2
 
 	for i := 0; i < xreadStreamCount; i++ {
-		streamKeys = append(streamKeys, request[indexJ + 1])
-		indexJ += 2
+		streamKeys = append(streamKeys, string(request[i]))
 	}
 
-	if isBlock && request[len(request)-1] == "$" {
+	if isBlock && string(request[len(request)-1]) == "$" {
 		entryIDs = make([]string, 0)
 		for i := 0; i < xreadStreamCount; i++ {
-			entryIDs = append(entryIDs, ch.Store.StreamStore.GetTopItemEntryID(streamKeys[i]))
+			entryIDs = append(entryIDs, db.StreamStore.GetTopItemEntryID(streamKeys[i]))
 		}
 	} else {
 		for i := 0; i < xreadStreamCount; i++ {
-			entryIDs = append(entryIDs, request[indexJ + 1])
-			indexJ += 2
+			entryIDs = append(entryIDs, string(request[xreadStreamCount + i]))
 		}
 	}
 
 	return streamKeys, entryIDs
 }
 
-func (ch *Commands) RdbFileHandler() ([]string, error) {
-	return []string{}, nil
+// db returns the database selected by client c
+func (ch *Commands) db(c *Client) *store.DB {
+	return ch.Store.DB(c.DB)
 }
 
-func (ch *Commands) SendToReplicas(request string, respChan chan bool) error {
-	fmt.Printf("send To Replicas message: %q\n", request)
-	for replicaConn := range ch.ServerOpts.Replicas {
-		_, err := replicaConn.Write([]byte(request))
-		if err != nil {
-			return fmt.Errorf("error writing commands: %s", err.Error())
-		}
+// isStreamOrNone reports whether key holds a stream or is missing, the keys
+// the stream commands accept
+func isStreamOrNone(db *store.DB, key string) bool {
+	keyType := db.Type(key)
+	return keyType == store.TypeStream || keyType == store.TypeNone
+}
+
+// propagate sends a write applied to database db to the replicas, selecting
+// the database first when the replication stream is on another one
+func (ch *Commands) propagate(db int, argv [][]byte) {
+	if db != ch.replicationDB {
+		ch.SendToReplicas(EncodeCommand(toBytesArgs(string(SELECT), strconv.Itoa(db))))
+		ch.replicationDB = db
 	}
-	return nil
-}
\ No newline at end of file
+	ch.SendToReplicas(EncodeCommand(argv))
+}
+
+// SendToReplicas queues request on the connection of every replica and
+// advances the replication offset by its length
+func (ch *Commands) SendToReplicas(request string) {
+	ch.ServerOpts.MasterReplicationOffset += int64(len(request))
+
+	for replica := range ch.Replicas {
+		replica.Reply([]string{request})
+	}
+}
+
+func toBytesArgs(args ...string) [][]byte {
+	res := make([][]byte, 0, len(args))
+	for _, arg := range args {
+		res = append(res, []byte(arg))
+	}
+	return res
+}
+
+// toStrings converts arguments, such as the fields of a hash, to strings
+func toStrings(args [][]byte) []string {
+	res := make([]string, 0, len(args))
+	for _, arg := range args {
+		res = append(res, string(arg))
+	}
+	return res
+}
@@ -3,6 +3,14 @@ package main
 import (
 	// "flag"
 	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -16,7 +24,7 @@ const (
 	TEST_REPLICATION_ID = "8371b4fb1155b71f4a04d3e1bc3e18c4a990aeeb"
 )
 
-func createCommandsHandler(role Role) Commands{
+func createCommandsHandler(role Role) *Commands {
 	return NewCommandsHandler(
 		ServerOpts{
 			ListnerPort: DefaultListenerPort,
@@ -33,6 +41,14 @@ func createCommandsHandler(role Role) Commands{
 	)
 }
 
+func toArgs(args ...string) [][]byte {
+	res := make([][]byte, 0, len(args))
+	for _, arg := range args {
+		res = append(res, []byte(arg))
+	}
+	return res
+}
+
 // TestParseCommands
 func TestParseCommands_Ping(t *testing.T) {
 	handler := createCommandsHandler(RoleMaster)
@@ -46,37 +62,1679 @@ func TestParseCommands_Ping(t *testing.T) {
 func TestParseCommands_Echo(t *testing.T) {
 	handler := createCommandsHandler(RoleMaster)
 
-	buf := []byte("*2\r\n$4\r\necho\r\n$11\r\nHello World\r\n")	
-	val, err := handler.ParseCommands(string(buf))
+	buf := []byte("*2\r\n$4\r\necho\r\n$11\r\nHello World\r\n")	
+	val, err := handler.ParseCommands(string(buf))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"$11\r\nHello World\r\n"}, val)
+}
+
+func TestParseCommands_Set(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	buf := []byte("*3\r\n$3\r\nset\r\n$10\r\nstrawberry\r\n$9\r\nraspberry\r\n")	
+	val, err := handler.ParseCommands(string(buf))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"+OK\r\n"}, val)
+}
+
+func TestParseCommands_SetWithExpiration(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	buf := []byte("*5\r\n$3\r\nset\r\n$5\r\nmango\r\n$9\r\nraspberry\r\n$2\r\npx\r\n$3\r\n100\r\n")	
+	val, err := handler.ParseCommands(string(buf))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"+OK\r\n"}, val)
+}
+
+func TestParseCommands_SetOptions(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	// NX and XX make the write conditional, GET returns the previous value
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("set", "lock", "a", "xx")) +
+		EncodeCommand(toArgs("set", "lock", "a", "nx", "px", "30000")) +
+		EncodeCommand(toArgs("set", "lock", "b", "PX", "30000", "NX")) +
+		EncodeCommand(toArgs("get", "lock")) +
+		EncodeCommand(toArgs("set", "lock", "c", "get", "xx", "keepttl")) +
+		EncodeCommand(toArgs("set", "lock", "d", "nx", "get")) +
+		EncodeCommand(toArgs("set", "fresh", "e", "get")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"$-1\r\n", "+OK\r\n", "$-1\r\n", "$1\r\na\r\n", "$1\r\na\r\n", "$1\r\nc\r\n", "$-1\r\n"}, val)
+
+	// KEEPTTL retains the expiration, a plain SET drops it
+	obj, _ := handler.Store.DB(0).Keyspace.Lookup("lock")
+	assert.Greater(t, obj.Expiration, time.Now().UnixMilli() + 29000)
+	handler.ParseCommands(EncodeCommand(toArgs("set", "lock", "f")))
+	obj, _ = handler.Store.DB(0).Keyspace.Lookup("lock")
+	assert.Equal(t, int64(-1), obj.Expiration)
+
+	now := time.Now()
+	val, err = handler.ParseCommands(
+		EncodeCommand(toArgs("set", "ex", "1", "ex", "100")) +
+		EncodeCommand(toArgs("set", "exat", "1", "exat", strconv.FormatInt(now.Unix() + 100, 10))) +
+		EncodeCommand(toArgs("set", "pxat", "1", "pxat", strconv.FormatInt(now.UnixMilli() + 100000, 10))) +
+		EncodeCommand(toArgs("set", "past", "1", "pxat", "1")) +
+		EncodeCommand(toArgs("get", "past")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"+OK\r\n", "+OK\r\n", "+OK\r\n", "+OK\r\n", "$-1\r\n"}, val)
+	for _, key := range []string{"ex", "exat", "pxat"} {
+		obj, exists := handler.Store.DB(0).Keyspace.Lookup(key)
+		assert.True(t, exists)
+		assert.InDelta(t, now.UnixMilli() + 100000, obj.Expiration, 1500, key)
+	}
+
+	val, err = handler.ParseCommands(
+		EncodeCommand(toArgs("set", "k", "v", "nx", "xx")) +
+		EncodeCommand(toArgs("set", "k", "v", "ex", "10", "px", "100")) +
+		EncodeCommand(toArgs("set", "k", "v", "keepttl", "ex", "10")) +
+		EncodeCommand(toArgs("set", "k", "v", "ex")) +
+		EncodeCommand(toArgs("set", "k", "v", "ex", "0")) +
+		EncodeCommand(toArgs("set", "k", "v", "ex", "-5")) +
+		EncodeCommand(toArgs("set", "k", "v", "ex", "9223372036854775807")) +
+		EncodeCommand(toArgs("set", "k", "v", "px", "1.5")) +
+		EncodeCommand(toArgs("set", "k", "v", "later")) +
+		EncodeCommand(toArgs("xadd", "stream", "1-1", "a", "b")) +
+		EncodeCommand(toArgs("set", "stream", "v", "get")) +
+		EncodeCommand(toArgs("set", "stream", "v")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"-ERR syntax error\r\n",
+		"-ERR syntax error\r\n",
+		"-ERR syntax error\r\n",
+		"-ERR syntax error\r\n",
+		"-ERR invalid expire time in 'set' command\r\n",
+		"-ERR invalid expire time in 'set' command\r\n",
+		"-ERR invalid expire time in 'set' command\r\n",
+		"-ERR value is not an integer or out of range\r\n",
+		"-ERR syntax error\r\n",
+		"$3\r\n1-1\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		"+OK\r\n",
+	}, val)
+}
+
+func TestParseCommands_SetPropagation(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	replica := NewClient(nil)
+	_, err := handler.ParseClientCommands(replica, EncodeCommand(toArgs("psync", "?", "-1")))
+	assert.Nil(t, err)
+	replica.takeReplies()
+
+	handler.ParseCommands(
+		EncodeCommand(toArgs("set", "lock", "a", "nx", "ex", "100")) +
+		EncodeCommand(toArgs("set", "lock", "b", "nx")) +
+		EncodeCommand(toArgs("set", "lock", "c", "xx", "keepttl")),
+	)
+	obj, _ := handler.Store.DB(0).Keyspace.Lookup("lock")
+
+	// relative expirations reach replicas as absolute ones, and writes that
+	// did not happen are not propagated at all
+	assert.Equal(t, []string{
+		EncodeCommand(toArgs("SELECT", "0")),
+		EncodeCommand(toArgs("set", "lock", "a", "nx", "PXAT", strconv.FormatInt(obj.Expiration, 10))),
+		EncodeCommand(toArgs("set", "lock", "c", "xx", "keepttl")),
+	}, replica.takeReplies())
+}
+
+func TestParseCommands_Counters(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("incr", "hits")) +
+		EncodeCommand(toArgs("incrby", "hits", "41")) +
+		EncodeCommand(toArgs("decr", "hits")) +
+		EncodeCommand(toArgs("decrby", "hits", "-10")) +
+		EncodeCommand(toArgs("get", "hits")) +
+		EncodeCommand(toArgs("set", "hits", "100")) +
+		EncodeCommand(toArgs("incr", "hits")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{":1\r\n", ":42\r\n", ":41\r\n", ":51\r\n", "$2\r\n51\r\n", "+OK\r\n", ":101\r\n"}, val)
+
+	// counters keep their expiration
+	handler.ParseCommands(EncodeCommand(toArgs("set", "limit", "5", "ex", "100")) + EncodeCommand(toArgs("incr", "limit")))
+	obj, _ := handler.Store.DB(0).Keyspace.Lookup("limit")
+	assert.Equal(t, int64(6), obj.Value)
+	assert.Greater(t, obj.Expiration, time.Now().UnixMilli())
+
+	val, err = handler.ParseCommands(
+		EncodeCommand(toArgs("set", "max", "9223372036854775806")) +
+		EncodeCommand(toArgs("incr", "max")) +
+		EncodeCommand(toArgs("incr", "max")) +
+		EncodeCommand(toArgs("decrby", "min", "-9223372036854775808")) +
+		EncodeCommand(toArgs("incrby", "min", "9223372036854775808")) +
+		EncodeCommand(toArgs("set", "text", "apple")) +
+		EncodeCommand(toArgs("incr", "text")) +
+		EncodeCommand(toArgs("set", "padded", " 1")) +
+		EncodeCommand(toArgs("incr", "padded")) +
+		EncodeCommand(toArgs("set", "signed", "+1")) +
+		EncodeCommand(toArgs("incr", "signed")) +
+		EncodeCommand(toArgs("xadd", "stream", "1-1", "a", "b")) +
+		EncodeCommand(toArgs("incr", "stream")) +
+		EncodeCommand(toArgs("get", "max")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"+OK\r\n",
+		":9223372036854775807\r\n",
+		"-ERR increment or decrement would overflow\r\n",
+		"-ERR decrement would overflow\r\n",
+		"-ERR value is not an integer or out of range\r\n",
+		"+OK\r\n",
+		"-ERR value is not an integer or out of range\r\n",
+		"+OK\r\n",
+		"-ERR value is not an integer or out of range\r\n",
+		"+OK\r\n",
+		"-ERR value is not an integer or out of range\r\n",
+		"$3\r\n1-1\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		"$19\r\n9223372036854775807\r\n",
+	}, val)
+}
+
+func TestParseCommands_IncrByFloat(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("set", "price", "10.50")) +
+		EncodeCommand(toArgs("incrbyfloat", "price", "0.1")) +
+		EncodeCommand(toArgs("incrbyfloat", "price", "-5")) +
+		EncodeCommand(toArgs("incrbyfloat", "price", "5.0e3")) +
+		EncodeCommand(toArgs("incr", "counter")) +
+		EncodeCommand(toArgs("incrbyfloat", "counter", "1.5")) +
+		EncodeCommand(toArgs("incrbyfloat", "price", "abc")) +
+		EncodeCommand(toArgs("incrbyfloat", "price", "inf")) +
+		EncodeCommand(toArgs("set", "huge", "1.7e308")) +
+		EncodeCommand(toArgs("incrbyfloat", "huge", "1.7e308")) +
+		EncodeCommand(toArgs("set", "word", "pear")) +
+		EncodeCommand(toArgs("incrbyfloat", "word", "1")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"+OK\r\n",
+		"$4\r\n10.6\r\n",
+		"$3\r\n5.6\r\n",
+		"$6\r\n5005.6\r\n",
+		":1\r\n",
+		"$3\r\n2.5\r\n",
+		"-ERR value is not a valid float\r\n",
+		"-ERR value is not a valid float\r\n",
+		"+OK\r\n",
+		"-ERR increment would produce NaN or Infinity\r\n",
+		"+OK\r\n",
+		"-ERR value is not a valid float\r\n",
+	}, val)
+
+	// increments are added in a long double and printed with 17 significant
+	// digits, as redis does, so 0.1 + 0.2 is 0.3
+	val, err = handler.ParseCommands(
+		EncodeCommand(toArgs("set", "f", "0.1")) +
+		EncodeCommand(toArgs("incrbyfloat", "f", "0.2")) +
+		EncodeCommand(toArgs("get", "f")) +
+		EncodeCommand(toArgs("incrbyfloat", "f", "-0.3")) +
+		EncodeCommand(toArgs("incrbyfloat", "tiny", "1.5e-7")) +
+		EncodeCommand(toArgs("incrbyfloat", "big", "1e20")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"+OK\r\n", "$3\r\n0.3\r\n", "$3\r\n0.3\r\n", "$1\r\n0\r\n",
+		"$10\r\n0.00000015\r\n", "$21\r\n100000000000000000000\r\n",
+	}, val)
+}
+
+func TestParseCommands_CounterPropagation(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	replica := NewClient(nil)
+	_, err := handler.ParseClientCommands(replica, EncodeCommand(toArgs("psync", "?", "-1")))
+	assert.Nil(t, err)
+	replica.takeReplies()
+
+	handler.ParseCommands(
+		EncodeCommand(toArgs("incrby", "hits", "5")) +
+		EncodeCommand(toArgs("incr", "text")) +
+		EncodeCommand(toArgs("incrbyfloat", "price", "0.1")) +
+		EncodeCommand(toArgs("set", "word", "pear")) +
+		EncodeCommand(toArgs("incr", "word")),
+	)
+
+	// INCRBYFLOAT reaches replicas as the value it computed
+	assert.Equal(t, []string{
+		EncodeCommand(toArgs("SELECT", "0")),
+		EncodeCommand(toArgs("incrby", "hits", "5")),
+		EncodeCommand(toArgs("incr", "text")),
+		EncodeCommand(toArgs("SET", "price", "0.1", "KEEPTTL")),
+		EncodeCommand(toArgs("set", "word", "pear")),
+	}, replica.takeReplies())
+}
+
+func TestParseCommands_StringCommands(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("append", "greeting", "Hello")) +
+		EncodeCommand(toArgs("append", "greeting", " World")) +
+		EncodeCommand(toArgs("strlen", "greeting")) +
+		EncodeCommand(toArgs("strlen", "missing")) +
+		EncodeCommand(toArgs("getrange", "greeting", "0", "4")) +
+		EncodeCommand(toArgs("getrange", "greeting", "-5", "-1")) +
+		EncodeCommand(toArgs("getrange", "greeting", "-1", "-5")) +
+		EncodeCommand(toArgs("getrange", "greeting", "6", "100")) +
+		EncodeCommand(toArgs("getrange", "missing", "0", "-1")) +
+		EncodeCommand(toArgs("setrange", "greeting", "6", "Redis")) +
+		EncodeCommand(toArgs("get", "greeting")) +
+		EncodeCommand(toArgs("setrange", "padded", "3", "abc")) +
+		EncodeCommand(toArgs("get", "padded")) +
+		EncodeCommand(toArgs("setrange", "empty", "3", "")) +
+		EncodeCommand(toArgs("dbsize")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		":5\r\n", ":11\r\n", ":11\r\n", ":0\r\n",
+		"$5\r\nHello\r\n", "$5\r\nWorld\r\n", "$0\r\n\r\n", "$5\r\nWorld\r\n", "$0\r\n\r\n",
+		":11\r\n", "$11\r\nHello Redis\r\n",
+		":6\r\n", "$6\r\n\x00\x00\x00abc\r\n",
+		":0\r\n", ":2\r\n",
+	}, val)
+
+	// counters are strings too
+	val, err = handler.ParseCommands(
+		EncodeCommand(toArgs("incrby", "counter", "42")) +
+		EncodeCommand(toArgs("append", "counter", "0")) +
+		EncodeCommand(toArgs("strlen", "counter")) +
+		EncodeCommand(toArgs("xadd", "stream", "1-1", "a", "b")) +
+		EncodeCommand(toArgs("append", "stream", "x")) +
+		EncodeCommand(toArgs("strlen", "stream")) +
+		EncodeCommand(toArgs("setrange", "greeting", "-1", "x")) +
+		EncodeCommand(toArgs("setrange", "greeting", "536870911", "xy")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		":42\r\n", ":3\r\n", ":3\r\n", "$3\r\n1-1\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		"-ERR offset is out of range\r\n",
+		"-ERR string exceeds maximum allowed size (proto-max-bulk-len)\r\n",
+	}, val)
+}
+
+func TestParseCommands_GetDelGetEx(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("set", "session", "token")) +
+		EncodeCommand(toArgs("getex", "session", "ex", "100")) +
+		EncodeCommand(toArgs("getex", "missing", "px", "100")) +
+		EncodeCommand(toArgs("getex", "session", "persist", "ex", "100")) +
+		EncodeCommand(toArgs("getex", "session", "ex", "0")) +
+		EncodeCommand(toArgs("getex", "session", "exat")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"+OK\r\n", "$5\r\ntoken\r\n", "$-1\r\n",
+		"-ERR syntax error\r\n",
+		"-ERR invalid expire time in 'getex' command\r\n",
+		"-ERR syntax error\r\n",
+	}, val)
+
+	obj, _ := handler.Store.DB(0).Keyspace.Lookup("session")
+	assert.Greater(t, obj.Expiration, time.Now().UnixMilli() + 99000)
+
+	val, err = handler.ParseCommands(
+		EncodeCommand(toArgs("getex", "session")) +
+		EncodeCommand(toArgs("getex", "session", "persist")) +
+		EncodeCommand(toArgs("getdel", "session")) +
+		EncodeCommand(toArgs("getdel", "session")) +
+		EncodeCommand(toArgs("get", "session")) +
+		EncodeCommand(toArgs("xadd", "stream", "1-1", "a", "b")) +
+		EncodeCommand(toArgs("getdel", "stream")) +
+		EncodeCommand(toArgs("getex", "stream", "persist")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"$5\r\ntoken\r\n", "$5\r\ntoken\r\n", "$5\r\ntoken\r\n", "$-1\r\n", "$-1\r\n", "$3\r\n1-1\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+	}, val)
+}
+
+func TestParseCommands_MultiKeyStrings(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("mset", "a", "1", "b", "2")) +
+		EncodeCommand(toArgs("mset", "a", "1", "b")) +
+		EncodeCommand(toArgs("xadd", "stream", "1-1", "a", "b")) +
+		EncodeCommand(toArgs("mget", "a", "missing", "stream", "b")) +
+		EncodeCommand(toArgs("msetnx", "c", "3", "a", "10")) +
+		EncodeCommand(toArgs("mget", "a", "c")) +
+		EncodeCommand(toArgs("msetnx", "c", "3", "d", "4")) +
+		EncodeCommand(toArgs("mget", "c", "d")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"+OK\r\n",
+		"-ERR wrong number of arguments for 'mset' command\r\n",
+		"$3\r\n1-1\r\n",
+		"*4\r\n$1\r\n1\r\n$-1\r\n$-1\r\n$1\r\n2\r\n",
+		":0\r\n",
+		"*2\r\n$1\r\n1\r\n$-1\r\n",
+		":1\r\n",
+		"*2\r\n$1\r\n3\r\n$1\r\n4\r\n",
+	}, val)
+
+	val, err = handler.ParseCommands(EncodeCommand(toArgs("command", "getkeys", "mset", "a", "1", "b", "2")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"*2\r\n$1\r\na\r\n$1\r\nb\r\n"}, val)
+}
+
+func TestParseCommands_Lcs(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	handler.ParseCommands(EncodeCommand(toArgs("mset", "key1", "ohmytext", "key2", "mynewtext")))
+
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("lcs", "key1", "key2")) +
+		EncodeCommand(toArgs("lcs", "key1", "key2", "len")) +
+		EncodeCommand(toArgs("lcs", "key1", "key2", "idx")) +
+		EncodeCommand(toArgs("lcs", "key1", "key2", "idx", "minmatchlen", "4", "withmatchlen")) +
+		EncodeCommand(toArgs("lcs", "key1", "missing")) +
+		EncodeCommand(toArgs("lcs", "key1", "key2", "len", "idx")) +
+		EncodeCommand(toArgs("lcs", "key1", "key2", "minmatchlen", "x")) +
+		EncodeCommand(toArgs("lcs", "key1", "key2", "fast")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"$6\r\nmytext\r\n",
+		":6\r\n",
+		"*4\r\n$7\r\nmatches\r\n*2\r\n*2\r\n*2\r\n:4\r\n:7\r\n*2\r\n:5\r\n:8\r\n*2\r\n*2\r\n:2\r\n:3\r\n*2\r\n:0\r\n:1\r\n$3\r\nlen\r\n:6\r\n",
+		"*4\r\n$7\r\nmatches\r\n*1\r\n*3\r\n*2\r\n:4\r\n:7\r\n*2\r\n:5\r\n:8\r\n:4\r\n$3\r\nlen\r\n:6\r\n",
+		"$0\r\n\r\n",
+		"-ERR If you want both the length and indexes, please just use IDX.\r\n",
+		"-ERR value is not an integer or out of range\r\n",
+		"-ERR syntax error\r\n",
+	}, val)
+
+	handler.ParseCommands(EncodeCommand(toArgs("xadd", "stream", "1-1", "a", "b")))
+	val, err = handler.ParseCommands(EncodeCommand(toArgs("lcs", "key1", "stream")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"-ERR The specified keys must contain string values\r\n"}, val)
+}
+
+func TestParseCommands_DelExists(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("mset", "a", "1", "b", "2", "c", "3")) +
+		EncodeCommand(toArgs("xadd", "stream", "1-1", "a", "b")) +
+		EncodeCommand(toArgs("exists", "a", "a", "stream", "missing")) +
+		EncodeCommand(toArgs("touch", "a", "missing")) +
+		EncodeCommand(toArgs("del", "a", "stream", "missing")) +
+		EncodeCommand(toArgs("unlink", "b", "b")) +
+		EncodeCommand(toArgs("exists", "a", "b", "stream")) +
+		EncodeCommand(toArgs("del", "missing")) +
+		EncodeCommand(toArgs("randomkey")) +
+		EncodeCommand(toArgs("del", "c")) +
+		EncodeCommand(toArgs("randomkey")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"+OK\r\n", "$3\r\n1-1\r\n", ":3\r\n", ":1\r\n", ":2\r\n", ":1\r\n", ":0\r\n", ":0\r\n",
+		"$1\r\nc\r\n", ":1\r\n", "$-1\r\n",
+	}, val)
+}
+
+func TestParseCommands_UnlinkLazyfree(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	released := make(chan *store.Object, 4)
+	unblock := make(chan struct{})
+	handler.lazyfree.release = func(obj *store.Object) {
+		released <- obj
+		<-unblock
+	}
+
+	items := []string{"rpush", "big"}
+	for i := 0; i <= LazyfreeThreshold; i++ {
+		items = append(items, strconv.Itoa(i))
+	}
+	handler.ParseCommands(
+		EncodeCommand(toArgs(items...)) +
+		EncodeCommand(toArgs(append([]string{"rpush", "big2"}, items[2:]...)...)),
+	)
+
+	// DEL drops the value without releasing it
+	val, err := handler.ParseCommands(EncodeCommand(toArgs("del", "big2")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{":1\r\n"}, val)
+	assert.Empty(t, released)
+
+	// UNLINK replies while the large value is still being released
+	val, err = handler.ParseCommands(EncodeCommand(toArgs("unlink", "big")) + EncodeCommand(toArgs("exists", "big")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{":1\r\n", ":0\r\n"}, val)
+	<-released
+	assert.Equal(t, int64(1), handler.lazyfree.pending.Load())
+	assert.Equal(t, int64(0), handler.lazyfree.freed.Load())
+
+	close(unblock)
+	assert.Eventually(t, func() bool {
+		return handler.lazyfree.freed.Load() == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, int64(0), handler.lazyfree.pending.Load())
+}
+
+func TestParseCommands_Rename(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("set", "old", "value", "ex", "100")) +
+		EncodeCommand(toArgs("rename", "old", "new")) +
+		EncodeCommand(toArgs("get", "old")) +
+		EncodeCommand(toArgs("get", "new")) +
+		EncodeCommand(toArgs("rename", "old", "new")) +
+		EncodeCommand(toArgs("rename", "new", "new")) +
+		EncodeCommand(toArgs("xadd", "stream", "1-1", "a", "b")) +
+		EncodeCommand(toArgs("renamenx", "new", "stream")) +
+		EncodeCommand(toArgs("renamenx", "new", "new")) +
+		EncodeCommand(toArgs("renamenx", "new", "newer")) +
+		EncodeCommand(toArgs("rename", "stream", "newer")) +
+		EncodeCommand(toArgs("type", "newer")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"+OK\r\n", "+OK\r\n", "$-1\r\n", "$5\r\nvalue\r\n",
+		"-ERR no such key\r\n", "+OK\r\n", "$3\r\n1-1\r\n",
+		":0\r\n", ":0\r\n", ":1\r\n", "+OK\r\n", "+stream\r\n",
+	}, val)
+
+	// the expiration follows the key
+	handler.ParseCommands(EncodeCommand(toArgs("set", "ttl", "v", "ex", "100")) + EncodeCommand(toArgs("rename", "ttl", "renamed")))
+	obj, _ := handler.Store.DB(0).Keyspace.Lookup("renamed")
+	assert.Greater(t, obj.Expiration, time.Now().UnixMilli())
+}
+
+func TestParseCommands_Copy(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("set", "src", "value", "ex", "100")) +
+		EncodeCommand(toArgs("copy", "src", "dst")) +
+		EncodeCommand(toArgs("copy", "src", "dst")) +
+		EncodeCommand(toArgs("set", "src", "other")) +
+		EncodeCommand(toArgs("copy", "src", "dst", "replace")) +
+		EncodeCommand(toArgs("get", "dst")) +
+		EncodeCommand(toArgs("copy", "src", "src")) +
+		EncodeCommand(toArgs("copy", "src", "src", "db", "2")) +
+		EncodeCommand(toArgs("copy", "missing", "dst")) +
+		EncodeCommand(toArgs("copy", "src", "dst", "db", "16")) +
+		EncodeCommand(toArgs("copy", "src", "dst", "db")) +
+		EncodeCommand(toArgs("select", "2")) +
+		EncodeCommand(toArgs("get", "src")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"+OK\r\n", ":1\r\n", ":0\r\n", "+OK\r\n", ":1\r\n", "$5\r\nother\r\n",
+		"-ERR source and destination objects are the same\r\n",
+		":1\r\n", ":0\r\n",
+		"-ERR DB index is out of range\r\n",
+		"-ERR syntax error\r\n",
+		"+OK\r\n", "$5\r\nother\r\n",
+	}, val)
+
+	// copies of a stream grow independently
+	val, err = handler.ParseCommands(
+		EncodeCommand(toArgs("xadd", "stream", "1-1", "a", "b")) +
+		EncodeCommand(toArgs("copy", "stream", "copied")) +
+		EncodeCommand(toArgs("xadd", "stream", "2-1", "from", "stream")) +
+		EncodeCommand(toArgs("xadd", "copied", "2-1", "from", "copied")) +
+		EncodeCommand(toArgs("xrange", "stream", "2", "+")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, "*1\r\n*2\r\n$3\r\n2-1\r\n*2\r\n$4\r\nfrom\r\n$6\r\nstream\r\n", val[4])
+}
+
+func TestParseCommands_Expire(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("set", "session", "token")) +
+		EncodeCommand(toArgs("ttl", "session")) +
+		EncodeCommand(toArgs("ttl", "missing")) +
+		EncodeCommand(toArgs("pttl", "missing")) +
+		EncodeCommand(toArgs("expire", "missing", "100")) +
+		EncodeCommand(toArgs("expire", "session", "100", "xx")) +
+		EncodeCommand(toArgs("expire", "session", "100", "gt")) +
+		EncodeCommand(toArgs("expire", "session", "100", "nx")) +
+		EncodeCommand(toArgs("expire", "session", "200", "nx")) +
+		EncodeCommand(toArgs("ttl", "session")) +
+		EncodeCommand(toArgs("expire", "session", "50", "gt")) +
+		EncodeCommand(toArgs("expire", "session", "200", "gt")) +
+		EncodeCommand(toArgs("expire", "session", "300", "lt")) +
+		EncodeCommand(toArgs("pexpire", "session", "50000", "lt")) +
+		EncodeCommand(toArgs("ttl", "session")) +
+		EncodeCommand(toArgs("persist", "session")) +
+		EncodeCommand(toArgs("persist", "session")) +
+		EncodeCommand(toArgs("expiretime", "session")) +
+		EncodeCommand(toArgs("expire", "session", "100", "lt")) +
+		EncodeCommand(toArgs("ttl", "session")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"+OK\r\n", ":-1\r\n", ":-2\r\n", ":-2\r\n", ":0\r\n", ":0\r\n", ":0\r\n", ":1\r\n", ":0\r\n", ":100\r\n",
+		":0\r\n", ":1\r\n", ":0\r\n", ":1\r\n", ":50\r\n", ":1\r\n", ":0\r\n", ":-1\r\n", ":1\r\n", ":100\r\n",
+	}, val)
+
+	at := time.Now().Unix() + 1000
+	val, err = handler.ParseCommands(
+		EncodeCommand(toArgs("expireat", "session", strconv.FormatInt(at, 10))) +
+		EncodeCommand(toArgs("expiretime", "session")) +
+		EncodeCommand(toArgs("pexpireat", "session", strconv.FormatInt(at * 1000 + 1, 10))) +
+		EncodeCommand(toArgs("pexpiretime", "session")) +
+		EncodeCommand(toArgs("expire", "session", "0")) +
+		EncodeCommand(toArgs("exists", "session")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		":1\r\n", fmt.Sprintf(":%d\r\n", at), ":1\r\n", fmt.Sprintf(":%d\r\n", at * 1000 + 1), ":1\r\n", ":0\r\n",
+	}, val)
+
+	val, err = handler.ParseCommands(
+		EncodeCommand(toArgs("set", "k", "v")) +
+		EncodeCommand(toArgs("expire", "k", "soon")) +
+		EncodeCommand(toArgs("expire", "k", "10", "nx", "xx")) +
+		EncodeCommand(toArgs("expire", "k", "10", "gt", "lt")) +
+		EncodeCommand(toArgs("expire", "k", "10", "later")) +
+		EncodeCommand(toArgs("expire", "k", "9223372036854775807")) +
+		EncodeCommand(toArgs("pexpire", "k", "9223372036854775807")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"+OK\r\n",
+		"-ERR value is not an integer or out of range\r\n",
+		"-ERR NX and XX, GT or LT options at the same time are not compatible\r\n",
+		"-ERR GT and LT options at the same time are not compatible\r\n",
+		"-ERR Unsupported option later\r\n",
+		"-ERR invalid expire time in 'expire' command\r\n",
+		"-ERR invalid expire time in 'pexpire' command\r\n",
+	}, val)
+}
+
+func TestParseCommands_ExpireStream(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	// streams expire like any other key, and adding entries keeps the expiration
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("xadd", "events", "1-1", "a", "b")) +
+		EncodeCommand(toArgs("pexpire", "events", "100")) +
+		EncodeCommand(toArgs("xadd", "events", "1-2", "a", "b")) +
+		EncodeCommand(toArgs("pttl", "events")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"$3\r\n1-1\r\n", ":1\r\n", "$3\r\n1-2\r\n"}, val[:3])
+	assert.NotEqual(t, ":-1\r\n", val[3])
+
+	time.Sleep(150 * time.Millisecond)
+	val, err = handler.ParseCommands(EncodeCommand(toArgs("type", "events")) + EncodeCommand(toArgs("xrange", "events", "-", "+")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"+none\r\n", "*0\r\n"}, val)
+}
+
+func TestParseCommands_ExpirePropagation(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	replica := NewClient(nil)
+	_, err := handler.ParseClientCommands(replica, EncodeCommand(toArgs("psync", "?", "-1")))
+	assert.Nil(t, err)
+	replica.takeReplies()
+
+	handler.ParseCommands(
+		EncodeCommand(toArgs("mset", "a", "1", "b", "2")) +
+		EncodeCommand(toArgs("expire", "a", "100", "nx")) +
+		EncodeCommand(toArgs("expire", "a", "100", "nx")) +
+		EncodeCommand(toArgs("expire", "b", "-1")) +
+		EncodeCommand(toArgs("getex", "a", "persist")),
+	)
+
+	propagated := replica.takeReplies()
+	assert.Equal(t, 5, len(propagated))
+
+	// the absolute time is computed on the master
+	args, err := NewRespReader(strings.NewReader(propagated[2])).ReadCommand()
+	assert.Nil(t, err)
+	assert.Equal(t, toArgs("PEXPIREAT", "a", string(args[2]), "nx"), args)
+	at, err := strconv.ParseInt(string(args[2]), 10, 64)
+	assert.Nil(t, err)
+	assert.InDelta(t, time.Now().UnixMilli() + 100000, at, 1000)
+	assert.Equal(t, []string{EncodeCommand(toArgs("DEL", "b")), EncodeCommand(toArgs("PERSIST", "a"))}, propagated[3:])
+}
+
+func TestParseCommands_ActiveExpire(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	replica := NewClient(nil)
+	_, err := handler.ParseClientCommands(replica, EncodeCommand(toArgs("psync", "?", "-1")))
+	assert.Nil(t, err)
+
+	var request strings.Builder
+	for i := 0; i < 500; i++ {
+		request.WriteString(EncodeCommand(toArgs("set", fmt.Sprintf("session:%d", i), "token", "px", "50")))
+	}
+	request.WriteString(EncodeCommand(toArgs("select", "5")) + EncodeCommand(toArgs("set", "other", "token", "px", "50")))
+	handler.ParseCommands(request.String())
+	handler.ParseCommands(EncodeCommand(toArgs("set", "persistent", "token")))
+
+	// the keys are removed without anybody reading them
+	deadline := time.Now().Add(2 * time.Second)
+	for handler.Store.DB(0).Keyspace.Len() > 1 || handler.Store.DB(5).Keyspace.Len() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expired keys were not removed: %d left", handler.Store.DB(0).Keyspace.Len())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	val, err := handler.ParseCommands(EncodeCommand(toArgs("keys", "*")) + EncodeCommand(toArgs("config", "get", "hz")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"*1\r\n$10\r\npersistent\r\n", "*2\r\n$2\r\nhz\r\n$2\r\n10\r\n"}, val)
+
+	// and replicas are told to delete them
+	propagated := make(map[string]bool)
+	for _, command := range replica.takeReplies() {
+		propagated[command] = true
+	}
+	assert.True(t, propagated[EncodeCommand(toArgs("DEL", "session:42"))])
+	assert.True(t, propagated[EncodeCommand(toArgs("SELECT", "5"))])
+	assert.True(t, propagated[EncodeCommand(toArgs("DEL", "other"))])
+}
+
+func TestParseCommands_KeysSkipsExpired(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	handler.ParseCommands(
+		EncodeCommand(toArgs("set", "fresh", "v")) +
+		EncodeCommand(toArgs("set", "stale", "v", "pxat", strconv.FormatInt(time.Now().UnixMilli() + 20, 10))),
+	)
+	time.Sleep(30 * time.Millisecond)
+
+	val, err := handler.ParseCommands(EncodeCommand(toArgs("keys", "*")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"*1\r\n$5\r\nfresh\r\n"}, val)
+}
+
+func TestParseCommands_KeysPattern(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	handler.ParseCommands(
+		EncodeCommand(toArgs("mset", "user:1:name", "a", "user:2:name", "b", "user:1:mail", "c", "hello", "d", "hallo", "e")) +
+		EncodeCommand(toArgs("xadd", "user:3:name", "1-1", "a", "b")),
+	)
+
+	cases := map[string][]string{
+		"user:*:name": {"user:1:name", "user:2:name", "user:3:name"},
+		"user:1:*": {"user:1:mail", "user:1:name"},
+		"h?llo": {"hallo", "hello"},
+		"h[^e]llo": {"hallo"},
+		"h[a-e]llo": {"hallo", "hello"},
+		"hello": {"hello"},
+		"user:\\*": {},
+		"*": {"hallo", "hello", "user:1:mail", "user:1:name", "user:2:name", "user:3:name"},
+	}
+	for pattern, expected := range cases {
+		val, err := handler.ParseCommands(EncodeCommand(toArgs("keys", pattern)))
+		assert.Nil(t, err)
+
+		args, err := NewRespReader(strings.NewReader(val[0])).ReadCommand()
+		assert.Nil(t, err)
+		keys := make([]string, 0)
+		for _, arg := range args {
+			keys = append(keys, string(arg))
+		}
+		sort.Strings(keys)
+		assert.Equal(t, expected, keys, pattern)
+	}
+}
+
+// scanReplyElements decodes a SCAN reply into its cursor and elements
+func scanReplyElements(t *testing.T, reply string) (string, []string) {
+	lines := strings.Split(strings.TrimSuffix(reply, "\r\n"), "\r\n")
+	assert.Equal(t, "*2", lines[0])
+	elements := make([]string, 0)
+	for i := 5; i < len(lines); i += 2 {
+		elements = append(elements, lines[i])
+	}
+	return lines[2], elements
+}
+
+func scanAll(t *testing.T, handler *Commands, args ...string) []string {
+	cursor := "0"
+	keys := make([]string, 0)
+	for {
+		val, err := handler.ParseCommands(EncodeCommand(toArgs(append([]string{"scan", cursor}, args...)...)))
+		assert.Nil(t, err)
+
+		var found []string
+		cursor, found = scanReplyElements(t, val[0])
+		keys = append(keys, found...)
+		if cursor == "0" {
+			break
+		}
+	}
+
+	sort.Strings(keys)
+	return slices.Compact(keys)
+}
+
+func TestParseCommands_Scan(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	expected := make([]string, 0)
+	for i := 0; i < 300; i++ {
+		key := fmt.Sprintf("key:%d", i)
+		handler.ParseCommands(EncodeCommand(toArgs("set", key, "v")))
+		expected = append(expected, key)
+	}
+	handler.ParseCommands(EncodeCommand(toArgs("xadd", "events", "1-1", "a", "b")))
+	sort.Strings(expected)
+
+	assert.Equal(t, expected, scanAll(t, handler, "count", "7", "type", "string"))
+	assert.Equal(t, 301, len(scanAll(t, handler)))
+	assert.Equal(t, []string{"events"}, scanAll(t, handler, "type", "STREAM"))
+	assert.Equal(t, []string{"key:100", "key:101", "key:102", "key:103", "key:104", "key:105", "key:106", "key:107", "key:108", "key:109"}, scanAll(t, handler, "match", "key:10?", "count", "1000"))
+	assert.Empty(t, scanAll(t, handler, "match", "missing*"))
+	assert.Empty(t, scanAll(t, handler, "type", "hash"))
+
+	// keys present for the whole iteration are returned while the keyspace grows
+	cursor, seen := "0", make(map[string]bool)
+	for i := 0; ; i++ {
+		val, _ := handler.ParseCommands(
+			EncodeCommand(toArgs("scan", cursor, "count", "5")) +
+			EncodeCommand(toArgs("mset", fmt.Sprintf("new:%d:a", i), "v", fmt.Sprintf("new:%d:b", i), "v")),
+		)
+		var found []string
+		cursor, found = scanReplyElements(t, val[0])
+		for _, key := range found {
+			seen[key] = true
+		}
+		if cursor == "0" {
+			break
+		}
+	}
+	for _, key := range expected {
+		assert.True(t, seen[key], key)
+	}
+
+	cases := map[string][]string{
+		"scan abc": {"-ERR invalid cursor\r\n"},
+		"scan -1": {"-ERR invalid cursor\r\n"},
+		"scan 0 count 0": {"-ERR syntax error\r\n"},
+		"scan 0 count x": {"-ERR value is not an integer or out of range\r\n"},
+		"scan 0 match": {"-ERR syntax error\r\n"},
+		"scan 0 type fruit": {"-ERR unknown type name 'fruit'\r\n"},
+		"scan 0 limit 10": {"-ERR syntax error\r\n"},
+		"hscan missing 0": {"*2\r\n$1\r\n0\r\n*0\r\n"},
+		"sscan missing 0 match *": {"*2\r\n$1\r\n0\r\n*0\r\n"},
+		"zscan missing abc": {"-ERR invalid cursor\r\n"},
+		"hscan events 0": {"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		"zscan key:1 0": {"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	}
+	for command, expected := range cases {
+		val, err := handler.ParseCommands(EncodeCommand(toArgs(strings.Fields(command)...)))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, val, command)
+	}
+}
+
+func TestParseCommands_Lists(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("rpush", "jobs", "b", "c", "d")) +
+		EncodeCommand(toArgs("lpush", "jobs", "a", "z")) +
+		EncodeCommand(toArgs("lpushx", "missing", "a")) +
+		EncodeCommand(toArgs("type", "jobs")) +
+		EncodeCommand(toArgs("llen", "jobs")) +
+		EncodeCommand(toArgs("lrange", "jobs", "0", "-1")) +
+		EncodeCommand(toArgs("lrange", "jobs", "-2", "100")) +
+		EncodeCommand(toArgs("lrange", "jobs", "3", "1")) +
+		EncodeCommand(toArgs("lindex", "jobs", "-1")) +
+		EncodeCommand(toArgs("lindex", "jobs", "5")) +
+		EncodeCommand(toArgs("lpop", "jobs")) +
+		EncodeCommand(toArgs("rpop", "jobs", "2")) +
+		EncodeCommand(toArgs("lpop", "jobs", "0")) +
+		EncodeCommand(toArgs("lpop", "missing")) +
+		EncodeCommand(toArgs("lpop", "missing", "2")) +
+		EncodeCommand(toArgs("lpop", "jobs", "-1")) +
+		EncodeCommand(toArgs("rpop", "jobs", "10")) +
+		EncodeCommand(toArgs("exists", "jobs")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		":3\r\n", ":5\r\n", ":0\r\n", "+list\r\n", ":5\r\n",
+		"*5\r\n$1\r\nz\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nd\r\n",
+		"*2\r\n$1\r\nc\r\n$1\r\nd\r\n", "*0\r\n",
+		"$1\r\nd\r\n", "$-1\r\n",
+		"$1\r\nz\r\n", "*2\r\n$1\r\nd\r\n$1\r\nc\r\n", "*0\r\n", "$-1\r\n", "*-1\r\n",
+		"-ERR value is out of range, must be positive\r\n",
+		"*2\r\n$1\r\nb\r\n$1\r\na\r\n",
+		// the list is deleted once empty
+		":0\r\n",
+	}, val)
+
+	val, err = handler.ParseCommands(
+		EncodeCommand(toArgs("rpush", "l", "a", "b", "c", "b", "a", "b")) +
+		EncodeCommand(toArgs("lset", "l", "-1", "x")) +
+		EncodeCommand(toArgs("lset", "l", "6", "x")) +
+		EncodeCommand(toArgs("lset", "missing", "0", "x")) +
+		EncodeCommand(toArgs("linsert", "l", "before", "c", "y")) +
+		EncodeCommand(toArgs("linsert", "l", "AFTER", "x", "z")) +
+		EncodeCommand(toArgs("linsert", "l", "after", "nope", "z")) +
+		EncodeCommand(toArgs("linsert", "missing", "after", "a", "z")) +
+		EncodeCommand(toArgs("linsert", "l", "around", "a", "z")) +
+		EncodeCommand(toArgs("lrange", "l", "0", "-1")) +
+		EncodeCommand(toArgs("lrem", "l", "-1", "a")) +
+		EncodeCommand(toArgs("lrem", "l", "0", "b")) +
+		EncodeCommand(toArgs("lrange", "l", "0", "-1")) +
+		EncodeCommand(toArgs("ltrim", "l", "1", "-2")) +
+		EncodeCommand(toArgs("lrange", "l", "0", "-1")) +
+		EncodeCommand(toArgs("ltrim", "l", "5", "10")) +
+		EncodeCommand(toArgs("exists", "l")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		":6\r\n", "+OK\r\n", "-ERR index out of range\r\n", "-ERR no such key\r\n",
+		":7\r\n", ":8\r\n", ":-1\r\n", ":0\r\n", "-ERR syntax error\r\n",
+		"*8\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\ny\r\n$1\r\nc\r\n$1\r\nb\r\n$1\r\na\r\n$1\r\nx\r\n$1\r\nz\r\n",
+		":1\r\n", ":2\r\n",
+		"*5\r\n$1\r\na\r\n$1\r\ny\r\n$1\r\nc\r\n$1\r\nx\r\n$1\r\nz\r\n",
+		"+OK\r\n", "*3\r\n$1\r\ny\r\n$1\r\nc\r\n$1\r\nx\r\n",
+		"+OK\r\n", ":0\r\n",
+	}, val)
+
+	val, err = handler.ParseCommands(
+		EncodeCommand(toArgs("rpush", "pos", "a", "b", "c", "1", "2", "3", "c", "c")) +
+		EncodeCommand(toArgs("lpos", "pos", "c")) +
+		EncodeCommand(toArgs("lpos", "pos", "c", "rank", "2")) +
+		EncodeCommand(toArgs("lpos", "pos", "c", "rank", "-1")) +
+		EncodeCommand(toArgs("lpos", "pos", "c", "count", "2")) +
+		EncodeCommand(toArgs("lpos", "pos", "c", "count", "0", "rank", "-2")) +
+		EncodeCommand(toArgs("lpos", "pos", "c", "count", "0", "maxlen", "3")) +
+		EncodeCommand(toArgs("lpos", "pos", "x")) +
+		EncodeCommand(toArgs("lpos", "pos", "x", "count", "1")) +
+		EncodeCommand(toArgs("lpos", "pos", "c", "rank", "0")) +
+		EncodeCommand(toArgs("lpos", "pos", "c", "count", "-1")) +
+		EncodeCommand(toArgs("lpos", "pos", "c", "maxlen")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		":8\r\n", ":2\r\n", ":6\r\n", ":7\r\n",
+		"*2\r\n:2\r\n:6\r\n", "*2\r\n:6\r\n:2\r\n", "*1\r\n:2\r\n",
+		"$-1\r\n", "*0\r\n",
+		"-ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list\r\n",
+		"-ERR COUNT can't be negative\r\n", "-ERR syntax error\r\n",
+	}, val)
+
+	val, err = handler.ParseCommands(
+		EncodeCommand(toArgs("rpush", "src", "1", "2", "3")) +
+		EncodeCommand(toArgs("lmove", "src", "dst", "left", "right")) +
+		EncodeCommand(toArgs("lmove", "src", "dst", "RIGHT", "LEFT")) +
+		EncodeCommand(toArgs("lmove", "src", "src", "left", "right")) +
+		EncodeCommand(toArgs("lrange", "dst", "0", "-1")) +
+		EncodeCommand(toArgs("lmove", "src", "dst", "up", "left")) +
+		EncodeCommand(toArgs("set", "str", "v")) +
+		EncodeCommand(toArgs("lmove", "dst", "str", "left", "left")) +
+		EncodeCommand(toArgs("lmove", "missing", "str", "left", "left")) +
+		EncodeCommand(toArgs("lmove", "missing", "dst", "left", "left")) +
+		EncodeCommand(toArgs("lpush", "str", "a")) +
+		EncodeCommand(toArgs("llen", "dst")) +
+		EncodeCommand(toArgs("get", "dst")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		":3\r\n", "$1\r\n1\r\n", "$1\r\n3\r\n", "$1\r\n2\r\n",
+		"*2\r\n$1\r\n3\r\n$1\r\n1\r\n",
+		"-ERR syntax error\r\n", "+OK\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		"$-1\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		":2\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+	}, val)
+}
+
+// a list big enough to span many quicklist nodes
+func TestParseCommands_LongList(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	for i := 0; i < 1000; i++ {
+		handler.ParseCommands(EncodeCommand(toArgs("rpush", "long", strconv.Itoa(i))))
+	}
+
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("lindex", "long", "500")) +
+		EncodeCommand(toArgs("lrange", "long", "-3", "-1")) +
+		EncodeCommand(toArgs("linsert", "long", "before", "700", "x")) +
+		EncodeCommand(toArgs("lindex", "long", "700")) +
+		EncodeCommand(toArgs("ltrim", "long", "100", "-101")) +
+		EncodeCommand(toArgs("llen", "long")) +
+		EncodeCommand(toArgs("lpos", "long", "999")) +
+		EncodeCommand(toArgs("lpos", "long", "899")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"$3\r\n500\r\n", "*3\r\n$3\r\n997\r\n$3\r\n998\r\n$3\r\n999\r\n",
+		":1001\r\n", "$1\r\nx\r\n",
+		"+OK\r\n", ":801\r\n", "$-1\r\n", ":800\r\n",
+	}, val)
+}
+
+func TestParseCommands_Hashes(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("hset", "user", "name", "ada", "lang", "go")) +
+		EncodeCommand(toArgs("hset", "user", "name", "grace", "born", "1906")) +
+		EncodeCommand(toArgs("hset", "user", "odd")) +
+		EncodeCommand(toArgs("hsetnx", "user", "name", "linus")) +
+		EncodeCommand(toArgs("hsetnx", "user", "city", "nyc")) +
+		EncodeCommand(toArgs("type", "user")) +
+		EncodeCommand(toArgs("hget", "user", "name")) +
+		EncodeCommand(toArgs("hget", "user", "missing")) +
+		EncodeCommand(toArgs("hmget", "user", "lang", "missing", "born")) +
+		EncodeCommand(toArgs("hlen", "user")) +
+		EncodeCommand(toArgs("hexists", "user", "city")) +
+		EncodeCommand(toArgs("hstrlen", "user", "name")) +
+		EncodeCommand(toArgs("hstrlen", "user", "missing")) +
+		EncodeCommand(toArgs("hgetall", "user")) +
+		EncodeCommand(toArgs("hkeys", "user")) +
+		EncodeCommand(toArgs("hvals", "missing")) +
+		EncodeCommand(toArgs("hdel", "user", "lang", "missing", "city")) +
+		EncodeCommand(toArgs("hgetall", "user")) +
+		EncodeCommand(toArgs("hmset", "user", "lang", "go")) +
+		EncodeCommand(toArgs("set", "str", "x")) +
+		EncodeCommand(toArgs("hget", "str", "x")) +
+		EncodeCommand(toArgs("get", "user")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		":2\r\n", ":1\r\n",
+		"-ERR wrong number of arguments for 'hset' command\r\n",
+		":0\r\n", ":1\r\n", "+hash\r\n",
+		"$5\r\ngrace\r\n", "$-1\r\n",
+		"*3\r\n$2\r\ngo\r\n$-1\r\n$4\r\n1906\r\n",
+		":4\r\n", ":1\r\n", ":5\r\n", ":0\r\n",
+		"*8\r\n$4\r\nname\r\n$5\r\ngrace\r\n$4\r\nlang\r\n$2\r\ngo\r\n$4\r\nborn\r\n$4\r\n1906\r\n$4\r\ncity\r\n$3\r\nnyc\r\n",
+		"*4\r\n$4\r\nname\r\n$4\r\nlang\r\n$4\r\nborn\r\n$4\r\ncity\r\n",
+		"*0\r\n",
+		":2\r\n",
+		"*4\r\n$4\r\nname\r\n$5\r\ngrace\r\n$4\r\nborn\r\n$4\r\n1906\r\n",
+		"+OK\r\n",
+		"+OK\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+	}, val)
+
+	val, err = handler.ParseCommands(
+		EncodeCommand(toArgs("hincrby", "counters", "hits", "5")) +
+		EncodeCommand(toArgs("hincrby", "counters", "hits", "-7")) +
+		EncodeCommand(toArgs("hincrby", "counters", "hits", "x")) +
+		EncodeCommand(toArgs("hset", "counters", "name", "ada", "max", "9223372036854775807")) +
+		EncodeCommand(toArgs("hincrby", "counters", "name", "1")) +
+		EncodeCommand(toArgs("hincrby", "counters", "max", "1")) +
+		EncodeCommand(toArgs("hincrbyfloat", "counters", "ratio", "0.5")) +
+		EncodeCommand(toArgs("hincrbyfloat", "counters", "ratio", "1e2")) +
+		EncodeCommand(toArgs("hincrbyfloat", "counters", "name", "1")) +
+		EncodeCommand(toArgs("hincrbyfloat", "counters", "ratio", "nope")) +
+		EncodeCommand(toArgs("hincrbyfloat", "counters", "sum", "0.1")) +
+		EncodeCommand(toArgs("hincrbyfloat", "counters", "sum", "0.2")) +
+		EncodeCommand(toArgs("hdel", "counters", "hits", "name", "max", "ratio", "sum")) +
+		EncodeCommand(toArgs("exists", "counters")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		":5\r\n", ":-2\r\n",
+		"-ERR value is not an integer or out of range\r\n",
+		":2\r\n",
+		"-ERR hash value is not an integer\r\n",
+		"-ERR increment or decrement would overflow\r\n",
+		"$3\r\n0.5\r\n", "$5\r\n100.5\r\n",
+		"-ERR hash value is not a float\r\n",
+		"-ERR value is not a valid float\r\n",
+		// added in a long double, as redis does
+		"$3\r\n0.1\r\n", "$3\r\n0.3\r\n",
+		// the hash is deleted once empty
+		":5\r\n", ":0\r\n",
+	}, val)
+
+	val, err = handler.ParseCommands(
+		EncodeCommand(toArgs("hset", "h", "a", "1", "b", "2", "c", "3")) +
+		EncodeCommand(toArgs("hrandfield", "h", "0")) +
+		EncodeCommand(toArgs("hrandfield", "missing")) +
+		EncodeCommand(toArgs("hrandfield", "missing", "3")) +
+		EncodeCommand(toArgs("hrandfield", "h", "1", "nope")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{":3\r\n", "*0\r\n", "$-1\r\n", "*0\r\n", "-ERR syntax error\r\n"}, val)
+
+	// positive counts return distinct fields, negative ones may repeat them
+	val, _ = handler.ParseCommands(EncodeCommand(toArgs("hrandfield", "h", "10")))
+	fields, err := NewRespReader(strings.NewReader(val[0])).ReadCommand()
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, toArgs("a", "b", "c"), fields)
+	val, _ = handler.ParseCommands(EncodeCommand(toArgs("hrandfield", "h", "-10", "withvalues")))
+	pairs, err := NewRespReader(strings.NewReader(val[0])).ReadCommand()
+	assert.Nil(t, err)
+	assert.Equal(t, 20, len(pairs))
+	for i := 0; i < len(pairs); i += 2 {
+		assert.Equal(t, string(pairs[i][0] - 'a' + '1'), string(pairs[i + 1]))
+	}
+}
+
+func TestParseCommands_HashEncoding(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	var request strings.Builder
+	for i := 0; i < 300; i++ {
+		request.WriteString(EncodeCommand(toArgs("hset", "big", fmt.Sprintf("field:%d", i), strconv.Itoa(i))))
+	}
+	handler.ParseCommands(request.String())
+
+	obj, _ := handler.Store.DB(0).Keyspace.Lookup("big")
+	assert.Equal(t, store.HashEncodingHashtable, obj.Value.(*store.Hash).Encoding())
+
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("hlen", "big")) +
+		EncodeCommand(toArgs("hget", "big", "field:299")) +
+		EncodeCommand(toArgs("config", "get", "hash-max-listpack-entries")) +
+		EncodeCommand(toArgs("config", "get", "hash-max-listpack-value")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		":300\r\n", "$3\r\n299\r\n",
+		"*2\r\n$25\r\nhash-max-listpack-entries\r\n$3\r\n128\r\n",
+		"*2\r\n$23\r\nhash-max-listpack-value\r\n$2\r\n64\r\n",
+	}, val)
+
+	// HSCAN returns every field once, with its value
+	cursor := "0"
+	found := make(map[string]string)
+	for {
+		val, err := handler.ParseCommands(EncodeCommand(toArgs("hscan", "big", cursor, "match", "field:1?", "count", "5")))
+		assert.Nil(t, err)
+
+		var elements []string
+		cursor, elements = scanReplyElements(t, val[0])
+		for i := 0; i < len(elements); i += 2 {
+			found[elements[i]] = elements[i + 1]
+		}
+		if cursor == "0" {
+			break
+		}
+	}
+	assert.Equal(t, 10, len(found))
+	for field, value := range found {
+		assert.Equal(t, "field:" + value, field)
+	}
+}
+
+func TestParseCommands_HashFieldExpiration(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	replica := NewClient(nil)
+	_, err := handler.ParseClientCommands(replica, EncodeCommand(toArgs("psync", "?", "-1")))
+	assert.Nil(t, err)
+	replica.takeReplies()
+
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("hset", "session", "token", "t", "user", "u", "flag", "f")) +
+		EncodeCommand(toArgs("hexpire", "session", "100", "fields", "2", "token", "missing")) +
+		EncodeCommand(toArgs("hexpire", "session", "200", "nx", "fields", "2", "token", "user")) +
+		EncodeCommand(toArgs("hexpire", "session", "50", "gt", "fields", "2", "token", "flag")) +
+		EncodeCommand(toArgs("hexpire", "session", "50", "lt", "fields", "2", "token", "flag")) +
+		EncodeCommand(toArgs("httl", "session", "fields", "3", "token", "user", "missing")) +
+		EncodeCommand(toArgs("hpersist", "session", "fields", "2", "flag", "user")) +
+		EncodeCommand(toArgs("httl", "missing", "fields", "1", "a")) +
+		EncodeCommand(toArgs("hexpire", "session", "0", "fields", "1", "token")) +
+		EncodeCommand(toArgs("hexists", "session", "token")) +
+		EncodeCommand(toArgs("hexpire", "session", "10", "fields", "2", "flag")) +
+		EncodeCommand(toArgs("hexpire", "session", "10", "fields", "0", "flag")) +
+		EncodeCommand(toArgs("hexpire", "session", "10", "flag", "user", "token")) +
+		EncodeCommand(toArgs("hexpire", "session", "-1", "fields", "1", "flag")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		":3\r\n",
+		"*2\r\n:1\r\n:-2\r\n",
+		"*2\r\n:0\r\n:1\r\n",
+		// no expiration counts as never expiring
+		"*2\r\n:0\r\n:0\r\n",
+		"*2\r\n:1\r\n:1\r\n",
+		"*3\r\n:50\r\n:200\r\n:-2\r\n",
+		"*2\r\n:1\r\n:1\r\n",
+		"*1\r\n:-2\r\n",
+		"*1\r\n:2\r\n", ":0\r\n",
+		"-ERR The `numfields` parameter must match the number of arguments\r\n",
+		"-ERR Parameter `numFields` should be greater than 0\r\n",
+		"-ERR Mandatory argument FIELDS is missing or not at the right position\r\n",
+		"-ERR invalid expire time, must be >= 0 && <= 281474976710655\r\n",
+	}, val)
+
+	// replicas receive absolute expirations, and deletions for past ones
+	propagated := replica.takeReplies()
+	assert.Equal(t, 7, len(propagated))
+	args, err := NewRespReader(strings.NewReader(propagated[2])).ReadCommand()
+	assert.Nil(t, err)
+	assert.Equal(t, toArgs("HPEXPIREAT", "session", string(args[2]), "FIELDS", "1", "token"), args)
+	at, err := strconv.ParseInt(string(args[2]), 10, 64)
+	assert.Nil(t, err)
+	assert.InDelta(t, time.Now().UnixMilli() + 100000, at, 1000)
+	assert.Equal(t, []string{
+		EncodeCommand(toArgs("hpersist", "session", "fields", "2", "flag", "user")),
+		EncodeCommand(toArgs("HDEL", "session", "token")),
+	}, propagated[5:])
+
+	// fields are removed without anybody reading them, and the hash with them
+	handler.ParseCommands(
+		EncodeCommand(toArgs("hpexpire", "session", "20", "fields", "2", "user", "flag")) +
+		EncodeCommand(toArgs("hset", "kept", "a", "1", "b", "2")) +
+		EncodeCommand(toArgs("hpexpire", "kept", "20", "fields", "1", "a")),
+	)
+	replica.takeReplies()
+	deadline := time.Now().Add(2 * time.Second)
+	for handler.Store.DB(0).Keyspace.Len() > 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("expired fields were not removed")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	val, err = handler.ParseCommands(EncodeCommand(toArgs("hgetall", "kept")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"*2\r\n$1\r\nb\r\n$1\r\n2\r\n"}, val)
+
+	propagated = make([]string, 0)
+	deadline = time.Now().Add(2 * time.Second)
+	for len(propagated) < 2 && time.Now().Before(deadline) {
+		propagated = append(propagated, replica.takeReplies()...)
+		time.Sleep(20 * time.Millisecond)
+	}
+	assert.Contains(t, propagated, EncodeCommand(toArgs("HDEL", "kept", "a")))
+}
+
+func TestParseCommands_Sets(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("sadd", "ids", "3", "1", "2", "3")) +
+		EncodeCommand(toArgs("sadd", "ids", "1")) +
+		EncodeCommand(toArgs("type", "ids")) +
+		EncodeCommand(toArgs("get", "ids")) +
+		EncodeCommand(toArgs("smembers", "ids")) +
+		EncodeCommand(toArgs("scard", "ids")) +
+		EncodeCommand(toArgs("sismember", "ids", "2")) +
+		EncodeCommand(toArgs("sismember", "ids", "02")) +
+		EncodeCommand(toArgs("smismember", "ids", "1", "4", "3")) +
+		EncodeCommand(toArgs("srem", "ids", "1", "4")) +
+		EncodeCommand(toArgs("smembers", "missing")) +
+		EncodeCommand(toArgs("smove", "ids", "tags", "2")) +
+		EncodeCommand(toArgs("smove", "ids", "tags", "2")) +
+		EncodeCommand(toArgs("smove", "missing", "tags", "2")) +
+		EncodeCommand(toArgs("set", "str", "x")) +
+		EncodeCommand(toArgs("smove", "tags", "str", "2")) +
+		EncodeCommand(toArgs("sadd", "str", "x")) +
+		EncodeCommand(toArgs("srem", "ids", "3")) +
+		EncodeCommand(toArgs("exists", "ids")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		":3\r\n", ":0\r\n", "+set\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		// sets of integers come out sorted
+		"*3\r\n$1\r\n1\r\n$1\r\n2\r\n$1\r\n3\r\n",
+		":3\r\n", ":1\r\n", ":0\r\n",
+		"*3\r\n:1\r\n:0\r\n:1\r\n",
+		":1\r\n", "*0\r\n",
+		":1\r\n", ":0\r\n", ":0\r\n",
+		"+OK\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		// the set is deleted once empty
+		":1\r\n", ":0\r\n",
+	}, val)
+
+	obj, _ := handler.Store.DB(0).Keyspace.Lookup("tags")
+	assert.Equal(t, store.SetEncodingIntset, obj.Value.(*store.Set).Encoding())
+	handler.ParseCommands(EncodeCommand(toArgs("sadd", "tags", "go")))
+	assert.Equal(t, store.SetEncodingHashtable, obj.Value.(*store.Set).Encoding())
+
+	val, err = handler.ParseCommands(
+		EncodeCommand(toArgs("sadd", "a", "1", "2", "3", "x")) +
+		EncodeCommand(toArgs("sadd", "b", "2", "3", "4")) +
+		EncodeCommand(toArgs("sadd", "c", "3", "x")) +
+		EncodeCommand(toArgs("sinter", "a", "b", "c")) +
+		EncodeCommand(toArgs("sinter", "a", "missing")) +
+		EncodeCommand(toArgs("sinter", "missing", "str")) +
+		EncodeCommand(toArgs("sintercard", "2", "a", "b")) +
+		EncodeCommand(toArgs("sintercard", "2", "a", "b", "limit", "1")) +
+		EncodeCommand(toArgs("sintercard", "2", "a", "b", "limit", "0")) +
+		EncodeCommand(toArgs("sintercard", "0", "a")) +
+		EncodeCommand(toArgs("sintercard", "3", "a", "b")) +
+		EncodeCommand(toArgs("sintercard", "1", "a", "limit", "-1")) +
+		EncodeCommand(toArgs("sintercard", "1", "a", "nope")) +
+		EncodeCommand(toArgs("sdiffstore", "d", "a", "b")) +
+		EncodeCommand(toArgs("smismember", "d", "1", "2", "x")) +
+		EncodeCommand(toArgs("sunionstore", "str", "b", "c")) +
+		EncodeCommand(toArgs("scard", "str")) +
+		EncodeCommand(toArgs("sinterstore", "str", "b", "missing")) +
+		EncodeCommand(toArgs("exists", "str")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		":4\r\n", ":3\r\n", ":2\r\n",
+		"*1\r\n$1\r\n3\r\n", "*0\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		":2\r\n", ":1\r\n", ":2\r\n",
+		"-ERR numkeys should be greater than 0\r\n",
+		"-ERR Number of keys can't be greater than number of args\r\n",
+		"-ERR LIMIT can't be negative\r\n",
+		"-ERR syntax error\r\n",
+		":2\r\n", "*3\r\n:1\r\n:0\r\n:1\r\n",
+		// the destination is replaced whatever its type, and deleted when empty
+		":4\r\n", ":4\r\n", ":0\r\n", ":0\r\n",
+	}, val)
+
+	val, err = handler.ParseCommands(EncodeCommand(toArgs("sunion", "a", "b")))
+	assert.Nil(t, err)
+	union, err := NewRespReader(strings.NewReader(val[0])).ReadCommand()
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, toArgs("1", "2", "3", "4", "x"), union)
+
+	// positive counts return distinct members, negative ones may repeat them
+	val, err = handler.ParseCommands(
+		EncodeCommand(toArgs("srandmember", "missing")) +
+		EncodeCommand(toArgs("srandmember", "missing", "-3")) +
+		EncodeCommand(toArgs("srandmember", "a", "0")) +
+		EncodeCommand(toArgs("srandmember", "a", "x")) +
+		EncodeCommand(toArgs("srandmember", "a", "10")) +
+		EncodeCommand(toArgs("srandmember", "a", "-10")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"$-1\r\n", "*0\r\n", "*0\r\n", "-ERR value is not an integer or out of range\r\n"}, val[:4])
+	members, err := NewRespReader(strings.NewReader(val[4])).ReadCommand()
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, toArgs("1", "2", "3", "x"), members)
+	members, err = NewRespReader(strings.NewReader(val[5])).ReadCommand()
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(members))
+	for _, member := range members {
+		assert.Contains(t, toArgs("1", "2", "3", "x"), member)
+	}
+}
+
+func TestParseCommands_SetPop(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	replica := NewClient(nil)
+	_, err := handler.ParseClientCommands(replica, EncodeCommand(toArgs("psync", "?", "-1")))
+	assert.Nil(t, err)
+	replica.takeReplies()
+
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("sadd", "s", "a")) +
+		EncodeCommand(toArgs("spop", "s")) +
+		EncodeCommand(toArgs("spop", "s")) +
+		EncodeCommand(toArgs("spop", "s", "2")) +
+		EncodeCommand(toArgs("spop", "s", "-1")) +
+		EncodeCommand(toArgs("sadd", "s", "a", "b", "c")) +
+		EncodeCommand(toArgs("spop", "s", "0")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		":1\r\n", "$1\r\na\r\n", "$-1\r\n", "*0\r\n",
+		"-ERR value is out of range, must be positive\r\n",
+		":3\r\n", "*0\r\n",
+	}, val)
+
+	val, err = handler.ParseCommands(EncodeCommand(toArgs("spop", "s", "2")) + EncodeCommand(toArgs("smembers", "s")))
+	assert.Nil(t, err)
+	popped, err := NewRespReader(strings.NewReader(val[0])).ReadCommand()
+	assert.Nil(t, err)
+	left, err := NewRespReader(strings.NewReader(val[1])).ReadCommand()
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, toArgs("a", "b", "c"), append(popped, left...))
+
+	// replicas remove the members picked on the master
+	assert.Equal(t, []string{
+		EncodeCommand(toArgs("SELECT", "0")),
+		EncodeCommand(toArgs("sadd", "s", "a")), EncodeCommand(toArgs("SREM", "s", "a")),
+		EncodeCommand(toArgs("sadd", "s", "a", "b", "c")),
+		EncodeCommand(toArgs(append([]string{"SREM", "s"}, string(popped[0]), string(popped[1]))...)),
+	}, replica.takeReplies())
+
+	// SSCAN returns every member once
+	var request strings.Builder
+	for i := 0; i < 1000; i++ {
+		request.WriteString(EncodeCommand(toArgs("sadd", "big", fmt.Sprintf("member:%d", i))))
+	}
+	handler.ParseCommands(request.String())
+	cursor := "0"
+	found := make(map[string]int)
+	for {
+		val, err := handler.ParseCommands(EncodeCommand(toArgs("sscan", "big", cursor, "match", "member:1*")))
+		assert.Nil(t, err)
+
+		var elements []string
+		cursor, elements = scanReplyElements(t, val[0])
+		for _, element := range elements {
+			found[element]++
+		}
+		if cursor == "0" {
+			break
+		}
+	}
+	assert.Equal(t, 111, len(found))
+}
+
+func TestParseCommands_SortedSets(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("zadd", "z", "1", "a", "2", "b", "3", "c")) +
+		EncodeCommand(toArgs("zadd", "z", "ch", "5", "a", "4", "d")) +
+		EncodeCommand(toArgs("zadd", "z", "nx", "0", "a")) +
+		EncodeCommand(toArgs("zadd", "z", "xx", "ch", "0", "e")) +
+		EncodeCommand(toArgs("zadd", "z", "gt", "ch", "1", "a")) +
+		EncodeCommand(toArgs("zadd", "z", "lt", "ch", "1", "a")) +
+		EncodeCommand(toArgs("zadd", "z", "incr", "1.5", "b")) +
+		EncodeCommand(toArgs("zadd", "z", "nx", "incr", "1", "b")) +
+		EncodeCommand(toArgs("zadd", "z", "nx", "xx", "1", "b")) +
+		EncodeCommand(toArgs("zadd", "z", "gt", "lt", "1", "b")) +
+		EncodeCommand(toArgs("zadd", "z", "incr", "1", "b", "2", "c")) +
+		EncodeCommand(toArgs("zadd", "z", "1", "b", "2")) +
+		EncodeCommand(toArgs("zadd", "z", "nan", "b")) +
+		EncodeCommand(toArgs("zincrby", "z", "-inf", "x")) +
+		EncodeCommand(toArgs("zincrby", "z", "+inf", "x")) +
+		EncodeCommand(toArgs("zrem", "z", "x", "y")) +
+		EncodeCommand(toArgs("zcard", "z")) +
+		EncodeCommand(toArgs("get", "z")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		":3\r\n", ":2\r\n", ":0\r\n", ":0\r\n", ":0\r\n", ":1\r\n",
+		"$3\r\n3.5\r\n", "$-1\r\n",
+		"-ERR XX and NX options at the same time are not compatible\r\n",
+		"-ERR GT, LT, and/or NX options at the same time are not compatible\r\n",
+		"-ERR INCR option supports a single increment-element pair\r\n",
+		"-ERR syntax error\r\n",
+		"-ERR value is not a valid float\r\n",
+		"$4\r\n-inf\r\n",
+		"-ERR resulting score is not a number (NaN)\r\n",
+		":1\r\n", ":4\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+	}, val)
+
+	// a: 1, c: 3, b: 3.5, d: 4
+	val, err = handler.ParseCommands(
+		EncodeCommand(toArgs("zscore", "z", "b")) +
+		EncodeCommand(toArgs("zscore", "z", "x")) +
+		EncodeCommand(toArgs("zmscore", "z", "a", "x")) +
+		EncodeCommand(toArgs("zrank", "z", "c")) +
+		EncodeCommand(toArgs("zrevrank", "z", "c", "withscore")) +
+		EncodeCommand(toArgs("zrank", "z", "x", "withscore")) +
+		EncodeCommand(toArgs("zrank", "z", "c", "withscores")) +
+		EncodeCommand(toArgs("zcount", "z", "(1", "+inf")) +
+		EncodeCommand(toArgs("zcount", "z", "x", "1")) +
+		EncodeCommand(toArgs("zrange", "z", "0", "-1")) +
+		EncodeCommand(toArgs("zrange", "z", "-2", "-1", "rev", "withscores")) +
+		EncodeCommand(toArgs("zrange", "z", "(1", "4", "byscore", "limit", "1", "1", "withscores")) +
+		EncodeCommand(toArgs("zrange", "z", "+inf", "3.5", "byscore", "rev")) +
+		EncodeCommand(toArgs("zrange", "z", "0", "-1", "limit", "0", "1")) +
+		EncodeCommand(toArgs("zrange", "z", "-", "+", "bylex", "withscores")) +
+		EncodeCommand(toArgs("zrange", "z", "a", "b", "bylex")) +
+		EncodeCommand(toArgs("zrange", "z", "a", "b", "byscore")) +
+		EncodeCommand(toArgs("zrange", "missing", "0", "-1")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"$3\r\n3.5\r\n", "$-1\r\n", "*2\r\n$1\r\n1\r\n$-1\r\n",
+		":1\r\n", "*2\r\n:2\r\n$1\r\n3\r\n", "*-1\r\n", "-ERR syntax error\r\n",
+		":3\r\n", "-ERR min or max is not a float\r\n",
+		"*4\r\n$1\r\na\r\n$1\r\nc\r\n$1\r\nb\r\n$1\r\nd\r\n",
+		"*4\r\n$1\r\nc\r\n$1\r\n3\r\n$1\r\na\r\n$1\r\n1\r\n",
+		"*2\r\n$1\r\nb\r\n$3\r\n3.5\r\n",
+		"*2\r\n$1\r\nd\r\n$1\r\nb\r\n",
+		"-ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX\r\n",
+		"-ERR syntax error, WITHSCORES not supported in combination with BYLEX\r\n",
+		"-ERR min or max not valid string range item\r\n",
+		"-ERR min or max is not a float\r\n",
+		"*0\r\n",
+	}, val)
+
+	// RESP3 replies with doubles, and with pairs for WITHSCORES
+	client := NewClient(nil)
+	val, err = handler.ParseClientCommands(client,
+		EncodeCommand(toArgs("hello", "3")) +
+		EncodeCommand(toArgs("zscore", "z", "b")) +
+		EncodeCommand(toArgs("zrange", "z", "0", "0", "withscores")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{",3.5\r\n", "*1\r\n*2\r\n$1\r\na\r\n,1\r\n"}, val[1:])
+
+	// ZSCAN returns every member once, with its score
+	var request strings.Builder
+	for i := 0; i < 1000; i++ {
+		request.WriteString(EncodeCommand(toArgs("zadd", "big", fmt.Sprint(i), fmt.Sprintf("member:%d", i))))
+	}
+	handler.ParseCommands(request.String())
+	cursor := "0"
+	found := make(map[string]string)
+	for {
+		val, err := handler.ParseCommands(EncodeCommand(toArgs("zscan", "big", cursor, "match", "member:1*")))
+		assert.Nil(t, err)
+
+		var elements []string
+		cursor, elements = scanReplyElements(t, val[0])
+		for i := 0; i + 1 < len(elements); i += 2 {
+			assert.NotContains(t, found, elements[i])
+			found[elements[i]] = elements[i + 1]
+		}
+		if cursor == "0" {
+			break
+		}
+	}
+	assert.Equal(t, 111, len(found))
+	assert.Equal(t, "123", found["member:123"])
+
+	// millisecond timestamps, as delay queues use them, are printed in full
+	val, err = handler.ParseCommands(
+		EncodeCommand(toArgs("zadd", "delayed", "1234567", "a", "1700000000000", "b")) +
+		EncodeCommand(toArgs("zrange", "delayed", "0", "-1", "withscores")) +
+		EncodeCommand(toArgs("zincrby", "delayed", "0.5", "b")) +
+		EncodeCommand(toArgs("zadd", "delayed", "1e20", "c")) +
+		EncodeCommand(toArgs("zscore", "delayed", "c")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		":2\r\n",
+		"*4\r\n$1\r\na\r\n$7\r\n1234567\r\n$1\r\nb\r\n$13\r\n1700000000000\r\n",
+		"$15\r\n1700000000000.5\r\n",
+		":1\r\n", "$5\r\n1e+20\r\n",
+	}, val)
+}
+
+func TestParseCommands_SortedSetAlgebra(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("zadd", "a", "1", "x", "2", "y", "3", "z")) +
+		EncodeCommand(toArgs("zadd", "b", "10", "y", "20", "z", "5", "w")) +
+		EncodeCommand(toArgs("zunion", "2", "a", "b", "withscores")) +
+		EncodeCommand(toArgs("zinter", "2", "a", "b", "weights", "1", "0.5", "aggregate", "min", "withscores")) +
+		EncodeCommand(toArgs("zdiff", "2", "a", "b")) +
+		EncodeCommand(toArgs("zunionstore", "dst", "2", "a", "b", "aggregate", "max")) +
+		EncodeCommand(toArgs("zrange", "dst", "0", "-1", "withscores")) +
+		EncodeCommand(toArgs("zinterstore", "dst", "2", "a", "missing")) +
+		EncodeCommand(toArgs("exists", "dst")) +
+		EncodeCommand(toArgs("zdiffstore", "dst", "1", "a")) +
+		EncodeCommand(toArgs("zrangestore", "dst2", "dst", "(1", "+inf", "byscore", "limit", "0", "1")) +
+		EncodeCommand(toArgs("zrange", "dst2", "0", "-1", "withscores")) +
+		EncodeCommand(toArgs("zrangestore", "dst2", "dst", "0", "-1", "withscores")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		":3\r\n", ":3\r\n",
+		"*8\r\n$1\r\nx\r\n$1\r\n1\r\n$1\r\nw\r\n$1\r\n5\r\n$1\r\ny\r\n$2\r\n12\r\n$1\r\nz\r\n$2\r\n23\r\n",
+		"*4\r\n$1\r\ny\r\n$1\r\n2\r\n$1\r\nz\r\n$1\r\n3\r\n",
+		"*1\r\n$1\r\nx\r\n",
+		":4\r\n",
+		"*8\r\n$1\r\nx\r\n$1\r\n1\r\n$1\r\nw\r\n$1\r\n5\r\n$1\r\ny\r\n$2\r\n10\r\n$1\r\nz\r\n$2\r\n20\r\n",
+		":0\r\n", ":0\r\n",
+		":3\r\n", ":1\r\n",
+		"*2\r\n$1\r\ny\r\n$1\r\n2\r\n",
+		"-ERR syntax error\r\n",
+	}, val)
+
+	val, err = handler.ParseCommands(
+		EncodeCommand(toArgs("zunion", "0", "a")) +
+		EncodeCommand(toArgs("zunion", "x", "a")) +
+		EncodeCommand(toArgs("zunionstore", "dst", "3", "a", "b")) +
+		EncodeCommand(toArgs("zinter", "2", "a", "b", "weights", "1")) +
+		EncodeCommand(toArgs("zinter", "2", "a", "b", "weights", "1", "x")) +
+		EncodeCommand(toArgs("zinter", "2", "a", "b", "aggregate", "avg")) +
+		EncodeCommand(toArgs("zdiff", "2", "a", "b", "weights", "1", "1")) +
+		EncodeCommand(toArgs("zunionstore", "dst", "1", "a", "withscores")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"-ERR at least 1 input key is needed for 'zunion' command\r\n",
+		"-ERR value is not an integer or out of range\r\n",
+		"-ERR syntax error\r\n", "-ERR syntax error\r\n",
+		"-ERR weight value is not a float\r\n",
+		"-ERR syntax error\r\n", "-ERR syntax error\r\n", "-ERR syntax error\r\n",
+	}, val)
+}
+
+func TestParseCommands_SortedSetPop(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	replica := NewClient(nil)
+	_, err := handler.ParseClientCommands(replica, EncodeCommand(toArgs("psync", "?", "-1")))
+	assert.Nil(t, err)
+	replica.takeReplies()
+
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("zadd", "jobs", "3", "c", "1", "a", "2", "b", "4", "d")) +
+		EncodeCommand(toArgs("zpopmin", "jobs")) +
+		EncodeCommand(toArgs("zpopmax", "jobs", "2")) +
+		EncodeCommand(toArgs("zpopmin", "jobs", "-1")) +
+		EncodeCommand(toArgs("zpopmin", "missing")) +
+		EncodeCommand(toArgs("zmpop", "2", "missing", "jobs", "min", "count", "5")) +
+		EncodeCommand(toArgs("zmpop", "1", "jobs", "max")) +
+		EncodeCommand(toArgs("zmpop", "1", "jobs", "up")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		":4\r\n",
+		"*2\r\n$1\r\na\r\n$1\r\n1\r\n",
+		"*4\r\n$1\r\nd\r\n$1\r\n4\r\n$1\r\nc\r\n$1\r\n3\r\n",
+		"-ERR value is out of range, must be positive\r\n",
+		"*0\r\n",
+		"*2\r\n$4\r\njobs\r\n*1\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n",
+		"*-1\r\n",
+		"-ERR syntax error\r\n",
+	}, val)
+
+	// ZMPOP is propagated as the pop it did
+	assert.Equal(t, []string{
+		EncodeCommand(toArgs("SELECT", "0")),
+		EncodeCommand(toArgs("zadd", "jobs", "3", "c", "1", "a", "2", "b", "4", "d")),
+		EncodeCommand(toArgs("zpopmin", "jobs")),
+		EncodeCommand(toArgs("zpopmax", "jobs", "2")),
+		EncodeCommand(toArgs("ZPOPMIN", "jobs", "1")),
+	}, replica.takeReplies())
+
+	// RESP3 pairs members with their score when a count is given
+	client := NewClient(nil)
+	val, err = handler.ParseClientCommands(client,
+		EncodeCommand(toArgs("hello", "3")) +
+		EncodeCommand(toArgs("zadd", "jobs", "1", "a", "2", "b")) +
+		EncodeCommand(toArgs("zpopmin", "jobs")) +
+		EncodeCommand(toArgs("zpopmin", "jobs", "1")),
+	)
 	assert.Nil(t, err)
-	assert.Equal(t, []string{"$11\r\nHello World\r\n"}, val)
+	assert.Equal(t, []string{"*2\r\n$1\r\na\r\n,1\r\n", "*1\r\n*2\r\n$1\r\nb\r\n,2\r\n"}, val[2:])
 }
 
-func TestParseCommands_Set(t *testing.T) {
+func TestParseCommands_HyperLogLog(t *testing.T) {
 	handler := createCommandsHandler(RoleMaster)
 
-	buf := []byte("*3\r\n$3\r\nset\r\n$10\r\nstrawberry\r\n$9\r\nraspberry\r\n")	
-	val, err := handler.ParseCommands(string(buf))
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("pfadd", "hll", "a", "b", "c", "d", "e", "f", "g")) +
+		EncodeCommand(toArgs("pfcount", "hll")) +
+		EncodeCommand(toArgs("pfadd", "hll", "a")) +
+		EncodeCommand(toArgs("pfadd", "empty")) +
+		EncodeCommand(toArgs("pfcount", "empty", "missing")) +
+		EncodeCommand(toArgs("pfadd", "other", "f", "g", "h", "i")) +
+		EncodeCommand(toArgs("pfcount", "hll", "other")) +
+		EncodeCommand(toArgs("pfmerge", "dst", "hll", "other")) +
+		EncodeCommand(toArgs("pfcount", "dst")) +
+		EncodeCommand(toArgs("type", "dst")) +
+		EncodeCommand(toArgs("config", "get", "hll-sparse-max-bytes")),
+	)
 	assert.Nil(t, err)
-	assert.Equal(t, []string{"+OK\r\n"}, val)
-}
-
-func TestParseCommands_SetWithExpiration(t *testing.T) {
-	handler := createCommandsHandler(RoleMaster)
+	assert.Equal(t, []string{
+		":1\r\n", ":7\r\n", ":0\r\n", ":1\r\n", ":0\r\n", ":1\r\n", ":9\r\n",
+		"+OK\r\n", ":9\r\n", "+string\r\n",
+		"*2\r\n$20\r\nhll-sparse-max-bytes\r\n$4\r\n3000\r\n",
+	}, val)
 
-	buf := []byte("*5\r\n$3\r\nset\r\n$5\r\nmango\r\n$9\r\nraspberry\r\n$2\r\npx\r\n$3\r\n100\r\n")	
-	val, err := handler.ParseCommands(string(buf))
+	// HyperLogLogs are plain strings, which can be copied around
+	val, err = handler.ParseCommands(EncodeCommand(toArgs("get", "dst")))
 	assert.Nil(t, err)
-	assert.Equal(t, []string{"+OK\r\n"}, val)
+	value := strings.TrimSuffix(strings.SplitN(val[0], "\r\n", 2)[1], "\r\n")
+	assert.True(t, strings.HasPrefix(value, "HYLL"))
+
+	val, err = handler.ParseCommands(
+		EncodeCommand(toArgs("set", "copy", value)) +
+		EncodeCommand(toArgs("pfcount", "copy")) +
+		EncodeCommand(toArgs("set", "str", "HYLL")) +
+		EncodeCommand(toArgs("pfadd", "str", "a")) +
+		EncodeCommand(toArgs("set", "corrupt", "HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x80\x7f")) +
+		EncodeCommand(toArgs("pfcount", "corrupt")) +
+		EncodeCommand(toArgs("rpush", "list", "a")) +
+		EncodeCommand(toArgs("pfmerge", "dst", "list")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"+OK\r\n", ":9\r\n",
+		"+OK\r\n", "-WRONGTYPE Key is not a valid HyperLogLog string value.\r\n",
+		"+OK\r\n", "-INVALIDOBJ Corrupted HLL object detected\r\n",
+		":1\r\n", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+	}, val)
 }
 
 func TestParseCommands_SlaveReceiveMultipleSetsWithExpiration_SendsNoResponse(t *testing.T) {
 	handler := createCommandsHandler(RoleSlave)
+	master := NewClient(nil)
+	master.IsMaster = true
 
 	buf := []byte("*5\r\n$3\r\nset\r\n$5\r\nmango\r\n$9\r\nraspberry\r\n$2\r\npx\r\n$3\r\n100\r\n*5\r\n$3\r\nset\r\n$5\r\nmango\r\n$9\r\nraspberry\r\n$2\r\npx\r\n$3\r\n100\r\n*5\r\n$3\r\nset\r\n$5\r\nmango\r\n$9\r\nraspberry\r\n$2\r\npx\r\n$3\r\n100\r\n")	
-	val, err := handler.ParseCommands(string(buf))
+	val, err := handler.ParseClientCommands(master, string(buf))
 	assert.Nil(t, err)
 	assert.Equal(t, []string{}, val)
+	assert.Equal(t, int64(len(buf)), handler.ServerOpts.ReplicaOffset)
+}
+
+func TestParseCommands_SlaveRejectsClientWrites(t *testing.T) {
+	handler := createCommandsHandler(RoleSlave)
+
+	val, err := handler.ParseCommands(EncodeCommand(toArgs("set", "mango", "raspberry")) + EncodeCommand(toArgs("get", "mango")) + EncodeCommand(toArgs("ping")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"-READONLY You can't write against a read only replica.\r\n", "$-1\r\n", "+PONG\r\n"}, val)
 }
 
 func TestParseCommands_Get(t *testing.T) {
@@ -109,6 +1767,52 @@ func TestParseCommands_Info(t *testing.T) {
 	assert.Equal(t, []string{"$87\r\nrole:master\nmaster_replid:8371b4fb1155b71f4a04d3e1bc3e18c4a990aeeb\nmaster_repl_offset:0\r\n"}, val)
 }
 
+func TestParseCommands_Hello(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+	client := NewClient(nil)
+
+	val, err := handler.ParseClientCommands(client, EncodeCommand(toArgs("hello", "3", "setname", "orchard")))
+	assert.Nil(t, err)
+	assert.Equal(t, RESP3, client.Protocol)
+	assert.Equal(t, "orchard", client.Name)
+	assert.Equal(t, []string{fmt.Sprintf("%%7\r\n$6\r\nserver\r\n$5\r\nredis\r\n$7\r\nversion\r\n$5\r\n7.2.0\r\n$5\r\nproto\r\n:3\r\n$2\r\nid\r\n:%v\r\n$4\r\nmode\r\n$10\r\nstandalone\r\n$4\r\nrole\r\n$6\r\nmaster\r\n$7\r\nmodules\r\n*0\r\n", client.ID)}, val)
+
+	// null replies and maps use the RESP3 types once negotiated
+	val, err = handler.ParseClientCommands(client, EncodeCommand(toArgs("get", "mango")) + EncodeCommand(toArgs("config", "get", "dir")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"_\r\n", "%1\r\n$3\r\ndir\r\n$2\r\n./\r\n"}, val)
+
+	val, err = handler.ParseClientCommands(client, EncodeCommand(toArgs("hello", "4")) + EncodeCommand(toArgs("hello", "2", "auth", "admin", "secret")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"-NOPROTO unsupported protocol version\r\n", "-WRONGPASS invalid username-password pair or user is disabled.\r\n"}, val)
+	assert.Equal(t, RESP3, client.Protocol)
+
+	val, err = handler.ParseClientCommands(client, EncodeCommand(toArgs("hello", "2")) + EncodeCommand(toArgs("get", "mango")))
+	assert.Nil(t, err)
+	assert.Equal(t, RESP2, client.Protocol)
+	assert.Equal(t, "$-1\r\n", val[1])
+}
+
+func TestParseCommands_Resp3Maps(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+	client := NewClient(nil)
+	client.Protocol = RESP3
+
+	val, err := handler.ParseClientCommands(client, EncodeCommand(toArgs("info", "replication")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"%3\r\n$4\r\nrole\r\n$6\r\nmaster\r\n$13\r\nmaster_replid\r\n$40\r\n8371b4fb1155b71f4a04d3e1bc3e18c4a990aeeb\r\n$18\r\nmaster_repl_offset\r\n$1\r\n0\r\n"}, val)
+
+	handler.ParseClientCommands(client, EncodeCommand(toArgs("xadd", "pear", "0-1", "temperature", "37")))
+
+	val, err = handler.ParseClientCommands(client, EncodeCommand(toArgs("xread", "streams", "pear", "apple", "0-0", "0-0")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"%1\r\n$4\r\npear\r\n*1\r\n*2\r\n$3\r\n0-1\r\n*2\r\n$11\r\ntemperature\r\n$2\r\n37\r\n"}, val)
+
+	val, err = handler.ParseClientCommands(client, EncodeCommand(toArgs("xread", "streams", "pear", "0-1")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"_\r\n"}, val)
+}
+
 func TestParseCommands_ReplConf(t *testing.T) {
 	handler := createCommandsHandler(RoleMaster)
 
@@ -136,7 +1840,7 @@ func TestParseCommands_Config(t *testing.T) {
 	buf := []byte("*3\r\n$6\r\nCONFIG\r\n$3\r\nget\r\n$3\r\ndir\r\n")
 	val, err := handler.ParseCommands(string(buf))
 	assert.Nil(t, err)
-	assert.Equal(t, []string{fmt.Sprintf("*2\r\n$3\r\ndir\r\n$%v\r\n%s\r\n", len(handler.Store.KVStore.Config.Dir), handler.Store.KVStore.Config.Dir)}, val)
+	assert.Equal(t, []string{fmt.Sprintf("*2\r\n$3\r\ndir\r\n$%v\r\n%s\r\n", len(handler.Store.Config.Dir), handler.Store.Config.Dir)}, val)
 }
 
 func TestParseCommands_Type(t *testing.T) {
@@ -173,35 +1877,37 @@ func TestParseCommands_XAdd(t *testing.T) {
 	{
 		buf := []byte("*5\r\n$4\r\nxadd\r\n$6\r\norange\r\n$3\r\n0-1\r\n$3\r\nfoo\r\n$3\r\nbar\r\n")	
 
-		_, exists := handler.Store.StreamStore.DataStore["orange"]
+		_, exists := handler.Store.DB(0).Keyspace.Lookup("orange")
 		assert.False(t, exists)
 
 		val, err := handler.ParseCommands(string(buf))
 		assert.Nil(t, err)
 		assert.Equal(t, []string{"$3\r\n0-1\r\n"}, val)
 
-		streamVal, exists := handler.Store.StreamStore.DataStore["orange"]
-		assert.True(t, exists)
+		streamVal, err := handler.Store.DB(0).StreamStore.GetStream("orange")
+		assert.Nil(t, err)
+		assert.NotNil(t, streamVal)
 		assert.Equal(t, "0-1", streamVal[0].ID)
-		assert.Equal(t, "foo", streamVal[0].Entry[0].Key)
-		assert.Equal(t, "bar", streamVal[0].Entry[0].Value)
+		assert.Equal(t, []byte("foo"), streamVal[0].Entry[0].Key)
+		assert.Equal(t, []byte("bar"), streamVal[0].Entry[0].Value)
 	}
 
 	{
 		buf := []byte("*5\r\n$4\r\nxadd\r\n$10\r\nstrawberry\r\n$3\r\n0-*\r\n$3\r\nfoo\r\n$3\r\nbar\r\n")	
 
-		_, exists := handler.Store.StreamStore.DataStore["strawberry"]
+		_, exists := handler.Store.DB(0).Keyspace.Lookup("strawberry")
 		assert.False(t, exists)
 
 		val, err := handler.ParseCommands(string(buf))
 		assert.Nil(t, err)
 		assert.Equal(t, []string{"$3\r\n0-1\r\n"}, val)
 
-		streamVal, exists := handler.Store.StreamStore.DataStore["strawberry"]
-		assert.True(t, exists)
+		streamVal, err := handler.Store.DB(0).StreamStore.GetStream("strawberry")
+		assert.Nil(t, err)
+		assert.NotNil(t, streamVal)
 		assert.Equal(t, "0-1", streamVal[0].ID)
-		assert.Equal(t, "foo", streamVal[0].Entry[0].Key)
-		assert.Equal(t, "bar", streamVal[0].Entry[0].Value)
+		assert.Equal(t, []byte("foo"), streamVal[0].Entry[0].Key)
+		assert.Equal(t, []byte("bar"), streamVal[0].Entry[0].Value)
 	}
 
 	{
@@ -211,11 +1917,12 @@ func TestParseCommands_XAdd(t *testing.T) {
 		assert.Nil(t, err)
 		assert.Equal(t, []string{"$3\r\n1-0\r\n"}, val)
 
-		streamVal, exists := handler.Store.StreamStore.DataStore["strawberry"]
-		assert.True(t, exists)
+		streamVal, err := handler.Store.DB(0).StreamStore.GetStream("strawberry")
+		assert.Nil(t, err)
+		assert.NotNil(t, streamVal)
 		assert.Equal(t, "1-0", streamVal[1].ID)
-		assert.Equal(t, "foo", streamVal[0].Entry[0].Key)
-		assert.Equal(t, "bar", streamVal[0].Entry[0].Value)
+		assert.Equal(t, []byte("foo"), streamVal[0].Entry[0].Key)
+		assert.Equal(t, []byte("bar"), streamVal[0].Entry[0].Value)
 	}
 
 }
@@ -253,6 +1960,27 @@ func TestParseCommands_XRange(t *testing.T) {
 
 	}
 
+	// keys of any other type are rejected, missing ones read as empty streams
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("rpush", "list", "a")) +
+		EncodeCommand(toArgs("hset", "hash", "a", "b")) +
+		EncodeCommand(toArgs("sadd", "set", "a")) +
+		EncodeCommand(toArgs("zadd", "zset", "1", "a")) +
+		EncodeCommand(toArgs("xrange", "list", "-", "+")) +
+		EncodeCommand(toArgs("xrange", "hash", "-", "+")) +
+		EncodeCommand(toArgs("xrange", "set", "-", "+")) +
+		EncodeCommand(toArgs("xrange", "zset", "-", "+")) +
+		EncodeCommand(toArgs("xrange", "missing", "-", "+")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		":1\r\n", ":1\r\n", ":1\r\n", ":1\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		"*0\r\n",
+	}, val)
 }
 
 func TestParseCommands_XRead(t *testing.T) {
@@ -267,6 +1995,28 @@ func TestParseCommands_XRead(t *testing.T) {
 		assert.Nil(t, err)
 		assert.Equal(t, []string{"*1\r\n*2\r\n$4\r\npear\r\n*1\r\n*2\r\n$3\r\n0-1\r\n*2\r\n$11\r\ntemperature\r\n$2\r\n37\r\n"}, val)
 	}
+
+	// any key that is not a stream fails the whole read, blocking or not
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("rpush", "list", "a")) +
+		EncodeCommand(toArgs("hset", "hash", "a", "b")) +
+		EncodeCommand(toArgs("sadd", "set", "a")) +
+		EncodeCommand(toArgs("zadd", "zset", "1", "a")) +
+		EncodeCommand(toArgs("xread", "streams", "pear", "list", "0-0", "0-0")) +
+		EncodeCommand(toArgs("xread", "streams", "hash", "0-0")) +
+		EncodeCommand(toArgs("xread", "streams", "set", "0-0")) +
+		EncodeCommand(toArgs("xread", "block", "0", "streams", "zset", "$")) +
+		EncodeCommand(toArgs("xread", "streams", "missing", "0-0")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		":1\r\n", ":1\r\n", ":1\r\n", ":1\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		"$-1\r\n",
+	}, val)
 }
 
 func TestParseCommands_XRead_WithBlock(t *testing.T) {
@@ -294,47 +2044,300 @@ func TestParseCommands_XRead_WithBlock(t *testing.T) {
 }
 
 func TestIsWriteCommand(t *testing.T) {
-	isWrite := IsWriteCommand("*1\r\n$4\r\nping\r\n")
+	isWrite := IsWriteCommand(toArgs("ping"))
 	assert.False(t, isWrite)
 
-	isWrite = IsWriteCommand("*3\r\n$3\r\nset\r\n$3\r\nbaz\r\n$3\r\n789\r\n")
+	isWrite = IsWriteCommand(toArgs("set", "baz", "789"))
 	assert.True(t, isWrite)
-}
 
-func TestIsPsyncCommand(t *testing.T) {
-	isWrite := ContainsPsyncCommand("*1\r\n$4\r\nping\r\n")
+	isWrite = IsWriteCommand(toArgs("XADD", "orange", "*", "foo", "bar"))
+	assert.True(t, isWrite)
+
+	isWrite = IsWriteCommand(toArgs("get", "baz"))
 	assert.False(t, isWrite)
+}
 
-	isWrite = ContainsPsyncCommand("*3\r\n$5\r\nPSYNC\r\n$1\r\n?\r\n$2\r\n-1\r\n")
-	assert.True(t, isWrite)
+func TestCommandTable(t *testing.T) {
+	spec, exists := LookupCommand([]byte("SeT"))
+	assert.True(t, exists)
+	assert.Equal(t, "set", spec.Name)
+	assert.True(t, spec.Flags.Has(CmdFlagWrite))
+	assert.Equal(t, []string{"write", "denyoom"}, spec.Flags.Names())
+
+	assert.True(t, spec.CheckArity(3))
+	assert.True(t, spec.CheckArity(5))
+	assert.False(t, spec.CheckArity(2))
+	assert.Equal(t, []int{1}, spec.KeyPositions(toArgs("set", "mango", "raspberry")))
+
+	spec, _ = LookupCommand([]byte("get"))
+	assert.False(t, spec.CheckArity(3))
+
+	_, exists = LookupCommand([]byte("gte"))
+	assert.False(t, exists)
+
+	// every command needs a handler, or subcommands to dispatch to
+	for _, name := range CommandNames() {
+		spec := commandTable[name]
+		assert.True(t, spec.Handler != nil || len(spec.Subcommands) > 0, name)
+		for _, subcommand := range spec.Subcommands {
+			assert.NotNil(t, subcommand.Handler, subcommand.FullName)
+		}
+
+		// and the documentation reported by COMMAND DOCS
+		assert.NotEmpty(t, spec.Summary, name)
+		assert.NotEmpty(t, spec.Group, name)
+	}
 
-	isWrite = ContainsPsyncCommand("*1\r\n$4\r\nping\r\n*3\r\n$5\r\nPSYNC\r\n$1\r\n?\r\n$2\r\n-1\r\n")
-	assert.True(t, isWrite)
+	// commands about a data type are in its ACL category
+	for name, categories := range map[string][]string{
+		"lpush": {"@write", "@fast", "@list"},
+		"blpop": {"@write", "@slow", "@blocking", "@list"},
+		"hget": {"@read", "@fast", "@hash"},
+		"sinter": {"@read", "@slow", "@set"},
+		"zadd": {"@write", "@fast", "@sortedset"},
+		"pfadd": {"@write", "@fast", "@hyperloglog"},
+		"xadd": {"@write", "@fast", "@stream"},
+		"del": {"@write", "@slow", "@keyspace"},
+	} {
+		spec, _ := LookupCommand([]byte(name))
+		assert.Equal(t, categories, spec.ACLCategories(), name)
+	}
+}
 
-	isWrite = ContainsPsyncCommand("*3\r\n$5\r\nPSYNC\r\n$1\r\n?\r\n$2\r\n-1\r\n*3\r\n$5\r\nPSYNC\r\n$1\r\n?\r\n$2\r\n-1\r\n")
-	assert.True(t, isWrite)
+func TestCommandTable_KeyPositions(t *testing.T) {
+	spec, _ := LookupCommand([]byte("xread"))
+	assert.True(t, spec.Flags.Has(CmdFlagMovableKeys))
+	assert.Equal(t, []int{4, 5}, spec.KeyPositions(toArgs("xread", "count", "2", "STREAMS", "mango", "kiwi", "0-0", "0-0")))
+	assert.Equal(t, []int{4}, spec.KeyPositions(toArgs("xread", "block", "0", "streams", "mango", "$")))
+	assert.Equal(t, []int{}, spec.KeyPositions(toArgs("xread", "mango", "0-0")))
+
+	// a keynum spec such as the one of ZUNIONSTORE
+	spec = &CommandSpec{
+		Name: "zunionstore", Arity: -4,
+		KeySpecs: []KeySpec{
+			{Index: 1, LastKey: 0, KeyStep: 1},
+			{Index: 2, NumKeys: true, NumKeysIndex: 0, FirstKey: 1, KeyStep: 1},
+		},
+	}
+	spec.init(nil)
+	assert.Equal(t, []int{1, 3, 4}, spec.KeyPositions(toArgs("zunionstore", "out", "2", "a", "b", "WEIGHTS", "1", "2")))
+
+	// key specs with their own flags still report the first key position
+	spec, _ = LookupCommand([]byte("pfmerge"))
+	assert.Equal(t, []int{1, -1, 1}, []int{spec.FirstKey, spec.LastKey, spec.Step})
+	positions, flags := spec.KeyFlags(toArgs("pfmerge", "dst", "a", "b"))
+	assert.Equal(t, []int{1, 2, 3}, positions)
+	assert.Equal(t, []string{"RW", "access", "insert"}, flags[0])
+
+	for name, keys := range map[string][]int{
+		"zrangestore": {1, 2, 1},
+		"zunionstore": {1, 1, 1},
+		"zinterstore": {1, 1, 1},
+		"zdiffstore": {1, 1, 1},
+	} {
+		spec, _ = LookupCommand([]byte(name))
+		assert.Equal(t, keys, []int{spec.FirstKey, spec.LastKey, spec.Step}, name)
+	}
+	spec, _ = LookupCommand([]byte("zinterstore"))
+	assert.Equal(t, []int{1, 3, 4}, spec.KeyPositions(toArgs("zinterstore", "out", "2", "a", "b")))
+}
+
+func TestParseCommands_Command(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	val, err := handler.ParseCommands(EncodeCommand(toArgs("COMMAND", "COUNT")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{fmt.Sprintf(":%d\r\n", len(commandTable))}, val)
+
+	val, err = handler.ParseCommands(EncodeCommand(toArgs("command", "info", "get", "nosuchcommand")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"*2\r\n" +
+		"*10\r\n$3\r\nget\r\n:2\r\n*2\r\n+readonly\r\n+fast\r\n:1\r\n:1\r\n:1\r\n" +
+		"*3\r\n+@read\r\n+@fast\r\n+@string\r\n*0\r\n" +
+		"*1\r\n*6\r\n$5\r\nflags\r\n*2\r\n+RO\r\n+access\r\n" +
+		"$12\r\nbegin_search\r\n*4\r\n$4\r\ntype\r\n$5\r\nindex\r\n$4\r\nspec\r\n*2\r\n$5\r\nindex\r\n:1\r\n" +
+		"$9\r\nfind_keys\r\n*4\r\n$4\r\ntype\r\n$5\r\nrange\r\n$4\r\nspec\r\n*6\r\n$7\r\nlastkey\r\n:0\r\n$7\r\nkeystep\r\n:1\r\n$5\r\nlimit\r\n:0\r\n" +
+		"*0\r\n" +
+		"$-1\r\n"}, val)
+
+	val, err = handler.ParseCommands(EncodeCommand(toArgs("command", "list", "filterby", "pattern", "x*")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{ResponseBuilder(ArraysRespType, "xadd", "xrange", "xread")}, val)
+
+	val, err = handler.ParseCommands(EncodeCommand(toArgs("command", "list", "filterby", "aclcat", "stream")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{ResponseBuilder(ArraysRespType, "xadd", "xrange", "xread")}, val)
+
+	for _, category := range []string{"list", "hash", "set", "sortedset", "hyperloglog"} {
+		val, err = handler.ParseCommands(EncodeCommand(toArgs("command", "list", "filterby", "aclcat", category)))
+		assert.Nil(t, err)
+		assert.NotEqual(t, []string{"*0\r\n"}, val, category)
+	}
+	val, err = handler.ParseCommands(EncodeCommand(toArgs("command", "list", "filterby", "aclcat", "hyperloglog")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{ResponseBuilder(ArraysRespType, "pfadd", "pfcount", "pfmerge")}, val)
+
+	val, err = handler.ParseCommands(EncodeCommand(toArgs("command", "list", "filterby", "pattern", "config*")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{ResponseBuilder(ArraysRespType, "config", "config|get")}, val)
+
+	val, err = handler.ParseCommands(EncodeCommand(toArgs("command", "list", "filterby", "colour", "red")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"-ERR syntax error\r\n"}, val)
+
+	val, err = handler.ParseCommands(EncodeCommand(toArgs("command", "docs", "echo", "nosuchcommand")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"*2\r\n$4\r\necho\r\n*8\r\n" +
+		"$7\r\nsummary\r\n$25\r\nReturns the given string.\r\n" +
+		"$5\r\nsince\r\n$5\r\n1.0.0\r\n" +
+		"$5\r\ngroup\r\n$10\r\nconnection\r\n" +
+		"$10\r\ncomplexity\r\n$4\r\nO(1)\r\n"}, val)
+
+	val, err = handler.ParseCommands(EncodeCommand(toArgs("command", "nosuchsubcommand")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"-ERR unknown subcommand 'nosuchsubcommand'. Try COMMAND HELP.\r\n"}, val)
+}
+
+func TestParseCommands_CommandGetKeys(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	val, err := handler.ParseCommands(EncodeCommand(toArgs("command", "getkeys", "set", "mango", "raspberry")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{ResponseBuilder(ArraysRespType, "mango")}, val)
+
+	val, err = handler.ParseCommands(EncodeCommand(toArgs("command", "getkeys", "xread", "count", "1", "streams", "mango", "kiwi", "0-0", "0-0")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{ResponseBuilder(ArraysRespType, "mango", "kiwi")}, val)
+
+	val, err = handler.ParseCommands(EncodeCommand(toArgs("command", "getkeysandflags", "set", "mango", "raspberry")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"*1\r\n*2\r\n$5\r\nmango\r\n*2\r\n+RW\r\n+update\r\n"}, val)
+
+	val, err = handler.ParseCommands(EncodeCommand(toArgs("command", "getkeys", "get")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"-ERR Invalid number of arguments specified for command\r\n"}, val)
+
+	val, err = handler.ParseCommands(EncodeCommand(toArgs("command", "getkeys", "ping", "hello")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"-ERR The command has no key arguments\r\n"}, val)
+
+	val, err = handler.ParseCommands(EncodeCommand(toArgs("command", "getkeys", "nosuchcommand", "mango")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"-ERR Invalid command specified\r\n"}, val)
+}
+
+func TestParseCommands_ArityErrors(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	val, err := handler.ParseCommands(EncodeCommand(toArgs("get", "mango", "extra")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"-ERR wrong number of arguments for 'get' command\r\n"}, val)
+
+	val, err = handler.ParseCommands(EncodeCommand(toArgs("config", "get")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"-ERR wrong number of arguments for 'config|get' command\r\n"}, val)
 }
 
+func TestParseCommands_ErrorReplies(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	// errors are replied in place and the rest of the pipeline still runs
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("GTE", "foo")) +
+		EncodeCommand(toArgs("set", "mango", "raspberry", "EX")) +
+		EncodeCommand(toArgs("set", "mango", "raspberry", "px", "soon")) +
+		EncodeCommand(toArgs("set", "mango", "raspberry")) +
+		EncodeCommand(toArgs("xadd", "mango", "*", "foo", "bar")) +
+		EncodeCommand(toArgs("xadd", "kiwi", "1-1", "foo", "bar")) +
+		EncodeCommand(toArgs("get", "kiwi")) +
+		EncodeCommand(toArgs("xread", "count", "1", "kiwi", "0-0")) +
+		EncodeCommand(toArgs("xread", "streams", "kiwi", "mango", "0-0")) +
+		EncodeCommand(toArgs("wait", "one", "100")) +
+		EncodeCommand(toArgs("echo", "still here")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"-ERR unknown command 'GTE', with args beginning with: 'foo' \r\n",
+		"-ERR syntax error\r\n",
+		"-ERR value is not an integer or out of range\r\n",
+		"+OK\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		"$3\r\n1-1\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		"-ERR syntax error\r\n",
+		"-ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.\r\n",
+		"-ERR value is not an integer or out of range\r\n",
+		"$10\r\nstill here\r\n",
+	}, val)
+}
 
+func TestIsPsyncCommand(t *testing.T) {
+	isPsync := IsPsyncCommand(toArgs("ping"))
+	assert.False(t, isPsync)
 
+	isPsync = IsPsyncCommand(toArgs("PSYNC", "?", "-1"))
+	assert.True(t, isPsync)
 
+	isPsync = IsPsyncCommand(toArgs("psync", "?", "-1"))
+	assert.True(t, isPsync)
+}
 
 func TestReadFromRDBFile(t *testing.T) {
 	{
 		handler := createCommandsHandler(RoleMaster)
-		handler.Store.KVStore.Config.DbFileName = "EmptyRDBTest"
+		handler.Store.Config.DbFileName = "EmptyRDBTest"
 
-		handler.Store.KVStore.InitializeDB()
-		assert.Equal(t, 0, len(handler.Store.KVStore.DataStore))
+		handler.Store.InitializeDB()
+		assert.Equal(t, 0, handler.Store.DB(0).Keyspace.Len())
 	}
 
 	{
 		handler := createCommandsHandler(RoleMaster)
-		handler.Store.KVStore.Config.DbFileName = "RDBTest"
+		handler.Store.Config.DbFileName = "RDBTest"
+
+		handler.Store.InitializeDB()
+		assert.Equal(t, 1, handler.Store.DB(0).Keyspace.Len())
+	}
+}
+
+func TestReadFromRDBFile_EncodedStrings(t *testing.T) {
+	rdb := "REDIS0011" +
+		"\xfa\x09redis-ver\x057.2.0" +
+		"\xfe\x00\xfb\x04\x00" +
+		"\x00\x04int8\xc0\x7b" +
+		"\x00\x05int16\xc1\x39\x30" +
+		"\x00\x03lzf\xc3\x05\x0a\x00\x61\xe0\x00\x00" +
+		"\x00\x03bin\x09\r\nREDIS\x00\xfe" +
+		"\xff\x00\x00\x00\x00\x00\x00\x00\x00"
+
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "dump.rdb"), []byte(rdb), 0644))
+
+	handler := createCommandsHandler(RoleMaster)
+	handler.Store.Config.Dir = dir
+	handler.Store.Config.DbFileName = "dump.rdb"
+
+	handler.Store.InitializeDB()
+	assert.Equal(t, 4, handler.Store.DB(0).Keyspace.Len())
+
+	val, err := handler.ParseCommands(EncodeCommand(toArgs("get", "int8")) + EncodeCommand(toArgs("get", "int16")) + EncodeCommand(toArgs("get", "lzf")) + EncodeCommand(toArgs("get", "bin")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"$3\r\n123\r\n", "$5\r\n12345\r\n", "$10\r\naaaaaaaaaa\r\n", "$9\r\n\r\nREDIS\x00\xfe\r\n"}, val)
+}
 
-		handler.Store.KVStore.InitializeDB()
-		assert.Equal(t, 1, len(handler.Store.KVStore.DataStore))
+func TestParseCommands_BinarySafeValues(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	values := []string{"line\r\nbreak", "REDIS0011", "\x00\xff\x10binary", ""}
+	for _, value := range values {
+		val, err := handler.ParseCommands(EncodeCommand(toArgs("set", "blob", value)) + EncodeCommand(toArgs("get", "blob")))
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"+OK\r\n", fmt.Sprintf("$%v\r\n%s\r\n", len(value), value)}, val)
 	}
+
+	val, err := handler.ParseCommands(EncodeCommand(toArgs("xadd", "stream", "0-1", "field\r\n", "REDIS\x00")) + EncodeCommand(toArgs("xrange", "stream", "-", "+")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"$3\r\n0-1\r\n", "*1\r\n*2\r\n$3\r\n0-1\r\n*2\r\n$7\r\nfield\r\n\r\n$6\r\nREDIS\x00\r\n"}, val)
 }
 
 func TestResponseBuilder(t *testing.T) {
@@ -368,45 +2371,500 @@ func TestResponseBuilder(t *testing.T) {
 
 		val = ResponseBuilder(ErrorsRespType, "pear", "banana")
 		assert.Equal(t, "", val)
+
+		val = ResponseBuilder(ErrorsRespType, "pear\r\nbanana")
+		assert.Equal(t, "-ERR pear  banana\r\n", val)
+	}
+}
+
+func TestResponseBuilder_Resp3(t *testing.T) {
+	assert.Equal(t, "_\r\n", ResponseBuilder(NullsRespType))
+	assert.Equal(t, ":42\r\n", ResponseBuilder(IntegersRespType, "42"))
+	assert.Equal(t, "%1\r\n$3\r\nkey\r\n$5\r\nvalue\r\n", ResponseBuilder(MapsRespType, "key", "value"))
+	assert.Equal(t, "", ResponseBuilder(MapsRespType, "key"))
+	assert.Equal(t, "~2\r\n$1\r\na\r\n$1\r\nb\r\n", ResponseBuilder(SetsRespType, "a", "b"))
+	assert.Equal(t, ",3.14\r\n", ResponseBuilder(DoublesRespType, "3.14"))
+	assert.Equal(t, "#t\r\n", ResponseBuilder(BooleansRespType, "t"))
+	assert.Equal(t, "", ResponseBuilder(BooleansRespType, "true"))
+	assert.Equal(t, "(3492890328409238509324850943850943825024385\r\n", ResponseBuilder(BigNumbersRespType, "3492890328409238509324850943850943825024385"))
+	assert.Equal(t, "=15\r\ntxt:Some string\r\n", ResponseBuilder(VerbatimStringsRespType, "txt", "Some string"))
+	assert.Equal(t, "|1\r\n$3\r\nttl\r\n$2\r\n10\r\n", ResponseBuilder(AttributesRespType, "ttl", "10"))
+	assert.Equal(t, ">2\r\n$7\r\nmessage\r\n$5\r\nhello\r\n", ResponseBuilder(PushesRespType, "message", "hello"))
+}
+
+func TestFormatDouble(t *testing.T) {
+	assert.Equal(t, "1.5", FormatDouble(1.5))
+	assert.Equal(t, "-3", FormatDouble(-3))
+	assert.Equal(t, "0", FormatDouble(0))
+	assert.Equal(t, "1234567", FormatDouble(1234567))
+	assert.Equal(t, "1700000000000", FormatDouble(1700000000000))
+	assert.Equal(t, "10000000000000000", FormatDouble(1e16))
+	assert.Equal(t, "1e+17", FormatDouble(1e17))
+	assert.Equal(t, "0.0001", FormatDouble(0.0001))
+	assert.Equal(t, "1.5e-05", FormatDouble(0.000015))
+	assert.Equal(t, "-inf", FormatDouble(math.Inf(-1)))
+}
+
+func TestResponseBuilder_Resp2Fallbacks(t *testing.T) {
+	assert.Equal(t, "*2\r\n$3\r\nkey\r\n$5\r\nvalue\r\n", MapResponse(RESP2, "key", "value"))
+	assert.Equal(t, "*1\r\n$1\r\na\r\n", SetResponse(RESP2, "a"))
+	assert.Equal(t, "$4\r\n1.25\r\n", DoubleResponse(RESP2, 1.25))
+	assert.Equal(t, ",1.25\r\n", DoubleResponse(RESP3, 1.25))
+	assert.Equal(t, ",inf\r\n", DoubleResponse(RESP3, math.Inf(1)))
+	assert.Equal(t, ",1700000000000\r\n", DoubleResponse(RESP3, 1700000000000))
+	assert.Equal(t, ":1\r\n", BooleanResponse(RESP2, true))
+	assert.Equal(t, "#f\r\n", BooleanResponse(RESP3, false))
+	assert.Equal(t, "$3\r\n123\r\n", BigNumberResponse(RESP2, "123"))
+	assert.Equal(t, "$2\r\nhi\r\n", VerbatimResponse(RESP2, "txt", "hi"))
+	assert.Equal(t, "", AttributeResponse(RESP2, "ttl", "10"))
+	assert.Equal(t, "*-1\r\n", NullArrayResponse(RESP2))
+	assert.Equal(t, "_\r\n", NullArrayResponse(RESP3))
+	assert.Equal(t, ">1\r\n", PushHeader(RESP3, 1))
+	assert.Equal(t, "*1\r\n", PushHeader(RESP2, 1))
+}
+
+// run with -race: clients on separate connections hitting the same keys
+func TestParseCommands_Concurrent(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c := NewClient(nil)
+			for j := 0; j < 100; j++ {
+				key := fmt.Sprintf("fruit:%d", j % 10)
+				val, err := handler.ParseClientCommands(c,
+					EncodeCommand(toArgs("set", key, strconv.Itoa(i), "px", "50")) +
+					EncodeCommand(toArgs("get", key)) +
+					EncodeCommand(toArgs("xadd", "basket", "*", "fruit", key)) +
+					EncodeCommand(toArgs("type", "basket")) +
+					EncodeCommand(toArgs("keys", "*")),
+				)
+				assert.Nil(t, err)
+				assert.Equal(t, 5, len(val))
+				assert.Equal(t, "+OK\r\n", val[0])
+				assert.Equal(t, "+stream\r\n", val[3])
+			}
+		}(i)
 	}
+	wg.Wait()
+
+	val, err := handler.ParseCommands(EncodeCommand(toArgs("xrange", "basket", "-", "+")))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(val[0], "*800\r\n"))
+}
+
+func TestParseCommands_Wait(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	replica := NewClient(nil)
+	_, err := handler.ParseClientCommands(replica, EncodeCommand(toArgs("psync", "?", "-1")))
+	assert.Nil(t, err)
+
+	// nothing written yet, so every replica is up to date
+	client := NewClient(nil)
+	val, err := handler.ParseClientCommands(client, EncodeCommand(toArgs("wait", "1", "0")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{":1\r\n"}, val)
+
+	// the first write is preceded by a SELECT of the client's database
+	selectDB := EncodeCommand(toArgs("SELECT", "0"))
+	set := EncodeCommand(toArgs("set", "mango", "raspberry"))
+	val, err = handler.ParseClientCommands(client, set)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"+OK\r\n"}, val)
+
+	// the replica acknowledges the write while the client waits for it
+	propagated := make(chan []string, 1)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		// no reply to the ACK itself, only what was propagated to the replica
+		val, _ := handler.ParseClientCommands(replica, EncodeCommand(toArgs("replconf", "ack", strconv.Itoa(len(selectDB) + len(set)))))
+		propagated <- val
+	}()
+
+	start := time.Now()
+	val, err = handler.ParseClientCommands(client, EncodeCommand(toArgs("wait", "1", "2000")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{":1\r\n"}, val)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// the write and a GETACK were propagated to the replica, in order
+	assert.Equal(t, []string{selectDB, set, EncodeCommand(toArgs("REPLCONF", "GETACK", "*"))}, <-propagated)
+
+	// a write the replica never acknowledges times out
+	handler.ParseClientCommands(client, set)
+	val, err = handler.ParseClientCommands(client, EncodeCommand(toArgs("wait", "1", "100")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{":0\r\n"}, val)
 }
 
+func TestParseCommands_BlockedClientDisconnects(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
 
-// TestParseRequest
+	client := NewClient(nil)
+	done := make(chan []string)
+	go func() {
+		val, _ := handler.ParseClientCommands(client, EncodeCommand(toArgs("xread", "block", "0", "streams", "orange", "$")))
+		done <- val
+	}()
 
-func TestParseRequest(t *testing.T) {
-	req, err := ParseRequest("*1\r\n$4\r\nping\r\n")
+	// the executor keeps serving other clients while one is blocked
+	time.Sleep(50 * time.Millisecond)
+	val, err := handler.ParseCommands(EncodeCommand(toArgs("ping")))
 	assert.Nil(t, err)
-	assert.Equal(t, []string{"*1\r\n$4\r\nping\r\n"}, req)
+	assert.Equal(t, []string{"+PONG\r\n"}, val)
+
+	handler.Disconnect(client)
+	select {
+		case val := <-done:
+			assert.Equal(t, []string{}, val)
+		case <-time.After(time.Second):
+			t.Fatal("blocked client was not released on disconnect")
+	}
+
+	assert.Equal(t, 0, len(handler.blockingKeys))
+}
+
+func TestParseCommands_BlockedClientsAllServed(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	results := make(chan []string, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			val, _ := handler.ParseClientCommands(NewClient(nil), EncodeCommand(toArgs("xread", "block", "0", "streams", "orange", "$")))
+			results <- val
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// a single entry wakes up every client reading the stream
+	handler.ParseCommands(EncodeCommand(toArgs("xadd", "orange", "1-1", "temperature", "90")))
+
+	expected := []string{"*1\r\n*2\r\n$6\r\norange\r\n*1\r\n*2\r\n$3\r\n1-1\r\n*2\r\n$11\r\ntemperature\r\n$2\r\n90\r\n"}
+	for i := 0; i < 2; i++ {
+		select {
+			case val := <-results:
+				assert.Equal(t, expected, val)
+			case <-time.After(time.Second):
+				t.Fatal("blocked client was not served")
+		}
+	}
+}
+
+// blockOn runs a blocking command for a new client in the background, and
+// waits long enough for it to block
+func blockOn(handler *Commands, args ...string) (*Client, chan []string) {
+	client := NewClient(nil)
+	results := make(chan []string, 1)
+	go func() {
+		val, _ := handler.ParseClientCommands(client, EncodeCommand(toArgs(args...)))
+		results <- val
+	}()
+	time.Sleep(30 * time.Millisecond)
+	return client, results
+}
+
+func receive(t *testing.T, results chan []string) []string {
+	select {
+		case val := <-results:
+			return val
+		case <-time.After(time.Second):
+			t.Fatal("blocked client was not served")
+			return nil
+	}
+}
 
-	_, err = ParseRequest("1\r\n$4\r\nping\r\n")
-	assert.NotNil(t, err)
+func TestParseCommands_BlockingPopFIFO(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+	replica := NewClient(nil)
+	handler.ParseClientCommands(replica, EncodeCommand(toArgs("psync", "?", "-1")))
+
+	_, first := blockOn(handler, "brpop", "queue", "0")
+	_, second := blockOn(handler, "brpop", "other", "queue", "0")
+	_, third := blockOn(handler, "blpop", "queue", "0")
+
+	// a single element wakes a single client, the one that blocked first
+	handler.ParseCommands(EncodeCommand(toArgs("lpush", "queue", "x")))
+	assert.Equal(t, []string{"*2\r\n$5\r\nqueue\r\n$1\r\nx\r\n"}, receive(t, first))
+	select {
+		case val := <-second:
+			t.Fatalf("second client served without an element: %q", val)
+		case <-third:
+			t.Fatal("third client served without an element")
+		case <-time.After(50 * time.Millisecond):
+	}
 
-	req, err = ParseRequest("*2\r\n$4\r\necho\r\n$11\r\nHello World\r\n")
+	handler.ParseCommands(EncodeCommand(toArgs("rpush", "queue", "y", "z")))
+	assert.Equal(t, []string{"*2\r\n$5\r\nqueue\r\n$1\r\nz\r\n"}, receive(t, second))
+	assert.Equal(t, []string{"*2\r\n$5\r\nqueue\r\n$1\r\ny\r\n"}, receive(t, third))
+	assert.Equal(t, 0, len(handler.blockingKeys))
+
+	val, err := handler.ParseCommands(EncodeCommand(toArgs("exists", "queue")))
 	assert.Nil(t, err)
-	assert.Equal(t, []string{"*2\r\n$4\r\necho\r\n$11\r\nHello World\r\n"}, req)
+	assert.Equal(t, []string{":0\r\n"}, val)
+
+	// replicas see the pops, not the blocking commands
+	assert.Equal(t, []string{
+		EncodeCommand(toArgs("SELECT", "0")),
+		EncodeCommand(toArgs("lpush", "queue", "x")), EncodeCommand(toArgs("RPOP", "queue")),
+		EncodeCommand(toArgs("rpush", "queue", "y", "z")), EncodeCommand(toArgs("RPOP", "queue")), EncodeCommand(toArgs("LPOP", "queue")),
+	}, replica.takeReplies())
+}
+
+func TestParseCommands_BlockingPopTimeout(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
 
-	req, err = ParseRequest("+FULLRESYNC 75cd7bc10c49047e0d163660f3b90625b1af31dc 0\r\n")
+	started := time.Now()
+	val, err := handler.ParseCommands(EncodeCommand(toArgs("blpop", "missing", "0.1")))
 	assert.Nil(t, err)
-	assert.Equal(t, []string{"+FULLRESYNC 75cd7bc10c49047e0d163660f3b90625b1af31dc 0\r\n"}, req)
+	assert.Equal(t, []string{"*-1\r\n"}, val)
+	assert.GreaterOrEqual(t, time.Since(started), 100 * time.Millisecond)
+	assert.Less(t, time.Since(started), time.Second)
+
+	val, err = handler.ParseCommands(
+		EncodeCommand(toArgs("blmove", "missing", "dst", "left", "right", "0.05")) +
+		EncodeCommand(toArgs("blmpop", "0.05", "1", "missing", "left")) +
+		EncodeCommand(toArgs("rpush", "list", "a", "b")) +
+		EncodeCommand(toArgs("blpop", "missing", "list", "0")) +
+		EncodeCommand(toArgs("blpop", "list", "-1")) +
+		EncodeCommand(toArgs("blpop", "list", "soon")) +
+		EncodeCommand(toArgs("blpop", "list", "inf")) +
+		EncodeCommand(toArgs("set", "str", "v")) +
+		EncodeCommand(toArgs("blpop", "missing", "str", "list", "0")) +
+		EncodeCommand(toArgs("blpop", "list", "str", "0")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"$-1\r\n", "*-1\r\n", ":2\r\n",
+		"*2\r\n$4\r\nlist\r\n$1\r\na\r\n",
+		"-ERR timeout is negative\r\n",
+		"-ERR timeout is not a float or out of range\r\n",
+		"-ERR timeout is not a float or out of range\r\n",
+		"+OK\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		"*2\r\n$4\r\nlist\r\n$1\r\nb\r\n",
+	}, val)
+	assert.Equal(t, 0, len(handler.blockingKeys))
 
-	req, err = ParseRequest("$88\r\nREDIS0011\xfa\tredis-ver\x057.2.0\xfa\nredis-bits\xc0@\xfa\x05ctime\xc2m\b\xbce\xfa\bused-mem°\xc4\x10\x00\xfa\baof-base\xc0\x00\xff\xf0n;\xfe\xc0\xffZ\xa2")
+	// a disconnected client stops waiting
+	client, results := blockOn(handler, "brpop", "missing", "0")
+	handler.Disconnect(client)
+	assert.Equal(t, []string{}, receive(t, results))
+	assert.Equal(t, 0, len(handler.blockingKeys))
+}
+
+func TestParseCommands_BlockingMove(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	// the element moved by BLMOVE serves a client blocked on the destination
+	_, mover := blockOn(handler, "blmove", "src", "dst", "right", "left", "0")
+	_, popper := blockOn(handler, "blpop", "dst", "0")
+
+	handler.ParseCommands(EncodeCommand(toArgs("rpush", "src", "a", "b")))
+	assert.Equal(t, []string{"$1\r\nb\r\n"}, receive(t, mover))
+	assert.Equal(t, []string{"*2\r\n$3\r\ndst\r\n$1\r\nb\r\n"}, receive(t, popper))
+
+	// a key holding another type keeps the client blocked
+	_, results := blockOn(handler, "blmpop", "0", "2", "str", "jobs", "left", "count", "5")
+	handler.ParseCommands(EncodeCommand(toArgs("set", "str", "v")))
+	handler.ParseCommands(EncodeCommand(toArgs("rpush", "jobs", "1", "2")))
+	assert.Equal(t, []string{"*2\r\n$4\r\njobs\r\n*2\r\n$1\r\n1\r\n$1\r\n2\r\n"}, receive(t, results))
+
+	val, err := handler.ParseCommands(
+		EncodeCommand(toArgs("rpush", "l1", "a", "b", "c")) +
+		EncodeCommand(toArgs("lmpop", "2", "missing", "l1", "right", "count", "2")) +
+		EncodeCommand(toArgs("lmpop", "1", "l1", "left")) +
+		EncodeCommand(toArgs("lmpop", "1", "l1", "left")) +
+		EncodeCommand(toArgs("lmpop", "0", "l1", "left")) +
+		EncodeCommand(toArgs("lmpop", "3", "l1", "left")) +
+		EncodeCommand(toArgs("lmpop", "1", "l1", "up")) +
+		EncodeCommand(toArgs("lmpop", "1", "l1", "left", "count", "0")) +
+		EncodeCommand(toArgs("lmpop", "1", "l1", "left", "limit", "1")),
+	)
 	assert.Nil(t, err)
-	assert.Equal(t, []string{"$88\r\nREDIS0011\xfa\tredis-ver\x057.2.0\xfa\nredis-bits\xc0@\xfa\x05ctime\xc2m\b\xbce\xfa\bused-mem°\xc4\x10\x00\xfa\baof-base\xc0\x00\xff\xf0n;\xfe\xc0\xffZ\xa2"}, req)
+	assert.Equal(t, []string{
+		":3\r\n",
+		"*2\r\n$2\r\nl1\r\n*2\r\n$1\r\nc\r\n$1\r\nb\r\n",
+		"*2\r\n$2\r\nl1\r\n*1\r\n$1\r\na\r\n",
+		"*-1\r\n",
+		"-ERR numkeys should be greater than 0\r\n",
+		"-ERR syntax error\r\n", "-ERR syntax error\r\n",
+		"-ERR count should be greater than 0\r\n",
+		"-ERR syntax error\r\n",
+	}, val)
+}
 
-	req, err = ParseRequest("+FULLRESYNC 75cd7bc10c49047e0d163660f3b90625b1af31dc 0\r\n$88\r\nREDIS0011\xfa\tredis-ver\x057.2.0\xfa\nredis-bits\xc0@\xfa\x05ctime\xc2m\b\xbce\xfa\bused-mem°\xc4\x10\x00\xfa\baof-base\xc0\x00\xff\xf0n;\xfe\xc0\xffZ\xa2*3\r\n$8\r\nREPLCONF\r\n$6\r\nGETACK\r\n$1\r\n*\r\n")
+func TestParseCommands_BlockingZPop(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+	replica := NewClient(nil)
+	handler.ParseClientCommands(replica, EncodeCommand(toArgs("psync", "?", "-1")))
+
+	_, first := blockOn(handler, "bzpopmin", "other", "sched", "0")
+	_, second := blockOn(handler, "bzmpop", "0", "1", "sched", "max", "count", "2")
+	replica.takeReplies()
+
+	handler.ParseCommands(EncodeCommand(toArgs("zadd", "sched", "5", "late", "1", "early", "3", "mid")))
+	assert.Equal(t, []string{"*3\r\n$5\r\nsched\r\n$5\r\nearly\r\n$1\r\n1\r\n"}, receive(t, first))
+	assert.Equal(t, []string{"*2\r\n$5\r\nsched\r\n*2\r\n*2\r\n$4\r\nlate\r\n$1\r\n5\r\n*2\r\n$3\r\nmid\r\n$1\r\n3\r\n"}, receive(t, second))
+
+	// replicas pop what the served clients popped
+	assert.Equal(t, []string{
+		EncodeCommand(toArgs("SELECT", "0")),
+		EncodeCommand(toArgs("zadd", "sched", "5", "late", "1", "early", "3", "mid")),
+		EncodeCommand(toArgs("ZPOPMIN", "sched")),
+		EncodeCommand(toArgs("ZPOPMAX", "sched", "2")),
+	}, replica.takeReplies())
+
+	_, timedOut := blockOn(handler, "bzpopmax", "sched", "0.05")
+	assert.Equal(t, []string{"*-1\r\n"}, receive(t, timedOut))
+}
+
+func TestParseCommands_Databases(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+	client := NewClient(nil)
+
+	val, err := handler.ParseClientCommands(client,
+		EncodeCommand(toArgs("set", "mango", "raspberry", "px", "100000")) +
+		EncodeCommand(toArgs("select", "1")) +
+		EncodeCommand(toArgs("get", "mango")) +
+		EncodeCommand(toArgs("dbsize")) +
+		EncodeCommand(toArgs("select", "16")) +
+		EncodeCommand(toArgs("select", "one")) +
+		EncodeCommand(toArgs("config", "get", "databases")),
+	)
 	assert.Nil(t, err)
 	assert.Equal(t, []string{
-		"+FULLRESYNC 75cd7bc10c49047e0d163660f3b90625b1af31dc 0\r\n",
-		"$88\r\nREDIS0011\xfa\tredis-ver\x057.2.0\xfa\nredis-bits\xc0@\xfa\x05ctime\xc2m\b\xbce\xfa\bused-mem°\xc4\x10\x00\xfa\baof-base\xc0\x00\xff\xf0n;\xfe\xc0\xffZ\xa2",
-		"*3\r\n$8\r\nREPLCONF\r\n$6\r\nGETACK\r\n$1\r\n*\r\n",
-	}, req)
+		"+OK\r\n", "+OK\r\n", "$-1\r\n", ":0\r\n",
+		"-ERR DB index is out of range\r\n",
+		"-ERR value is not an integer or out of range\r\n",
+		"*2\r\n$9\r\ndatabases\r\n$2\r\n16\r\n",
+	}, val)
+
+	// MOVE keeps the expiration and refuses to overwrite the destination
+	val, err = handler.ParseClientCommands(client,
+		EncodeCommand(toArgs("select", "0")) +
+		EncodeCommand(toArgs("move", "mango", "1")) +
+		EncodeCommand(toArgs("move", "mango", "1")) +
+		EncodeCommand(toArgs("move", "mango", "0")) +
+		EncodeCommand(toArgs("set", "mango", "papaya")) +
+		EncodeCommand(toArgs("move", "mango", "1")) +
+		EncodeCommand(toArgs("get", "mango")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"+OK\r\n", ":1\r\n", ":0\r\n", "-ERR source and destination objects are the same\r\n", "+OK\r\n", ":0\r\n", "$6\r\npapaya\r\n"}, val)
+
+	moved, exists := handler.Store.DB(1).Keyspace.Lookup("mango")
+	assert.True(t, exists)
+	assert.Equal(t, []byte("raspberry"), moved.Value)
+	assert.Greater(t, moved.Expiration, time.Now().UnixMilli())
+
+	// SWAPDB is seen by every client connected to the swapped databases
+	val, err = handler.ParseClientCommands(client,
+		EncodeCommand(toArgs("swapdb", "0", "1")) +
+		EncodeCommand(toArgs("get", "mango")) +
+		EncodeCommand(toArgs("swapdb", "0", "x")) +
+		EncodeCommand(toArgs("swapdb", "0", "99")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"+OK\r\n", "$9\r\nraspberry\r\n", "-ERR invalid second DB index\r\n", "-ERR DB index is out of range\r\n"}, val)
+
+	val, err = handler.ParseClientCommands(client,
+		EncodeCommand(toArgs("flushdb", "async")) +
+		EncodeCommand(toArgs("dbsize")) +
+		EncodeCommand(toArgs("select", "1")) +
+		EncodeCommand(toArgs("dbsize")) +
+		EncodeCommand(toArgs("flushall", "now")) +
+		EncodeCommand(toArgs("flushall", "sync")) +
+		EncodeCommand(toArgs("dbsize")),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"+OK\r\n", ":0\r\n", "+OK\r\n", ":1\r\n", "-ERR syntax error\r\n", "+OK\r\n", ":0\r\n"}, val)
+}
+
+func TestParseCommands_BlockedClientsAfterSwapDB(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	done := make(chan []string)
+	go func() {
+		val, _ := handler.ParseClientCommands(NewClient(nil), EncodeCommand(toArgs("xread", "block", "0", "streams", "orange", "0-0")))
+		done <- val
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// an entry added to another database does not serve the client, until
+	// that database is swapped with the one the client reads from
+	handler.ParseCommands(EncodeCommand(toArgs("select", "3")) + EncodeCommand(toArgs("xadd", "orange", "1-1", "temperature", "90")))
+	select {
+		case <-done:
+			t.Fatal("client served from another database")
+		case <-time.After(50 * time.Millisecond):
+	}
+
+	handler.ParseCommands(EncodeCommand(toArgs("swapdb", "3", "0")))
+	select {
+		case val := <-done:
+			assert.Equal(t, []string{"*1\r\n*2\r\n$6\r\norange\r\n*1\r\n*2\r\n$3\r\n1-1\r\n*2\r\n$11\r\ntemperature\r\n$2\r\n90\r\n"}, val)
+		case <-time.After(time.Second):
+			t.Fatal("blocked client was not served after SWAPDB")
+	}
+}
+
+func TestParseCommands_PropagateSelect(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
 
-	req, err = ParseRequest("*5\r\n$3\r\nset\r\n$5\r\nmango\r\n$9\r\nraspberry\r\n$2\r\npx\r\n$3\r\n100\r\n*5\r\n$3\r\nset\r\n$5\r\nmango\r\n$9\r\nraspberry\r\n$2\r\npx\r\n$3\r\n100\r\n*5\r\n$3\r\nset\r\n$5\r\nmango\r\n$9\r\nraspberry\r\n$2\r\npx\r\n$3\r\n100\r\n")
+	replica := NewClient(nil)
+	_, err := handler.ParseClientCommands(replica, EncodeCommand(toArgs("psync", "?", "-1")))
 	assert.Nil(t, err)
+
+	first, second := NewClient(nil), NewClient(nil)
+	handler.ParseClientCommands(first, EncodeCommand(toArgs("set", "mango", "1")))
+	handler.ParseClientCommands(second, EncodeCommand(toArgs("select", "2")) + EncodeCommand(toArgs("set", "kiwi", "2")))
+	handler.ParseClientCommands(second, EncodeCommand(toArgs("set", "kiwi", "3")))
+	handler.ParseClientCommands(first, EncodeCommand(toArgs("set", "mango", "4")))
+
 	assert.Equal(t, []string{
-		"*5\r\n$3\r\nset\r\n$5\r\nmango\r\n$9\r\nraspberry\r\n$2\r\npx\r\n$3\r\n100\r\n",
-		"*5\r\n$3\r\nset\r\n$5\r\nmango\r\n$9\r\nraspberry\r\n$2\r\npx\r\n$3\r\n100\r\n",
-		"*5\r\n$3\r\nset\r\n$5\r\nmango\r\n$9\r\nraspberry\r\n$2\r\npx\r\n$3\r\n100\r\n",
-	}, req)
+		EncodeCommand(toArgs("SELECT", "0")), EncodeCommand(toArgs("set", "mango", "1")),
+		EncodeCommand(toArgs("SELECT", "2")), EncodeCommand(toArgs("set", "kiwi", "2")),
+		EncodeCommand(toArgs("set", "kiwi", "3")),
+		EncodeCommand(toArgs("SELECT", "0")), EncodeCommand(toArgs("set", "mango", "4")),
+	}, replica.takeReplies())
+
+	// the replica applies the writes to the same databases
+	replicaHandler := createCommandsHandler(RoleSlave)
+	master := NewClient(nil)
+	master.IsMaster = true
+	_, err = replicaHandler.ParseClientCommands(master,
+		EncodeCommand(toArgs("SELECT", "2")) + EncodeCommand(toArgs("set", "kiwi", "3")),
+	)
+	assert.Nil(t, err)
+	val, exists := replicaHandler.Store.DB(2).KVStore.Get("kiwi")
+	assert.True(t, exists)
+	assert.Equal(t, []byte("3"), val)
+}
+
+func TestReadFromRDBFile_SelectDB(t *testing.T) {
+	rdb := "REDIS0011" +
+		"\xfe\x00\xfb\x01\x00" +
+		"\x00\x05mango\x09raspberry" +
+		"\xfe\x03\xfb\x01\x00" +
+		"\x00\x04kiwi\x05green" +
+		"\xff\x00\x00\x00\x00\x00\x00\x00\x00"
+
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "dump.rdb"), []byte(rdb), 0644))
+
+	handler := createCommandsHandler(RoleMaster)
+	handler.Store.Config.Dir = dir
+	handler.Store.Config.DbFileName = "dump.rdb"
+
+	handler.Store.InitializeDB()
+	assert.Equal(t, 1, handler.Store.DB(0).Keyspace.Len())
+	assert.Equal(t, 1, handler.Store.DB(3).Keyspace.Len())
+
+	val, err := handler.ParseCommands(EncodeCommand(toArgs("get", "kiwi")) + EncodeCommand(toArgs("select", "3")) + EncodeCommand(toArgs("get", "kiwi")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"$-1\r\n", "+OK\r\n", "$5\r\ngreen\r\n"}, val)
 }
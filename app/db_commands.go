@@ -0,0 +1,124 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// parseDBIndex parses a database index argument, returning errNotInteger when it
+// is not an integer and with an out of range error when no such database exists
+func (ch *Commands) parseDBIndex(arg []byte, errNotInteger error) (int, error) {
+	index, err := strconv.Atoi(string(arg))
+	if err != nil {
+		return 0, errNotInteger
+	}
+	if !ch.Store.ValidDB(index) {
+		return 0, NewCommandError("DB index is out of range")
+	}
+	return index, nil
+}
+
+// SelectHandler changes the database the client works on. Usage: SELECT index
+func (ch *Commands) SelectHandler(c *Client, args [][]byte) ([]string, error) {
+	index, err := ch.parseDBIndex(args[1], ErrNotInteger)
+	if err != nil {
+		return nil, err
+	}
+
+	c.DB = index
+	return OKResponse(), nil
+}
+
+// MoveHandler moves a key, with its expiration, to another database. It
+// replies 0 when the key is missing or already exists in the destination.
+// Usage: MOVE key db
+func (ch *Commands) MoveHandler(c *Client, args [][]byte) ([]string, error) {
+	dst, err := ch.parseDBIndex(args[2], ErrNotInteger)
+	if err != nil {
+		return nil, err
+	}
+	if dst == c.DB {
+		return nil, NewCommandError("source and destination objects are the same")
+	}
+
+	key := string(args[1])
+	src, dstDB := ch.db(c), ch.Store.DB(dst)
+
+	obj, exists := src.Keyspace.Lookup(key)
+	if !exists {
+		return []string{intReply(0)}, nil
+	}
+	if _, exists := dstDB.Keyspace.Lookup(key); exists {
+		return []string{intReply(0)}, nil
+	}
+
+	dstDB.Keyspace.Set(key, obj)
+	src.Keyspace.Delete(key)
+	ch.signalKeyAsReady(dst, key)
+
+	return []string{intReply(1)}, nil
+}
+
+// SwapDBHandler exchanges the contents of two databases. Clients blocked on
+// keys of either database are retried against their new contents.
+// Usage: SWAPDB index1 index2
+func (ch *Commands) SwapDBHandler(c *Client, args [][]byte) ([]string, error) {
+	first, err := ch.parseDBIndex(args[1], NewCommandError("invalid first DB index"))
+	if err != nil {
+		return nil, err
+	}
+	second, err := ch.parseDBIndex(args[2], NewCommandError("invalid second DB index"))
+	if err != nil {
+		return nil, err
+	}
+
+	if first != second {
+		ch.Store.SwapDB(first, second)
+		ch.signalDBAsReady(first)
+		ch.signalDBAsReady(second)
+	}
+	return OKResponse(), nil
+}
+
+// FlushDBHandler removes every key of the selected database.
+// Usage: FLUSHDB [ASYNC | SYNC]
+func (ch *Commands) FlushDBHandler(c *Client, args [][]byte) ([]string, error) {
+	if err := parseFlushMode(args); err != nil {
+		return nil, err
+	}
+
+	ch.db(c).Keyspace.Flush()
+	return OKResponse(), nil
+}
+
+// FlushAllHandler removes every key of every database.
+// Usage: FLUSHALL [ASYNC | SYNC]
+func (ch *Commands) FlushAllHandler(c *Client, args [][]byte) ([]string, error) {
+	if err := parseFlushMode(args); err != nil {
+		return nil, err
+	}
+
+	ch.Store.FlushAll()
+	return OKResponse(), nil
+}
+
+// parseFlushMode validates the optional ASYNC or SYNC argument of the flush
+// commands. Flushing swaps in empty keyspaces, leaving the old ones to the
+// garbage collector, so both modes return without walking the keys.
+func parseFlushMode(args [][]byte) error {
+	if len(args) == 1 {
+		return nil
+	}
+	if len(args) == 2 {
+		switch Command(strings.ToUpper(string(args[1]))) {
+			case ASYNC, SYNC:
+				return nil
+		}
+	}
+	return ErrSyntax
+}
+
+// DBSizeHandler replies with the number of keys in the selected database
+func (ch *Commands) DBSizeHandler(c *Client, args [][]byte) ([]string, error) {
+	return []string{intReply(ch.db(c).Keyspace.Len())}, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/store"
+)
+
+const (
+	ErrPrefix = "ERR"
+	WrongTypePrefix = "WRONGTYPE"
+	InvalidObjPrefix = "INVALIDOBJ"
+)
+
+// CommandError is an error reply. Handlers return it to have it written back
+// to the client, which keeps its connection and goes on with its pipeline.
+// Prefix is the error code the reply starts with, such as ERR or WRONGTYPE.
+type CommandError struct {
+	Prefix  string
+	Message string
+}
+
+var (
+	ErrSyntax = NewCommandError("syntax error")
+	ErrWrongType = &CommandError{Prefix: WrongTypePrefix, Message: "Operation against a key holding the wrong kind of value"}
+	ErrNotInteger = NewCommandError("value is not an integer or out of range")
+	ErrTimeoutNotInteger = NewCommandError("timeout is not an integer or out of range")
+	ErrNotValidFloat = NewCommandError("value is not a valid float")
+	ErrMinMaxNotFloat = NewCommandError("min or max is not a float")
+	ErrMinMaxNotLex = NewCommandError("min or max not valid string range item")
+)
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("%s %s", e.Prefix, e.Message)
+}
+
+// NewCommandError() Creates a new ERR reply from a formatted message
+func NewCommandError(format string, args ...interface{}) *CommandError {
+	return &CommandError{
+		Prefix: ErrPrefix,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// UnknownCommandError is the reply to a command missing from the command table
+func UnknownCommandError(args [][]byte) *CommandError {
+	var sb strings.Builder
+	for _, arg := range args[1:] {
+		fmt.Fprintf(&sb, "'%s' ", truncateArg(arg))
+	}
+	return NewCommandError("unknown command '%s', with args beginning with: %s", truncateArg(args[0]), sb.String())
+}
+
+// WrongArityError is the reply to a command called with the wrong number of arguments
+func WrongArityError(spec *CommandSpec) *CommandError {
+	return NewCommandError("wrong number of arguments for '%s' command", spec.FullName)
+}
+
+// ErrorResponse encodes err as an error reply. Errors other than
+// CommandError are reported with the generic ERR prefix.
+func ErrorResponse(err error) []string {
+	var commandErr *CommandError
+	if !errors.As(err, &commandErr) {
+		commandErr = NewCommandError("%s", err.Error())
+	}
+
+	return []string{fmt.Sprintf("%s%s %s%s", ErrorsFirstChar, commandErr.Prefix, sanitizeLine(commandErr.Message), CLRF)}
+}
+
+// storeError converts an error of the store to its reply. Store errors are
+// worded as replies already, except for the wrong type one.
+func storeError(err error) error {
+	switch err {
+		case store.ErrWrongType:
+			return ErrWrongType
+		case store.ErrNotHyperLogLog:
+			return &CommandError{Prefix: WrongTypePrefix, Message: err.Error()}
+		case store.ErrCorruptHyperLogLog:
+			return &CommandError{Prefix: InvalidObjPrefix, Message: err.Error()}
+	}
+	return NewCommandError("%s", err.Error())
+}
+
+// truncateArg shortens an argument echoed back in an error reply, the same
+// way redis limits them to 128 characters
+func truncateArg(arg []byte) string {
+	if len(arg) > 128 {
+		return string(arg[:128])
+	}
+	return string(arg)
+}
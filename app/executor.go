@@ -0,0 +1,83 @@
+package main
+
+// Executor runs tasks one at a time on a single goroutine. Every command is
+// executed through it, so commands are atomic with respect to each other and
+// handlers never need locks, the same way redis runs its event loop.
+type Executor struct {
+	tasks chan func()
+}
+
+// NewExecutor() Creates a new Executor. Tasks are only run once Run is started.
+func NewExecutor() *Executor {
+	return &Executor{
+		tasks: make(chan func(), 1024),
+	}
+}
+
+// Run executes submitted tasks until the process exits
+func (e *Executor) Run() {
+	for task := range e.tasks {
+		task()
+	}
+}
+
+// Submit queues task to run on the executor goroutine. It must not be called
+// from a task, as it may block until the executor has room for it.
+func (e *Executor) Submit(task func()) {
+	e.tasks <- task
+}
+
+// Execute runs a command for client c on the executor and waits until it has
+// completed. A blocking command only completes once it is served, times out
+// or the client disconnects. Its replies are queued on the client.
+func (ch *Commands) Execute(c *Client, args [][]byte) {
+	done := make(chan struct{})
+
+	ch.executor.Submit(func() {
+		resp := ch.CommandsHandler(c, args)
+
+		if c.blocked != nil {
+			// the reply is sent when the client is unblocked
+			c.blocked.done = done
+			if c.disconnected {
+				ch.unblockClient(c, nil)
+			}
+		} else {
+			c.Reply(resp)
+			close(done)
+		}
+
+		ch.handleClientsBlockedOnKeys()
+	})
+
+	<-done
+}
+
+// Disconnect marks a client whose connection closed. A command it is blocked
+// on is aborted without a reply, and so are blocking commands it still had
+// pending.
+func (ch *Commands) Disconnect(c *Client) {
+	ch.runOnExecutor(func() {
+		c.disconnected = true
+		ch.unblockClient(c, nil)
+	})
+}
+
+// FreeClient forgets a disconnected client once its last command completed
+func (ch *Commands) FreeClient(c *Client) {
+	ch.runOnExecutor(func() {
+		delete(ch.Replicas, c)
+	})
+}
+
+// runOnExecutor runs task on the executor and waits for it
+func (ch *Commands) runOnExecutor(task func()) {
+	done := make(chan struct{})
+
+	ch.executor.Submit(func() {
+		task()
+		close(done)
+	})
+
+	<-done
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExpireHandler sets a key to expire after a number of seconds.
+// Usage: EXPIRE key seconds [NX | XX | GT | LT]
+func (ch *Commands) ExpireHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.expire(c, args, EX, "expire")
+}
+
+// PExpireHandler sets a key to expire after a number of milliseconds.
+// Usage: PEXPIRE key milliseconds [NX | XX | GT | LT]
+func (ch *Commands) PExpireHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.expire(c, args, PX, "pexpire")
+}
+
+// ExpireAtHandler sets a key to expire at a unix time in seconds.
+// Usage: EXPIREAT key unix-time-seconds [NX | XX | GT | LT]
+func (ch *Commands) ExpireAtHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.expire(c, args, EXAT, "expireat")
+}
+
+// PExpireAtHandler sets a key to expire at a unix time in milliseconds.
+// Usage: PEXPIREAT key unix-time-milliseconds [NX | XX | GT | LT]
+func (ch *Commands) PExpireAtHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.expire(c, args, PXAT, "pexpireat")
+}
+
+// expire implements the EXPIRE family, whose time argument is given in unit
+// (EX, PX, EXAT or PXAT). NX only sets an expiration on keys without one, XX
+// only on keys with one, GT only when it is later than the current one and LT
+// only when it is earlier, keys without an expiration counting as never
+// expiring. It replies 1 when the expiration was set. Replicas receive it as
+// an absolute PEXPIREAT, or as a DEL when it is already in the past.
+func (ch *Commands) expire(c *Client, args [][]byte, unit Command, command string) ([]string, error) {
+	nx, xx, gt, lt := false, false, false, false
+	for _, arg := range args[3:] {
+		switch Command(strings.ToUpper(string(arg))) {
+			case NX:
+				nx = true
+			case XX:
+				xx = true
+			case GT:
+				gt = true
+			case LT:
+				lt = true
+			default:
+				return nil, NewCommandError("Unsupported option %s", truncateArg(arg))
+		}
+	}
+	if nx && (xx || gt || lt) {
+		return nil, NewCommandError("NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if gt && lt {
+		return nil, NewCommandError("GT and LT options at the same time are not compatible")
+	}
+
+	at, err := parseExpireArg(args[2], unit, command)
+	if err != nil {
+		return nil, err
+	}
+
+	db := ch.db(c)
+	key := string(args[1])
+
+	current, exists := db.Keyspace.Expiration(key)
+	persistent := current == -1
+	switch {
+		case !exists,
+			nx && !persistent,
+			xx && persistent,
+			gt && (persistent || at <= current),
+			lt && !persistent && at >= current:
+			c.noPropagate = true
+			return []string{intReply(0)}, nil
+	}
+
+	// an expiration in the past deletes the key right away, except on
+	// replicas, which wait for the master to delete it
+	if at <= time.Now().UnixMilli() && !c.IsMaster {
+		db.Keyspace.Delete(key)
+		c.Argv = toBytesArgs(string(DEL), key)
+		return []string{intReply(1)}, nil
+	}
+
+	db.Keyspace.SetExpiration(key, at)
+	c.Argv = append(toBytesArgs(string(PEXPIREAT), key, strconv.FormatInt(at, 10)), args[3:]...)
+	return []string{intReply(1)}, nil
+}
+
+// parseExpireArg converts the time argument of the EXPIRE family to an
+// absolute unix time in milliseconds. Unlike for SET it may be zero or
+// negative, which expires the key right away.
+func parseExpireArg(arg []byte, unit Command, command string) (int64, error) {
+	value, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, ErrNotInteger
+	}
+
+	invalid := NewCommandError("invalid expire time in '%s' command", command)
+	if unit == EX || unit == EXAT {
+		if value > math.MaxInt64 / 1000 || value < math.MinInt64 / 1000 {
+			return 0, invalid
+		}
+		value *= 1000
+	}
+
+	if unit == EX || unit == PX {
+		now := time.Now().UnixMilli()
+		if value > math.MaxInt64 - now {
+			return 0, invalid
+		}
+		value += now
+	}
+	return value, nil
+}
+
+// PersistHandler removes the expiration of a key, and replies 1 when it had
+// one. Usage: PERSIST key
+func (ch *Commands) PersistHandler(c *Client, args [][]byte) ([]string, error) {
+	db := ch.db(c)
+	key := string(args[1])
+
+	current, exists := db.Keyspace.Expiration(key)
+	if !exists || current == -1 {
+		c.noPropagate = true
+		return []string{intReply(0)}, nil
+	}
+
+	db.Keyspace.SetExpiration(key, -1)
+	return []string{intReply(1)}, nil
+}
+
+// TtlHandler replies with the seconds left before a key expires, -1 when it
+// does not expire and -2 when it does not exist. Usage: TTL key
+func (ch *Commands) TtlHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.ttl(c, args[1], false, false)
+}
+
+// PTtlHandler is TTL in milliseconds. Usage: PTTL key
+func (ch *Commands) PTtlHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.ttl(c, args[1], true, false)
+}
+
+// ExpireTimeHandler replies with the unix time in seconds at which a key
+// expires, -1 when it does not expire and -2 when it does not exist.
+// Usage: EXPIRETIME key
+func (ch *Commands) ExpireTimeHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.ttl(c, args[1], false, true)
+}
+
+// PExpireTimeHandler is EXPIRETIME in milliseconds. Usage: PEXPIRETIME key
+func (ch *Commands) PExpireTimeHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.ttl(c, args[1], true, true)
+}
+
+func (ch *Commands) ttl(c *Client, key []byte, ms bool, absolute bool) ([]string, error) {
+	expiration, exists := ch.db(c).Keyspace.Expiration(string(key))
+	if !exists {
+		return []string{intReply(-2)}, nil
+	}
+	if expiration == -1 {
+		return []string{intReply(-1)}, nil
+	}
+
+	ttl := expiration
+	if !absolute {
+		ttl = max(expiration - time.Now().UnixMilli(), 0)
+	}
+	if !ms {
+		ttl = (ttl + 500) / 1000
+	}
+	return []string{ResponseBuilder(IntegersRespType, strconv.FormatInt(ttl, 10))}, nil
+}
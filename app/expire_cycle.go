@@ -0,0 +1,88 @@
+package main
+
+import (
+	"time"
+)
+
+const (
+	DefaultHz = 10
+	MaxHz = 500
+
+	DefaultActiveExpireEffort = 1
+	MaxActiveExpireEffort = 10
+
+	// keys sampled per database and loop, percentage of CPU time a cycle may
+	// use and percentage of expired keys among the sampled ones below which a
+	// database is left alone, at the lowest effort. Each extra effort level
+	// samples more keys, spends more time and tolerates fewer expired keys.
+	ActiveExpireCycleKeysPerLoop = 20
+	ActiveExpireCycleSlowTimePerc = 25
+	ActiveExpireCycleAcceptableStale = 10
+)
+
+// runCron runs the periodic background tasks on the executor, Hz times per
+// second, for as long as the process lives
+func (ch *Commands) runCron() {
+	ticker := time.NewTicker(time.Second / time.Duration(ch.ServerOpts.Hz))
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ch.executor.Submit(ch.activeExpireCycle)
+	}
+}
+
+// activeExpireCycle removes expired keys nobody reads, the way redis does:
+// it samples keys with an expiration in every database, deletes the expired
+// ones and samples the same database again while many of them were expired.
+// A cycle stops once it used its share of CPU time, and the next one resumes
+// from the database it stopped at. Expired hash fields are removed the same
+// way. Deletions are propagated to the replicas, which never expire keys on
+// their own.
+func (ch *Commands) activeExpireCycle() {
+	if ch.ServerOpts.Role != RoleMaster {
+		return
+	}
+
+	effort := ch.ServerOpts.ActiveExpireEffort - 1
+	keysPerLoop := ActiveExpireCycleKeysPerLoop + ActiveExpireCycleKeysPerLoop / 4 * effort
+	timeLimit := time.Second * time.Duration(ActiveExpireCycleSlowTimePerc + 2 * effort) / time.Duration(100 * ch.ServerOpts.Hz)
+	acceptableStale := ActiveExpireCycleAcceptableStale - effort
+
+	start := time.Now()
+	for i := 0; i < len(ch.Store.DBs); i++ {
+		db := ch.Store.DB(ch.expireCycleDB)
+
+		for iteration := 0; ; iteration++ {
+			sampled, expired := db.Keyspace.ExpireSample(keysPerLoop)
+			for _, key := range expired {
+				ch.propagate(db.ID, toBytesArgs(string(DEL), key))
+			}
+
+			if sampled == 0 || len(expired) * 100 / sampled <= acceptableStale {
+				break
+			}
+			// checking the clock is not free, so only do it every few loops
+			if iteration % 16 == 15 && time.Since(start) > timeLimit {
+				return
+			}
+		}
+
+		// hash fields expire the same way, sampling hashes with fields that
+		// have an expiration
+		for iteration := 0; ; iteration++ {
+			sampled, expired := db.Keyspace.ExpireFieldsSample(keysPerLoop)
+			for _, hash := range expired {
+				ch.propagate(db.ID, toBytesArgs(append([]string{string(HDEL), hash.Key}, hash.Fields...)...))
+			}
+
+			if sampled == 0 || len(expired) * 100 / sampled <= acceptableStale {
+				break
+			}
+			if iteration % 16 == 15 && time.Since(start) > timeLimit {
+				return
+			}
+		}
+
+		ch.expireCycleDB = (ch.expireCycleDB + 1) % len(ch.Store.DBs)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"strings"
+)
+
+// DelHandler removes keys of any type and replies with how many existed.
+// Usage: DEL key [key ...]
+func (ch *Commands) DelHandler(c *Client, args [][]byte) ([]string, error) {
+	deleted := 0
+	for _, key := range args[1:] {
+		if ch.db(c).Keyspace.Delete(string(key)) {
+			deleted++
+		}
+	}
+
+	if deleted == 0 {
+		c.noPropagate = true
+	}
+	return []string{intReply(deleted)}, nil
+}
+
+// UnlinkHandler removes keys like DEL. The keys are only detached from the
+// keyspace here, and values larger than LazyfreeThreshold elements are
+// released in the background, so unlinking them does not hold up other
+// commands. Usage: UNLINK key [key ...]
+func (ch *Commands) UnlinkHandler(c *Client, args [][]byte) ([]string, error) {
+	unlinked := 0
+	for _, key := range args[1:] {
+		obj, existed := ch.db(c).Keyspace.Unlink(string(key))
+		if obj == nil {
+			continue
+		}
+		if existed {
+			unlinked++
+		}
+		ch.lazyfree.free(obj)
+	}
+
+	if unlinked == 0 {
+		c.noPropagate = true
+	}
+	return []string{intReply(unlinked)}, nil
+}
+
+// ExistsHandler replies with how many of the keys exist. A key given several
+// times is counted as many times. Usage: EXISTS key [key ...]
+func (ch *Commands) ExistsHandler(c *Client, args [][]byte) ([]string, error) {
+	return []string{intReply(ch.countExisting(c, args[1:]))}, nil
+}
+
+// TouchHandler replies with how many of the keys exist. Usage: TOUCH key [key ...]
+func (ch *Commands) TouchHandler(c *Client, args [][]byte) ([]string, error) {
+	return []string{intReply(ch.countExisting(c, args[1:]))}, nil
+}
+
+func (ch *Commands) countExisting(c *Client, keys [][]byte) int {
+	count := 0
+	for _, key := range keys {
+		if _, exists := ch.db(c).Keyspace.Lookup(string(key)); exists {
+			count++
+		}
+	}
+	return count
+}
+
+// RenameHandler renames a key, with its expiration, replacing the
+// destination key. Usage: RENAME key newkey
+func (ch *Commands) RenameHandler(c *Client, args [][]byte) ([]string, error) {
+	if _, err := ch.rename(c, args[1], args[2], false); err != nil {
+		return nil, err
+	}
+	return OKResponse(), nil
+}
+
+// RenameNXHandler renames a key only when the destination does not exist,
+// and replies 1 when it was renamed. Usage: RENAMENX key newkey
+func (ch *Commands) RenameNXHandler(c *Client, args [][]byte) ([]string, error) {
+	renamed, err := ch.rename(c, args[1], args[2], true)
+	if err != nil {
+		return nil, err
+	}
+
+	if !renamed {
+		c.noPropagate = true
+		return []string{intReply(0)}, nil
+	}
+	return []string{intReply(1)}, nil
+}
+
+func (ch *Commands) rename(c *Client, src, dst []byte, nx bool) (bool, error) {
+	db := ch.db(c)
+
+	obj, exists := db.Keyspace.Lookup(string(src))
+	if !exists {
+		return false, NewCommandError("no such key")
+	}
+	if string(src) == string(dst) {
+		return !nx, nil
+	}
+	if _, exists := db.Keyspace.Lookup(string(dst)); exists && nx {
+		return false, nil
+	}
+
+	db.Keyspace.Set(string(dst), obj)
+	db.Keyspace.Delete(string(src))
+	return true, nil
+}
+
+// CopyHandler copies a key, with its expiration, to another key of the same
+// or of another database. It replies 1 when the key was copied and 0 when the
+// destination exists and REPLACE was not given.
+// Usage: COPY source destination [DB destination-db] [REPLACE]
+func (ch *Commands) CopyHandler(c *Client, args [][]byte) ([]string, error) {
+	dstIndex, replace := c.DB, false
+
+	for i := 3; i < len(args); i++ {
+		option := Command(strings.ToUpper(string(args[i])))
+		switch {
+			case option == DB && i + 1 < len(args):
+				index, err := ch.parseDBIndex(args[i + 1], ErrNotInteger)
+				if err != nil {
+					return nil, err
+				}
+				dstIndex = index
+				i++
+
+			case option == REPLACE:
+				replace = true
+
+			default:
+				return nil, ErrSyntax
+		}
+	}
+
+	src, dst := string(args[1]), string(args[2])
+	if src == dst && dstIndex == c.DB {
+		return nil, NewCommandError("source and destination objects are the same")
+	}
+
+	obj, exists := ch.db(c).Keyspace.Lookup(src)
+	if !exists {
+		c.noPropagate = true
+		return []string{intReply(0)}, nil
+	}
+
+	dstDB := ch.Store.DB(dstIndex)
+	if _, exists := dstDB.Keyspace.Lookup(dst); exists && !replace {
+		c.noPropagate = true
+		return []string{intReply(0)}, nil
+	}
+
+	dstDB.Keyspace.Set(dst, obj.Clone())
+	ch.signalKeyAsReady(dstIndex, dst)
+	return []string{intReply(1)}, nil
+}
+
+// RandomKeyHandler replies with a random key of the selected database, or a
+// null when it is empty. Usage: RANDOMKEY
+func (ch *Commands) RandomKeyHandler(c *Client, args [][]byte) ([]string, error) {
+	key, exists := ch.db(c).Keyspace.RandomKey()
+	if !exists {
+		return NullResponse(c.Protocol), nil
+	}
+	return []string{ResponseBuilder(BulkStringsRespType, key)}, nil
+}
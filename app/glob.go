@@ -0,0 +1,138 @@
+package main
+
+// MaxGlobNesting bounds the recursion of a match, so patterns with many
+// stars cannot make it take exponential time
+const MaxGlobNesting = 1000
+
+// StringMatch reports whether str matches the glob-style pattern, with the
+// semantics of redis used by KEYS, SCAN MATCH, PSUBSCRIBE and ACL key
+// patterns:
+//
+//	*        matches any sequence of bytes, including an empty one
+//	?        matches a single byte
+//	[abc]    matches one of the bytes listed
+//	[^abc]   matches a byte not listed
+//	[a-z]    matches a byte in a range, bounds in any order
+//	\x       matches x literally, also within brackets
+//
+// nocase makes the comparison ASCII case insensitive.
+func StringMatch(pattern, str []byte, nocase bool) bool {
+	skipLongerMatches := false
+	return stringMatch(pattern, str, nocase, &skipLongerMatches, 0)
+}
+
+func stringMatch(pattern, str []byte, nocase bool, skipLongerMatches *bool, nesting int) bool {
+	if nesting > MaxGlobNesting {
+		return false
+	}
+
+	for len(pattern) > 0 && len(str) > 0 {
+		switch pattern[0] {
+			case '*':
+				for len(pattern) > 1 && pattern[1] == '*' {
+					pattern = pattern[1:]
+				}
+				if len(pattern) == 1 {
+					return true
+				}
+				for len(str) > 0 {
+					if stringMatch(pattern[1:], str, nocase, skipLongerMatches, nesting + 1) {
+						return true
+					}
+					if *skipLongerMatches {
+						return false
+					}
+					str = str[1:]
+				}
+				// the rest of the pattern matches nowhere in the rest of the
+				// string, so earlier stars matching more bytes cannot help
+				*skipLongerMatches = true
+				return false
+
+			case '?':
+				str = str[1:]
+
+			case '[':
+				pattern = pattern[1:]
+				not := len(pattern) > 0 && pattern[0] == '^'
+				if not {
+					pattern = pattern[1:]
+				}
+
+				match := false
+				for len(pattern) > 0 && pattern[0] != ']' {
+					switch {
+						case pattern[0] == '\\' && len(pattern) >= 2:
+							pattern = pattern[1:]
+							if pattern[0] == str[0] {
+								match = true
+							}
+
+						case len(pattern) >= 3 && pattern[1] == '-':
+							start, end, c := pattern[0], pattern[2], str[0]
+							if start > end {
+								start, end = end, start
+							}
+							if nocase {
+								start, end, c = toLower(start), toLower(end), toLower(c)
+							}
+							pattern = pattern[2:]
+							if c >= start && c <= end {
+								match = true
+							}
+
+						default:
+							if equalByte(pattern[0], str[0], nocase) {
+								match = true
+							}
+					}
+					pattern = pattern[1:]
+				}
+
+				if not {
+					match = !match
+				}
+				if !match {
+					return false
+				}
+				str = str[1:]
+
+			case '\\':
+				if len(pattern) >= 2 {
+					pattern = pattern[1:]
+				}
+				fallthrough
+
+			default:
+				if !equalByte(pattern[0], str[0], nocase) {
+					return false
+				}
+				str = str[1:]
+		}
+
+		// an unterminated bracket consumed the whole pattern
+		if len(pattern) > 0 {
+			pattern = pattern[1:]
+		}
+	}
+
+	// trailing stars match the empty rest of the string
+	for len(str) == 0 && len(pattern) > 0 && pattern[0] == '*' {
+		pattern = pattern[1:]
+	}
+	return len(pattern) == 0 && len(str) == 0
+}
+
+func equalByte(a, b byte, nocase bool) bool {
+	if nocase {
+		return toLower(a) == toLower(b)
+	}
+	return a == b
+}
+
+func toLower(b byte) byte {
+	if b >= 'A' && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
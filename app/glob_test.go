@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStringMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		str     string
+		match   bool
+	}{
+		{"*", "", true},
+		{"**", "", true},
+		{"?*", "", false},
+		{"*", "anything", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "hllo", true},
+		{"h*llo", "heeeello", true},
+		{"h*llo", "hellO", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[b-a]llo", "hallo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hello", false},
+		{"h[\\]]llo", "h]llo", true},
+		{"user:*:name", "user:42:name", true},
+		{"user:*:name", "user:42:mail", false},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxbyy", false},
+		{"abc", "abcd", false},
+		{"abc*", "abc", true},
+		{"[abc", "b", true},
+		{"[abc", "d", false},
+		{"", "", true},
+		{"", "a", false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.match, StringMatch([]byte(c.pattern), []byte(c.str), false), "%q ~ %q", c.pattern, c.str)
+	}
+
+	assert.True(t, StringMatch([]byte("H[A-C]LLO"), []byte("hbllo"), true))
+	assert.False(t, StringMatch([]byte("H[A-C]LLO"), []byte("hbllo"), false))
+}
+
+func TestStringMatch_Pathological(t *testing.T) {
+	// must not backtrack exponentially
+	pattern := strings.Repeat("a*", 30) + "b"
+	assert.False(t, StringMatch([]byte(pattern), []byte(strings.Repeat("a", 100)), false))
+}
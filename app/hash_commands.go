@@ -0,0 +1,470 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/store"
+)
+
+// MaxFieldExpiration is the latest unix time in milliseconds a hash field may
+// expire at, as redis stores field expirations on 48 bits
+const MaxFieldExpiration = 1 << 48 - 1
+
+// HSetHandler sets fields of a hash to values, creating it when missing, and
+// replies with the number of fields added. Usage: HSET key field value [field value ...]
+func (ch *Commands) HSetHandler(c *Client, args [][]byte) ([]string, error) {
+	if len(args) % 2 != 0 {
+		return nil, WrongArityError(commandTable["hset"])
+	}
+
+	added, err := ch.db(c).HashStore.Set(string(args[1]), args[2:])
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return []string{intReply(added)}, nil
+}
+
+// HMSetHandler is HSET replying OK, as it did before HSET took several
+// fields. Usage: HMSET key field value [field value ...]
+func (ch *Commands) HMSetHandler(c *Client, args [][]byte) ([]string, error) {
+	if len(args) % 2 != 0 {
+		return nil, WrongArityError(commandTable["hmset"])
+	}
+
+	if _, err := ch.db(c).HashStore.Set(string(args[1]), args[2:]); err != nil {
+		return nil, storeError(err)
+	}
+	return OKResponse(), nil
+}
+
+// HSetNXHandler sets a field of a hash only when it does not exist, and
+// replies 1 when it was set. Usage: HSETNX key field value
+func (ch *Commands) HSetNXHandler(c *Client, args [][]byte) ([]string, error) {
+	stored, err := ch.db(c).HashStore.SetNX(string(args[1]), string(args[2]), args[3])
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if !stored {
+		c.noPropagate = true
+		return []string{intReply(0)}, nil
+	}
+	return []string{intReply(1)}, nil
+}
+
+// HGetHandler replies with the value of a field of a hash. Usage: HGET key field
+func (ch *Commands) HGetHandler(c *Client, args [][]byte) ([]string, error) {
+	value, exists, err := ch.db(c).HashStore.Get(string(args[1]), string(args[2]))
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if !exists {
+		return NullResponse(c.Protocol), nil
+	}
+	return []string{ResponseBuilder(BulkStringsRespType, string(value))}, nil
+}
+
+// HMGetHandler replies with the values of fields of a hash, null for the
+// missing ones. Usage: HMGET key field [field ...]
+func (ch *Commands) HMGetHandler(c *Client, args [][]byte) ([]string, error) {
+	values, err := ch.db(c).HashStore.MGet(string(args[1]), toStrings(args[2:]))
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(ArrayHeader(len(values)))
+	for _, value := range values {
+		if value == nil {
+			sb.WriteString(NullResponse(c.Protocol)[0])
+			continue
+		}
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, string(value.Value)))
+	}
+	return []string{sb.String()}, nil
+}
+
+// HDelHandler removes fields from a hash, deleting it once it has none left,
+// and replies with the number of fields removed. Usage: HDEL key field [field ...]
+func (ch *Commands) HDelHandler(c *Client, args [][]byte) ([]string, error) {
+	deleted, err := ch.db(c).HashStore.Delete(string(args[1]), toStrings(args[2:]))
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if deleted == 0 {
+		c.noPropagate = true
+	}
+	return []string{intReply(deleted)}, nil
+}
+
+// HGetAllHandler replies with the fields of a hash and their values.
+// Usage: HGETALL key
+func (ch *Commands) HGetAllHandler(c *Client, args [][]byte) ([]string, error) {
+	fields, err := ch.db(c).HashStore.GetAll(string(args[1]))
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	pairs := make([]string, 0, len(fields) * 2)
+	for _, field := range fields {
+		pairs = append(pairs, field.Field, string(field.Value))
+	}
+	return []string{MapResponse(c.Protocol, pairs...)}, nil
+}
+
+// HKeysHandler replies with the fields of a hash. Usage: HKEYS key
+func (ch *Commands) HKeysHandler(c *Client, args [][]byte) ([]string, error) {
+	fields, err := ch.db(c).HashStore.GetAll(string(args[1]))
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	keys := make([]string, 0, len(fields))
+	for _, field := range fields {
+		keys = append(keys, field.Field)
+	}
+	return []string{aggregateBuilder(ArraysFirstChar, len(keys), keys)}, nil
+}
+
+// HValsHandler replies with the values of a hash. Usage: HVALS key
+func (ch *Commands) HValsHandler(c *Client, args [][]byte) ([]string, error) {
+	fields, err := ch.db(c).HashStore.GetAll(string(args[1]))
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	values := make([][]byte, 0, len(fields))
+	for _, field := range fields {
+		values = append(values, field.Value)
+	}
+	return []string{bulkArrayReply(values)}, nil
+}
+
+// HLenHandler replies with the number of fields of a hash. Usage: HLEN key
+func (ch *Commands) HLenHandler(c *Client, args [][]byte) ([]string, error) {
+	length, err := ch.db(c).HashStore.Len(string(args[1]))
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return []string{intReply(length)}, nil
+}
+
+// HExistsHandler replies 1 when a field exists in a hash. Usage: HEXISTS key field
+func (ch *Commands) HExistsHandler(c *Client, args [][]byte) ([]string, error) {
+	_, exists, err := ch.db(c).HashStore.Get(string(args[1]), string(args[2]))
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if !exists {
+		return []string{intReply(0)}, nil
+	}
+	return []string{intReply(1)}, nil
+}
+
+// HStrLenHandler replies with the length of the value of a field of a hash,
+// 0 when it is missing. Usage: HSTRLEN key field
+func (ch *Commands) HStrLenHandler(c *Client, args [][]byte) ([]string, error) {
+	value, _, err := ch.db(c).HashStore.Get(string(args[1]), string(args[2]))
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return []string{intReply(len(value))}, nil
+}
+
+// HIncrByHandler adds to the integer stored at a field of a hash. Usage:
+// HINCRBY key field increment
+func (ch *Commands) HIncrByHandler(c *Client, args [][]byte) ([]string, error) {
+	increment, err := strconv.ParseInt(string(args[3]), 10, 64)
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+
+	value, err := ch.db(c).HashStore.IncrBy(string(args[1]), string(args[2]), increment)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return []string{ResponseBuilder(IntegersRespType, strconv.FormatInt(value, 10))}, nil
+}
+
+// HIncrByFloatHandler adds a floating point increment to the number stored
+// at a field of a hash. Replicas receive the resulting value as an HSET, like
+// INCRBYFLOAT. Usage: HINCRBYFLOAT key field increment
+func (ch *Commands) HIncrByFloatHandler(c *Client, args [][]byte) ([]string, error) {
+	increment, ok := store.ParseLongDouble(args[3])
+	if !ok {
+		return nil, NewCommandError("%s", store.ErrNotFloat.Error())
+	}
+
+	value, err := ch.db(c).HashStore.IncrByFloat(string(args[1]), string(args[2]), increment)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	c.Argv = toBytesArgs(string(HSET), string(args[1]), string(args[2]), string(value))
+	return []string{ResponseBuilder(BulkStringsRespType, string(value))}, nil
+}
+
+// HRandFieldHandler replies with a field of a hash picked at random, or with
+// count distinct fields when count is positive and count fields that may
+// repeat when it is negative, along with their values with WITHVALUES.
+// Usage: HRANDFIELD key [count [WITHVALUES]]
+func (ch *Commands) HRandFieldHandler(c *Client, args [][]byte) ([]string, error) {
+	db := ch.db(c)
+	key := string(args[1])
+
+	if len(args) == 2 {
+		fields, err := db.HashStore.RandomFields(key, 1, false)
+		if err != nil {
+			return nil, storeError(err)
+		}
+		if len(fields) == 0 {
+			return NullResponse(c.Protocol), nil
+		}
+		return []string{ResponseBuilder(BulkStringsRespType, fields[0].Field)}, nil
+	}
+
+	if len(args) > 4 {
+		return nil, ErrSyntax
+	}
+	withValues := false
+	if len(args) == 4 {
+		if Command(strings.ToUpper(string(args[3]))) != WITHVALUES {
+			return nil, ErrSyntax
+		}
+		withValues = true
+	}
+
+	count, allowDuplicates, err := parseRandomCount(args[2])
+	if err != nil {
+		return nil, err
+	}
+	fields, err := db.HashStore.RandomFields(key, count, allowDuplicates)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	if !withValues {
+		names := make([]string, 0, len(fields))
+		for _, field := range fields {
+			names = append(names, field.Field)
+		}
+		return []string{aggregateBuilder(ArraysFirstChar, len(names), names)}, nil
+	}
+
+	// RESP3 pairs each field with its value, RESP2 flattens them
+	var sb strings.Builder
+	if c.Protocol == RESP3 {
+		sb.WriteString(ArrayHeader(len(fields)))
+		for _, field := range fields {
+			sb.WriteString(aggregateBuilder(ArraysFirstChar, 2, []string{field.Field, string(field.Value)}))
+		}
+		return []string{sb.String()}, nil
+	}
+	pairs := make([]string, 0, len(fields) * 2)
+	for _, field := range fields {
+		pairs = append(pairs, field.Field, string(field.Value))
+	}
+	return []string{aggregateBuilder(ArraysFirstChar, len(pairs), pairs)}, nil
+}
+
+// HExpireHandler sets fields of a hash to expire after a number of seconds.
+// Usage: HEXPIRE key seconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+func (ch *Commands) HExpireHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.hexpire(c, args, EX, "hexpire")
+}
+
+// HPExpireHandler sets fields of a hash to expire after a number of
+// milliseconds.
+// Usage: HPEXPIRE key milliseconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+func (ch *Commands) HPExpireHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.hexpire(c, args, PX, "hpexpire")
+}
+
+// HExpireAtHandler sets fields of a hash to expire at a unix time in seconds.
+// Usage: HEXPIREAT key unix-time-seconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+func (ch *Commands) HExpireAtHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.hexpire(c, args, EXAT, "hexpireat")
+}
+
+// HPExpireAtHandler sets fields of a hash to expire at a unix time in
+// milliseconds.
+// Usage: HPEXPIREAT key unix-time-milliseconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+func (ch *Commands) HPExpireAtHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.hexpire(c, args, PXAT, "hpexpireat")
+}
+
+// hexpire implements the HEXPIRE family, whose time argument is given in
+// unit. The conditions are those of EXPIRE, applied to each field. It
+// replies with an array holding for each field -2 when it does not exist, 0
+// when the condition was not met, 1 when the expiration was set and 2 when
+// the field was deleted because the time is already past. Replicas receive
+// an absolute HPEXPIREAT of the fields that were set, or an HDEL of the
+// deleted ones.
+func (ch *Commands) hexpire(c *Client, args [][]byte, unit Command, command string) ([]string, error) {
+	at, err := parseExpireArg(args[2], unit, command)
+	if err != nil {
+		return nil, err
+	}
+	if args[2][0] == '-' || at > MaxFieldExpiration {
+		return nil, NewCommandError("invalid expire time, must be >= 0 && <= %d", MaxFieldExpiration)
+	}
+
+	cond := func(current int64) bool { return true }
+	fieldsAt := 3
+	switch Command(strings.ToUpper(string(args[3]))) {
+		case NX:
+			cond = func(current int64) bool { return current == -1 }
+		case XX:
+			cond = func(current int64) bool { return current != -1 }
+		case GT:
+			cond = func(current int64) bool { return current != -1 && at > current }
+		case LT:
+			cond = func(current int64) bool { return current == -1 || at < current }
+		default:
+			fieldsAt = 2
+	}
+
+	fields, err := parseHashFields(args, fieldsAt + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	key := string(args[1])
+	// replicas wait for the master to delete fields set to expire in the past
+	results, err := ch.db(c).HashStore.SetFieldsExpiration(key, fields, at, cond, c.IsMaster)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	updated := make([]string, 0)
+	deleted := make([]string, 0)
+	for i, result := range results {
+		switch result {
+			case store.FieldUpdated:
+				updated = append(updated, fields[i])
+			case store.FieldDeleted:
+				deleted = append(deleted, fields[i])
+		}
+	}
+
+	switch {
+		case len(deleted) > 0:
+			c.Argv = toBytesArgs(append([]string{string(HDEL), key}, deleted...)...)
+		case len(updated) > 0:
+			c.Argv = toBytesArgs(append([]string{string(HPEXPIREAT), key, strconv.FormatInt(at, 10),
+				string(FIELDS), strconv.Itoa(len(updated))}, updated...)...)
+		default:
+			c.noPropagate = true
+	}
+	return []string{intArrayReply(results)}, nil
+}
+
+// HPersistHandler removes the expiration of fields of a hash. It replies
+// with an array holding for each field -2 when it does not exist, -1 when it
+// had no expiration and 1 when the expiration was removed.
+// Usage: HPERSIST key FIELDS numfields field [field ...]
+func (ch *Commands) HPersistHandler(c *Client, args [][]byte) ([]string, error) {
+	fields, err := parseHashFields(args, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := ch.db(c).HashStore.PersistFields(string(args[1]), fields)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	c.noPropagate = true
+	for _, result := range results {
+		if result == store.FieldUpdated {
+			c.noPropagate = false
+		}
+	}
+	return []string{intArrayReply(results)}, nil
+}
+
+// HTtlHandler replies with the seconds left before fields of a hash expire,
+// -1 for the fields that do not expire and -2 for the missing ones.
+// Usage: HTTL key FIELDS numfields field [field ...]
+func (ch *Commands) HTtlHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.httl(c, args, false, false)
+}
+
+// HPTtlHandler is HTTL in milliseconds.
+// Usage: HPTTL key FIELDS numfields field [field ...]
+func (ch *Commands) HPTtlHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.httl(c, args, true, false)
+}
+
+// HExpireTimeHandler replies with the unix time in seconds at which fields
+// of a hash expire, -1 for the fields that do not expire and -2 for the
+// missing ones. Usage: HEXPIRETIME key FIELDS numfields field [field ...]
+func (ch *Commands) HExpireTimeHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.httl(c, args, false, true)
+}
+
+// HPExpireTimeHandler is HEXPIRETIME in milliseconds.
+// Usage: HPEXPIRETIME key FIELDS numfields field [field ...]
+func (ch *Commands) HPExpireTimeHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.httl(c, args, true, true)
+}
+
+func (ch *Commands) httl(c *Client, args [][]byte, ms bool, absolute bool) ([]string, error) {
+	fields, err := parseHashFields(args, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	expirations, err := ch.db(c).HashStore.FieldsExpiration(string(args[1]), fields)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	now := time.Now().UnixMilli()
+	var sb strings.Builder
+	sb.WriteString(ArrayHeader(len(expirations)))
+	for _, expiration := range expirations {
+		ttl := expiration
+		switch {
+			case expiration < 0:
+			case absolute && !ms:
+				ttl = expiration / 1000
+			case !absolute:
+				ttl = max(expiration - now, 0)
+				if !ms {
+					// a field expiring in less than a second still has one to go
+					ttl = (ttl + 999) / 1000
+				}
+		}
+		sb.WriteString(ResponseBuilder(IntegersRespType, strconv.FormatInt(ttl, 10)))
+	}
+	return []string{sb.String()}, nil
+}
+
+// parseHashFields parses the FIELDS numfields field [field ...] arguments of
+// the field expiration commands, which start at args[i] and end the command
+func parseHashFields(args [][]byte, i int) ([]string, error) {
+	if i + 1 >= len(args) || Command(strings.ToUpper(string(args[i]))) != FIELDS {
+		return nil, NewCommandError("Mandatory argument FIELDS is missing or not at the right position")
+	}
+
+	numFields, err := strconv.Atoi(string(args[i + 1]))
+	if err != nil || numFields <= 0 {
+		return nil, NewCommandError("Parameter `numFields` should be greater than 0")
+	}
+	if numFields != len(args) - i - 2 {
+		return nil, NewCommandError("The `numfields` parameter must match the number of arguments")
+	}
+	return toStrings(args[i + 2:]), nil
+}
+
+// intArrayReply encodes values as an array of integers
+func intArrayReply(values []int) string {
+	var sb strings.Builder
+	sb.WriteString(ArrayHeader(len(values)))
+	for _, value := range values {
+		sb.WriteString(intReply(value))
+	}
+	return sb.String()
+}
@@ -0,0 +1,37 @@
+package main
+
+// PFAddHandler adds elements to a HyperLogLog, creating it when missing, and
+// replies with 1 when its estimate may have changed, 0 otherwise.
+// Usage: PFADD key [element [element ...]]
+func (ch *Commands) PFAddHandler(c *Client, args [][]byte) ([]string, error) {
+	updated, err := ch.db(c).KVStore.PFAdd(string(args[1]), args[2:])
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if !updated {
+		c.noPropagate = true
+		return []string{intReply(0)}, nil
+	}
+	return []string{intReply(1)}, nil
+}
+
+// PFCountHandler replies with the estimated number of distinct elements added
+// to any of the HyperLogLogs, with a standard error of 0.81%.
+// Usage: PFCOUNT key [key ...]
+func (ch *Commands) PFCountHandler(c *Client, args [][]byte) ([]string, error) {
+	count, err := ch.db(c).KVStore.PFCount(toStrings(args[1:]))
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return []string{intReply(int(count))}, nil
+}
+
+// PFMergeHandler merges HyperLogLogs into the one stored at destkey, creating
+// it when missing, so that it estimates the union of all of them.
+// Usage: PFMERGE destkey [sourcekey [sourcekey ...]]
+func (ch *Commands) PFMergeHandler(c *Client, args [][]byte) ([]string, error) {
+	if err := ch.db(c).KVStore.PFMerge(string(args[1]), toStrings(args[2:])); err != nil {
+		return nil, storeError(err)
+	}
+	return OKResponse(), nil
+}
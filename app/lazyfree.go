@@ -0,0 +1,44 @@
+package main
+
+import (
+	"sync/atomic"
+
+	"github.com/codecrafters-io/redis-starter-go/store"
+)
+
+// LazyfreeThreshold is the free effort past which UNLINK releases a value in
+// the background rather than on the executor, as in redis
+const LazyfreeThreshold = 64
+
+// lazyfree releases the values UNLINK removes in the background, so that the
+// executor goes on with other commands meanwhile
+type lazyfree struct {
+	// pending is the number of values waiting to be released and freed the
+	// number released so far, as the redis lazyfree_pending_objects and
+	// lazyfreed_objects
+	pending atomic.Int64
+	freed   atomic.Int64
+
+	// release releases a value, store.Release unless a test replaces it
+	release func(obj *store.Object)
+}
+
+func newLazyfree() *lazyfree {
+	return &lazyfree{release: store.Release}
+}
+
+// free releases obj right away when it is small, and in the background
+// otherwise
+func (lf *lazyfree) free(obj *store.Object) {
+	if store.FreeEffort(obj) <= LazyfreeThreshold {
+		lf.release(obj)
+		return
+	}
+
+	lf.pending.Add(1)
+	go func() {
+		lf.release(obj)
+		lf.pending.Add(-1)
+		lf.freed.Add(1)
+	}()
+}
@@ -0,0 +1,531 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/store"
+)
+
+// LPushHandler inserts elements at the head of a list, creating it when
+// missing, and replies with its length. Usage: LPUSH key element [element ...]
+func (ch *Commands) LPushHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.push(c, args, true, false)
+}
+
+// RPushHandler inserts elements at the tail of a list, creating it when
+// missing, and replies with its length. Usage: RPUSH key element [element ...]
+func (ch *Commands) RPushHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.push(c, args, false, false)
+}
+
+// LPushXHandler inserts elements at the head of a list only when it exists.
+// Usage: LPUSHX key element [element ...]
+func (ch *Commands) LPushXHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.push(c, args, true, true)
+}
+
+// RPushXHandler inserts elements at the tail of a list only when it exists.
+// Usage: RPUSHX key element [element ...]
+func (ch *Commands) RPushXHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.push(c, args, false, true)
+}
+
+func (ch *Commands) push(c *Client, args [][]byte, front bool, onlyExisting bool) ([]string, error) {
+	length, err := ch.db(c).ListStore.Push(string(args[1]), args[2:], front, onlyExisting)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if length == 0 {
+		c.noPropagate = true
+	}
+	return []string{intReply(length)}, nil
+}
+
+// LPopHandler removes and replies with the first element of a list, or with
+// an array of up to count elements when count is given.
+// Usage: LPOP key [count]
+func (ch *Commands) LPopHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.pop(c, args, true)
+}
+
+// RPopHandler removes and replies with the last element of a list, or with
+// an array of up to count elements when count is given.
+// Usage: RPOP key [count]
+func (ch *Commands) RPopHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.pop(c, args, false)
+}
+
+func (ch *Commands) pop(c *Client, args [][]byte, front bool) ([]string, error) {
+	if len(args) > 3 {
+		return nil, ErrSyntax
+	}
+
+	count := 1
+	if len(args) == 3 {
+		parsed, err := strconv.Atoi(string(args[2]))
+		if err != nil || parsed < 0 {
+			return nil, NewCommandError("value is out of range, must be positive")
+		}
+		count = parsed
+	}
+
+	values, err := ch.db(c).ListStore.Pop(string(args[1]), count, front)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if len(values) == 0 {
+		c.noPropagate = true
+	}
+
+	if len(args) == 2 {
+		if values == nil {
+			return NullResponse(c.Protocol), nil
+		}
+		return []string{ResponseBuilder(BulkStringsRespType, string(values[0]))}, nil
+	}
+
+	if values == nil {
+		return []string{NullArrayResponse(c.Protocol)}, nil
+	}
+	return []string{bulkArrayReply(values)}, nil
+}
+
+// LLenHandler replies with the length of a list. Usage: LLEN key
+func (ch *Commands) LLenHandler(c *Client, args [][]byte) ([]string, error) {
+	length, err := ch.db(c).ListStore.Len(string(args[1]))
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return []string{intReply(length)}, nil
+}
+
+// LRangeHandler replies with the elements of a list between two indexes,
+// both included. Negative indexes count from the tail.
+// Usage: LRANGE key start stop
+func (ch *Commands) LRangeHandler(c *Client, args [][]byte) ([]string, error) {
+	start, stop, err := parseListRange(args[2], args[3])
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := ch.db(c).ListStore.Range(string(args[1]), start, stop)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return []string{bulkArrayReply(values)}, nil
+}
+
+// LIndexHandler replies with the element at an index of a list.
+// Usage: LINDEX key index
+func (ch *Commands) LIndexHandler(c *Client, args [][]byte) ([]string, error) {
+	index, err := strconv.Atoi(string(args[2]))
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+
+	value, exists, err := ch.db(c).ListStore.Index(string(args[1]), index)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if !exists {
+		return NullResponse(c.Protocol), nil
+	}
+	return []string{ResponseBuilder(BulkStringsRespType, string(value))}, nil
+}
+
+// LSetHandler replaces the element at an index of a list.
+// Usage: LSET key index element
+func (ch *Commands) LSetHandler(c *Client, args [][]byte) ([]string, error) {
+	index, err := strconv.Atoi(string(args[2]))
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+
+	if err := ch.db(c).ListStore.SetIndex(string(args[1]), index, args[3]); err != nil {
+		return nil, storeError(err)
+	}
+	return OKResponse(), nil
+}
+
+// LInsertHandler inserts an element before or after the first occurrence of
+// a pivot, and replies with the new length, -1 when the pivot was not found
+// and 0 when the list does not exist.
+// Usage: LINSERT key BEFORE|AFTER pivot element
+func (ch *Commands) LInsertHandler(c *Client, args [][]byte) ([]string, error) {
+	var after bool
+	switch Command(strings.ToUpper(string(args[2]))) {
+		case BEFORE:
+			after = false
+		case AFTER:
+			after = true
+		default:
+			return nil, ErrSyntax
+	}
+
+	length, err := ch.db(c).ListStore.Insert(string(args[1]), args[3], args[4], after)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if length <= 0 {
+		c.noPropagate = true
+	}
+	return []string{intReply(length)}, nil
+}
+
+// LRemHandler removes the first count occurrences of an element, the last
+// ones when count is negative or all of them when it is 0, and replies with
+// how many were removed. Usage: LREM key count element
+func (ch *Commands) LRemHandler(c *Client, args [][]byte) ([]string, error) {
+	count, err := strconv.Atoi(string(args[2]))
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+
+	removed, err := ch.db(c).ListStore.Remove(string(args[1]), count, args[3])
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if removed == 0 {
+		c.noPropagate = true
+	}
+	return []string{intReply(removed)}, nil
+}
+
+// LTrimHandler keeps only the elements of a list between two indexes, both
+// included. Usage: LTRIM key start stop
+func (ch *Commands) LTrimHandler(c *Client, args [][]byte) ([]string, error) {
+	start, stop, err := parseListRange(args[2], args[3])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ch.db(c).ListStore.Trim(string(args[1]), start, stop); err != nil {
+		return nil, storeError(err)
+	}
+	return OKResponse(), nil
+}
+
+// LPosHandler replies with the index of the first element equal to the
+// given one. RANK picks a later match, searching from the tail when
+// negative, COUNT asks for an array of that many matches (0 for all of them)
+// and MAXLEN limits how many elements are compared.
+// Usage: LPOS key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+func (ch *Commands) LPosHandler(c *Client, args [][]byte) ([]string, error) {
+	opts := store.PosOptions{Rank: 1}
+	withCount := false
+
+	for i := 3; i < len(args); i += 2 {
+		if i + 1 == len(args) {
+			return nil, ErrSyntax
+		}
+		value, err := strconv.Atoi(string(args[i + 1]))
+		if err != nil {
+			return nil, ErrNotInteger
+		}
+
+		switch Command(strings.ToUpper(string(args[i]))) {
+			case RANK:
+				if value == 0 || value == math.MinInt {
+					return nil, NewCommandError("RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")
+				}
+				opts.Rank = value
+			case COUNT:
+				if value < 0 {
+					return nil, NewCommandError("COUNT can't be negative")
+				}
+				opts.Count, withCount = value, true
+			case MAXLEN:
+				if value < 0 {
+					return nil, NewCommandError("MAXLEN can't be negative")
+				}
+				opts.MaxLen = value
+			default:
+				return nil, ErrSyntax
+		}
+	}
+
+	if !withCount {
+		opts.Count = 1
+	}
+	matches, err := ch.db(c).ListStore.Pos(string(args[1]), args[2], opts)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	if withCount {
+		var sb strings.Builder
+		sb.WriteString(ArrayHeader(len(matches)))
+		for _, index := range matches {
+			sb.WriteString(intReply(index))
+		}
+		return []string{sb.String()}, nil
+	}
+	if len(matches) == 0 {
+		return NullResponse(c.Protocol), nil
+	}
+	return []string{intReply(matches[0])}, nil
+}
+
+// LMoveHandler pops an element from one end of a list and pushes it to one
+// end of another, atomically, replying with the element.
+// Usage: LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+func (ch *Commands) LMoveHandler(c *Client, args [][]byte) ([]string, error) {
+	fromFront, err := parseListEnd(args[3])
+	if err != nil {
+		return nil, err
+	}
+	toFront, err := parseListEnd(args[4])
+	if err != nil {
+		return nil, err
+	}
+
+	value, moved, err := ch.db(c).ListStore.Move(string(args[1]), string(args[2]), fromFront, toFront)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if !moved {
+		c.noPropagate = true
+		return NullResponse(c.Protocol), nil
+	}
+	return []string{ResponseBuilder(BulkStringsRespType, string(value))}, nil
+}
+
+// LMPopHandler pops up to count elements from the first non empty list
+// among the keys, and replies with its name and the elements.
+// Usage: LMPOP numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func (ch *Commands) LMPopHandler(c *Client, args [][]byte) ([]string, error) {
+	keys, front, count, err := parseMPopArgs(args[1:], parseListEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, argv, err := ch.mpop(c, keys, front, count)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if resp == nil {
+		c.noPropagate = true
+		return []string{NullArrayResponse(c.Protocol)}, nil
+	}
+	c.Argv = argv
+	return resp, nil
+}
+
+// BLMPopHandler pops elements like LMPOP, blocking like BLPOP when every list
+// is empty. Usage: BLMPOP timeout numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func (ch *Commands) BLMPopHandler(c *Client, args [][]byte) ([]string, error) {
+	timeout, err := parseBlockTimeout(args[1])
+	if err != nil {
+		return nil, err
+	}
+	keys, front, count, err := parseMPopArgs(args[2:], parseListEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	return ch.serveOrBlock(c, timeout, keys,
+		func(keys []string) ([]string, [][]byte, error) {
+			return ch.mpop(c, keys, front, count)
+		},
+		func() []string {
+			return []string{NullArrayResponse(c.Protocol)}
+		},
+	)
+}
+
+// mpop pops up to count elements from the first non empty list among keys.
+// It returns the reply, with the name of the list and the elements, and the
+// LPOP or RPOP to propagate, or a nil reply when every list is empty.
+func (ch *Commands) mpop(c *Client, keys []string, front bool, count int) ([]string, [][]byte, error) {
+	key, values, err := ch.popFirst(c, keys, front, count)
+	if err != nil || values == nil {
+		return nil, nil, err
+	}
+
+	resp := ArrayHeader(2) + ResponseBuilder(BulkStringsRespType, key) + bulkArrayReply(values)
+	return []string{resp}, append(popCommand(key, front), []byte(strconv.Itoa(len(values)))), nil
+}
+
+// popFirst pops up to count elements from the first non empty list among
+// keys, and returns its key and the elements, or nil elements when every
+// list is empty. A key holding another type fails the pop once it is reached.
+func (ch *Commands) popFirst(c *Client, keys []string, front bool, count int) (string, [][]byte, error) {
+	for _, key := range keys {
+		values, err := ch.db(c).ListStore.Pop(key, count, front)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(values) > 0 {
+			return key, values, nil
+		}
+	}
+	return "", nil, nil
+}
+
+// popCommand returns the LPOP or RPOP of key that blocking and multi key pops
+// are propagated as
+func popCommand(key string, front bool) [][]byte {
+	if front {
+		return toBytesArgs("LPOP", key)
+	}
+	return toBytesArgs("RPOP", key)
+}
+
+// BLPopHandler pops the first element of the first non empty list among the
+// keys, and replies with the name of the list and the element. When they are
+// all empty the client blocks until an element is pushed to one of them, or
+// the timeout in seconds elapses. Clients blocked on the same key are served
+// in the order they blocked. Usage: BLPOP key [key ...] timeout
+func (ch *Commands) BLPopHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.blockingPop(c, args, true)
+}
+
+// BRPopHandler pops the last element of the first non empty list among the
+// keys like BLPOP. Usage: BRPOP key [key ...] timeout
+func (ch *Commands) BRPopHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.blockingPop(c, args, false)
+}
+
+func (ch *Commands) blockingPop(c *Client, args [][]byte, front bool) ([]string, error) {
+	timeout, err := parseBlockTimeout(args[len(args) - 1])
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(args) - 2)
+	for _, key := range args[1:len(args) - 1] {
+		keys = append(keys, string(key))
+	}
+
+	return ch.serveOrBlock(c, timeout, keys,
+		func(keys []string) ([]string, [][]byte, error) {
+			key, values, err := ch.popFirst(c, keys, front, 1)
+			if err != nil || values == nil {
+				return nil, nil, err
+			}
+			return []string{bulkArrayReply([][]byte{[]byte(key), values[0]})}, popCommand(key, front), nil
+		},
+		func() []string {
+			return []string{NullArrayResponse(c.Protocol)}
+		},
+	)
+}
+
+// BLMoveHandler moves an element from one list to another like LMOVE. When
+// the source is empty the client blocks like BLPOP.
+// Usage: BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout
+func (ch *Commands) BLMoveHandler(c *Client, args [][]byte) ([]string, error) {
+	fromFront, err := parseListEnd(args[3])
+	if err != nil {
+		return nil, err
+	}
+	toFront, err := parseListEnd(args[4])
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := parseBlockTimeout(args[5])
+	if err != nil {
+		return nil, err
+	}
+
+	src, dst := string(args[1]), string(args[2])
+	return ch.serveOrBlock(c, timeout, []string{src},
+		func([]string) ([]string, [][]byte, error) {
+			value, moved, err := ch.db(c).ListStore.Move(src, dst, fromFront, toFront)
+			if err != nil || !moved {
+				return nil, nil, err
+			}
+			return []string{ResponseBuilder(BulkStringsRespType, string(value))}, toBytesArgs("LMOVE", src, dst, string(args[3]), string(args[4])), nil
+		},
+		func() []string {
+			return NullResponse(c.Protocol)
+		},
+	)
+}
+
+// parseBlockTimeout parses the timeout of a blocking list command, in seconds
+// with an optional fractional part. A zero timeout blocks forever.
+func parseBlockTimeout(arg []byte) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, NewCommandError("timeout is not a float or out of range")
+	}
+	if seconds < 0 {
+		return 0, NewCommandError("timeout is negative")
+	}
+	if seconds > float64(math.MaxInt64) / float64(time.Second) {
+		return 0, NewCommandError("timeout is out of range")
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// parseMPopArgs parses the arguments of LMPOP and ZMPOP from numkeys on, the
+// keys being followed by the end to pop from, which parseEnd parses
+func parseMPopArgs(args [][]byte, parseEnd func(arg []byte) (bool, error)) (keys []string, front bool, count int, err error) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil || numKeys <= 0 {
+		return nil, false, 0, NewCommandError("numkeys should be greater than 0")
+	}
+	// the keys must be followed by the end
+	if numKeys > len(args) - 2 {
+		return nil, false, 0, ErrSyntax
+	}
+
+	for _, key := range args[1:numKeys + 1] {
+		keys = append(keys, string(key))
+	}
+	front, err = parseEnd(args[numKeys + 1])
+	if err != nil {
+		return nil, false, 0, err
+	}
+
+	count = 1
+	options := args[numKeys + 2:]
+	switch {
+		case len(options) == 0:
+		case len(options) == 2 && Command(strings.ToUpper(string(options[0]))) == COUNT:
+			count, err = strconv.Atoi(string(options[1]))
+			if err != nil || count <= 0 {
+				return nil, false, 0, NewCommandError("count should be greater than 0")
+			}
+		default:
+			return nil, false, 0, ErrSyntax
+	}
+
+	return keys, front, count, nil
+}
+
+// parseListEnd parses LEFT or RIGHT, reporting whether it is the head
+func parseListEnd(arg []byte) (bool, error) {
+	switch Command(strings.ToUpper(string(arg))) {
+		case LEFT:
+			return true, nil
+		case RIGHT:
+			return false, nil
+	}
+	return false, ErrSyntax
+}
+
+func parseListRange(startArg, stopArg []byte) (int, int, error) {
+	start, err := strconv.Atoi(string(startArg))
+	if err != nil {
+		return 0, 0, ErrNotInteger
+	}
+	stop, err := strconv.Atoi(string(stopArg))
+	if err != nil {
+		return 0, 0, ErrNotInteger
+	}
+	return start, stop, nil
+}
+
+// bulkArrayReply encodes values as an array of bulk strings
+func bulkArrayReply(values [][]byte) string {
+	var sb strings.Builder
+	sb.WriteString(ArrayHeader(len(values)))
+	for _, value := range values {
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, string(value)))
+	}
+	return sb.String()
+}
@@ -2,9 +2,8 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"strconv"
-
-	// "strconv"
 	"strings"
 )
 
@@ -14,13 +13,28 @@ type RESPFirstChar string
 const (
 	CLRF string = "\r\n"
 
+	// Protocol versions negotiated with HELLO
+	RESP2 = 2
+	RESP3 = 3
+
 	// RESP Protocol CHARS
 	SimpleStringsFirstChar = "+"
 	BulkStringsFirstChar = "$"
 	ArraysFirstChar = "*"
-	NullsFirstChar = "-"
+	ErrorsFirstChar = "-"
 	IntegersFirstChar = ":"
 
+	// RESP3 Protocol CHARS
+	NullsFirstChar = "_"
+	MapsFirstChar = "%"
+	SetsFirstChar = "~"
+	DoublesFirstChar = ","
+	BooleansFirstChar = "#"
+	BigNumbersFirstChar = "("
+	VerbatimStringsFirstChar = "="
+	AttributesFirstChar = "|"
+	PushesFirstChar = ">"
+
 	// RESP Protocol Type Names
 	SimpleStringsRespType RESPType = "SimpleStrings"
 	BulkStringsRespType RESPType = "BulkStrings"
@@ -28,6 +42,16 @@ const (
 	NullsRespType RESPType = "Nulls"
 	IntegersRespType RESPType = "Integers"
 	ErrorsRespType RESPType = "Errors"
+
+	// RESP3 Protocol Type Names
+	MapsRespType RESPType = "Maps"
+	SetsRespType RESPType = "Sets"
+	DoublesRespType RESPType = "Doubles"
+	BooleansRespType RESPType = "Booleans"
+	BigNumbersRespType RESPType = "BigNumbers"
+	VerbatimStringsRespType RESPType = "VerbatimStrings"
+	AttributesRespType RESPType = "Attributes"
+	PushesRespType RESPType = "Pushes"
 )
 
 // Responses
@@ -36,20 +60,16 @@ func OKResponse() []string {
 	return []string{"+OK\r\n"}
 }
 
-func NullResponse() []string {
+// NullResponse is the null bulk string under RESP2 and the null type under RESP3
+func NullResponse(proto int) []string {
+	if proto == RESP3 {
+		return []string{ResponseBuilder(NullsRespType)}
+	}
 	return []string{"$-1\r\n"}
 }
 
-func NoneTypeResponse() []string {
-	return []string{"+none\r\n"}
-}
-
-func StringResponse() []string {
-	return []string{"+string\r\n"}
-}
-
-func StreamResponse() []string {
-	return []string{"+stream\r\n"}
+func ReadOnlyReplicaResponse() []string {
+	return []string{fmt.Sprintf("%sREADONLY You can't write against a read only replica.%s", ErrorsFirstChar, CLRF)}
 }
 
 func ResponseBuilder(respType RESPType, args ...string) string {
@@ -59,7 +79,7 @@ func ResponseBuilder(respType RESPType, args ...string) string {
 				fmt.Println("invalid response. simple strings cannot have more than one string")
 				return "" 
 			}
-			return fmt.Sprintf("%s%s%s", SimpleStringsFirstChar, args[0], CLRF)
+			return fmt.Sprintf("%s%s%s", SimpleStringsFirstChar, sanitizeLine(args[0]), CLRF)
 
 		case BulkStringsRespType:
 			res := args[0]
@@ -85,139 +105,221 @@ func ResponseBuilder(respType RESPType, args ...string) string {
 				fmt.Println("invalid response. error strings cannot have more than one string")
 				return "" 
 			}
-			return fmt.Sprintf("%sERR %s%s", NullsFirstChar, args[0], CLRF)
-	}
+			return fmt.Sprintf("%sERR %s%s", ErrorsFirstChar, sanitizeLine(args[0]), CLRF)
 
-	return ""
-}
+		case IntegersRespType:
+			if len(args) != 1 {
+				fmt.Println("invalid response. integers should have exactly one argument")
+				return ""
+			}
+			return fmt.Sprintf("%s%s%s", IntegersFirstChar, args[0], CLRF)
 
-func ParseRequest(req string) (cReqs []string, err error) {
-	requestLines := SplitRequests(req)
+		case NullsRespType:
+			return fmt.Sprintf("%s%s", NullsFirstChar, CLRF)
 
-	for i := 0; i < len(requestLines); {
-		cReq, nextIndex, err := FetchCommandRequest(requestLines, i)
-		if err != nil {
-			return cReqs, fmt.Errorf("error fetching commands from request: %s", err.Error())
-		}
+		case MapsRespType, AttributesRespType:
+			if len(args) % 2 != 0 {
+				fmt.Println("invalid response. maps should have a value for every key")
+				return ""
+			}
 
-		cReqs = append(cReqs, cReq) 
-		i = nextIndex
-	}
+			firstChar := MapsFirstChar
+			if respType == AttributesRespType {
+				firstChar = AttributesFirstChar
+			}
+			return aggregateBuilder(firstChar, len(args) / 2, args)
 
-	return cReqs, nil
-}
+		case SetsRespType:
+			return aggregateBuilder(SetsFirstChar, len(args), args)
 
-func FetchCommandRequest(requestLines []string, startIndex int) (cReq string, nextIndex int, err error) {
-	switch requestLines[startIndex][0:1] {
-		
-		case SimpleStringsFirstChar:
-			cReq = requestLines[startIndex] + CLRF
-			return cReq, startIndex + 1, nil
-
-		case BulkStringsFirstChar:
-			reqLength, err := strconv.Atoi(requestLines[startIndex][1:])
-			if err != nil {
-				return "", startIndex + 1, fmt.Errorf("error converting bulkstring length in request from str to int: %s", err.Error())
+		case PushesRespType:
+			if len(args) == 0 {
+				fmt.Println("invalid response. push messages cannot have zero arguments")
+				return ""
 			}
-			endIndex := startIndex + 1
-			if reqLength != len(requestLines[endIndex]) {
-				
-				// Since RDB file is not a RESP response, it does not end with CLRF
-				if IsRdbFile(requestLines[endIndex]) {
-					overlappingReq := requestLines[endIndex][reqLength:]
-					
-					// add overlapping request after rdb file
-					requestLines[endIndex] = requestLines[endIndex][0:reqLength]
-					requestLines = append(requestLines[0:endIndex + 1], requestLines[endIndex:]...)
-					requestLines[endIndex + 1] = overlappingReq
-				} else {
-					return "", startIndex + 1, fmt.Errorf("bulkstring length: %v in request does not match the following string: %s", reqLength, requestLines[startIndex + 1])
-				}
+			return aggregateBuilder(PushesFirstChar, len(args), args)
+
+		case DoublesRespType:
+			if len(args) != 1 {
+				fmt.Println("invalid response. doubles should have exactly one argument")
+				return ""
 			}
-			cReq = requestLines[startIndex] + CLRF + requestLines[startIndex + 1]
-			if !IsRdbFile(requestLines[startIndex + 1]) {
-				cReq += CLRF
+			return fmt.Sprintf("%s%s%s", DoublesFirstChar, args[0], CLRF)
+
+		case BooleansRespType:
+			if len(args) != 1 || (args[0] != "t" && args[0] != "f") {
+				fmt.Println("invalid response. booleans should be either t or f")
+				return ""
 			}
+			return fmt.Sprintf("%s%s%s", BooleansFirstChar, args[0], CLRF)
 
-			return cReq, startIndex + 2, nil
+		case BigNumbersRespType:
+			if len(args) != 1 {
+				fmt.Println("invalid response. big numbers should have exactly one argument")
+				return ""
+			}
+			return fmt.Sprintf("%s%s%s", BigNumbersFirstChar, args[0], CLRF)
 
-		case ArraysFirstChar:
-			reqLength, err := strconv.Atoi(requestLines[startIndex][1:])
-			if err != nil {
-				return "", startIndex + 1, fmt.Errorf("error converting array length in request from str to int: %s", err.Error())
+		case VerbatimStringsRespType:
+			// first argument is the three character format, such as txt or mkd
+			if len(args) != 2 || len(args[0]) != 3 {
+				fmt.Println("invalid response. verbatim strings need a format and a text")
+				return ""
 			}
+			return fmt.Sprintf("%s%v%s%s:%s%s", VerbatimStringsFirstChar, len(args[1]) + 4, CLRF, args[0], args[1], CLRF)
+	}
 
-			endIndex := startIndex + (reqLength * 2) + 1
+	return ""
+}
 
-			return strings.Join(requestLines[startIndex:endIndex], CLRF) + CLRF, endIndex, nil
+// aggregateBuilder writes an aggregate header followed by each argument as a bulk string
+func aggregateBuilder(firstChar string, length int, args []string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s%v%s", firstChar, length, CLRF)
+	for _, arg := range args {
+		fmt.Fprintf(&sb, "%s%v%s%s%s", BulkStringsFirstChar, len(arg), CLRF, arg, CLRF)
+	}
+	return sb.String()
+}
+
+// Protocol aware builders. Under RESP2 every RESP3 type falls back to the
+// closest RESP2 type, the same way redis downgrades replies for old clients.
+
+// MapResponse encodes key value pairs as a map, or a flat array under RESP2
+func MapResponse(proto int, pairs ...string) string {
+	if proto == RESP3 {
+		return ResponseBuilder(MapsRespType, pairs...)
+	}
+	return aggregateBuilder(ArraysFirstChar, len(pairs), pairs)
+}
+
+// ArrayHeader starts an array of length elements whose elements are written by the caller
+func ArrayHeader(length int) string {
+	return fmt.Sprintf("%s%v%s", ArraysFirstChar, length, CLRF)
+}
 
-		default:
-			return "", startIndex + 1, fmt.Errorf("error parsing request. invalid first char received: %s", requestLines[startIndex][0:1])
+// MapHeader starts a map of length pairs whose elements are written by the caller
+func MapHeader(proto int, length int) string {
+	if proto == RESP3 {
+		return fmt.Sprintf("%s%v%s", MapsFirstChar, length, CLRF)
+	}
+	return fmt.Sprintf("%s%v%s", ArraysFirstChar, length * 2, CLRF)
+}
 
+// SetResponse encodes members as a set, or an array under RESP2
+func SetResponse(proto int, members ...string) string {
+	if proto == RESP3 {
+		return ResponseBuilder(SetsRespType, members...)
 	}
+	return aggregateBuilder(ArraysFirstChar, len(members), members)
 }
 
-// func requestValidator(request []string) error {
-// 	if len(request) < 3 {
-// 		return fmt.Errorf("invalid request received: %s", request)
-// 	}
+// SetHeader starts a set of length members whose elements are written by the caller
+func SetHeader(proto int, length int) string {
+	if proto == RESP3 {
+		return fmt.Sprintf("%s%v%s", SetsFirstChar, length, CLRF)
+	}
+	return fmt.Sprintf("%s%v%s", ArraysFirstChar, length, CLRF)
+}
 
-// 	// should start with an asterisk (*) 
-// 	if request[0][0:1] == ArraysFirstChar {
-// 		request[0] = request[0][1:]
-// 	}
+// PushHeader starts an out of band push message, a plain array under RESP2
+func PushHeader(proto int, length int) string {
+	if proto == RESP3 {
+		return fmt.Sprintf("%s%v%s", PushesFirstChar, length, CLRF)
+	}
+	return fmt.Sprintf("%s%v%s", ArraysFirstChar, length, CLRF)
+}
 
-// 	// asterisk should be followed by the size of array
-// 	arraySizeStr := request[0][0:]
-// 	arraySize, err := strconv.Atoi(arraySizeStr)
-// 	if err != nil {
-// 		return fmt.Errorf("invalid array size received: %s", arraySizeStr)
-// 	}
+// AttributeResponse encodes auxiliary data for the reply that follows it.
+// RESP2 has no way to express attributes, so they are dropped.
+func AttributeResponse(proto int, pairs ...string) string {
+	if proto == RESP3 {
+		return ResponseBuilder(AttributesRespType, pairs...)
+	}
+	return ""
+}
 
-// 	var i int = 1
-// 	if len(request[i:]) != (arraySize * 2) {
-// 		return fmt.Errorf("array size does not match request size: %s", arraySizeStr)
-// 	}
+// DoubleResponse encodes a float as a double, or a bulk string under RESP2
+func DoubleResponse(proto int, value float64) string {
+	formatted := FormatDouble(value)
+	if proto == RESP3 {
+		return ResponseBuilder(DoublesRespType, formatted)
+	}
+	return ResponseBuilder(BulkStringsRespType, formatted)
+}
 
-// 	// keeping it simple for now, only expect to have bulk strings inside input arrays
-// 	for j := 0; j < arraySize; j ++ {
-// 		if request[i][0:1] != BulkStringsFirstChar {
-// 			return fmt.Errorf("content inside request is not a bulk string: %s", request)
-// 		}
+// BooleanResponse encodes a boolean, or the integers 1 and 0 under RESP2
+func BooleanResponse(proto int, value bool) string {
+	if proto == RESP3 {
+		if value {
+			return ResponseBuilder(BooleansRespType, "t")
+		}
+		return ResponseBuilder(BooleansRespType, "f")
+	}
+	if value {
+		return ResponseBuilder(IntegersRespType, "1")
+	}
+	return ResponseBuilder(IntegersRespType, "0")
+}
 
-// 		bulkStringSizeStr := request[i][1:]
-// 		bulkStringSize, err := strconv.Atoi(bulkStringSizeStr)
-// 		if err != nil {
-// 			return fmt.Errorf("invalid bulk string size received: %s", bulkStringSizeStr)
-// 		}
-// 		if len(request[i+1]) != bulkStringSize {
-// 			return fmt.Errorf("string size does not match request size: %v, string: %s", bulkStringSize, request[i+1])
-// 		}
-// 		i += 2
-// 	}
+// BigNumberResponse encodes an arbitrary precision integer, or a bulk string under RESP2
+func BigNumberResponse(proto int, value string) string {
+	if proto == RESP3 {
+		return ResponseBuilder(BigNumbersRespType, value)
+	}
+	return ResponseBuilder(BulkStringsRespType, value)
+}
 
-// 	return nil
-// }
+// VerbatimResponse encodes text with its format, or a bulk string under RESP2
+func VerbatimResponse(proto int, format string, text string) string {
+	if proto == RESP3 {
+		return ResponseBuilder(VerbatimStringsRespType, format, text)
+	}
+	return ResponseBuilder(BulkStringsRespType, text)
+}
 
-func IsRdbFile(req string) bool {
-	return strings.Contains(req, "REDIS")
+// NullArrayResponse is the null array under RESP2 and the null type under RESP3
+func NullArrayResponse(proto int) string {
+	if proto == RESP3 {
+		return ResponseBuilder(NullsRespType)
+	}
+	return fmt.Sprintf("%s-1%s", ArraysFirstChar, CLRF)
 }
 
-func SplitRequests(req string) []string {
-	requestLines := strings.Split(req, CLRF)
+// FormatDouble formats a float with the fewest digits that read back to it,
+// in plain notation unless it is below 1e-4 or from 1e17 on, where %.17g as
+// redis uses it switches to an exponent. Scores such as millisecond
+// timestamps are then printed in full.
+func FormatDouble(value float64) string {
+	switch {
+		case math.IsInf(value, 1):
+			return "inf"
+		case math.IsInf(value, -1):
+			return "-inf"
+		case math.IsNaN(value):
+			return "nan"
+	}
 
-	// remove the empty string at the end
-	if len(requestLines[len(requestLines) - 1]) == 0 {
-		requestLines = requestLines[0:len(requestLines)-1]
+	abs := math.Abs(value)
+	if abs != 0 && (abs < 1e-4 || abs >= 1e17) {
+		return strconv.FormatFloat(value, 'e', -1, 64)
 	}
-	
-	return requestLines
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// sanitizeLine replaces newlines in single line replies, which cannot be
+// escaped and would otherwise break the framing of the reply
+func sanitizeLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
 }
 
-func CombineRequests(reqs []string, isRespRequest bool) string {
-	req := strings.Join(reqs, CLRF)
-	if isRespRequest {
-		req += CLRF
+// EncodeCommand encodes an argument vector as a RESP array of bulk strings,
+// the form used to propagate commands to replicas
+func EncodeCommand(args [][]byte) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s%v%s", ArraysFirstChar, len(args), CLRF)
+	for _, arg := range args {
+		fmt.Fprintf(&sb, "%s%v%s%s%s", BulkStringsFirstChar, len(arg), CLRF, arg, CLRF)
 	}
-	return req
-}
\ No newline at end of file
+	return sb.String()
+}
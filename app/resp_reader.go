@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	// MaxBulkLength mirrors redis' proto-max-bulk-len default (512mb)
+	MaxBulkLength = 512 * 1024 * 1024
+	// MaxMultiBulkLength is the largest number of arguments accepted in one command
+	MaxMultiBulkLength = 1024 * 1024
+	// MaxLineLength caps header and inline lines so a peer cannot grow the buffer forever
+	MaxLineLength = 64 * 1024
+)
+
+var (
+	ErrProtocol = errors.New("protocol error")
+	ErrUnbalancedQuotes = fmt.Errorf("%w: unbalanced quotes in request", ErrProtocol)
+)
+
+// RespReader is an incremental RESP decoder. It reads from the underlying
+// connection through a buffer, so bytes belonging to the next command are
+// carried over between reads and a command split across several TCP reads
+// is only returned once it is complete.
+type RespReader struct {
+	rd *bufio.Reader
+}
+
+// NewRespReader() Creates a new RespReader reading from rd
+func NewRespReader(rd io.Reader) *RespReader {
+	return &RespReader{
+		rd: bufio.NewReaderSize(rd, DefaultBufferSize),
+	}
+}
+
+// Buffered returns the number of bytes already received but not yet decoded
+func (r *RespReader) Buffered() int {
+	return r.rd.Buffered()
+}
+
+// ReadCommand reads the next command as an argument vector. Commands are
+// either multibulk arrays or inline commands, plain space separated text
+// terminated by a newline as typed into telnet. An empty multibulk (*0 or
+// *-1) or an empty inline line yields an empty vector which callers should skip.
+func (r *RespReader) ReadCommand() ([][]byte, error) {
+	firstChar, err := r.rd.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if string(firstChar) != ArraysFirstChar {
+		return r.readInlineCommand()
+	}
+
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	argc, err := parseLength(line[1:])
+	if err != nil || argc > MaxMultiBulkLength {
+		return nil, fmt.Errorf("%w: invalid multibulk length", ErrProtocol)
+	}
+
+	if argc <= 0 {
+		return [][]byte{}, nil
+	}
+
+	args := make([][]byte, 0, argc)
+	for i := 0; i < argc; i++ {
+		arg, err := r.readBulk(true)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+
+	return args, nil
+}
+
+// ReadLine reads a single reply line such as +OK or +FULLRESYNC <id> <offset>.
+// Error replies are returned as errors.
+func (r *RespReader) ReadLine() (string, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return "", err
+	}
+
+	if len(line) == 0 {
+		return "", fmt.Errorf("%w: empty reply line", ErrProtocol)
+	}
+
+	switch line[0:1] {
+	case SimpleStringsFirstChar, IntegersFirstChar:
+		return line[1:], nil
+
+	case NullsFirstChar:
+		return "", errors.New(line[1:])
+
+	default:
+		return "", fmt.Errorf("%w: unexpected reply %q", ErrProtocol, line)
+	}
+}
+
+// ReadRDB reads the RDB payload sent by a master after FULLRESYNC. The
+// payload is framed like a bulk string but has no trailing CRLF.
+func (r *RespReader) ReadRDB() ([]byte, error) {
+	return r.readBulk(false)
+}
+
+func (r *RespReader) readBulk(withCLRF bool) ([]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 || line[0:1] != BulkStringsFirstChar {
+		return nil, fmt.Errorf("%w: expected '%s', got %q", ErrProtocol, BulkStringsFirstChar, line)
+	}
+
+	size, err := parseLength(line[1:])
+	if err != nil || size < 0 || size > MaxBulkLength {
+		return nil, fmt.Errorf("%w: invalid bulk length", ErrProtocol)
+	}
+
+	total := size
+	if withCLRF {
+		total += len(CLRF)
+	}
+
+	buf := make([]byte, total)
+	if _, err := io.ReadFull(r.rd, buf); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	if withCLRF && string(buf[size:]) != CLRF {
+		return nil, fmt.Errorf("%w: bulk string is not terminated by CRLF", ErrProtocol)
+	}
+
+	return buf[:size], nil
+}
+
+func (r *RespReader) readInlineCommand() ([][]byte, error) {
+	line, err := r.readRawLine()
+	if err != nil {
+		return nil, err
+	}
+
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+
+	return SplitInlineArgs(line)
+}
+
+// readLine returns the next CRLF terminated line without the terminator
+func (r *RespReader) readLine() (string, error) {
+	line, err := r.readRawLine()
+	if err != nil {
+		return "", err
+	}
+
+	if len(line) < len(CLRF) || string(line[len(line)-len(CLRF):]) != CLRF {
+		return "", fmt.Errorf("%w: line is not terminated by CRLF", ErrProtocol)
+	}
+
+	return string(line[:len(line)-len(CLRF)]), nil
+}
+
+// readRawLine returns the next newline terminated line including the terminator
+func (r *RespReader) readRawLine() ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := r.rd.ReadSlice('\n')
+		line = append(line, chunk...)
+
+		if err == nil {
+			break
+		}
+		if err != bufio.ErrBufferFull {
+			if len(line) > 0 {
+				return nil, unexpectedEOF(err)
+			}
+			return nil, err
+		}
+		if len(line) > MaxLineLength {
+			return nil, fmt.Errorf("%w: too big line", ErrProtocol)
+		}
+	}
+
+	return line, nil
+}
+
+// SplitInlineArgs splits an inline command into arguments the way redis-cli
+// does: arguments are separated by spaces, and may be "double quoted" with
+// C style escapes such as \n and \x41, or 'single quoted' where only \' is escaped.
+func SplitInlineArgs(line []byte) ([][]byte, error) {
+	args := make([][]byte, 0)
+
+	for i := 0; ; {
+		for i < len(line) && isInlineSpace(line[i]) {
+			i++
+		}
+		if i >= len(line) {
+			return args, nil
+		}
+
+		var current []byte
+		inDoubleQuotes, inSingleQuotes := false, false
+
+		for done := false; !done; {
+			if i >= len(line) {
+				if inDoubleQuotes || inSingleQuotes {
+					return nil, ErrUnbalancedQuotes
+				}
+				break
+			}
+
+			c := line[i]
+			switch {
+				case inDoubleQuotes:
+					if c == '\\' && i + 3 < len(line) && line[i+1] == 'x' && isHexDigit(line[i+2]) && isHexDigit(line[i+3]) {
+						value, _ := strconv.ParseUint(string(line[i+2:i+4]), 16, 8)
+						current = append(current, byte(value))
+						i += 3
+					} else if c == '\\' && i + 1 < len(line) {
+						i++
+						switch line[i] {
+							case 'n':
+								current = append(current, '\n')
+							case 'r':
+								current = append(current, '\r')
+							case 't':
+								current = append(current, '\t')
+							case 'b':
+								current = append(current, '\b')
+							case 'a':
+								current = append(current, '\a')
+							default:
+								current = append(current, line[i])
+						}
+					} else if c == '"' {
+						// closing quote must be followed by a space or nothing at all
+						if i + 1 < len(line) && !isInlineSpace(line[i+1]) {
+							return nil, ErrUnbalancedQuotes
+						}
+						done = true
+					} else {
+						current = append(current, c)
+					}
+
+				case inSingleQuotes:
+					if c == '\\' && i + 1 < len(line) && line[i+1] == '\'' {
+						i++
+						current = append(current, '\'')
+					} else if c == '\'' {
+						if i + 1 < len(line) && !isInlineSpace(line[i+1]) {
+							return nil, ErrUnbalancedQuotes
+						}
+						done = true
+					} else {
+						current = append(current, c)
+					}
+
+				case isInlineSpace(c):
+					done = true
+
+				case c == '"':
+					inDoubleQuotes = true
+
+				case c == '\'':
+					inSingleQuotes = true
+
+				default:
+					current = append(current, c)
+			}
+			i++
+		}
+
+		if current == nil {
+			current = []byte{}
+		}
+		args = append(args, current)
+	}
+}
+
+func isInlineSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func isHexDigit(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func parseLength(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid length %q: %s", s, err.Error())
+	}
+	return n, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRespReader_ReadCommand(t *testing.T) {
+	reader := NewRespReader(strings.NewReader("*1\r\n$4\r\nping\r\n*2\r\n$4\r\necho\r\n$11\r\nHello World\r\n"))
+
+	args, err := reader.ReadCommand()
+	assert.Nil(t, err)
+	assert.Equal(t, toArgs("ping"), args)
+
+	args, err = reader.ReadCommand()
+	assert.Nil(t, err)
+	assert.Equal(t, toArgs("echo", "Hello World"), args)
+
+	_, err = reader.ReadCommand()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestRespReader_ReadCommand_PartialReads(t *testing.T) {
+	req := strings.Repeat("*5\r\n$3\r\nset\r\n$5\r\nmango\r\n$9\r\nraspberry\r\n$2\r\npx\r\n$3\r\n100\r\n", 3)
+
+	// every read returns a single byte, so each frame is split across many reads
+	reader := NewRespReader(iotest.OneByteReader(strings.NewReader(req)))
+
+	for i := 0; i < 3; i++ {
+		args, err := reader.ReadCommand()
+		assert.Nil(t, err)
+		assert.Equal(t, toArgs("set", "mango", "raspberry", "px", "100"), args)
+	}
+
+	_, err := reader.ReadCommand()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestRespReader_ReadCommand_LargeBulk(t *testing.T) {
+	value := strings.Repeat("x", 500*1024)
+	req := EncodeCommand(toArgs("set", "blob", value)) + EncodeCommand(toArgs("get", "blob"))
+
+	reader := NewRespReader(iotest.HalfReader(strings.NewReader(req)))
+
+	args, err := reader.ReadCommand()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(args))
+	assert.Equal(t, value, string(args[2]))
+
+	args, err = reader.ReadCommand()
+	assert.Nil(t, err)
+	assert.Equal(t, toArgs("get", "blob"), args)
+}
+
+func TestRespReader_ReadCommand_Errors(t *testing.T) {
+	{
+		reader := NewRespReader(strings.NewReader("*1\r\n$4\r\nping\r\n*1\r\n$4\r\npi"))
+
+		_, err := reader.ReadCommand()
+		assert.Nil(t, err)
+
+		_, err = reader.ReadCommand()
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+	}
+
+	{
+		reader := NewRespReader(strings.NewReader("*1\r\n$4\r\npingxx\r\n"))
+
+		_, err := reader.ReadCommand()
+		assert.ErrorIs(t, err, ErrProtocol)
+	}
+
+	{
+		reader := NewRespReader(strings.NewReader("*1\r\n$-5\r\n"))
+
+		_, err := reader.ReadCommand()
+		assert.ErrorIs(t, err, ErrProtocol)
+	}
+}
+
+func TestRespReader_ReadCommand_Inline(t *testing.T) {
+	reader := NewRespReader(iotest.OneByteReader(strings.NewReader("PING\r\nset  fruit \"red apple\"\n\r\n*1\r\n$4\r\nping\r\necho 'it\\'s'\r\n")))
+
+	args, err := reader.ReadCommand()
+	assert.Nil(t, err)
+	assert.Equal(t, toArgs("PING"), args)
+
+	args, err = reader.ReadCommand()
+	assert.Nil(t, err)
+	assert.Equal(t, toArgs("set", "fruit", "red apple"), args)
+
+	// blank lines yield no arguments
+	args, err = reader.ReadCommand()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(args))
+
+	args, err = reader.ReadCommand()
+	assert.Nil(t, err)
+	assert.Equal(t, toArgs("ping"), args)
+
+	args, err = reader.ReadCommand()
+	assert.Nil(t, err)
+	assert.Equal(t, toArgs("echo", "it's"), args)
+
+	_, err = reader.ReadCommand()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestSplitInlineArgs(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected [][]byte
+		err      error
+	}{
+		{"", toArgs(), nil},
+		{"   ", toArgs(), nil},
+		{"GET key", toArgs("GET", "key"), nil},
+		{"\tset   key\t value ", toArgs("set", "key", "value"), nil},
+		{`set key "hello world"`, toArgs("set", "key", "hello world"), nil},
+		{`set key "line\r\nbreak\t\x41\x4a"`, toArgs("set", "key", "line\r\nbreak\tAJ"), nil},
+		{`set key "say \"hi\""`, toArgs("set", "key", `say "hi"`), nil},
+		{`set key 'no \n escapes'`, toArgs("set", "key", `no \n escapes`), nil},
+		{`set key ""`, toArgs("set", "key", ""), nil},
+		{`set key "unbalanced`, nil, ErrUnbalancedQuotes},
+		{`set key 'unbalanced`, nil, ErrUnbalancedQuotes},
+		{`set key "closed"too`, nil, ErrUnbalancedQuotes},
+	}
+
+	for _, test := range tests {
+		args, err := SplitInlineArgs([]byte(test.line))
+		assert.Equal(t, test.err, err, test.line)
+		assert.Equal(t, test.expected, args, test.line)
+	}
+}
+
+func TestRespReader_ReadRDB(t *testing.T) {
+	rdb := "REDIS0011\xfa\tredis-ver\x057.2.0\xfa\nredis-bits\xc0@\xfa\x05ctime\xc2m\b\xbce\xfa\bused-mem°\xc4\x10\x00\xfa\baof-base\xc0\x00\xff\xf0n;\xfe\xc0\xffZ\xa2"
+	req := "+FULLRESYNC 75cd7bc10c49047e0d163660f3b90625b1af31dc 0\r\n" +
+		"$88\r\n" + rdb +
+		"*3\r\n$8\r\nREPLCONF\r\n$6\r\nGETACK\r\n$1\r\n*\r\n"
+
+	reader := NewRespReader(strings.NewReader(req))
+
+	line, err := reader.ReadLine()
+	assert.Nil(t, err)
+	assert.Equal(t, "FULLRESYNC 75cd7bc10c49047e0d163660f3b90625b1af31dc 0", line)
+
+	payload, err := reader.ReadRDB()
+	assert.Nil(t, err)
+	assert.Equal(t, rdb, string(payload))
+
+	args, err := reader.ReadCommand()
+	assert.Nil(t, err)
+	assert.Equal(t, toArgs("REPLCONF", "GETACK", "*"), args)
+}
+
+func TestParseCommands_LargeValue(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	value := strings.Repeat("{\"k\":\"v\"}", 50*1024)
+
+	val, err := handler.ParseCommands(EncodeCommand(toArgs("set", "blob", value)) + EncodeCommand(toArgs("get", "blob")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"+OK\r\n", ResponseBuilder(BulkStringsRespType, value)}, val)
+}
+
+func TestParseCommands_Inline(t *testing.T) {
+	handler := createCommandsHandler(RoleMaster)
+
+	val, err := handler.ParseCommands("PING\r\nSET fruit \"red apple\"\r\nGET fruit\n")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"+PONG\r\n", "+OK\r\n", "$9\r\nred apple\r\n"}, val)
+}
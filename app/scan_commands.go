@@ -0,0 +1,216 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/store"
+)
+
+// DefaultScanCount is the amount of work a SCAN call does when no COUNT is given
+const DefaultScanCount = 10
+
+// scanOptions are the MATCH, COUNT and TYPE filters of the SCAN family
+type scanOptions struct {
+	// pattern is nil when every element matches
+	pattern  []byte
+	count    int
+	// typeName is empty when keys of every type are returned
+	typeName string
+}
+
+// ScanHandler iterates the keys of the database a few at a time: each call
+// replies with the cursor to pass to the next one, 0 once the iteration is
+// complete, and the keys found. COUNT hints at how many keys to look at, and
+// MATCH and TYPE filter the keys found, so calls may reply with no keys
+// before the end of the iteration.
+// Usage: SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+func (ch *Commands) ScanHandler(c *Client, args [][]byte) ([]string, error) {
+	cursor, err := parseScanCursor(args[1])
+	if err != nil {
+		return nil, err
+	}
+	opts, err := parseScanOptions(args[2:], true)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0)
+	next := ch.db(c).Keyspace.Scan(cursor, opts.count, func(key string, obj *store.Object) {
+		if opts.typeName != "" && store.TypeOf(obj) != opts.typeName {
+			return
+		}
+		if opts.matches(key) {
+			keys = append(keys, key)
+		}
+	})
+
+	return []string{scanReply(next, keys)}, nil
+}
+
+// HScanHandler iterates the fields and values of a hash like SCAN.
+// Usage: HSCAN key cursor [MATCH pattern] [COUNT count]
+func (ch *Commands) HScanHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.scanKey(c, args, store.TypeHash)
+}
+
+// SScanHandler iterates the members of a set like SCAN.
+// Usage: SSCAN key cursor [MATCH pattern] [COUNT count]
+func (ch *Commands) SScanHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.scanKey(c, args, store.TypeSet)
+}
+
+// ZScanHandler iterates the members and scores of a sorted set like SCAN.
+// Usage: ZSCAN key cursor [MATCH pattern] [COUNT count]
+func (ch *Commands) ZScanHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.scanKey(c, args, store.TypeZSet)
+}
+
+// scanKey iterates the elements of the collection at args[1], which must be
+// of type typeName. A missing key is an empty collection.
+func (ch *Commands) scanKey(c *Client, args [][]byte, typeName string) ([]string, error) {
+	cursor, err := parseScanCursor(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	// lists and hashes are changed in place, so they are only read under the
+	// lock of their key
+	var next uint64
+	var elements []string
+	err = ch.db(c).Keyspace.View(string(args[1]), func(obj *store.Object) error {
+		if obj == nil {
+			return nil
+		}
+		if store.TypeOf(obj) != typeName {
+			return ErrWrongType
+		}
+
+		opts, err := parseScanOptions(args[3:], false)
+		if err != nil {
+			return err
+		}
+		next, elements = scanCollection(obj, cursor, opts)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{scanReply(next, elements)}, nil
+}
+
+// scanCollection returns the elements of a hash, set or sorted set found at
+// cursor that match opts, and the cursor to continue from. Hashes and sorted
+// sets return each member followed by its value or score.
+func scanCollection(obj *store.Object, cursor uint64, opts scanOptions) (uint64, []string) {
+	elements := make([]string, 0)
+
+	switch value := obj.Value.(type) {
+		case *store.Hash:
+			now := time.Now().UnixMilli()
+			// like the keyspace, look at up to ten times count buckets to
+			// find count fields
+			for i := 0; i < opts.count * 10 && len(elements) < opts.count * 2; i++ {
+				cursor = value.Scan(cursor, now, func(field string, v []byte) {
+					if opts.matches(field) {
+						elements = append(elements, field, string(v))
+					}
+				})
+				if cursor == 0 {
+					break
+				}
+			}
+			return cursor, elements
+		case *store.Set:
+			for i := 0; i < opts.count * 10 && len(elements) < opts.count; i++ {
+				cursor = value.Scan(cursor, func(member string) {
+					if opts.matches(member) {
+						elements = append(elements, member)
+					}
+				})
+				if cursor == 0 {
+					break
+				}
+			}
+			return cursor, elements
+		case *store.ZSet:
+			for i := 0; i < opts.count * 10 && len(elements) < opts.count * 2; i++ {
+				cursor = value.Scan(cursor, func(member string, score float64) {
+					if opts.matches(member) {
+						elements = append(elements, member, FormatDouble(score))
+					}
+				})
+				if cursor == 0 {
+					break
+				}
+			}
+			return cursor, elements
+		default:
+			return 0, nil
+	}
+}
+
+// parseScanCursor parses a cursor, which is an unsigned 64 bit integer
+func parseScanCursor(arg []byte) (uint64, error) {
+	cursor, err := strconv.ParseUint(string(arg), 10, 64)
+	if err != nil {
+		return 0, NewCommandError("invalid cursor")
+	}
+	return cursor, nil
+}
+
+// parseScanOptions parses the options following the cursor. TYPE is only
+// accepted when scanning the keyspace.
+func parseScanOptions(args [][]byte, allowType bool) (scanOptions, error) {
+	opts := scanOptions{count: DefaultScanCount}
+
+	for i := 0; i < len(args); i += 2 {
+		if i + 1 == len(args) {
+			return opts, ErrSyntax
+		}
+		value := args[i + 1]
+
+		switch Command(strings.ToUpper(string(args[i]))) {
+			case MATCH:
+				opts.pattern = value
+				if string(value) == "*" {
+					opts.pattern = nil
+				}
+			case COUNT:
+				count, err := strconv.Atoi(string(value))
+				if err != nil {
+					return opts, ErrNotInteger
+				}
+				if count < 1 {
+					return opts, ErrSyntax
+				}
+				opts.count = count
+			case TYPE:
+				if !allowType {
+					return opts, ErrSyntax
+				}
+				opts.typeName = strings.ToLower(string(value))
+				if !slices.Contains(store.TypeNames, opts.typeName) {
+					return opts, NewCommandError("unknown type name '%s'", value)
+				}
+			default:
+				return opts, ErrSyntax
+		}
+	}
+
+	return opts, nil
+}
+
+func (opts scanOptions) matches(element string) bool {
+	return opts.pattern == nil || StringMatch(opts.pattern, []byte(element), false)
+}
+
+// scanReply encodes the next cursor followed by the elements found
+func scanReply(cursor uint64, elements []string) string {
+	return ArrayHeader(2) +
+		ResponseBuilder(BulkStringsRespType, strconv.FormatUint(cursor, 10)) +
+		aggregateBuilder(ArraysFirstChar, len(elements), elements)
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/codecrafters-io/redis-starter-go/store"
 )
@@ -15,6 +18,8 @@ type Role string
 const (
 	DefaultListenerPort = "6379"
 	DefaultBufferSize = 4096
+	// MaxPendingCommands is how many commands are read ahead of the one executing
+	MaxPendingCommands = 1024
 
 	// flag constants
 	FlagPort = "port"
@@ -29,6 +34,27 @@ const (
 	FlagDBFileName = "dbfilename"
 	FlagDBFileNameUsage = "Provides DB File Name"
 
+	FlagDatabases = "databases"
+	FlagDatabasesUsage = "number of logical databases"
+
+	FlagHz = "hz"
+	FlagHzUsage = "how many times per second background tasks run"
+
+	FlagActiveExpireEffort = "active-expire-effort"
+	FlagActiveExpireEffortUsage = "effort (1 to 10) spent expiring keys in the background"
+
+	FlagHashMaxListpackEntries = "hash-max-listpack-entries"
+	FlagHashMaxListpackEntriesUsage = "number of fields past which a hash converts to a hash table"
+
+	FlagHashMaxListpackValue = "hash-max-listpack-value"
+	FlagHashMaxListpackValueUsage = "length of a field or value past which a hash converts to a hash table"
+
+	FlagSetMaxIntsetEntries = "set-max-intset-entries"
+	FlagSetMaxIntsetEntriesUsage = "number of members past which a set of integers converts to a hash table"
+
+	FlagHllSparseMaxBytes = "hll-sparse-max-bytes"
+	FlagHllSparseMaxBytesUsage = "size in bytes past which a sparse HyperLogLog converts to the dense encoding"
+
 	// server constants
 	TcpNetwork = "tcp"
 	ReplicaIdLength = 40
@@ -49,13 +75,17 @@ type ServerOpts struct {
 
 	ReplicaOffset 			int64
 
-	Replicas 				map[net.Conn]int
+	// Hz is how many times per second background tasks such as the active
+	// expiration cycle run, and ActiveExpireEffort (1 to 10) how much CPU
+	// time and how many keys each expiration cycle may spend
+	Hz 						int
+	ActiveExpireEffort 		int
 }
 
 type Server struct {
 	ServerOpts
 	listner  	net.Listener
-	commands  	Commands
+	commands  	*Commands
 
 	MasterConn 	net.Conn
 }
@@ -74,12 +104,20 @@ func main() {
 
 	dirPtr := flag.String(FlagDir, ".", "--dir")
 	dbFileNamePtr := flag.String(FlagDBFileName, "dump.rdb", "--dbfilename")
+	databasesPtr := flag.Int(FlagDatabases, store.DefaultDatabases, FlagDatabasesUsage)
+	hzPtr := flag.Int(FlagHz, DefaultHz, FlagHzUsage)
+	activeExpireEffortPtr := flag.Int(FlagActiveExpireEffort, DefaultActiveExpireEffort, FlagActiveExpireEffortUsage)
+	hashMaxListpackEntriesPtr := flag.Int(FlagHashMaxListpackEntries, store.DefaultHashMaxListpackEntries, FlagHashMaxListpackEntriesUsage)
+	hashMaxListpackValuePtr := flag.Int(FlagHashMaxListpackValue, store.DefaultHashMaxListpackValue, FlagHashMaxListpackValueUsage)
+	setMaxIntsetEntriesPtr := flag.Int(FlagSetMaxIntsetEntries, store.DefaultSetMaxIntsetEntries, FlagSetMaxIntsetEntriesUsage)
+	hllSparseMaxBytesPtr := flag.Int(FlagHllSparseMaxBytes, store.DefaultHllSparseMaxBytes, FlagHllSparseMaxBytesUsage)
 
 	flag.Parse()
 
 	serverOpts := ServerOpts{
 		ListnerPort: *portPtr,
-		Replicas: make(map[net.Conn]int, 0),
+		Hz: *hzPtr,
+		ActiveExpireEffort: *activeExpireEffortPtr,
 	}
 
 	if len(*replicaOfPtr) > 0 {
@@ -103,16 +141,32 @@ func main() {
 			Dir: *dirPtr,
 			DbFileName: *dbFileNamePtr,
 		},
+		Databases: *databasesPtr,
+		Encoding: store.EncodingConfig{
+			HashMaxListpackEntries: *hashMaxListpackEntriesPtr,
+			HashMaxListpackValue: *hashMaxListpackValuePtr,
+			SetMaxIntsetEntries: *setMaxIntsetEntriesPtr,
+			HllSparseMaxBytes: *hllSparseMaxBytesPtr,
+		},
 	}
 
 	server := NewServer(serverOpts, storeOpts)
 
 	if server.Role == RoleSlave {
-		server.handshakeMaster()
-		go server.handleConn(server.MasterConn)
+		reader, err := server.handshakeMaster()
+		if err != nil {
+			fmt.Println("error during handshake with master: ", err.Error())
+		} else {
+			go func() {
+				defer server.MasterConn.Close()
+				master := NewClient(server.MasterConn)
+				master.IsMaster = true
+				server.serveClient(master, reader)
+			}()
+		}
 	}
 
-	server.commands.Store.KVStore.InitializeDB()
+	server.commands.Store.InitializeDB()
 	server.StartServer()
 }
 
@@ -144,136 +198,133 @@ func (s *Server) Run() {
 func (s *Server) handleConn(conn net.Conn) {
 	defer conn.Close()
 
+	s.serveClient(NewClient(conn), NewRespReader(conn))
+}
+
+// serveClient runs the commands sent by a client. Commands are read off the
+// connection on this goroutine, so a command split across several reads or
+// several commands in one read are both fine. A dispatcher goroutine hands
+// them to the executor in order, one at a time, and replies are written back
+// by the client's writer goroutine.
+func (s *Server) serveClient(c *Client, reader *RespReader) {
+	c.StartWriter()
+	defer c.Close()
+
+	pending := make(chan [][]byte, MaxPendingCommands)
+	dispatched := make(chan struct{})
+	go func() {
+		defer close(dispatched)
+		for args := range pending {
+			s.commands.Execute(c, args)
+		}
+	}()
+
 	for {
-		buf := make([]byte, DefaultBufferSize)
-		n, err := conn.Read(buf)
+		args, err := reader.ReadCommand()
 		if err != nil {
-			fmt.Println("error reading from main connection: ", err.Error())
-			return
+			if err != io.EOF {
+				fmt.Println("error reading from connection: ", err.Error())
+			}
+
+			// like redis, tell the client what was wrong with its request
+			// before closing, as the rest of the stream cannot be framed
+			if errors.Is(err, ErrProtocol) && !c.IsMaster {
+				c.Reply(ErrorResponse(NewCommandError("Protocol error: %s", strings.TrimPrefix(err.Error(), ErrProtocol.Error() + ": "))))
+			}
+			break
 		}
-		if n == 0 {
-			fmt.Println("buffer is empty")
-			return
+		if len(args) == 0 {
+			continue
 		}
 
-		fmt.Printf("Message Received: %q\n", buf[:n])
-
-		// parse requests
-		req := string(buf[:n])
-		
-		err = s.HandleRequests(conn, req)
-		if err != nil {
-			fmt.Printf("error processing request: %s", err.Error())
-			return
-		}
+		fmt.Printf("Command Received: %q\n", args)
+		pending <- args
 	}
+
+	// commands already read still run, but a blocked client is released now
+	close(pending)
+	s.commands.Disconnect(c)
+	<-dispatched
+	s.commands.FreeClient(c)
 }
 
-func (s *Server) HandleRequests(conn net.Conn, req string) error {
-	// parse requests
-	responses, err := s.commands.ParseCommands(req)
+// handshakeMaster() connects to the master and performs the PING, REPLCONF, PSYNC handshake.
+// It returns a reader positioned right after the RDB payload, from which the
+// propagated command stream can be served.
+func (s *Server) handshakeMaster() (*RespReader, error) {
+	conn, err := net.Dial(TcpNetwork, net.JoinHostPort(s.MasterHost, s.MasterPort))
 	if err != nil {
-		return fmt.Errorf("error parsing commands: %s", err.Error())
+		return nil, fmt.Errorf("failed to bind to master host: %s port:%s error:%s", s.MasterHost, s.MasterPort, err.Error())
 	}
 
-	// store replicas
-	if ContainsPsyncCommand(req) {
-		_, ok := s.Replicas[conn]
-		if !ok {
-			s.Replicas[conn] = 0
-		}
-	}
+	s.MasterConn = conn
+	reader := NewRespReader(conn)
 
-	// write responses
-	err = s.writeMessages(conn, responses)
-	if err != nil {
-		return fmt.Errorf("error writing messages: %s", err.Error())
+	// start handshake
+	// Send PING to master
+	if _, err := s.sendToMaster(reader, "PING"); err != nil {
+		return nil, err
 	}
 
-	return nil
-}
-
-
-func (s *Server) writeMessages(conn net.Conn, messages []string) error {
-	if len(messages) == 0 {
-		return nil
+	// Send first REPLCONF to master with slave listening PORT
+	if _, err := s.sendToMaster(reader, "REPLCONF", "listening-port", s.ListnerPort); err != nil {
+		return nil, err
 	}
 
-	fmt.Printf("writing messages to conn: %q\n", messages)
-	for _, message := range messages {
-		_, err := conn.Write([]byte(message))
-		if err != nil {
-			return fmt.Errorf("error writing to connection: %s", err.Error())
-		}
+	// Send second REPLCONF to master with PSYNC2 Capability
+	if _, err := s.sendToMaster(reader, "REPLCONF", "capa", "psync2"); err != nil {
+		return nil, err
 	}
-	return nil
-}
 
-func (s *Server) handshakeMaster() {
-	conn, err := net.Dial(TcpNetwork, fmt.Sprintf("%s:%s", s.MasterHost, s.MasterPort))
-	if err != nil {
-		fmt.Printf("Failed to bind to master host: %s port:%s error:%s\n", s.MasterHost, s.MasterPort, err.Error())
-		return
+	// Send first PSYNC to master with PSYNC2 Capability
+	sendReplicationID := s.MasterReplicationID
+	if len(s.MasterReplicationID) == 0 {
+		sendReplicationID = "?"
 	}
+	sendOffset := strconv.Itoa(int(s.MasterReplicationOffset))
 
-	s.MasterConn = conn
-
-	// start handshake
-	// Send PING to master
-	_, err = conn.Write([]byte("*1\r\n$4\r\nping\r\n"))
+	reply, err := s.sendToMaster(reader, "PSYNC", sendReplicationID, sendOffset)
 	if err != nil {
-		fmt.Println("error writing to connection: ", err.Error())
-		return
+		return nil, err
 	}
 
-	_, err = conn.Read(make([]byte, 1024))
-	if err != nil {
-		return
+	// FULLRESYNC <replid> <offset>: the stream that follows starts at offset
+	if fields := strings.Fields(reply); len(fields) == 3 && Command(fields[0]) == FULLRESYNC {
+		offset, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid offset in %s reply: %q", FULLRESYNC, reply)
+		}
+		s.commands.ServerOpts.MasterReplicationID = fields[1]
+		s.commands.ServerOpts.ReplicaOffset = offset
 	}
 
-	// Send first REPLCONF to master with slave listening PORT
-	_, err = conn.Write([]byte(fmt.Sprintf("*3\r\n$8\r\nREPLCONF\r\n$14\r\nlistening-port\r\n$%v\r\n%s\r\n", len(s.ListnerPort), s.ListnerPort)))
+	// the FULLRESYNC reply is followed by the master's RDB snapshot
+	rdb, err := reader.ReadRDB()
 	if err != nil {
-		fmt.Println("error writing to connection: ", err.Error())
-		return
+		return nil, fmt.Errorf("error reading rdb file from master: %s", err.Error())
 	}
+	fmt.Printf("received rdb file from master of size: %v\n", len(rdb))
 
-	_, err = conn.Read(make([]byte, DefaultBufferSize))
-	if err != nil {
-		fmt.Println("error reading from connection: ", err.Error())
-		return
-	}
+	return reader, nil
+}
 
-	// Send second REPLCONF to master with PSYNC2 Capability
-	_, err = conn.Write([]byte("*3\r\n$8\r\nREPLCONF\r\n$4\r\ncapa\r\n$6\r\npsync2\r\n"))
-	if err != nil {
-		fmt.Println("error writing to connection: ", err.Error())
-		return
+// sendToMaster() writes a command to the master and waits for its single line reply
+func (s *Server) sendToMaster(reader *RespReader, args ...string) (string, error) {
+	cmd := make([][]byte, 0, len(args))
+	for _, arg := range args {
+		cmd = append(cmd, []byte(arg))
 	}
 
-	buf := make([]byte, DefaultBufferSize)
-	_, err = conn.Read(buf)
+	_, err := s.MasterConn.Write([]byte(EncodeCommand(cmd)))
 	if err != nil {
-		fmt.Println("error reading from connection: ", err.Error())
-		return
-	}
-
-	// Send first PSYNC to master with PSYNC2 Capability
-	sendReplicationID := s.MasterReplicationID
-	if len(s.MasterReplicationID) == 0 {
-		sendReplicationID = "?"
+		return "", fmt.Errorf("error writing to connection: %s", err.Error())
 	}
-	sendOffset := strconv.Itoa(int(s.MasterReplicationOffset))
 
-	_, err = conn.Write([]byte(fmt.Sprintf("*3\r\n$5\r\nPSYNC\r\n$%v\r\n%s\r\n$%v\r\n%s\r\n", len(sendReplicationID), sendReplicationID, len(sendOffset), sendOffset)))
+	reply, err := reader.ReadLine()
 	if err != nil {
-		fmt.Println("error writing to connection: ", err.Error())
-		return
+		return "", fmt.Errorf("error reading %s reply from master: %s", args[0], err.Error())
 	}
+	fmt.Printf("master replied to %s: %s\n", args[0], reply)
 
-	// n, err := conn.Read(buf)
-	// if err != nil {
-	// 	fmt.Println("error reading from connection: ", err.Error())
-	// 	return
-	// } 
-}
\ No newline at end of file
+	return reply, nil
+}
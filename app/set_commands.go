@@ -0,0 +1,274 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// SAddHandler adds members to a set, creating it when missing, and replies
+// with the number of members added. Usage: SADD key member [member ...]
+func (ch *Commands) SAddHandler(c *Client, args [][]byte) ([]string, error) {
+	added, err := ch.db(c).SetStore.Add(string(args[1]), toStrings(args[2:]))
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if added == 0 {
+		c.noPropagate = true
+	}
+	return []string{intReply(added)}, nil
+}
+
+// SRemHandler removes members from a set, deleting it once it has none
+// left, and replies with the number of members removed.
+// Usage: SREM key member [member ...]
+func (ch *Commands) SRemHandler(c *Client, args [][]byte) ([]string, error) {
+	removed, err := ch.db(c).SetStore.Remove(string(args[1]), toStrings(args[2:]))
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if removed == 0 {
+		c.noPropagate = true
+	}
+	return []string{intReply(removed)}, nil
+}
+
+// SMembersHandler replies with the members of a set. Usage: SMEMBERS key
+func (ch *Commands) SMembersHandler(c *Client, args [][]byte) ([]string, error) {
+	members, err := ch.db(c).SetStore.Members(string(args[1]))
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return []string{SetResponse(c.Protocol, members...)}, nil
+}
+
+// SIsMemberHandler replies 1 when a member belongs to a set.
+// Usage: SISMEMBER key member
+func (ch *Commands) SIsMemberHandler(c *Client, args [][]byte) ([]string, error) {
+	found, err := ch.db(c).SetStore.IsMember(string(args[1]), []string{string(args[2])})
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if !found[0] {
+		return []string{intReply(0)}, nil
+	}
+	return []string{intReply(1)}, nil
+}
+
+// SMIsMemberHandler replies with an array holding 1 for each member that
+// belongs to a set and 0 for the others. Usage: SMISMEMBER key member [member ...]
+func (ch *Commands) SMIsMemberHandler(c *Client, args [][]byte) ([]string, error) {
+	found, err := ch.db(c).SetStore.IsMember(string(args[1]), toStrings(args[2:]))
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	results := make([]int, len(found))
+	for i, isMember := range found {
+		if isMember {
+			results[i] = 1
+		}
+	}
+	return []string{intArrayReply(results)}, nil
+}
+
+// SCardHandler replies with the number of members of a set. Usage: SCARD key
+func (ch *Commands) SCardHandler(c *Client, args [][]byte) ([]string, error) {
+	length, err := ch.db(c).SetStore.Card(string(args[1]))
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return []string{intReply(length)}, nil
+}
+
+// SPopHandler removes and replies with a member of a set picked at random,
+// or with up to count members when count is given. Replicas receive the
+// members removed as an SREM. Usage: SPOP key [count]
+func (ch *Commands) SPopHandler(c *Client, args [][]byte) ([]string, error) {
+	if len(args) > 3 {
+		return nil, ErrSyntax
+	}
+
+	count := 1
+	if len(args) == 3 {
+		parsed, err := strconv.Atoi(string(args[2]))
+		if err != nil || parsed < 0 {
+			return nil, NewCommandError("value is out of range, must be positive")
+		}
+		count = parsed
+	}
+
+	key := string(args[1])
+	members, err := ch.db(c).SetStore.Pop(key, count)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if len(members) == 0 {
+		c.noPropagate = true
+	} else {
+		c.Argv = toBytesArgs(append([]string{string(SREM), key}, members...)...)
+	}
+
+	if len(args) == 2 {
+		if members == nil {
+			return NullResponse(c.Protocol), nil
+		}
+		return []string{ResponseBuilder(BulkStringsRespType, members[0])}, nil
+	}
+	return []string{SetResponse(c.Protocol, members...)}, nil
+}
+
+// SRandMemberHandler replies with a member of a set picked at random, or with
+// count distinct members when count is positive and count members that may
+// repeat when it is negative. Usage: SRANDMEMBER key [count]
+func (ch *Commands) SRandMemberHandler(c *Client, args [][]byte) ([]string, error) {
+	db := ch.db(c)
+	key := string(args[1])
+
+	if len(args) == 2 {
+		members, err := db.SetStore.RandomMembers(key, 1, false)
+		if err != nil {
+			return nil, storeError(err)
+		}
+		if len(members) == 0 {
+			return NullResponse(c.Protocol), nil
+		}
+		return []string{ResponseBuilder(BulkStringsRespType, members[0])}, nil
+	}
+	if len(args) > 3 {
+		return nil, ErrSyntax
+	}
+
+	count, allowDuplicates, err := parseRandomCount(args[2])
+	if err != nil {
+		return nil, err
+	}
+	members, err := db.SetStore.RandomMembers(key, count, allowDuplicates)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return []string{aggregateBuilder(ArraysFirstChar, len(members), members)}, nil
+}
+
+// SMoveHandler moves a member from a set to another, and replies 1 when it
+// was a member of the source. Usage: SMOVE source destination member
+func (ch *Commands) SMoveHandler(c *Client, args [][]byte) ([]string, error) {
+	moved, err := ch.db(c).SetStore.Move(string(args[1]), string(args[2]), string(args[3]))
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if !moved {
+		c.noPropagate = true
+		return []string{intReply(0)}, nil
+	}
+	return []string{intReply(1)}, nil
+}
+
+// SInterHandler replies with the members of every given set, a missing key
+// being an empty set. Usage: SINTER key [key ...]
+func (ch *Commands) SInterHandler(c *Client, args [][]byte) ([]string, error) {
+	members, err := ch.db(c).SetStore.Inter(toStrings(args[1:]), 0)
+	return setAlgebraReply(c, members, err)
+}
+
+// SUnionHandler replies with the members of any given set.
+// Usage: SUNION key [key ...]
+func (ch *Commands) SUnionHandler(c *Client, args [][]byte) ([]string, error) {
+	members, err := ch.db(c).SetStore.Union(toStrings(args[1:]))
+	return setAlgebraReply(c, members, err)
+}
+
+// SDiffHandler replies with the members of the first set that belong to
+// none of the following ones. Usage: SDIFF key [key ...]
+func (ch *Commands) SDiffHandler(c *Client, args [][]byte) ([]string, error) {
+	members, err := ch.db(c).SetStore.Diff(toStrings(args[1:]))
+	return setAlgebraReply(c, members, err)
+}
+
+// SInterStoreHandler is SINTER storing the result at destination, which is
+// replaced whatever its type or deleted when the result is empty, and
+// replying with its size. Usage: SINTERSTORE destination key [key ...]
+func (ch *Commands) SInterStoreHandler(c *Client, args [][]byte) ([]string, error) {
+	members, err := ch.db(c).SetStore.Inter(toStrings(args[2:]), 0)
+	return ch.setAlgebraStore(c, args[1], members, err)
+}
+
+// SUnionStoreHandler is SUNION storing the result at destination.
+// Usage: SUNIONSTORE destination key [key ...]
+func (ch *Commands) SUnionStoreHandler(c *Client, args [][]byte) ([]string, error) {
+	members, err := ch.db(c).SetStore.Union(toStrings(args[2:]))
+	return ch.setAlgebraStore(c, args[1], members, err)
+}
+
+// SDiffStoreHandler is SDIFF storing the result at destination.
+// Usage: SDIFFSTORE destination key [key ...]
+func (ch *Commands) SDiffStoreHandler(c *Client, args [][]byte) ([]string, error) {
+	members, err := ch.db(c).SetStore.Diff(toStrings(args[2:]))
+	return ch.setAlgebraStore(c, args[1], members, err)
+}
+
+// SInterCardHandler replies with the number of members of every given set,
+// counting no further than LIMIT when it is given and not 0.
+// Usage: SINTERCARD numkeys key [key ...] [LIMIT limit]
+func (ch *Commands) SInterCardHandler(c *Client, args [][]byte) ([]string, error) {
+	numKeys, err := strconv.Atoi(string(args[1]))
+	if err != nil || numKeys <= 0 {
+		return nil, NewCommandError("numkeys should be greater than 0")
+	}
+	if numKeys > len(args) - 2 {
+		return nil, NewCommandError("Number of keys can't be greater than number of args")
+	}
+
+	limit := 0
+	options := args[numKeys + 2:]
+	switch {
+		case len(options) == 0:
+		case len(options) == 2 && Command(strings.ToUpper(string(options[0]))) == LIMIT:
+			limit, err = strconv.Atoi(string(options[1]))
+			if err != nil || limit < 0 {
+				return nil, NewCommandError("LIMIT can't be negative")
+			}
+		default:
+			return nil, ErrSyntax
+	}
+
+	members, err := ch.db(c).SetStore.Inter(toStrings(args[2:numKeys + 2]), limit)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return []string{intReply(len(members))}, nil
+}
+
+func setAlgebraReply(c *Client, members []string, err error) ([]string, error) {
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return []string{SetResponse(c.Protocol, members...)}, nil
+}
+
+func (ch *Commands) setAlgebraStore(c *Client, dst []byte, members []string, err error) ([]string, error) {
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return []string{intReply(ch.db(c).SetStore.Replace(string(dst), members))}, nil
+}
+
+// parseRandomCount parses the count of SRANDMEMBER and HRANDFIELD, whose
+// sign tells whether the elements picked may repeat
+func parseRandomCount(arg []byte) (count int, allowDuplicates bool, err error) {
+	parsed, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, false, ErrNotInteger
+	}
+	// the reply to a negative count holds that many elements, so it is
+	// bounded the way redis bounds it
+	if parsed < -math.MaxInt64 / 2 {
+		return 0, false, NewCommandError("value is out of range")
+	}
+
+	allowDuplicates = parsed < 0
+	if allowDuplicates {
+		parsed = -parsed
+	}
+	return int(min(parsed, math.MaxInt32)), allowDuplicates, nil
+}
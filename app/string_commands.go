@@ -0,0 +1,427 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/store"
+)
+
+// IncrHandler increments the integer stored at a key. Usage: INCR key
+func (ch *Commands) IncrHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.incrDecr(c, args[1], 1)
+}
+
+// DecrHandler decrements the integer stored at a key. Usage: DECR key
+func (ch *Commands) DecrHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.incrDecr(c, args[1], -1)
+}
+
+// IncrByHandler adds to the integer stored at a key. Usage: INCRBY key increment
+func (ch *Commands) IncrByHandler(c *Client, args [][]byte) ([]string, error) {
+	increment, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+	return ch.incrDecr(c, args[1], increment)
+}
+
+// DecrByHandler subtracts from the integer stored at a key. Usage: DECRBY key decrement
+func (ch *Commands) DecrByHandler(c *Client, args [][]byte) ([]string, error) {
+	decrement, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+	if decrement == math.MinInt64 {
+		return nil, NewCommandError("decrement would overflow")
+	}
+	return ch.incrDecr(c, args[1], -decrement)
+}
+
+func (ch *Commands) incrDecr(c *Client, key []byte, delta int64) ([]string, error) {
+	value, err := ch.db(c).KVStore.IncrBy(string(key), delta)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return []string{ResponseBuilder(IntegersRespType, strconv.FormatInt(value, 10))}, nil
+}
+
+// IncrByFloatHandler adds a floating point increment to the number stored at
+// a key. Replicas receive the resulting value, so they do not depend on
+// rounding. Usage: INCRBYFLOAT key increment
+func (ch *Commands) IncrByFloatHandler(c *Client, args [][]byte) ([]string, error) {
+	increment, ok := store.ParseLongDouble(args[2])
+	if !ok {
+		return nil, NewCommandError("%s", store.ErrNotFloat.Error())
+	}
+
+	value, err := ch.db(c).KVStore.IncrByFloat(string(args[1]), increment)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	c.Argv = toBytesArgs(string(SET), string(args[1]), string(value), string(KEEPTTL))
+	return []string{ResponseBuilder(BulkStringsRespType, string(value))}, nil
+}
+
+// MaxStringLength is the largest string SETRANGE may create, as redis
+// limits it with proto-max-bulk-len
+const MaxStringLength = 512 * 1024 * 1024
+
+// AppendHandler appends a value to a string, creating it when it is missing,
+// and replies with the new length. Usage: APPEND key value
+func (ch *Commands) AppendHandler(c *Client, args [][]byte) ([]string, error) {
+	length, err := ch.db(c).KVStore.Append(string(args[1]), args[2])
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return []string{intReply(length)}, nil
+}
+
+// StrlenHandler replies with the length of a string, 0 when it is missing.
+// Usage: STRLEN key
+func (ch *Commands) StrlenHandler(c *Client, args [][]byte) ([]string, error) {
+	value, _, err := ch.db(c).KVStore.GetString(string(args[1]))
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return []string{intReply(len(value))}, nil
+}
+
+// GetRangeHandler replies with the substring between two inclusive offsets.
+// Negative offsets count from the end of the string. Usage: GETRANGE key start end
+func (ch *Commands) GetRangeHandler(c *Client, args [][]byte) ([]string, error) {
+	start, err := strconv.Atoi(string(args[2]))
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+	end, err := strconv.Atoi(string(args[3]))
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+
+	value, _, err := ch.db(c).KVStore.GetString(string(args[1]))
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	// both offsets negative and out of order selects nothing
+	if start < 0 && end < 0 && start > end {
+		return []string{ResponseBuilder(BulkStringsRespType, "")}, nil
+	}
+
+	length := len(value)
+	if start < 0 {
+		start = max(length + start, 0)
+	}
+	if end < 0 {
+		end = max(length + end, 0)
+	}
+	end = min(end, length - 1)
+
+	if start > end || length == 0 {
+		return []string{ResponseBuilder(BulkStringsRespType, "")}, nil
+	}
+	return []string{ResponseBuilder(BulkStringsRespType, string(value[start:end + 1]))}, nil
+}
+
+// SetRangeHandler overwrites part of a string from an offset on, padding it
+// with zero bytes when needed, and replies with the new length.
+// Usage: SETRANGE key offset value
+func (ch *Commands) SetRangeHandler(c *Client, args [][]byte) ([]string, error) {
+	offset, err := strconv.Atoi(string(args[2]))
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+	if offset < 0 {
+		return nil, NewCommandError("offset is out of range")
+	}
+	if len(args[3]) > 0 && offset + len(args[3]) > MaxStringLength {
+		return nil, NewCommandError("string exceeds maximum allowed size (proto-max-bulk-len)")
+	}
+
+	length, err := ch.db(c).KVStore.SetRange(string(args[1]), offset, args[3])
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if len(args[3]) == 0 {
+		c.noPropagate = true
+	}
+	return []string{intReply(length)}, nil
+}
+
+// GetDelHandler deletes a string and replies with its value. Usage: GETDEL key
+func (ch *Commands) GetDelHandler(c *Client, args [][]byte) ([]string, error) {
+	value, exists, err := ch.db(c).KVStore.GetDel(string(args[1]))
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if !exists {
+		c.noPropagate = true
+		return NullResponse(c.Protocol), nil
+	}
+	return []string{ResponseBuilder(BulkStringsRespType, string(value))}, nil
+}
+
+// GetExHandler replies with the value of a string and sets or removes its
+// expiration. Replicas receive it as a PEXPIREAT or a PERSIST.
+// Usage: GETEX key [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST]
+func (ch *Commands) GetExHandler(c *Client, args [][]byte) ([]string, error) {
+	var expiration int64
+	update, persist := false, false
+
+	for i := 2; i < len(args); i++ {
+		option := Command(strings.ToUpper(string(args[i])))
+		switch {
+			case option == PERSIST && !update:
+				update, persist = true, true
+				expiration = -1
+
+			case (option == EX || option == PX || option == EXAT || option == PXAT) && !update && i + 1 < len(args):
+				at, err := parseExpireTime(args[i + 1], option, "getex")
+				if err != nil {
+					return nil, err
+				}
+				update, expiration = true, at
+				i++
+
+			default:
+				return nil, ErrSyntax
+		}
+	}
+
+	key := string(args[1])
+	var value []byte
+	var exists bool
+	var err error
+	if update {
+		value, exists, err = ch.db(c).KVStore.GetEx(key, expiration)
+	} else {
+		value, exists, err = ch.db(c).KVStore.GetString(key)
+	}
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	switch {
+		case !exists || !update:
+			c.noPropagate = true
+		case persist:
+			c.Argv = toBytesArgs(string(PERSIST), key)
+		default:
+			c.Argv = toBytesArgs(string(PEXPIREAT), key, strconv.FormatInt(expiration, 10))
+	}
+
+	if !exists {
+		return NullResponse(c.Protocol), nil
+	}
+	return []string{ResponseBuilder(BulkStringsRespType, string(value))}, nil
+}
+
+// MGetHandler replies with the values of several keys, with a null for keys
+// that are missing or do not hold a string. Usage: MGET key [key ...]
+func (ch *Commands) MGetHandler(c *Client, args [][]byte) ([]string, error) {
+	var sb strings.Builder
+	sb.WriteString(ArrayHeader(len(args) - 1))
+
+	for _, key := range args[1:] {
+		value, exists := ch.db(c).KVStore.Get(string(key))
+		if !exists {
+			sb.WriteString(NullResponse(c.Protocol)[0])
+			continue
+		}
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, string(value)))
+	}
+	return []string{sb.String()}, nil
+}
+
+// MSetHandler sets several keys at once. Usage: MSET key value [key value ...]
+func (ch *Commands) MSetHandler(c *Client, args [][]byte) ([]string, error) {
+	if len(args) % 2 == 0 {
+		return nil, WrongArityError(commandTable["mset"])
+	}
+
+	db := ch.db(c)
+	for i := 1; i < len(args); i += 2 {
+		db.KVStore.Set(string(args[i]), args[i + 1], -1)
+	}
+	return OKResponse(), nil
+}
+
+// MSetNXHandler sets several keys at once, only when none of them exists.
+// It replies 1 when the keys were set and 0 otherwise.
+// Usage: MSETNX key value [key value ...]
+func (ch *Commands) MSetNXHandler(c *Client, args [][]byte) ([]string, error) {
+	if len(args) % 2 == 0 {
+		return nil, WrongArityError(commandTable["msetnx"])
+	}
+
+	// commands run one at a time, so no key can be created in between
+	db := ch.db(c)
+	for i := 1; i < len(args); i += 2 {
+		if _, exists := db.Keyspace.Lookup(string(args[i])); exists {
+			c.noPropagate = true
+			return []string{intReply(0)}, nil
+		}
+	}
+
+	for i := 1; i < len(args); i += 2 {
+		db.KVStore.Set(string(args[i]), args[i + 1], -1)
+	}
+	return []string{intReply(1)}, nil
+}
+
+// LcsHandler replies with the longest common subsequence of two strings, its
+// length with LEN, or the matching ranges with IDX, optionally only those of
+// at least MINMATCHLEN bytes and with their length (WITHMATCHLEN).
+// Usage: LCS key1 key2 [LEN] [IDX] [MINMATCHLEN min-match-len] [WITHMATCHLEN]
+func (ch *Commands) LcsHandler(c *Client, args [][]byte) ([]string, error) {
+	getLen, getIdx, withMatchLen := false, false, false
+	minMatchLen := 0
+
+	for i := 3; i < len(args); i++ {
+		option := Command(strings.ToUpper(string(args[i])))
+		switch {
+			case option == LEN:
+				getLen = true
+			case option == IDX:
+				getIdx = true
+			case option == WITHMATCHLEN:
+				withMatchLen = true
+			case option == MINMATCHLEN && i + 1 < len(args):
+				value, err := strconv.Atoi(string(args[i + 1]))
+				if err != nil {
+					return nil, ErrNotInteger
+				}
+				minMatchLen = max(value, 0)
+				i++
+			default:
+				return nil, ErrSyntax
+		}
+	}
+
+	a, _, errA := ch.db(c).KVStore.GetString(string(args[1]))
+	b, _, errB := ch.db(c).KVStore.GetString(string(args[2]))
+	if errA != nil || errB != nil {
+		return nil, NewCommandError("The specified keys must contain string values")
+	}
+	if getLen && getIdx {
+		return nil, NewCommandError("If you want both the length and indexes, please just use IDX.")
+	}
+	if (len(a) + 1) * (len(b) + 1) > MaxStringLength / 4 {
+		return nil, NewCommandError("Insufficient memory, transient memory for LCS exceeds proto-max-bulk-len")
+	}
+
+	table := newLcsTable(a, b)
+	length := table.at(len(a), len(b))
+
+	if getLen {
+		return []string{intReply(length)}, nil
+	}
+
+	// walk the table back from the end of both strings, collecting the
+	// subsequence and the ranges of contiguous matches, last ones first
+	result := make([]byte, length)
+	var ranges strings.Builder
+	numRanges := 0
+
+	idx := length
+	aStart, aEnd, bStart, bEnd := -1, 0, 0, 0
+	for i, j := len(a), len(b); i > 0 && j > 0; {
+		emit := false
+		if a[i - 1] == b[j - 1] {
+			result[idx - 1] = a[i - 1]
+
+			if aStart < 0 {
+				aStart, aEnd, bStart, bEnd = i - 1, i - 1, j - 1, j - 1
+			} else if aStart == i && bStart == j {
+				// the match extends the current range backwards
+				aStart--
+				bStart--
+			} else {
+				emit = true
+			}
+			// a range reaching the start of either string is complete
+			if aStart == 0 || bStart == 0 {
+				emit = true
+			}
+			idx--
+			i--
+			j--
+		} else {
+			if table.at(i - 1, j) > table.at(i, j - 1) {
+				i--
+			} else {
+				j--
+			}
+			if aStart >= 0 {
+				emit = true
+			}
+		}
+
+		if emit {
+			matchLen := aEnd - aStart + 1
+			if getIdx && matchLen >= minMatchLen {
+				ranges.WriteString(lcsRangeReply(aStart, aEnd, bStart, bEnd, matchLen, withMatchLen))
+				numRanges++
+			}
+			aStart = -1
+		}
+	}
+
+	if !getIdx {
+		return []string{ResponseBuilder(BulkStringsRespType, string(result))}, nil
+	}
+
+	resp := MapHeader(c.Protocol, 2)
+	resp += ResponseBuilder(BulkStringsRespType, "matches") + ArrayHeader(numRanges) + ranges.String()
+	resp += ResponseBuilder(BulkStringsRespType, "len") + intReply(length)
+	return []string{resp}, nil
+}
+
+// lcsTable holds the lengths of the longest common subsequences of every
+// prefix of two strings, as uint32 to bound its memory the way redis does
+type lcsTable struct {
+	cols  int
+	cells []uint32
+}
+
+func newLcsTable(a, b []byte) *lcsTable {
+	table := &lcsTable{
+		cols: len(b) + 1,
+		cells: make([]uint32, (len(a) + 1) * (len(b) + 1)),
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			if a[i - 1] == b[j - 1] {
+				table.cells[i * table.cols + j] = table.cells[(i - 1) * table.cols + j - 1] + 1
+			} else {
+				table.cells[i * table.cols + j] = max(table.cells[(i - 1) * table.cols + j], table.cells[i * table.cols + j - 1])
+			}
+		}
+	}
+	return table
+}
+
+// at returns the length of the longest common subsequence of a[:i] and b[:j]
+func (t *lcsTable) at(i, j int) int {
+	return int(t.cells[i * t.cols + j])
+}
+
+// lcsRangeReply encodes a match of LCS IDX as the ranges it spans in both strings
+func lcsRangeReply(aStart, aEnd, bStart, bEnd, matchLen int, withMatchLen bool) string {
+	var sb strings.Builder
+	if withMatchLen {
+		sb.WriteString(ArrayHeader(3))
+	} else {
+		sb.WriteString(ArrayHeader(2))
+	}
+	sb.WriteString(ArrayHeader(2) + intReply(aStart) + intReply(aEnd))
+	sb.WriteString(ArrayHeader(2) + intReply(bStart) + intReply(bEnd))
+	if withMatchLen {
+		sb.WriteString(intReply(matchLen))
+	}
+	return sb.String()
+}
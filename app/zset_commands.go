@@ -0,0 +1,705 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/store"
+)
+
+// ZAddHandler sets the scores of members of a sorted set, creating it when
+// missing. NX only adds new members and XX only updates existing ones, GT
+// only updates scores to greater ones and LT to lower ones. It replies with
+// the number of members added, or also updated with CH. INCR adds the score
+// to the current one and replies with the new score, or null when a
+// condition was not met.
+// Usage: ZADD key [NX | XX] [GT | LT] [CH] [INCR] score member [score member ...]
+func (ch *Commands) ZAddHandler(c *Client, args [][]byte) ([]string, error) {
+	var opts store.ZAddOptions
+	changed := false
+
+	i := 2
+	for ; i < len(args); i++ {
+		switch Command(strings.ToUpper(string(args[i]))) {
+			case NX:
+				opts.NX = true
+				continue
+			case XX:
+				opts.XX = true
+				continue
+			case GT:
+				opts.GT = true
+				continue
+			case LT:
+				opts.LT = true
+				continue
+			case CH:
+				changed = true
+				continue
+			case INCR:
+				opts.Incr = true
+				continue
+		}
+		break
+	}
+
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs) % 2 != 0 {
+		return nil, ErrSyntax
+	}
+	if opts.NX && opts.XX {
+		return nil, NewCommandError("XX and NX options at the same time are not compatible")
+	}
+	if (opts.GT && opts.NX) || (opts.LT && opts.NX) || (opts.GT && opts.LT) {
+		return nil, NewCommandError("GT, LT, and/or NX options at the same time are not compatible")
+	}
+	if opts.Incr && len(pairs) > 2 {
+		return nil, NewCommandError("INCR option supports a single increment-element pair")
+	}
+
+	members, err := parseScoreMembers(pairs)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := ch.db(c).ZSetStore.Add(string(args[1]), members, opts)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if result.Added + result.Updated == 0 {
+		c.noPropagate = true
+	}
+
+	if opts.Incr {
+		if !result.Applied {
+			return NullResponse(c.Protocol), nil
+		}
+		return []string{DoubleResponse(c.Protocol, result.Score)}, nil
+	}
+	if changed {
+		return []string{intReply(result.Added + result.Updated)}, nil
+	}
+	return []string{intReply(result.Added)}, nil
+}
+
+// ZIncrByHandler adds to the score of a member of a sorted set, adding it
+// with that score when missing, and replies with the new score.
+// Usage: ZINCRBY key increment member
+func (ch *Commands) ZIncrByHandler(c *Client, args [][]byte) ([]string, error) {
+	members, err := parseScoreMembers(args[2:])
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := ch.db(c).ZSetStore.Add(string(args[1]), members, store.ZAddOptions{Incr: true})
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return []string{DoubleResponse(c.Protocol, result.Score)}, nil
+}
+
+// ZRemHandler removes members from a sorted set, deleting it once it has
+// none left, and replies with the number of members removed.
+// Usage: ZREM key member [member ...]
+func (ch *Commands) ZRemHandler(c *Client, args [][]byte) ([]string, error) {
+	removed, err := ch.db(c).ZSetStore.Remove(string(args[1]), toStrings(args[2:]))
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if removed == 0 {
+		c.noPropagate = true
+	}
+	return []string{intReply(removed)}, nil
+}
+
+// ZScoreHandler replies with the score of a member of a sorted set.
+// Usage: ZSCORE key member
+func (ch *Commands) ZScoreHandler(c *Client, args [][]byte) ([]string, error) {
+	scores, found, err := ch.db(c).ZSetStore.Scores(string(args[1]), []string{string(args[2])})
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if !found[0] {
+		return NullResponse(c.Protocol), nil
+	}
+	return []string{DoubleResponse(c.Protocol, scores[0])}, nil
+}
+
+// ZMScoreHandler replies with the scores of members of a sorted set, null
+// for the missing ones. Usage: ZMSCORE key member [member ...]
+func (ch *Commands) ZMScoreHandler(c *Client, args [][]byte) ([]string, error) {
+	scores, found, err := ch.db(c).ZSetStore.Scores(string(args[1]), toStrings(args[2:]))
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(ArrayHeader(len(scores)))
+	for i, score := range scores {
+		if !found[i] {
+			sb.WriteString(NullResponse(c.Protocol)[0])
+			continue
+		}
+		sb.WriteString(DoubleResponse(c.Protocol, score))
+	}
+	return []string{sb.String()}, nil
+}
+
+// ZCardHandler replies with the number of members of a sorted set.
+// Usage: ZCARD key
+func (ch *Commands) ZCardHandler(c *Client, args [][]byte) ([]string, error) {
+	length, err := ch.db(c).ZSetStore.Card(string(args[1]))
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return []string{intReply(length)}, nil
+}
+
+// ZRankHandler replies with the rank of a member of a sorted set, from the
+// lowest score, along with its score with WITHSCORE.
+// Usage: ZRANK key member [WITHSCORE]
+func (ch *Commands) ZRankHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.zrank(c, args, false)
+}
+
+// ZRevRankHandler replies with the rank of a member of a sorted set, from
+// the highest score, along with its score with WITHSCORE.
+// Usage: ZREVRANK key member [WITHSCORE]
+func (ch *Commands) ZRevRankHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.zrank(c, args, true)
+}
+
+func (ch *Commands) zrank(c *Client, args [][]byte, reverse bool) ([]string, error) {
+	withScore := false
+	switch {
+		case len(args) == 4 && Command(strings.ToUpper(string(args[3]))) == WITHSCORE:
+			withScore = true
+		case len(args) > 3:
+			return nil, ErrSyntax
+	}
+
+	rank, score, exists, err := ch.db(c).ZSetStore.Rank(string(args[1]), string(args[2]), reverse)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	switch {
+		case !exists && withScore:
+			return []string{NullArrayResponse(c.Protocol)}, nil
+		case !exists:
+			return NullResponse(c.Protocol), nil
+		case withScore:
+			return []string{ArrayHeader(2) + intReply(rank) + DoubleResponse(c.Protocol, score)}, nil
+	}
+	return []string{intReply(rank)}, nil
+}
+
+// ZCountHandler replies with the number of members of a sorted set whose
+// score is between min and max, which are included unless prefixed with (.
+// Usage: ZCOUNT key min max
+func (ch *Commands) ZCountHandler(c *Client, args [][]byte) ([]string, error) {
+	r, ok := store.ParseScoreRange(args[2], args[3])
+	if !ok {
+		return nil, ErrMinMaxNotFloat
+	}
+
+	count, err := ch.db(c).ZSetStore.Count(string(args[1]), r)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return []string{intReply(count)}, nil
+}
+
+// ZRangeHandler replies with the members of a sorted set between two ranks,
+// both included, or with BYSCORE between two scores and with BYLEX between
+// two members, which are then included unless prefixed with ( and may be
+// infinite. REV starts from the highest score, the first end being the
+// maximum one. LIMIT skips offset members and returns no more than count,
+// unless it is negative. WITHSCORES replies with the scores too.
+// Usage: ZRANGE key start stop [BYSCORE | BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func (ch *Commands) ZRangeHandler(c *Client, args [][]byte) ([]string, error) {
+	opts, withScores, err := parseZRangeArgs(args[2:], true)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := ch.db(c).ZSetStore.Range(string(args[1]), opts)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return []string{zmembersReply(c.Protocol, members, withScores)}, nil
+}
+
+// parseZRangeArgs parses the arguments of ZRANGE from start on. WITHSCORES
+// is only accepted when allowScores is set.
+func parseZRangeArgs(args [][]byte, allowScores bool) (opts store.ZRangeOptions, withScores bool, err error) {
+	byScore, byLex, limited := false, false, false
+	opts.Count = -1
+
+	for i := 2; i < len(args); i++ {
+		switch Command(strings.ToUpper(string(args[i]))) {
+			case BYSCORE:
+				byScore = true
+			case BYLEX:
+				byLex = true
+			case REV:
+				opts.Reverse = true
+			case WITHSCORES:
+				if !allowScores {
+					return opts, false, ErrSyntax
+				}
+				withScores = true
+			case LIMIT:
+				if i + 2 >= len(args) {
+					return opts, false, ErrSyntax
+				}
+				offset, err := strconv.Atoi(string(args[i + 1]))
+				if err != nil {
+					return opts, false, ErrNotInteger
+				}
+				count, err := strconv.Atoi(string(args[i + 2]))
+				if err != nil {
+					return opts, false, ErrNotInteger
+				}
+				opts.Offset, opts.Count = offset, count
+				limited = true
+				i += 2
+			default:
+				return opts, false, ErrSyntax
+		}
+	}
+
+	switch {
+		case byScore && byLex:
+			return opts, false, ErrSyntax
+		case limited && !byScore && !byLex:
+			return opts, false, NewCommandError("syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+		case withScores && byLex:
+			return opts, false, NewCommandError("syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+
+	// the range is given from its maximum end when reversed
+	minArg, maxArg := args[0], args[1]
+	if opts.Reverse {
+		minArg, maxArg = maxArg, minArg
+	}
+
+	switch {
+		case byScore:
+			r, ok := store.ParseScoreRange(minArg, maxArg)
+			if !ok {
+				return opts, false, ErrMinMaxNotFloat
+			}
+			opts.ByScore = &r
+		case byLex:
+			r, ok := store.ParseLexRange(minArg, maxArg)
+			if !ok {
+				return opts, false, ErrMinMaxNotLex
+			}
+			opts.ByLex = &r
+		default:
+			if opts.Start, err = strconv.Atoi(string(args[0])); err != nil {
+				return opts, false, ErrNotInteger
+			}
+			if opts.Stop, err = strconv.Atoi(string(args[1])); err != nil {
+				return opts, false, ErrNotInteger
+			}
+	}
+
+	// a negative offset selects nothing
+	if opts.Offset < 0 {
+		opts.Count = 0
+	}
+	return opts, withScores, nil
+}
+
+// parseScoreMembers parses score member pairs
+func parseScoreMembers(pairs [][]byte) ([]store.ZMember, error) {
+	members := make([]store.ZMember, 0, len(pairs) / 2)
+	for i := 0; i + 1 < len(pairs); i += 2 {
+		score, ok := store.ParseScore(pairs[i])
+		if !ok {
+			return nil, ErrNotValidFloat
+		}
+		members = append(members, store.ZMember{Member: string(pairs[i + 1]), Score: score})
+	}
+	return members, nil
+}
+
+// zmembersReply encodes members, followed by their score when withScores is
+// set: as a flat array under RESP2, and as member score pairs under RESP3
+func zmembersReply(proto int, members []store.ZMember, withScores bool) string {
+	if withScores && proto == RESP3 {
+		return zpairsReply(proto, members)
+	}
+
+	var sb strings.Builder
+	if withScores {
+		sb.WriteString(ArrayHeader(len(members) * 2))
+	} else {
+		sb.WriteString(ArrayHeader(len(members)))
+	}
+	for _, m := range members {
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, m.Member))
+		if withScores {
+			sb.WriteString(DoubleResponse(proto, m.Score))
+		}
+	}
+	return sb.String()
+}
+
+// zpairsReply encodes members as member score pairs
+func zpairsReply(proto int, members []store.ZMember) string {
+	var sb strings.Builder
+	sb.WriteString(ArrayHeader(len(members)))
+	for _, m := range members {
+		sb.WriteString(ArrayHeader(2))
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, m.Member))
+		sb.WriteString(DoubleResponse(proto, m.Score))
+	}
+	return sb.String()
+}
+
+// ZRangeStoreHandler stores the members ZRANGE selects at destination, which
+// is replaced whatever its type or deleted when there are none, and replies
+// with their number.
+// Usage: ZRANGESTORE dst src min max [BYSCORE | BYLEX] [REV] [LIMIT offset count]
+func (ch *Commands) ZRangeStoreHandler(c *Client, args [][]byte) ([]string, error) {
+	opts, _, err := parseZRangeArgs(args[3:], false)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := ch.db(c).ZSetStore.Range(string(args[2]), opts)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return []string{intReply(ch.db(c).ZSetStore.Replace(string(args[1]), members))}, nil
+}
+
+// ZPopMinHandler removes the members with the lowest scores from a sorted
+// set, one unless count is given, and replies with them and their scores.
+// Usage: ZPOPMIN key [count]
+func (ch *Commands) ZPopMinHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.zpop(c, args, false)
+}
+
+// ZPopMaxHandler removes the members with the highest scores from a sorted
+// set like ZPOPMIN. Usage: ZPOPMAX key [count]
+func (ch *Commands) ZPopMaxHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.zpop(c, args, true)
+}
+
+func (ch *Commands) zpop(c *Client, args [][]byte, max bool) ([]string, error) {
+	if len(args) > 3 {
+		return nil, ErrSyntax
+	}
+
+	count := 1
+	if len(args) == 3 {
+		parsed, err := strconv.Atoi(string(args[2]))
+		if err != nil {
+			return nil, ErrNotInteger
+		}
+		if parsed < 0 {
+			return nil, NewCommandError("value is out of range, must be positive")
+		}
+		count = parsed
+	}
+
+	members, err := ch.db(c).ZSetStore.Pop(string(args[1]), count, max)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if len(members) == 0 {
+		c.noPropagate = true
+	}
+
+	// only a count asks for member score pairs under RESP3
+	if len(args) == 3 {
+		return []string{zmembersReply(c.Protocol, members, true)}, nil
+	}
+	var sb strings.Builder
+	sb.WriteString(ArrayHeader(len(members) * 2))
+	for _, m := range members {
+		sb.WriteString(ResponseBuilder(BulkStringsRespType, m.Member) + DoubleResponse(c.Protocol, m.Score))
+	}
+	return []string{sb.String()}, nil
+}
+
+// BZPopMinHandler pops the member with the lowest score from the first non
+// empty sorted set among the keys, and replies with the name of the sorted
+// set, the member and its score. When they are all empty the client blocks
+// like BLPOP. Usage: BZPOPMIN key [key ...] timeout
+func (ch *Commands) BZPopMinHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.blockingZPop(c, args, false)
+}
+
+// BZPopMaxHandler pops the member with the highest score from the first non
+// empty sorted set among the keys like BZPOPMIN.
+// Usage: BZPOPMAX key [key ...] timeout
+func (ch *Commands) BZPopMaxHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.blockingZPop(c, args, true)
+}
+
+func (ch *Commands) blockingZPop(c *Client, args [][]byte, max bool) ([]string, error) {
+	timeout, err := parseBlockTimeout(args[len(args) - 1])
+	if err != nil {
+		return nil, err
+	}
+
+	return ch.serveOrBlock(c, timeout, toStrings(args[1:len(args) - 1]),
+		func(keys []string) ([]string, [][]byte, error) {
+			key, members, err := ch.zpopFirst(c, keys, max, 1)
+			if err != nil || members == nil {
+				return nil, nil, err
+			}
+			resp := ArrayHeader(3) + ResponseBuilder(BulkStringsRespType, key) +
+				ResponseBuilder(BulkStringsRespType, members[0].Member) + DoubleResponse(c.Protocol, members[0].Score)
+			return []string{resp}, zpopCommand(key, max), nil
+		},
+		func() []string {
+			return []string{NullArrayResponse(c.Protocol)}
+		},
+	)
+}
+
+// ZMPopHandler pops up to count members with the lowest or highest scores
+// from the first non empty sorted set among the keys, and replies with its
+// name and the members with their scores.
+// Usage: ZMPOP numkeys key [key ...] MIN|MAX [COUNT count]
+func (ch *Commands) ZMPopHandler(c *Client, args [][]byte) ([]string, error) {
+	keys, popMin, count, err := parseMPopArgs(args[1:], parseZSetEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, argv, err := ch.zmpop(c, keys, !popMin, count)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if resp == nil {
+		c.noPropagate = true
+		return []string{NullArrayResponse(c.Protocol)}, nil
+	}
+	c.Argv = argv
+	return resp, nil
+}
+
+// BZMPopHandler pops members like ZMPOP, blocking like BZPOPMIN when every
+// sorted set is empty.
+// Usage: BZMPOP timeout numkeys key [key ...] MIN|MAX [COUNT count]
+func (ch *Commands) BZMPopHandler(c *Client, args [][]byte) ([]string, error) {
+	timeout, err := parseBlockTimeout(args[1])
+	if err != nil {
+		return nil, err
+	}
+	keys, popMin, count, err := parseMPopArgs(args[2:], parseZSetEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	return ch.serveOrBlock(c, timeout, keys,
+		func(keys []string) ([]string, [][]byte, error) {
+			return ch.zmpop(c, keys, !popMin, count)
+		},
+		func() []string {
+			return []string{NullArrayResponse(c.Protocol)}
+		},
+	)
+}
+
+// zmpop pops up to count members from the first non empty sorted set among
+// keys. It returns the reply, with the name of the sorted set and the
+// members, and the ZPOPMIN or ZPOPMAX to propagate, or a nil reply when every
+// sorted set is empty.
+func (ch *Commands) zmpop(c *Client, keys []string, max bool, count int) ([]string, [][]byte, error) {
+	key, members, err := ch.zpopFirst(c, keys, max, count)
+	if err != nil || members == nil {
+		return nil, nil, err
+	}
+
+	resp := ArrayHeader(2) + ResponseBuilder(BulkStringsRespType, key) + zpairsReply(c.Protocol, members)
+	return []string{resp}, append(zpopCommand(key, max), []byte(strconv.Itoa(len(members)))), nil
+}
+
+// zpopFirst pops up to count members from the first non empty sorted set
+// among keys, and returns its key and the members, or nil members when every
+// sorted set is empty
+func (ch *Commands) zpopFirst(c *Client, keys []string, max bool, count int) (string, []store.ZMember, error) {
+	for _, key := range keys {
+		members, err := ch.db(c).ZSetStore.Pop(key, count, max)
+		if err != nil {
+			return "", nil, err
+		}
+		if members != nil {
+			return key, members, nil
+		}
+	}
+	return "", nil, nil
+}
+
+// zpopCommand returns the ZPOPMIN or ZPOPMAX of key
+func zpopCommand(key string, max bool) [][]byte {
+	if max {
+		return toBytesArgs(string(ZPOPMAX), key)
+	}
+	return toBytesArgs(string(ZPOPMIN), key)
+}
+
+// parseZSetEnd parses MIN or MAX, reporting whether it is MIN
+func parseZSetEnd(arg []byte) (bool, error) {
+	switch Command(strings.ToUpper(string(arg))) {
+		case MIN:
+			return true, nil
+		case MAX:
+			return false, nil
+	}
+	return false, ErrSyntax
+}
+
+// ZUnionHandler replies with the members of any given sorted set, ordered by
+// their score: the sum of their scores in each of them, each multiplied by
+// the weight of its sorted set when WEIGHTS are given, or the lowest or
+// highest of these with AGGREGATE. Sets count as sorted sets whose members
+// have a score of 1.
+// Usage: ZUNION numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+func (ch *Commands) ZUnionHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.zsetOp(c, args, false, true, ch.db(c).ZSetStore.Union)
+}
+
+// ZUnionStoreHandler is ZUNION storing the result at destination, which is
+// replaced whatever its type or deleted when the result is empty, and
+// replying with its size.
+// Usage: ZUNIONSTORE destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX]
+func (ch *Commands) ZUnionStoreHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.zsetOp(c, args, true, true, ch.db(c).ZSetStore.Union)
+}
+
+// ZInterHandler replies with the members of every given sorted set, with
+// scores combined like ZUNION.
+// Usage: ZINTER numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+func (ch *Commands) ZInterHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.zsetOp(c, args, false, true, ch.db(c).ZSetStore.Inter)
+}
+
+// ZInterStoreHandler is ZINTER storing the result at destination.
+// Usage: ZINTERSTORE destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX]
+func (ch *Commands) ZInterStoreHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.zsetOp(c, args, true, true, ch.db(c).ZSetStore.Inter)
+}
+
+// ZDiffHandler replies with the members of the first sorted set that are not
+// members of the others, with their score in the first one.
+// Usage: ZDIFF numkeys key [key ...] [WITHSCORES]
+func (ch *Commands) ZDiffHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.zsetOp(c, args, false, false, ch.zdiff(c))
+}
+
+// ZDiffStoreHandler is ZDIFF storing the result at destination.
+// Usage: ZDIFFSTORE destination numkeys key [key ...]
+func (ch *Commands) ZDiffStoreHandler(c *Client, args [][]byte) ([]string, error) {
+	return ch.zsetOp(c, args, true, false, ch.zdiff(c))
+}
+
+// zsetOpFunc combines the sorted sets stored at keys
+type zsetOpFunc func(keys []string, weights []float64, aggregate store.ZAggregate) ([]store.ZMember, error)
+
+func (ch *Commands) zdiff(c *Client) zsetOpFunc {
+	return func(keys []string, _ []float64, _ store.ZAggregate) ([]store.ZMember, error) {
+		return ch.db(c).ZSetStore.Diff(keys)
+	}
+}
+
+// zsetOp runs op on the sorted sets given by args, which start with a
+// destination to store the result at when withDst is set, and replies with
+// the result or its size. WEIGHTS and AGGREGATE are only accepted when
+// aggregates is set.
+func (ch *Commands) zsetOp(c *Client, args [][]byte, withDst bool, aggregates bool, op zsetOpFunc) ([]string, error) {
+	first := 1
+	if withDst {
+		first = 2
+	}
+	parsed, err := parseZSetOpArgs(strings.ToLower(string(args[0])), args[first:], aggregates, !withDst)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := op(parsed.keys, parsed.weights, parsed.aggregate)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if withDst {
+		return []string{intReply(ch.db(c).ZSetStore.Replace(string(args[1]), members))}, nil
+	}
+	return []string{zmembersReply(c.Protocol, members, parsed.withScores)}, nil
+}
+
+// zsetOpArgs are the arguments of ZUNION, ZINTER and ZDIFF
+type zsetOpArgs struct {
+	keys       []string
+	weights    []float64
+	aggregate  store.ZAggregate
+	withScores bool
+}
+
+// parseZSetOpArgs parses the arguments of the command named name from
+// numkeys on. WEIGHTS and AGGREGATE are only accepted when aggregates is set,
+// and WITHSCORES when allowScores is.
+func parseZSetOpArgs(name string, args [][]byte, aggregates bool, allowScores bool) (zsetOpArgs, error) {
+	var parsed zsetOpArgs
+
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return parsed, ErrNotInteger
+	}
+	if numKeys < 1 {
+		return parsed, NewCommandError("at least 1 input key is needed for '%s' command", name)
+	}
+	if numKeys > len(args) - 1 {
+		return parsed, ErrSyntax
+	}
+	parsed.keys = toStrings(args[1:numKeys + 1])
+
+	options := args[numKeys + 1:]
+	for i := 0; i < len(options); i++ {
+		switch Command(strings.ToUpper(string(options[i]))) {
+			case WEIGHTS:
+				if !aggregates || i + numKeys >= len(options) {
+					return parsed, ErrSyntax
+				}
+				parsed.weights = make([]float64, numKeys)
+				for j := range parsed.weights {
+					weight, ok := store.ParseScore(options[i + 1 + j])
+					if !ok {
+						return parsed, NewCommandError("weight value is not a float")
+					}
+					parsed.weights[j] = weight
+				}
+				i += numKeys
+			case AGGREGATE:
+				if !aggregates || i + 1 >= len(options) {
+					return parsed, ErrSyntax
+				}
+				switch Command(strings.ToUpper(string(options[i + 1]))) {
+					case SUM:
+						parsed.aggregate = store.ZAggregateSum
+					case MIN:
+						parsed.aggregate = store.ZAggregateMin
+					case MAX:
+						parsed.aggregate = store.ZAggregateMax
+					default:
+						return parsed, ErrSyntax
+				}
+				i++
+			case WITHSCORES:
+				if !allowScores {
+					return parsed, ErrSyntax
+				}
+				parsed.withScores = true
+			default:
+				return parsed, ErrSyntax
+		}
+	}
+	return parsed, nil
+}
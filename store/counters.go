@@ -0,0 +1,182 @@
+package store
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// LongDoublePrecision is the mantissa precision, in bits, of the x87 long
+// double redis adds floating point increments in
+const LongDoublePrecision = 64
+
+// IncrBy adds delta to the integer stored at key, creating it at 0 when it is
+// missing, and returns the new value. The expiration of the key is kept.
+// Counters are stored as an int64, so they are not parsed back from a string
+// on every increment.
+func (kv *KVStoreImpl) IncrBy(key string, delta int64) (int64, error) {
+	var result int64
+
+	err := kv.Keyspace.Update(key, func(obj *Object) (*Object, error) {
+		var current int64
+		expiration := int64(-1)
+
+		if obj != nil {
+			value, err := integerValue(obj)
+			if err != nil {
+				return nil, err
+			}
+			current, expiration = value, obj.Expiration
+		}
+
+		if (delta > 0 && current > math.MaxInt64 - delta) || (delta < 0 && current < math.MinInt64 - delta) {
+			return nil, ErrOverflow
+		}
+
+		result = current + delta
+		return &Object{
+			Value:      result,
+			Expiration: expiration,
+		}, nil
+	})
+
+	return result, err
+}
+
+// IncrByFloat adds delta, as parsed by ParseLongDouble, to the number stored
+// at key, creating it at 0 when it is missing, and returns the new value as
+// it is stored. The expiration of the key is kept.
+func (kv *KVStoreImpl) IncrByFloat(key string, delta *big.Float) ([]byte, error) {
+	var result []byte
+
+	err := kv.Keyspace.Update(key, func(obj *Object) (*Object, error) {
+		current := new(big.Float).SetPrec(LongDoublePrecision)
+		expiration := int64(-1)
+
+		if obj != nil {
+			value, isString := stringValue(obj)
+			if !isString {
+				return nil, ErrWrongType
+			}
+			parsed, ok := ParseLongDouble(value)
+			if !ok {
+				return nil, ErrNotFloat
+			}
+			current, expiration = parsed, obj.Expiration
+		}
+
+		var err error
+		result, err = addLongDouble(current, delta)
+		if err != nil {
+			return nil, err
+		}
+		return &Object{
+			Value:      result,
+			Expiration: expiration,
+		}, nil
+	})
+
+	return result, err
+}
+
+// integerValue returns the integer held by a string object
+func integerValue(obj *Object) (int64, error) {
+	switch value := obj.Value.(type) {
+		case int64:
+			return value, nil
+		case []byte:
+			parsed, ok := ParseStrictInt(value)
+			if !ok {
+				return 0, ErrNotInteger
+			}
+			return parsed, nil
+	}
+	return 0, ErrWrongType
+}
+
+// addLongDouble adds two numbers the way redis adds floating point
+// increments, in a long double, and formats the sum with FormatLongDouble. It
+// fails when the sum no longer fits a float64, which ParseFloat would reject.
+func addLongDouble(current *big.Float, delta *big.Float) ([]byte, error) {
+	sum := new(big.Float).SetPrec(LongDoublePrecision).Add(current, delta)
+	if value, _ := sum.Float64(); math.IsInf(value, 0) {
+		return nil, ErrNaNOrInfinity
+	}
+	return FormatLongDouble(sum), nil
+}
+
+// ParseLongDouble parses a number accepted by ParseFloat at the precision of
+// a long double, so that 0.1 is as close to a tenth as redis has it
+func ParseLongDouble(b []byte) (*big.Float, bool) {
+	value, ok := ParseFloat(b)
+	if !ok {
+		return nil, false
+	}
+
+	parsed, _, err := big.ParseFloat(string(b), 10, LongDoublePrecision, big.ToNearestEven)
+	if err != nil {
+		// forms big does not read in base 10, such as hexadecimal floats
+		return new(big.Float).SetPrec(LongDoublePrecision).SetFloat64(value), true
+	}
+	return parsed, true
+}
+
+// FormatLongDouble formats a number the way redis prints the result of a
+// floating point increment: rounded to 17 significant digits, in plain
+// notation, without trailing zeros after the decimal point
+func FormatLongDouble(value *big.Float) []byte {
+	if value.Sign() == 0 {
+		return []byte("0")
+	}
+
+	// d.dddddddddddddddde±dd
+	text := value.Text('e', 16)
+	sign := ""
+	if text[0] == '-' {
+		sign, text = "-", text[1:]
+	}
+	mantissa, exponent, _ := strings.Cut(text, "e")
+	digits := strings.Replace(mantissa, ".", "", 1)
+	point, _ := strconv.Atoi(exponent)
+	point++
+
+	var formatted string
+	switch {
+		case point <= 0:
+			formatted = "0." + strings.Repeat("0", -point) + digits
+		case point >= len(digits):
+			formatted = digits + strings.Repeat("0", point - len(digits))
+		default:
+			formatted = digits[:point] + "." + digits[point:]
+	}
+	if strings.Contains(formatted, ".") {
+		formatted = strings.TrimRight(strings.TrimRight(formatted, "0"), ".")
+	}
+	return []byte(sign + formatted)
+}
+
+// ParseStrictInt parses a 64 bit integer the way redis does: in canonical
+// form only, without a sign prefix, leading zeros or spaces
+func ParseStrictInt(b []byte) (int64, bool) {
+	value, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil || strconv.FormatInt(value, 10) != string(b) {
+		return 0, false
+	}
+	return value, true
+}
+
+// ParseFloat parses a finite floating point number, rejecting surrounding
+// spaces, NaN and infinities
+func ParseFloat(b []byte) (float64, bool) {
+	s := string(b)
+	if len(s) == 0 || strings.TrimSpace(s) != s {
+		return 0, false
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false
+	}
+	return value, true
+}
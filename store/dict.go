@@ -0,0 +1,338 @@
+package store
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"math/rand"
+)
+
+const (
+	// DictInitialSize is the number of buckets of a new table
+	DictInitialSize = 4
+	// DictMinFill is the percentage of buckets in use below which a table
+	// shrinks
+	DictMinFill = 10
+	// dictRehashEmptyVisits bounds how many empty buckets a rehash step may
+	// walk over for each bucket it should move
+	dictRehashEmptyVisits = 10
+)
+
+// Dict is a hash table with chaining, built like the redis dict so that it
+// can be scanned with a cursor: a table has a power of two number of buckets
+// and grows or shrinks by moving its entries to a second table a few buckets
+// at a time, on every write. Scan visits buckets in reverse binary order,
+// which keeps a cursor valid across resizes.
+//
+// Reads (Get, Len, Scan, Random, Range) do not modify the dict and may run
+// concurrently with each other, but not with writes.
+type Dict[V any] struct {
+	seed   maphash.Seed
+	tables [2][]*dictEntry[V]
+	used   [2]int
+	// rehashIdx is the next bucket of tables[0] to move to tables[1], or -1
+	// when the dict is not being resized
+	rehashIdx int
+}
+
+type dictEntry[V any] struct {
+	key   string
+	value V
+	next  *dictEntry[V]
+}
+
+// NewDict() Creates a new empty Dict
+func NewDict[V any]() *Dict[V] {
+	return &Dict[V]{
+		seed:      maphash.MakeSeed(),
+		rehashIdx: -1,
+	}
+}
+
+// Len returns the number of entries
+func (d *Dict[V]) Len() int {
+	return d.used[0] + d.used[1]
+}
+
+// release removes every entry, clearing the buckets one by one
+func (d *Dict[V]) release() {
+	for i := range d.tables {
+		clear(d.tables[i])
+		d.tables[i] = nil
+		d.used[i] = 0
+	}
+	d.rehashIdx = -1
+}
+
+func (d *Dict[V]) isRehashing() bool {
+	return d.rehashIdx >= 0
+}
+
+func (d *Dict[V]) hash(key string) uint64 {
+	return maphash.String(d.seed, key)
+}
+
+// find returns the entry of key, looking in both tables while resizing
+func (d *Dict[V]) find(key string) *dictEntry[V] {
+	h := d.hash(key)
+	for _, table := range d.tables {
+		if len(table) == 0 {
+			continue
+		}
+		for e := table[h & uint64(len(table) - 1)]; e != nil; e = e.next {
+			if e.key == key {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+// Get returns the value stored at key
+func (d *Dict[V]) Get(key string) (V, bool) {
+	if e := d.find(key); e != nil {
+		return e.value, true
+	}
+
+	var zero V
+	return zero, false
+}
+
+// Set stores value at key and reports whether the key was added
+func (d *Dict[V]) Set(key string, value V) bool {
+	d.rehashStep()
+
+	if e := d.find(key); e != nil {
+		e.value = value
+		return false
+	}
+
+	d.expandIfNeeded()
+
+	// while resizing, new entries go to the new table
+	t := 0
+	if d.isRehashing() {
+		t = 1
+	}
+	table := d.tables[t]
+	idx := d.hash(key) & uint64(len(table) - 1)
+	table[idx] = &dictEntry[V]{key: key, value: value, next: table[idx]}
+	d.used[t]++
+	return true
+}
+
+// Delete removes key and returns the value it held
+func (d *Dict[V]) Delete(key string) (V, bool) {
+	var zero V
+	if d.Len() == 0 {
+		return zero, false
+	}
+	d.rehashStep()
+
+	h := d.hash(key)
+	for t, table := range d.tables {
+		if len(table) == 0 {
+			continue
+		}
+
+		idx := h & uint64(len(table) - 1)
+		var prev *dictEntry[V]
+		for e := table[idx]; e != nil; prev, e = e, e.next {
+			if e.key != key {
+				continue
+			}
+			if prev == nil {
+				table[idx] = e.next
+			} else {
+				prev.next = e.next
+			}
+			d.used[t]--
+			d.shrinkIfNeeded()
+			return e.value, true
+		}
+	}
+	return zero, false
+}
+
+// expandIfNeeded allocates the first table, or starts growing the table once
+// it holds as many entries as buckets
+func (d *Dict[V]) expandIfNeeded() {
+	if d.isRehashing() {
+		return
+	}
+	if len(d.tables[0]) == 0 {
+		d.tables[0] = make([]*dictEntry[V], DictInitialSize)
+		return
+	}
+	if d.used[0] >= len(d.tables[0]) {
+		d.resize(d.used[0] + 1)
+	}
+}
+
+// shrinkIfNeeded starts shrinking the table once few of its buckets are used
+func (d *Dict[V]) shrinkIfNeeded() {
+	if d.isRehashing() || len(d.tables[0]) <= DictInitialSize {
+		return
+	}
+	if d.used[0] * 100 / len(d.tables[0]) < DictMinFill {
+		d.resize(d.used[0])
+	}
+}
+
+// resize starts moving the entries to a table of the smallest power of two
+// size holding at least size entries
+func (d *Dict[V]) resize(size int) {
+	newSize := DictInitialSize
+	for newSize < size {
+		newSize *= 2
+	}
+	if newSize == len(d.tables[0]) {
+		return
+	}
+
+	d.tables[1] = make([]*dictEntry[V], newSize)
+	d.rehashIdx = 0
+}
+
+// rehashStep moves one bucket to the new table while resizing
+func (d *Dict[V]) rehashStep() {
+	if !d.isRehashing() {
+		return
+	}
+
+	emptyVisits := dictRehashEmptyVisits
+	for d.tables[0][d.rehashIdx] == nil {
+		d.rehashIdx++
+		emptyVisits--
+		if d.rehashIdx == len(d.tables[0]) {
+			d.finishRehash()
+			return
+		}
+		if emptyVisits == 0 {
+			return
+		}
+	}
+
+	mask := uint64(len(d.tables[1]) - 1)
+	for e := d.tables[0][d.rehashIdx]; e != nil; {
+		next := e.next
+		idx := d.hash(e.key) & mask
+		e.next = d.tables[1][idx]
+		d.tables[1][idx] = e
+		d.used[0]--
+		d.used[1]++
+		e = next
+	}
+	d.tables[0][d.rehashIdx] = nil
+	d.rehashIdx++
+
+	if d.rehashIdx == len(d.tables[0]) {
+		d.finishRehash()
+	}
+}
+
+func (d *Dict[V]) finishRehash() {
+	d.tables[0], d.tables[1] = d.tables[1], nil
+	d.used[0], d.used[1] = d.used[1], 0
+	d.rehashIdx = -1
+}
+
+// Scan calls fn for the entries of the buckets at cursor and returns the
+// cursor to continue from, which is 0 once every bucket was visited. A full
+// iteration, starting and ending at cursor 0, returns every entry present
+// during all of it at least once, even when the dict is resized in between,
+// though an entry may be returned more than once.
+//
+// Cursors count in reverse binary: the high bits of the bucket index are
+// incremented first. When a table grows from 2^n to 2^m buckets, the
+// entries of bucket i move to buckets whose n low bits are i, all of which
+// come after i in that order; shrinking merges buckets the same way.
+func (d *Dict[V]) Scan(cursor uint64, fn func(key string, value V)) uint64 {
+	if d.Len() == 0 {
+		return 0
+	}
+
+	emit := func(table []*dictEntry[V], idx uint64) {
+		for e := table[idx]; e != nil; e = e.next {
+			fn(e.key, e.value)
+		}
+	}
+
+	if !d.isRehashing() {
+		table := d.tables[0]
+		mask := uint64(len(table) - 1)
+		emit(table, cursor & mask)
+		return nextCursor(cursor, mask)
+	}
+
+	small, large := d.tables[0], d.tables[1]
+	if len(small) > len(large) {
+		small, large = large, small
+	}
+	smallMask, largeMask := uint64(len(small) - 1), uint64(len(large) - 1)
+
+	emit(small, cursor & smallMask)
+	// then every bucket of the larger table the small bucket expands to
+	for {
+		emit(large, cursor & largeMask)
+		cursor = nextCursor(cursor, largeMask)
+		if cursor & (smallMask ^ largeMask) == 0 {
+			break
+		}
+	}
+	return cursor
+}
+
+// nextCursor increments the bits of cursor under mask in reverse order
+func nextCursor(cursor, mask uint64) uint64 {
+	cursor |= ^mask
+	cursor = bits.Reverse64(cursor)
+	cursor++
+	return bits.Reverse64(cursor)
+}
+
+// Random returns an entry picked at random, and false when the dict is empty
+func (d *Dict[V]) Random() (string, V, bool) {
+	var zero V
+	if d.Len() == 0 {
+		return "", zero, false
+	}
+
+	var e *dictEntry[V]
+	for e == nil {
+		if d.isRehashing() {
+			// buckets of the old table before rehashIdx are empty
+			size0 := len(d.tables[0])
+			idx := d.rehashIdx + rand.Intn(size0 + len(d.tables[1]) - d.rehashIdx)
+			if idx >= size0 {
+				e = d.tables[1][idx - size0]
+			} else {
+				e = d.tables[0][idx]
+			}
+		} else {
+			e = d.tables[0][rand.Intn(len(d.tables[0]))]
+		}
+	}
+
+	// then an entry of the chain at random
+	length := 0
+	for c := e; c != nil; c = c.next {
+		length++
+	}
+	for i := rand.Intn(length); i > 0; i-- {
+		e = e.next
+	}
+	return e.key, e.value, true
+}
+
+// Range calls fn for every entry until it returns false
+func (d *Dict[V]) Range(fn func(key string, value V) bool) {
+	for _, table := range d.tables {
+		for _, bucket := range table {
+			for e := bucket; e != nil; e = e.next {
+				if !fn(e.key, e.value) {
+					return
+				}
+			}
+		}
+	}
+}
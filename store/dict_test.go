@@ -0,0 +1,90 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDict(t *testing.T) {
+	d := NewDict[int]()
+
+	_, exists := d.Get("mango")
+	assert.False(t, exists)
+	_, _, exists = d.Random()
+	assert.False(t, exists)
+
+	for i := 0; i < 1000; i++ {
+		assert.True(t, d.Set(fmt.Sprintf("key:%d", i), i))
+	}
+	assert.False(t, d.Set("key:7", 70))
+	assert.Equal(t, 1000, d.Len())
+
+	value, exists := d.Get("key:7")
+	assert.True(t, exists)
+	assert.Equal(t, 70, value)
+
+	key, value, exists := d.Random()
+	assert.True(t, exists)
+	stored, _ := d.Get(key)
+	assert.Equal(t, stored, value)
+
+	for i := 0; i < 990; i++ {
+		_, deleted := d.Delete(fmt.Sprintf("key:%d", i))
+		assert.True(t, deleted)
+	}
+	_, deleted := d.Delete("key:0")
+	assert.False(t, deleted)
+	assert.Equal(t, 10, d.Len())
+
+	// the table shrank back once most keys were deleted
+	for d.isRehashing() {
+		d.rehashStep()
+	}
+	assert.Less(t, len(d.tables[0]), 1024)
+
+	keys := 0
+	d.Range(func(key string, value int) bool {
+		keys++
+		return true
+	})
+	assert.Equal(t, 10, keys)
+}
+
+// keys present for a whole scan are returned even though the table grows and
+// shrinks between the calls
+func TestDict_ScanDuringResize(t *testing.T) {
+	d := NewDict[int]()
+	for i := 0; i < 500; i++ {
+		d.Set(fmt.Sprintf("stable:%d", i), i)
+	}
+
+	seen := make(map[string]bool)
+	cursor, calls := uint64(0), 0
+	for {
+		cursor = d.Scan(cursor, func(key string, value int) {
+			seen[key] = true
+		})
+		calls++
+
+		switch {
+			case calls < 50:
+				for i := 0; i < 100; i++ {
+					d.Set(fmt.Sprintf("grow:%d:%d", calls, i), i)
+				}
+			case calls < 100:
+				for i := 0; i < 100; i++ {
+					d.Delete(fmt.Sprintf("grow:%d:%d", calls - 49, i))
+				}
+		}
+
+		if cursor == 0 {
+			break
+		}
+	}
+
+	for i := 0; i < 500; i++ {
+		assert.True(t, seen[fmt.Sprintf("stable:%d", i)], i)
+	}
+}
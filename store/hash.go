@@ -0,0 +1,355 @@
+package store
+
+import (
+	"math/rand"
+)
+
+const (
+	// DefaultHashMaxListpackEntries and DefaultHashMaxListpackValue are the
+	// limits past which a hash converts to a hash table, as the redis
+	// hash-max-listpack-entries and hash-max-listpack-value settings
+	DefaultHashMaxListpackEntries = 128
+	DefaultHashMaxListpackValue   = 64
+
+	HashEncodingListpack  = "listpack"
+	HashEncodingHashtable = "hashtable"
+)
+
+// Hash maps fields to values, each with an optional expiration. Small hashes
+// keep their fields in a slice, in insertion order, like the redis listpack
+// encoding: it is compact and scanning a few entries is as fast as hashing.
+// Once a hash holds more fields, or longer fields or values, than the
+// configured limits it converts to a Dict, and never converts back.
+//
+// Expired fields are hidden from reads and removed by writes, or by the
+// active expiration cycle. It is not safe for concurrent use.
+type Hash struct {
+	listpack []*hashEntry
+	dict     *Dict[*hashEntry]
+	// volatile is the number of fields with an expiration
+	volatile int
+	// latestExpiration is the latest field expiration, or 0 without any
+	latestExpiration int64
+}
+
+type hashEntry struct {
+	field string
+	value []byte
+	// expiration is the absolute expiration in unix milliseconds, or -1
+	expiration int64
+}
+
+func (e *hashEntry) isExpired(now int64) bool {
+	return e.expiration > 0 && now > e.expiration
+}
+
+// NewHash() Creates a new empty Hash in the compact encoding
+func NewHash() *Hash {
+	return &Hash{}
+}
+
+// Encoding returns the name of the encoding, as OBJECT ENCODING reports it
+func (h *Hash) Encoding() string {
+	if h.dict != nil {
+		return HashEncodingHashtable
+	}
+	return HashEncodingListpack
+}
+
+// rawLen returns the number of fields, including expired ones
+func (h *Hash) rawLen() int {
+	if h.dict != nil {
+		return h.dict.Len()
+	}
+	return len(h.listpack)
+}
+
+// find returns the entry of field, even when it expired
+func (h *Hash) find(field string) *hashEntry {
+	if h.dict != nil {
+		entry, _ := h.dict.Get(field)
+		return entry
+	}
+
+	for _, entry := range h.listpack {
+		if entry.field == field {
+			return entry
+		}
+	}
+	return nil
+}
+
+// lookup returns the entry of field unless it expired
+func (h *Hash) lookup(field string, now int64) *hashEntry {
+	entry := h.find(field)
+	if entry == nil || entry.isExpired(now) {
+		return nil
+	}
+	return entry
+}
+
+// Get returns the value of field
+func (h *Hash) Get(field string, now int64) ([]byte, bool) {
+	entry := h.lookup(field, now)
+	if entry == nil {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// Len returns the number of fields that have not expired
+func (h *Hash) Len(now int64) int {
+	if h.volatile == 0 {
+		return h.rawLen()
+	}
+
+	length := 0
+	h.Range(now, func(field string, value []byte) bool {
+		length++
+		return true
+	})
+	return length
+}
+
+// allExpired reports whether every field of a hash with fields has expired,
+// in which case the hash is gone as a whole. It only reads the hash, as
+// lookups call it under a read lock.
+func (h *Hash) allExpired(now int64) bool {
+	return h.volatile > 0 && h.volatile == h.rawLen() && now > h.latestExpiration
+}
+
+// Set stores value at field, removing its expiration unless keepTTL is set,
+// and reports whether the field was added. The hash converts to a hash table
+// once it exceeds the limits of config.
+func (h *Hash) Set(field string, value []byte, keepTTL bool, now int64, config *EncodingConfig) bool {
+	if entry := h.find(field); entry != nil {
+		added := entry.isExpired(now)
+		if added || !keepTTL {
+			h.setEntryExpiration(entry, -1)
+		}
+		entry.value = value
+		return added
+	}
+
+	entry := &hashEntry{field: field, value: value, expiration: -1}
+	if h.dict == nil {
+		h.listpack = append(h.listpack, entry)
+		if len(h.listpack) > config.HashMaxListpackEntries ||
+			len(field) > config.HashMaxListpackValue || len(value) > config.HashMaxListpackValue {
+			h.convert()
+		}
+		return true
+	}
+	h.dict.Set(field, entry)
+	return true
+}
+
+// convert moves the fields to a Dict
+func (h *Hash) convert() {
+	h.dict = NewDict[*hashEntry]()
+	for _, entry := range h.listpack {
+		h.dict.Set(entry.field, entry)
+	}
+	h.listpack = nil
+}
+
+// Delete removes field and reports whether it existed and had not expired
+func (h *Hash) Delete(field string, now int64) bool {
+	entry := h.find(field)
+	if entry == nil {
+		return false
+	}
+
+	h.remove(entry)
+	return !entry.isExpired(now)
+}
+
+func (h *Hash) remove(entry *hashEntry) {
+	h.setEntryExpiration(entry, -1)
+
+	if h.dict != nil {
+		h.dict.Delete(entry.field)
+		return
+	}
+	for i, e := range h.listpack {
+		if e == entry {
+			h.listpack = append(h.listpack[:i], h.listpack[i + 1:]...)
+			return
+		}
+	}
+}
+
+// Range calls fn for every field that has not expired, in insertion order
+// for the compact encoding, until it returns false
+func (h *Hash) Range(now int64, fn func(field string, value []byte) bool) {
+	if h.dict != nil {
+		h.dict.Range(func(field string, entry *hashEntry) bool {
+			if entry.isExpired(now) {
+				return true
+			}
+			return fn(field, entry.value)
+		})
+		return
+	}
+
+	for _, entry := range h.listpack {
+		if !entry.isExpired(now) && !fn(entry.field, entry.value) {
+			return
+		}
+	}
+}
+
+// Scan calls fn for the fields that have not expired in the buckets at
+// cursor, like Dict.Scan. A hash in the compact encoding is returned whole,
+// with a 0 cursor.
+func (h *Hash) Scan(cursor uint64, now int64, fn func(field string, value []byte)) uint64 {
+	if h.dict == nil {
+		h.Range(now, func(field string, value []byte) bool {
+			fn(field, value)
+			return true
+		})
+		return 0
+	}
+
+	return h.dict.Scan(cursor, func(field string, entry *hashEntry) {
+		if !entry.isExpired(now) {
+			fn(field, entry.value)
+		}
+	})
+}
+
+// Random returns a field that has not expired picked at random, and false
+// when there is none
+func (h *Hash) Random(now int64) (string, []byte, bool) {
+	length := h.Len(now)
+	if length == 0 {
+		return "", nil, false
+	}
+
+	if h.dict != nil && h.volatile == 0 {
+		field, entry, _ := h.dict.Random()
+		return field, entry.value, true
+	}
+
+	var field string
+	var value []byte
+	skip := rand.Intn(length)
+	h.Range(now, func(f string, v []byte) bool {
+		if skip > 0 {
+			skip--
+			return true
+		}
+		field, value = f, v
+		return false
+	})
+	return field, value, true
+}
+
+// Expiration returns the absolute expiration of field in unix milliseconds,
+// or -1 when it does not expire, and whether the field exists
+func (h *Hash) Expiration(field string, now int64) (int64, bool) {
+	entry := h.lookup(field, now)
+	if entry == nil {
+		return 0, false
+	}
+	return entry.expiration, true
+}
+
+// SetExpiration sets the absolute expiration of field in unix milliseconds,
+// or removes it when expiration is -1, and reports whether the field exists
+func (h *Hash) SetExpiration(field string, expiration int64, now int64) bool {
+	entry := h.lookup(field, now)
+	if entry == nil {
+		return false
+	}
+	h.setEntryExpiration(entry, expiration)
+	return true
+}
+
+// setEntryExpiration sets the expiration of entry, keeping the count of
+// volatile fields and the latest expiration up to date. The latest expiration
+// is searched again when it was entry's and entry now expires sooner.
+func (h *Hash) setEntryExpiration(entry *hashEntry, expiration int64) {
+	previous := entry.expiration
+	if previous > 0 {
+		h.volatile--
+	}
+	if expiration > 0 {
+		h.volatile++
+	}
+	entry.expiration = expiration
+
+	switch {
+		case h.volatile == 0:
+			h.latestExpiration = 0
+		case expiration >= h.latestExpiration:
+			h.latestExpiration = expiration
+		case previous == h.latestExpiration:
+			h.latestExpiration = 0
+			h.rangeEntries(func(entry *hashEntry) {
+				h.latestExpiration = max(h.latestExpiration, entry.expiration)
+			})
+	}
+}
+
+// rangeEntries calls fn for every entry, expired or not
+func (h *Hash) rangeEntries(fn func(entry *hashEntry)) {
+	if h.dict != nil {
+		h.dict.Range(func(field string, entry *hashEntry) bool {
+			fn(entry)
+			return true
+		})
+		return
+	}
+	for _, entry := range h.listpack {
+		fn(entry)
+	}
+}
+
+// RemoveExpired removes the expired fields and returns them
+func (h *Hash) RemoveExpired(now int64) []string {
+	if h.volatile == 0 {
+		return nil
+	}
+
+	expired := make([]*hashEntry, 0)
+	h.rangeEntries(func(entry *hashEntry) {
+		if entry.isExpired(now) {
+			expired = append(expired, entry)
+		}
+	})
+
+	fields := make([]string, 0, len(expired))
+	for _, entry := range expired {
+		h.remove(entry)
+		fields = append(fields, entry.field)
+	}
+	return fields
+}
+
+// Clone returns a copy of the hash sharing no entry with it
+func (h *Hash) Clone() *Hash {
+	clone := &Hash{
+		volatile: h.volatile,
+		latestExpiration: h.latestExpiration,
+	}
+
+	copyEntry := func(entry *hashEntry) *hashEntry {
+		copied := *entry
+		return &copied
+	}
+	if h.dict != nil {
+		clone.dict = NewDict[*hashEntry]()
+		h.dict.Range(func(field string, entry *hashEntry) bool {
+			clone.dict.Set(field, copyEntry(entry))
+			return true
+		})
+		return clone
+	}
+
+	clone.listpack = make([]*hashEntry, 0, len(h.listpack))
+	for _, entry := range h.listpack {
+		clone.listpack = append(clone.listpack, copyEntry(entry))
+	}
+	return clone
+}
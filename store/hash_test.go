@@ -0,0 +1,121 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHash_Encoding(t *testing.T) {
+	config := &EncodingConfig{HashMaxListpackEntries: 4, HashMaxListpackValue: 8}
+
+	// small hashes keep their fields in insertion order
+	h := NewHash()
+	for i := 0; i < 4; i++ {
+		assert.True(t, h.Set(fmt.Sprintf("f%d", i), []byte("v"), false, 0, config))
+	}
+	assert.False(t, h.Set("f0", []byte("updated"), false, 0, config))
+	assert.Equal(t, HashEncodingListpack, h.Encoding())
+	fields := make([]string, 0)
+	h.Range(0, func(field string, value []byte) bool {
+		fields = append(fields, field)
+		return true
+	})
+	assert.Equal(t, []string{"f0", "f1", "f2", "f3"}, fields)
+
+	// one field too many converts the hash, and it never converts back
+	h.Set("f4", []byte("v"), false, 0, config)
+	assert.Equal(t, HashEncodingHashtable, h.Encoding())
+	assert.Equal(t, 5, h.Len(0))
+	value, exists := h.Get("f0", 0)
+	assert.True(t, exists)
+	assert.Equal(t, []byte("updated"), value)
+	assert.True(t, h.Delete("f4", 0))
+	assert.True(t, h.Delete("f3", 0))
+	assert.Equal(t, HashEncodingHashtable, h.Encoding())
+
+	// so does a value too long
+	h = NewHash()
+	h.Set("f", []byte(strings.Repeat("x", 9)), false, 0, config)
+	assert.Equal(t, HashEncodingHashtable, h.Encoding())
+}
+
+func TestHash_FieldExpiration(t *testing.T) {
+	for _, entries := range []int{128, 1} {
+		config := &EncodingConfig{HashMaxListpackEntries: entries, HashMaxListpackValue: 64}
+		h := NewHash()
+		h.Set("short", []byte("1"), false, 0, config)
+		h.Set("long", []byte("2"), false, 0, config)
+		h.Set("forever", []byte("3"), false, 0, config)
+
+		assert.True(t, h.SetExpiration("short", 100, 0))
+		assert.True(t, h.SetExpiration("long", 1000, 0))
+		assert.False(t, h.SetExpiration("missing", 100, 0))
+		assert.Equal(t, 2, h.volatile)
+
+		// expired fields are hidden before being removed
+		assert.Equal(t, 2, h.Len(500))
+		_, exists := h.Get("short", 500)
+		assert.False(t, exists)
+		expiration, exists := h.Expiration("long", 500)
+		assert.True(t, exists)
+		assert.Equal(t, int64(1000), expiration)
+		assert.False(t, h.allExpired(500))
+
+		// setting a field again removes its expiration unless asked to keep it
+		h.Set("long", []byte("4"), true, 500, config)
+		expiration, _ = h.Expiration("long", 500)
+		assert.Equal(t, int64(1000), expiration)
+
+		assert.Equal(t, []string{"short"}, h.RemoveExpired(500))
+		assert.Equal(t, 2, h.rawLen())
+		assert.Equal(t, 1, h.volatile)
+
+		h.Set("long", []byte("5"), false, 500, config)
+		assert.Equal(t, 0, h.volatile)
+	}
+}
+
+func TestHash_AllExpired(t *testing.T) {
+	for _, entries := range []int{128, 1} {
+		config := &EncodingConfig{HashMaxListpackEntries: entries, HashMaxListpackValue: 64}
+		h := NewHash()
+		assert.False(t, h.allExpired(0))
+
+		for i := 1; i <= 3; i++ {
+			field := fmt.Sprintf("f%d", i)
+			h.Set(field, []byte("v"), false, 0, config)
+			h.SetExpiration(field, int64(i * 100), 0)
+		}
+		assert.Equal(t, int64(300), h.latestExpiration)
+		assert.False(t, h.allExpired(300))
+		assert.True(t, h.allExpired(301))
+
+		// shortening the latest expiration finds the next latest one
+		h.SetExpiration("f3", 150, 0)
+		assert.Equal(t, int64(200), h.latestExpiration)
+		assert.False(t, h.allExpired(200))
+		assert.True(t, h.allExpired(201))
+		h.Delete("f2", 0)
+		assert.Equal(t, int64(150), h.latestExpiration)
+		h.Set("f2", []byte("v"), false, 0, config)
+		h.SetExpiration("f2", 200, 0)
+
+		// a field without expiration keeps the hash alive
+		h.Set("forever", []byte("v"), false, 0, config)
+		assert.False(t, h.allExpired(1000))
+
+		clone := h.Clone()
+		h.Delete("forever", 0)
+		assert.True(t, h.allExpired(1000))
+		assert.False(t, clone.allExpired(1000))
+
+		for i := 1; i <= 3; i++ {
+			h.SetExpiration(fmt.Sprintf("f%d", i), -1, 0)
+		}
+		assert.Equal(t, int64(0), h.latestExpiration)
+		assert.False(t, h.allExpired(1000))
+	}
+}
@@ -0,0 +1,398 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// errors of the hash operations, worded as the replies sent to clients
+var (
+	ErrHashNotInteger = errors.New("hash value is not an integer")
+	ErrHashNotFloat = errors.New("hash value is not a float")
+)
+
+// results of setting or removing the expiration of a field, as HEXPIRE and
+// HPERSIST reply them
+const (
+	FieldNotFound        = -2
+	FieldNoExpiration    = -1
+	FieldConditionNotMet = 0
+	FieldUpdated         = 1
+	FieldDeleted         = 2
+)
+
+// HashField is a field of a hash and its value
+type HashField struct {
+	Field string
+	Value []byte
+}
+
+// hashOf returns the hash of a hash object, nil for a missing key
+func hashOf(obj *Object) (*Hash, error) {
+	if obj == nil {
+		return nil, nil
+	}
+
+	hash, isHash := obj.Value.(*Hash)
+	if !isHash {
+		return nil, ErrWrongType
+	}
+	return hash, nil
+}
+
+// update changes the hash stored at key in place with fn, which receives nil
+// when the key is missing. A hash left with no fields by fn is deleted.
+func (hs *HashStoreImpl) update(key string, fn func(hash *Hash, now int64) (*Hash, error)) error {
+	now := time.Now().UnixMilli()
+
+	return hs.Keyspace.Update(key, func(obj *Object) (*Object, error) {
+		hash, err := hashOf(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		hash, err = fn(hash, now)
+		if err != nil {
+			return nil, err
+		}
+
+		if hash == nil || hash.Len(now) == 0 {
+			return nil, nil
+		}
+		if obj != nil && obj.Value == hash {
+			return obj, nil
+		}
+		return &Object{
+			Value:      hash,
+			Expiration: -1,
+		}, nil
+	})
+}
+
+// view calls fn with the hash stored at key, nil when the key is missing
+func (hs *HashStoreImpl) view(key string, fn func(hash *Hash, now int64) error) error {
+	now := time.Now().UnixMilli()
+
+	return hs.Keyspace.View(key, func(obj *Object) error {
+		hash, err := hashOf(obj)
+		if err != nil {
+			return err
+		}
+		return fn(hash, now)
+	})
+}
+
+// Set stores the field value pairs in the hash stored at key, creating it
+// when missing, and returns how many fields were added. The expiration of
+// the fields is removed.
+func (hs *HashStoreImpl) Set(key string, pairs [][]byte) (int, error) {
+	added := 0
+
+	err := hs.update(key, func(hash *Hash, now int64) (*Hash, error) {
+		if hash == nil {
+			hash = NewHash()
+		}
+		for i := 0; i + 1 < len(pairs); i += 2 {
+			if hash.Set(string(pairs[i]), pairs[i + 1], false, now, hs.Config) {
+				added++
+			}
+		}
+		return hash, nil
+	})
+
+	return added, err
+}
+
+// SetNX stores value at field only when the field does not exist, and
+// reports whether it was stored
+func (hs *HashStoreImpl) SetNX(key string, field string, value []byte) (bool, error) {
+	stored := false
+
+	err := hs.update(key, func(hash *Hash, now int64) (*Hash, error) {
+		if hash == nil {
+			hash = NewHash()
+		}
+		if _, exists := hash.Get(field, now); !exists {
+			stored = hash.Set(field, value, false, now, hs.Config)
+		}
+		return hash, nil
+	})
+
+	return stored, err
+}
+
+// Get returns the value of field in the hash stored at key
+func (hs *HashStoreImpl) Get(key string, field string) (value []byte, exists bool, err error) {
+	err = hs.view(key, func(hash *Hash, now int64) error {
+		if hash != nil {
+			value, exists = hash.Get(field, now)
+		}
+		return nil
+	})
+
+	return value, exists, err
+}
+
+// MGet returns the values of fields in the hash stored at key, with a nil
+// value for the fields that do not exist
+func (hs *HashStoreImpl) MGet(key string, fields []string) ([]*HashField, error) {
+	values := make([]*HashField, len(fields))
+
+	err := hs.view(key, func(hash *Hash, now int64) error {
+		if hash == nil {
+			return nil
+		}
+		for i, field := range fields {
+			if value, exists := hash.Get(field, now); exists {
+				values[i] = &HashField{Field: field, Value: value}
+			}
+		}
+		return nil
+	})
+
+	return values, err
+}
+
+// GetAll returns the fields of the hash stored at key with their values
+func (hs *HashStoreImpl) GetAll(key string) ([]HashField, error) {
+	fields := make([]HashField, 0)
+
+	err := hs.view(key, func(hash *Hash, now int64) error {
+		if hash == nil {
+			return nil
+		}
+		hash.Range(now, func(field string, value []byte) bool {
+			fields = append(fields, HashField{Field: field, Value: value})
+			return true
+		})
+		return nil
+	})
+
+	return fields, err
+}
+
+// Len returns the number of fields of the hash stored at key
+func (hs *HashStoreImpl) Len(key string) (int, error) {
+	length := 0
+
+	err := hs.view(key, func(hash *Hash, now int64) error {
+		if hash != nil {
+			length = hash.Len(now)
+		}
+		return nil
+	})
+
+	return length, err
+}
+
+// Delete removes fields from the hash stored at key, deleting the key once
+// it has none left, and returns how many existed
+func (hs *HashStoreImpl) Delete(key string, fields []string) (int, error) {
+	deleted := 0
+
+	err := hs.update(key, func(hash *Hash, now int64) (*Hash, error) {
+		if hash == nil {
+			return nil, nil
+		}
+		for _, field := range fields {
+			if hash.Delete(field, now) {
+				deleted++
+			}
+		}
+		return hash, nil
+	})
+
+	return deleted, err
+}
+
+// IncrBy adds delta to the integer stored at field, creating it at 0 when it
+// is missing, and returns the new value. The expiration of the field is kept.
+func (hs *HashStoreImpl) IncrBy(key string, field string, delta int64) (int64, error) {
+	var result int64
+
+	err := hs.update(key, func(hash *Hash, now int64) (*Hash, error) {
+		if hash == nil {
+			hash = NewHash()
+		}
+
+		var current int64
+		if value, exists := hash.Get(field, now); exists {
+			parsed, ok := ParseStrictInt(value)
+			if !ok {
+				return nil, ErrHashNotInteger
+			}
+			current = parsed
+		}
+
+		if (delta > 0 && current > math.MaxInt64 - delta) || (delta < 0 && current < math.MinInt64 - delta) {
+			return nil, ErrOverflow
+		}
+
+		result = current + delta
+		hash.Set(field, []byte(strconv.FormatInt(result, 10)), true, now, hs.Config)
+		return hash, nil
+	})
+
+	return result, err
+}
+
+// IncrByFloat adds delta, as parsed by ParseLongDouble, to the number stored
+// at field, creating it at 0 when it is missing, and returns the new value as
+// it is stored. The expiration of the field is kept.
+func (hs *HashStoreImpl) IncrByFloat(key string, field string, delta *big.Float) ([]byte, error) {
+	var result []byte
+
+	err := hs.update(key, func(hash *Hash, now int64) (*Hash, error) {
+		if hash == nil {
+			hash = NewHash()
+		}
+
+		current := new(big.Float).SetPrec(LongDoublePrecision)
+		if value, exists := hash.Get(field, now); exists {
+			parsed, ok := ParseLongDouble(value)
+			if !ok {
+				return nil, ErrHashNotFloat
+			}
+			current = parsed
+		}
+
+		var err error
+		result, err = addLongDouble(current, delta)
+		if err != nil {
+			return nil, err
+		}
+		hash.Set(field, result, true, now, hs.Config)
+		return hash, nil
+	})
+
+	return result, err
+}
+
+// RandomFields returns count fields of the hash stored at key picked at
+// random. Fields are distinct, so fewer are returned when the hash is
+// smaller, unless allowDuplicates is set.
+func (hs *HashStoreImpl) RandomFields(key string, count int, allowDuplicates bool) ([]HashField, error) {
+	picked := make([]HashField, 0)
+
+	err := hs.view(key, func(hash *Hash, now int64) error {
+		if hash == nil || count == 0 {
+			return nil
+		}
+
+		if allowDuplicates {
+			for i := 0; i < count; i++ {
+				field, value, _ := hash.Random(now)
+				picked = append(picked, HashField{Field: field, Value: value})
+			}
+			return nil
+		}
+
+		hash.Range(now, func(field string, value []byte) bool {
+			picked = append(picked, HashField{Field: field, Value: value})
+			return true
+		})
+		rand.Shuffle(len(picked), func(i, j int) {
+			picked[i], picked[j] = picked[j], picked[i]
+		})
+		picked = picked[:min(count, len(picked))]
+		return nil
+	})
+
+	return picked, err
+}
+
+// SetFieldsExpiration sets the absolute expiration of fields of the hash
+// stored at key in unix milliseconds, for the fields whose current
+// expiration, -1 for none, passes cond. Fields whose expiration is already
+// past are deleted instead, unless keepPast is set. It returns one of the
+// Field results for each field.
+func (hs *HashStoreImpl) SetFieldsExpiration(key string, fields []string, expiration int64, cond func(current int64) bool, keepPast bool) ([]int, error) {
+	results := fieldResults(len(fields))
+
+	err := hs.update(key, func(hash *Hash, now int64) (*Hash, error) {
+		if hash == nil {
+			return nil, nil
+		}
+
+		for i, field := range fields {
+			current, exists := hash.Expiration(field, now)
+			switch {
+				case !exists:
+				case !cond(current):
+					results[i] = FieldConditionNotMet
+				case expiration <= now && !keepPast:
+					hash.Delete(field, now)
+					results[i] = FieldDeleted
+				default:
+					hash.SetExpiration(field, expiration, now)
+					results[i] = FieldUpdated
+			}
+		}
+		return hash, nil
+	})
+
+	return results, err
+}
+
+// PersistFields removes the expiration of fields of the hash stored at key,
+// and returns one of the Field results for each field
+func (hs *HashStoreImpl) PersistFields(key string, fields []string) ([]int, error) {
+	results := fieldResults(len(fields))
+
+	err := hs.update(key, func(hash *Hash, now int64) (*Hash, error) {
+		if hash == nil {
+			return nil, nil
+		}
+
+		for i, field := range fields {
+			current, exists := hash.Expiration(field, now)
+			switch {
+				case !exists:
+				case current < 0:
+					results[i] = FieldNoExpiration
+				default:
+					hash.SetExpiration(field, -1, now)
+					results[i] = FieldUpdated
+			}
+		}
+		return hash, nil
+	})
+
+	return results, err
+}
+
+// FieldsExpiration returns the absolute expiration of fields of the hash
+// stored at key in unix milliseconds, FieldNoExpiration for the fields that
+// do not expire and FieldNotFound for the missing ones
+func (hs *HashStoreImpl) FieldsExpiration(key string, fields []string) ([]int64, error) {
+	expirations := make([]int64, len(fields))
+	for i := range expirations {
+		expirations[i] = FieldNotFound
+	}
+
+	err := hs.view(key, func(hash *Hash, now int64) error {
+		if hash == nil {
+			return nil
+		}
+		for i, field := range fields {
+			if expiration, exists := hash.Expiration(field, now); exists {
+				expirations[i] = expiration
+			}
+		}
+		return nil
+	})
+
+	return expirations, err
+}
+
+func fieldResults(n int) []int {
+	results := make([]int, n)
+	for i := range results {
+		results[i] = FieldNotFound
+	}
+	return results
+}
@@ -0,0 +1,345 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// HyperLogLogs are strings laid out the way redis lays them out, so they can
+// be copied from and to a redis server: a 16 byte header followed by the
+// registers, either dense or sparse.
+//
+// The header holds the "HYLL" magic, the encoding, three unused bytes and the
+// last estimate as a little endian integer, whose most significant bit is set
+// once an update made it stale.
+//
+// Dense registers take 6 bits each, packed from the least significant bit of
+// each byte. Sparse registers are runs of opcodes: ZERO (00xxxxxx) for up to
+// 64 registers set to 0, XZERO (01xxxxxx yyyyyyyy) for up to 16384 of them,
+// and VAL (1vvvvvxx) for up to 4 registers set to the same value, at most 32.
+const (
+	// hllP is the number of bits of an element's hash that select its
+	// register, leaving hllQ bits to count the trailing zeros of
+	hllP = 14
+	hllQ = 64 - hllP
+	hllRegisters = 1 << hllP
+
+	hllBits = 6
+	hllRegisterMax = 1 << hllBits - 1
+	hllHeaderSize = 16
+	hllDenseSize = hllHeaderSize + (hllRegisters * hllBits + 7) / 8
+
+	hllEncodingDense = 0
+	hllEncodingSparse = 1
+
+	hllSparseZeroMaxLen = 64
+	hllSparseXZeroMaxLen = 16384
+	hllSparseValMaxValue = 32
+	hllSparseValMaxLen = 4
+
+	hllCacheStale = 1 << 7
+	hllSeed = 0xadc83b19
+	hllAlphaInf = 0.721347520444481703680
+
+	// DefaultHllSparseMaxBytes is the size past which a sparse HyperLogLog
+	// converts to the dense encoding, as the redis hll-sparse-max-bytes
+	// setting
+	DefaultHllSparseMaxBytes = 3000
+)
+
+var (
+	hllMagic = []byte("HYLL")
+
+	// ErrNotHyperLogLog is returned for a string that is not a HyperLogLog
+	ErrNotHyperLogLog = errors.New("Key is not a valid HyperLogLog string value.")
+	// ErrCorruptHyperLogLog is returned for a sparse HyperLogLog whose opcodes
+	// do not cover every register
+	ErrCorruptHyperLogLog = errors.New("Corrupted HLL object detected")
+)
+
+// hyperLogLog holds the registers of a HyperLogLog: for each register, one
+// more than the most trailing zeros seen in the hashes of the elements
+// selecting it
+type hyperLogLog struct {
+	registers [hllRegisters]uint8
+	dense     bool
+}
+
+// parseHyperLogLog decodes the registers of a HyperLogLog string
+func parseHyperLogLog(value []byte) (*hyperLogLog, error) {
+	if len(value) < hllHeaderSize || string(value[:4]) != string(hllMagic) {
+		return nil, ErrNotHyperLogLog
+	}
+
+	h := &hyperLogLog{}
+	switch value[4] {
+		case hllEncodingDense:
+			if len(value) != hllDenseSize {
+				return nil, ErrNotHyperLogLog
+			}
+			h.dense = true
+			for i := range h.registers {
+				h.registers[i] = denseRegister(value[hllHeaderSize:], i)
+			}
+		case hllEncodingSparse:
+			if err := h.parseSparse(value[hllHeaderSize:]); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, ErrNotHyperLogLog
+	}
+	return h, nil
+}
+
+func (h *hyperLogLog) parseSparse(p []byte) error {
+	index := 0
+	for i := 0; i < len(p); i++ {
+		var run int
+		switch {
+			case p[i] & 0xc0 == 0:
+				run = int(p[i] & 0x3f) + 1
+			case p[i] & 0xc0 == 0x40:
+				if i + 1 == len(p) {
+					return ErrCorruptHyperLogLog
+				}
+				run = (int(p[i] & 0x3f) << 8 | int(p[i + 1])) + 1
+				i++
+			default:
+				run = int(p[i] & 0x3) + 1
+				if index + run > hllRegisters {
+					return ErrCorruptHyperLogLog
+				}
+				value := (p[i] >> 2) & 0x1f + 1
+				for j := index; j < index + run; j++ {
+					h.registers[j] = value
+				}
+		}
+		index += run
+		if index > hllRegisters {
+			return ErrCorruptHyperLogLog
+		}
+	}
+
+	if index != hllRegisters {
+		return ErrCorruptHyperLogLog
+	}
+	return nil
+}
+
+// denseRegister returns the register at index of dense registers p
+func denseRegister(p []byte, index int) uint8 {
+	b := index * hllBits / 8
+	fb := uint(index * hllBits & 7)
+
+	value := uint(p[b]) >> fb
+	if b + 1 < len(p) {
+		value |= uint(p[b + 1]) << (8 - fb)
+	}
+	return uint8(value & hllRegisterMax)
+}
+
+// setDenseRegister sets the register at index of dense registers p
+func setDenseRegister(p []byte, index int, value uint8) {
+	b := index * hllBits / 8
+	fb := uint(index * hllBits & 7)
+
+	p[b] &^= hllRegisterMax << fb
+	p[b] |= value << fb
+	if b + 1 < len(p) {
+		p[b + 1] &^= hllRegisterMax >> (8 - fb)
+		p[b + 1] |= value >> (8 - fb)
+	}
+}
+
+// add adds element and reports whether a register changed
+func (h *hyperLogLog) add(element []byte) bool {
+	hash := murmurHash64A(element, hllSeed)
+	index := hash & (hllRegisters - 1)
+
+	// the trailing zeros are counted on the remaining bits, with a bit set
+	// past them so that there are at most hllQ
+	hash = hash >> hllP | 1 << hllQ
+	count := uint8(bits.TrailingZeros64(hash) + 1)
+
+	if count <= h.registers[index] {
+		return false
+	}
+	h.registers[index] = count
+	return true
+}
+
+// merge sets every register to the highest of its value in h and in other,
+// which estimates the union of both
+func (h *hyperLogLog) merge(other *hyperLogLog) {
+	for i, value := range other.registers {
+		h.registers[i] = max(h.registers[i], value)
+	}
+	h.dense = h.dense || other.dense
+}
+
+// count estimates the number of distinct elements added, with the estimator
+// from Otmar Ertl's "New cardinality estimation algorithms for HyperLogLog
+// sketches" redis uses, whose standard error is 1.04 / sqrt(hllRegisters)
+func (h *hyperLogLog) count() int64 {
+	var histogram [hllRegisterMax + 1]int
+	for _, value := range h.registers {
+		histogram[value]++
+	}
+
+	m := float64(hllRegisters)
+	z := m * hllTau((m - float64(histogram[hllQ + 1])) / m)
+	for j := hllQ; j >= 1; j-- {
+		z += float64(histogram[j])
+		z *= 0.5
+	}
+	z += m * hllSigma(float64(histogram[0]) / m)
+	return int64(math.Round(hllAlphaInf * m * m / z))
+}
+
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+
+	y, z := 1.0, x
+	for {
+		x *= x
+		previous := z
+		z += x * y
+		y += y
+		if z == previous {
+			return z
+		}
+	}
+}
+
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+
+	y, z := 1.0, 1 - x
+	for {
+		x = math.Sqrt(x)
+		previous := z
+		y *= 0.5
+		z -= math.Pow(1 - x, 2) * y
+		if z == previous {
+			return z / 3
+		}
+	}
+}
+
+// encode returns h as a HyperLogLog string with a stale estimate. It stays
+// sparse unless it was dense already, has a register too high for a VAL
+// opcode or would take more than sparseMaxBytes.
+func (h *hyperLogLog) encode(sparseMaxBytes int) []byte {
+	if !h.dense {
+		if value := h.encodeSparse(sparseMaxBytes); value != nil {
+			return value
+		}
+	}
+
+	value := make([]byte, hllDenseSize)
+	writeHLLHeader(value, hllEncodingDense)
+	for i, register := range h.registers {
+		setDenseRegister(value[hllHeaderSize:], i, register)
+	}
+	return value
+}
+
+// encodeSparse returns the sparse encoding of h, or nil when it has to be
+// dense
+func (h *hyperLogLog) encodeSparse(sparseMaxBytes int) []byte {
+	value := make([]byte, hllHeaderSize, hllHeaderSize + 16)
+	writeHLLHeader(value, hllEncodingSparse)
+
+	for i := 0; i < hllRegisters; {
+		register := h.registers[i]
+		run := 1
+		for i + run < hllRegisters && h.registers[i + run] == register {
+			run++
+		}
+		i += run
+
+		switch {
+			case register > hllSparseValMaxValue:
+				return nil
+			case register == 0:
+				for ; run > hllSparseZeroMaxLen; run -= hllSparseXZeroMaxLen {
+					n := min(run, hllSparseXZeroMaxLen) - 1
+					value = append(value, 0x40 | byte(n >> 8), byte(n))
+				}
+				if run > 0 {
+					value = append(value, byte(run - 1))
+				}
+			default:
+				for ; run > 0; run -= hllSparseValMaxLen {
+					n := min(run, hllSparseValMaxLen) - 1
+					value = append(value, 0x80 | (register - 1) << 2 | byte(n))
+				}
+		}
+
+		if len(value) > sparseMaxBytes {
+			return nil
+		}
+	}
+	return value
+}
+
+func writeHLLHeader(value []byte, encoding byte) {
+	copy(value, hllMagic)
+	value[4] = encoding
+	value[15] = hllCacheStale
+}
+
+// cachedCount returns the estimate cached in the header of a HyperLogLog
+// string, unless an update made it stale
+func cachedCount(value []byte) (int64, bool) {
+	if value[15] & hllCacheStale != 0 {
+		return 0, false
+	}
+	return int64(binary.LittleEndian.Uint64(value[8:16])), true
+}
+
+// withCachedCount returns a copy of a HyperLogLog string caching count
+func withCachedCount(value []byte, count int64) []byte {
+	updated := make([]byte, len(value))
+	copy(updated, value)
+	binary.LittleEndian.PutUint64(updated[8:16], uint64(count))
+	return updated
+}
+
+// murmurHash64A is the 64 bit MurmurHash2 by Austin Appleby, which redis
+// hashes HyperLogLog elements with
+func murmurHash64A(key []byte, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+
+	h := seed ^ uint64(len(key)) * m
+
+	for len(key) >= 8 {
+		k := binary.LittleEndian.Uint64(key)
+		k *= m
+		k ^= k >> r
+		k *= m
+
+		h ^= k
+		h *= m
+		key = key[8:]
+	}
+
+	if len(key) > 0 {
+		for i := len(key) - 1; i >= 0; i-- {
+			h ^= uint64(key[i]) << (8 * i)
+		}
+		h *= m
+	}
+
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
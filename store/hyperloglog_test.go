@@ -0,0 +1,118 @@
+package store
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHyperLogLog_Hash(t *testing.T) {
+	// the hashes redis computes for the same elements
+	for element, hash := range map[string]uint64{
+		"": 15627466953755236146,
+		"a": 6039968161137406375,
+		"foo": 16592960565925911732,
+		"hello world": 12184977182547125431,
+		"0123456789abcdefXYZ": 216464458254671902,
+	} {
+		assert.Equal(t, hash, murmurHash64A([]byte(element), hllSeed), element)
+	}
+}
+
+func TestHyperLogLog_Encoding(t *testing.T) {
+	h := &hyperLogLog{}
+	assert.Equal(t, int64(0), h.count())
+
+	// an empty HyperLogLog written by redis is a single XZERO opcode
+	empty := append([]byte("HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"), 0x7f, 0xff)
+	parsed, err := parseHyperLogLog(empty)
+	assert.Nil(t, err)
+	assert.Equal(t, h, parsed)
+	assert.Equal(t, empty[hllHeaderSize:], h.encode(DefaultHllSparseMaxBytes)[hllHeaderSize:])
+
+	for i := 0; i < 100; i++ {
+		h.add([]byte(fmt.Sprint(i)))
+	}
+	sparse := h.encode(DefaultHllSparseMaxBytes)
+	assert.Equal(t, byte(hllEncodingSparse), sparse[4])
+	parsed, err = parseHyperLogLog(sparse)
+	assert.Nil(t, err)
+	assert.Equal(t, h.registers, parsed.registers)
+	assert.InDelta(t, 100, parsed.count(), 2)
+
+	// too large a sparse encoding converts to dense, which stays dense
+	dense := h.encode(len(sparse) - 1)
+	assert.Equal(t, hllDenseSize, len(dense))
+	parsed, err = parseHyperLogLog(dense)
+	assert.Nil(t, err)
+	assert.Equal(t, h.registers, parsed.registers)
+	assert.Equal(t, hllDenseSize, len(parsed.encode(DefaultHllSparseMaxBytes)))
+
+	// so does a register too high for a VAL opcode
+	h = &hyperLogLog{}
+	h.registers[hllRegisters - 1] = hllSparseValMaxValue + 1
+	value := h.encode(DefaultHllSparseMaxBytes)
+	assert.Equal(t, byte(hllEncodingDense), value[4])
+	parsed, err = parseHyperLogLog(value)
+	assert.Nil(t, err)
+	assert.Equal(t, h.registers, parsed.registers)
+
+	for _, invalid := range []string{"", "HYLL", "HYLX\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00", "HYLL\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"} {
+		_, err = parseHyperLogLog([]byte(invalid))
+		assert.Equal(t, ErrNotHyperLogLog, err, invalid)
+	}
+	for _, corrupt := range []string{"\x7f", "\x7f\xfe", "\x7f\xff\x00", "\x7f\xfe\x83"} {
+		_, err = parseHyperLogLog(append(empty[:hllHeaderSize:hllHeaderSize], corrupt...))
+		assert.Equal(t, ErrCorruptHyperLogLog, err, corrupt)
+	}
+}
+
+func TestKVStore_HyperLogLog(t *testing.T) {
+	s := NewDB(0)
+
+	// the estimate stays within a few standard errors
+	elements := make([][]byte, 0, 1000)
+	for i := 0; i < 100000; i++ {
+		elements = append(elements, []byte(fmt.Sprintf("visitor:%d", i)))
+		if len(elements) == cap(elements) {
+			updated, err := s.KVStore.PFAdd("visits", elements)
+			assert.Nil(t, err)
+			assert.True(t, updated)
+			elements = elements[:0]
+		}
+	}
+	count, err := s.KVStore.PFCount([]string{"visits"})
+	assert.Nil(t, err)
+	assert.Less(t, math.Abs(float64(count) - 100000), 100000 * 3 * 1.04 / math.Sqrt(hllRegisters))
+
+	// the estimate is cached until the next update
+	value, _ := s.KVStore.Get("visits")
+	cached, valid := cachedCount(value)
+	assert.True(t, valid)
+	assert.Equal(t, count, cached)
+	updated, err := s.KVStore.PFAdd("visits", [][]byte{[]byte("visitor:1")})
+	assert.Nil(t, err)
+	assert.False(t, updated)
+	value, _ = s.KVStore.Get("visits")
+	_, valid = cachedCount(value)
+	assert.True(t, valid)
+
+	s.KVStore.PFAdd("a", [][]byte{[]byte("1"), []byte("2"), []byte("3")})
+	s.KVStore.PFAdd("b", [][]byte{[]byte("3"), []byte("4")})
+	count, err = s.KVStore.PFCount([]string{"a", "b", "missing"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), count)
+	assert.Nil(t, s.KVStore.PFMerge("a", []string{"b", "missing"}))
+	count, err = s.KVStore.PFCount([]string{"a"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), count)
+
+	s.KVStore.Set("str", []byte("v"), -1)
+	_, err = s.KVStore.PFAdd("str", nil)
+	assert.Equal(t, ErrNotHyperLogLog, err)
+	s.ListStore.Push("list", [][]byte{[]byte("v")}, true, false)
+	_, err = s.KVStore.PFCount([]string{"a", "list"})
+	assert.Equal(t, ErrWrongType, err)
+}
@@ -0,0 +1,137 @@
+package store
+
+// hyperLogLogOf decodes the HyperLogLog stored in a string object, nil for a
+// missing key
+func hyperLogLogOf(obj *Object) (*hyperLogLog, error) {
+	if obj == nil {
+		return nil, nil
+	}
+
+	value, isString := stringValue(obj)
+	if !isString {
+		return nil, ErrWrongType
+	}
+	return parseHyperLogLog(value)
+}
+
+// PFAdd adds elements to the HyperLogLog stored at key, creating it when
+// missing, and reports whether it was created or one of its registers
+// changed, which may change its estimate
+func (kv *KVStoreImpl) PFAdd(key string, elements [][]byte) (bool, error) {
+	updated := false
+
+	err := kv.Keyspace.Update(key, func(obj *Object) (*Object, error) {
+		h, err := hyperLogLogOf(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		expiration := int64(-1)
+		if h == nil {
+			h, updated = &hyperLogLog{}, true
+		} else {
+			expiration = obj.Expiration
+		}
+
+		for _, element := range elements {
+			if h.add(element) {
+				updated = true
+			}
+		}
+		if !updated {
+			return obj, nil
+		}
+
+		return &Object{
+			Value:      h.encode(kv.Config.HllSparseMaxBytes),
+			Expiration: expiration,
+		}, nil
+	})
+
+	return updated, err
+}
+
+// PFCount estimates the number of distinct elements added to any of the
+// HyperLogLogs stored at keys, a missing key being empty. The estimate of a
+// single HyperLogLog is cached in its header until it is updated.
+func (kv *KVStoreImpl) PFCount(keys []string) (int64, error) {
+	if len(keys) == 1 {
+		return kv.countOne(keys[0])
+	}
+
+	union := &hyperLogLog{}
+	for _, key := range keys {
+		err := kv.Keyspace.View(key, func(obj *Object) error {
+			h, err := hyperLogLogOf(obj)
+			if h != nil {
+				union.merge(h)
+			}
+			return err
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return union.count(), nil
+}
+
+func (kv *KVStoreImpl) countOne(key string) (int64, error) {
+	var count int64
+
+	err := kv.Keyspace.Update(key, func(obj *Object) (*Object, error) {
+		h, err := hyperLogLogOf(obj)
+		if h == nil {
+			return obj, err
+		}
+
+		value, _ := stringValue(obj)
+		cached, valid := cachedCount(value)
+		if valid {
+			count = cached
+			return obj, nil
+		}
+
+		count = h.count()
+		return &Object{
+			Value:      withCachedCount(value, count),
+			Expiration: obj.Expiration,
+		}, nil
+	})
+
+	return count, err
+}
+
+// PFMerge stores at dst the union of the HyperLogLogs stored at dst and at
+// keys, creating it when missing
+func (kv *KVStoreImpl) PFMerge(dst string, keys []string) error {
+	union := &hyperLogLog{}
+	for _, key := range keys {
+		err := kv.Keyspace.View(key, func(obj *Object) error {
+			h, err := hyperLogLogOf(obj)
+			if h != nil {
+				union.merge(h)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return kv.Keyspace.Update(dst, func(obj *Object) (*Object, error) {
+		h, err := hyperLogLogOf(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		expiration := int64(-1)
+		if h != nil {
+			union.merge(h)
+			expiration = obj.Expiration
+		}
+		return &Object{
+			Value:      union.encode(kv.Config.HllSparseMaxBytes),
+			Expiration: expiration,
+		}, nil
+	})
+}
@@ -0,0 +1,457 @@
+package store
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// KeyspaceShards is the number of independently locked partitions of the
+// keyspace. Commands on keys in different shards do not contend.
+const KeyspaceShards = 32
+
+// Object is a value stored in the keyspace together with its absolute
+// expiration time in unix milliseconds, or -1 when it does not expire.
+// Value holds a []byte for strings, or an int64 for strings holding an
+// integer, a *Quicklist for lists, a *Hash for hashes, a *Set for sets, a
+// *ZSet for sorted sets and a []StreamValues for streams.
+type Object struct {
+	Value      interface{}
+	Expiration int64
+}
+
+// Keyspace maps keys to objects of any type. It is safe for concurrent use:
+// every key belongs to one shard, guarded by its own lock. Objects handed out
+// by the keyspace must not be mutated in place; writers store a new Object
+// (or use Update to read and replace one atomically). Lists, hashes, sets
+// and sorted sets are the exception: they are changed in place by Update and
+// only read through View, so writes do not copy the whole aggregate.
+type Keyspace struct {
+	shards [KeyspaceShards]*keyspaceShard
+}
+
+type keyspaceShard struct {
+	mu    sync.RWMutex
+	items *Dict[*Object]
+	// volatile holds the keys of items with an expiration, sampled by the
+	// active expiration cycle
+	volatile map[string]struct{}
+	// volatileFields holds the keys of hashes with fields that expire
+	volatileFields map[string]struct{}
+}
+
+// NewKeyspace() Creates a new empty Keyspace
+func NewKeyspace() *Keyspace {
+	ks := &Keyspace{}
+	for i := range ks.shards {
+		ks.shards[i] = &keyspaceShard{
+			items: NewDict[*Object](),
+			volatile: make(map[string]struct{}),
+			volatileFields: make(map[string]struct{}),
+		}
+	}
+	return ks
+}
+
+func (ks *Keyspace) shardFor(key string) *keyspaceShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return ks.shards[h.Sum32() % KeyspaceShards]
+}
+
+// set stores obj at key. The shard must be locked for writing.
+func (shard *keyspaceShard) set(key string, obj *Object) {
+	shard.items.Set(key, obj)
+	if obj.Expiration > 0 {
+		shard.volatile[key] = struct{}{}
+	} else {
+		delete(shard.volatile, key)
+	}
+
+	if hash, isHash := obj.Value.(*Hash); isHash && hash.volatile > 0 {
+		shard.volatileFields[key] = struct{}{}
+	} else {
+		delete(shard.volatileFields, key)
+	}
+}
+
+// remove deletes key. The shard must be locked for writing.
+func (shard *keyspaceShard) remove(key string) {
+	shard.items.Delete(key)
+	delete(shard.volatile, key)
+	delete(shard.volatileFields, key)
+}
+
+// isExpired reports whether the object expired, or is a hash whose fields
+// all expired
+func (o *Object) isExpired(now int64) bool {
+	if o.Expiration > 0 && now > o.Expiration {
+		return true
+	}
+	hash, isHash := o.Value.(*Hash)
+	return isHash && hash.allExpired(now)
+}
+
+// Lookup returns the object stored at key. Expired keys are deleted and
+// reported as missing.
+func (ks *Keyspace) Lookup(key string) (*Object, bool) {
+	shard := ks.shardFor(key)
+
+	shard.mu.RLock()
+	obj, exists := shard.items.Get(key)
+	shard.mu.RUnlock()
+
+	if !exists {
+		return nil, false
+	}
+
+	if obj.isExpired(time.Now().UnixMilli()) {
+		shard.mu.Lock()
+		// the key may have been overwritten since it was read
+		if current, exists := shard.items.Get(key); exists && current.isExpired(time.Now().UnixMilli()) {
+			shard.remove(key)
+		}
+		shard.mu.Unlock()
+		return nil, false
+	}
+
+	return obj, true
+}
+
+// View calls fn with the object stored at key, nil when the key is missing or
+// expired, while no writer can change it
+func (ks *Keyspace) View(key string, fn func(obj *Object) error) error {
+	shard := ks.shardFor(key)
+
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	obj, exists := shard.items.Get(key)
+	if exists && obj.isExpired(time.Now().UnixMilli()) {
+		obj = nil
+	}
+	return fn(obj)
+}
+
+// Set stores obj at key, replacing any previous value whatever its type
+func (ks *Keyspace) Set(key string, obj *Object) {
+	shard := ks.shardFor(key)
+
+	shard.mu.Lock()
+	shard.set(key, obj)
+	shard.mu.Unlock()
+}
+
+// Update atomically replaces the object stored at key with the one returned
+// by fn, which receives the current object (nil when the key is missing or
+// expired). No other writer can change the key while fn runs. When fn
+// returns an error the key is left untouched; when it returns a nil object
+// the key is deleted.
+func (ks *Keyspace) Update(key string, fn func(obj *Object) (*Object, error)) error {
+	shard := ks.shardFor(key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	current, exists := shard.items.Get(key)
+	if exists && current.isExpired(time.Now().UnixMilli()) {
+		current = nil
+	}
+
+	updated, err := fn(current)
+	if err != nil {
+		return err
+	}
+
+	if updated == nil {
+		shard.remove(key)
+	} else {
+		shard.set(key, updated)
+	}
+	return nil
+}
+
+// Expiration returns the absolute expiration of key in unix milliseconds, or
+// -1 when it does not expire, and whether the key exists
+func (ks *Keyspace) Expiration(key string) (int64, bool) {
+	obj, exists := ks.Lookup(key)
+	if !exists {
+		return 0, false
+	}
+	return obj.Expiration, true
+}
+
+// SetExpiration sets the absolute expiration of key in unix milliseconds, or
+// removes it when expiration is -1, whatever the type of its value. It
+// reports whether the key exists.
+func (ks *Keyspace) SetExpiration(key string, expiration int64) bool {
+	exists := false
+
+	ks.Update(key, func(obj *Object) (*Object, error) {
+		if obj == nil {
+			return nil, nil
+		}
+
+		exists = true
+		return &Object{
+			Value:      obj.Value,
+			Expiration: expiration,
+		}, nil
+	})
+	return exists
+}
+
+// Delete removes key and reports whether it existed
+func (ks *Keyspace) Delete(key string) bool {
+	shard := ks.shardFor(key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	obj, exists := shard.items.Get(key)
+	if !exists {
+		return false
+	}
+	shard.remove(key)
+	return !obj.isExpired(time.Now().UnixMilli())
+}
+
+// Unlink removes key like Delete, and returns its value, even when it has
+// expired, so that it can be released elsewhere. It returns nil when the key
+// is missing.
+func (ks *Keyspace) Unlink(key string) (obj *Object, existed bool) {
+	shard := ks.shardFor(key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	obj, exists := shard.items.Get(key)
+	if !exists {
+		return nil, false
+	}
+	shard.remove(key)
+	return obj, !obj.isExpired(time.Now().UnixMilli())
+}
+
+// Keys returns every key that has not expired, in no particular order
+func (ks *Keyspace) Keys() []string {
+	now := time.Now().UnixMilli()
+	keys := make([]string, 0)
+
+	for _, shard := range ks.shards {
+		shard.mu.RLock()
+		shard.items.Range(func(key string, obj *Object) bool {
+			if !obj.isExpired(now) {
+				keys = append(keys, key)
+			}
+			return true
+		})
+		shard.mu.RUnlock()
+	}
+
+	return keys
+}
+
+// RandomKey returns a key that has not expired, picked at random, and false
+// when there is none
+func (ks *Keyspace) RandomKey() (string, bool) {
+	now := time.Now().UnixMilli()
+	offset := rand.Intn(KeyspaceShards)
+
+	for i := range ks.shards {
+		shard := ks.shards[(offset + i) % KeyspaceShards]
+
+		shard.mu.RLock()
+		key, found := shard.randomKey(now)
+		shard.mu.RUnlock()
+		if found {
+			return key, true
+		}
+	}
+
+	return "", false
+}
+
+// randomKeyTries is how many keys RandomKey picks at random in a shard before
+// looking for one that has not expired in order
+const randomKeyTries = 100
+
+// randomKey returns a key of the shard that has not expired. The shard must be
+// locked for reading.
+func (shard *keyspaceShard) randomKey(now int64) (string, bool) {
+	for i := 0; i < randomKeyTries; i++ {
+		key, obj, found := shard.items.Random()
+		if !found {
+			return "", false
+		}
+		if !obj.isExpired(now) {
+			return key, true
+		}
+	}
+
+	// mostly expired keys: settle for the first live one
+	var live string
+	found := false
+	shard.items.Range(func(key string, obj *Object) bool {
+		if obj.isExpired(now) {
+			return true
+		}
+		live, found = key, true
+		return false
+	})
+	return live, found
+}
+
+// Scan returns the keys that have not expired in a few buckets of the
+// keyspace, calling fn for each, starting at cursor. It visits buckets until
+// at least count keys were returned or it looked at ten times count buckets,
+// and returns the cursor to continue from, which is 0 once the iteration is
+// complete. Keys present during the whole iteration are returned at least
+// once, though some may be returned more than once.
+//
+// The low bits of the cursor select a shard, and the others are the cursor
+// of the shard's Dict, so shards are scanned one after the other.
+func (ks *Keyspace) Scan(cursor uint64, count int, fn func(key string, obj *Object)) uint64 {
+	now := time.Now().UnixMilli()
+	found := 0
+	emit := func(key string, obj *Object) {
+		if !obj.isExpired(now) {
+			fn(key, obj)
+			found++
+		}
+	}
+
+	shardIdx, dictCursor := cursor % KeyspaceShards, cursor / KeyspaceShards
+	for maxIterations := count * 10; maxIterations > 0 && found < count; maxIterations-- {
+		shard := ks.shards[shardIdx]
+
+		shard.mu.RLock()
+		dictCursor = shard.items.Scan(dictCursor, emit)
+		shard.mu.RUnlock()
+
+		if dictCursor == 0 {
+			shardIdx++
+			if shardIdx == KeyspaceShards {
+				return 0
+			}
+		}
+	}
+
+	return dictCursor * KeyspaceShards + shardIdx
+}
+
+// Len returns the number of keys, including expired keys not yet removed
+func (ks *Keyspace) Len() int {
+	n := 0
+	for _, shard := range ks.shards {
+		shard.mu.RLock()
+		n += shard.items.Len()
+		shard.mu.RUnlock()
+	}
+	return n
+}
+
+// Flush removes every key
+func (ks *Keyspace) Flush() {
+	for _, shard := range ks.shards {
+		shard.mu.Lock()
+		shard.items = NewDict[*Object]()
+		shard.volatile = make(map[string]struct{})
+		shard.volatileFields = make(map[string]struct{})
+		shard.mu.Unlock()
+	}
+}
+
+// VolatileLen returns the number of keys with an expiration, including
+// expired keys not yet removed
+func (ks *Keyspace) VolatileLen() int {
+	n := 0
+	for _, shard := range ks.shards {
+		shard.mu.RLock()
+		n += len(shard.volatile)
+		shard.mu.RUnlock()
+	}
+	return n
+}
+
+// ExpireSample looks at up to count keys with an expiration, starting from a
+// shard picked at random, and deletes the expired ones. It returns how many
+// keys it looked at and the keys it deleted.
+func (ks *Keyspace) ExpireSample(count int) (sampled int, expired []string) {
+	now := time.Now().UnixMilli()
+	offset := rand.Intn(KeyspaceShards)
+
+	for i := range ks.shards {
+		shard := ks.shards[(offset + i) % KeyspaceShards]
+
+		shard.mu.Lock()
+		// map iteration starts at a random element
+		for key := range shard.volatile {
+			if sampled == count {
+				break
+			}
+			sampled++
+
+			if obj, _ := shard.items.Get(key); obj.isExpired(now) {
+				shard.remove(key)
+				expired = append(expired, key)
+			}
+		}
+		shard.mu.Unlock()
+
+		if sampled == count {
+			break
+		}
+	}
+
+	return sampled, expired
+}
+
+// ExpiredFields are the fields of a hash removed by ExpireFieldsSample
+type ExpiredFields struct {
+	Key    string
+	Fields []string
+}
+
+// ExpireFieldsSample looks at up to count hashes with fields that expire,
+// starting from a shard picked at random, and removes their expired fields,
+// deleting the hashes left empty. It returns how many hashes it looked at and
+// the fields it removed.
+func (ks *Keyspace) ExpireFieldsSample(count int) (sampled int, expired []ExpiredFields) {
+	now := time.Now().UnixMilli()
+	offset := rand.Intn(KeyspaceShards)
+
+	for i := range ks.shards {
+		shard := ks.shards[(offset + i) % KeyspaceShards]
+
+		shard.mu.Lock()
+		for key := range shard.volatileFields {
+			if sampled == count {
+				break
+			}
+			sampled++
+
+			obj, _ := shard.items.Get(key)
+			hash := obj.Value.(*Hash)
+			fields := hash.RemoveExpired(now)
+			if len(fields) == 0 {
+				continue
+			}
+
+			expired = append(expired, ExpiredFields{Key: key, Fields: fields})
+			if hash.rawLen() == 0 {
+				shard.remove(key)
+			} else {
+				shard.set(key, obj)
+			}
+		}
+		shard.mu.Unlock()
+
+		if sampled == count {
+			break
+		}
+	}
+
+	return sampled, expired
+}
@@ -0,0 +1,299 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyspace(t *testing.T) {
+	ks := NewKeyspace()
+
+	_, exists := ks.Lookup("mango")
+	assert.False(t, exists)
+
+	ks.Set("mango", &Object{Value: []byte("raspberry"), Expiration: -1})
+	obj, exists := ks.Lookup("mango")
+	assert.True(t, exists)
+	assert.Equal(t, []byte("raspberry"), obj.Value)
+	assert.Equal(t, 1, ks.Len())
+
+	// expired keys are reported missing and removed on access
+	ks.Set("kiwi", &Object{Value: []byte("green"), Expiration: time.Now().UnixMilli() - 1})
+	_, exists = ks.Lookup("kiwi")
+	assert.False(t, exists)
+	assert.Equal(t, []string{"mango"}, ks.Keys())
+	assert.Equal(t, 1, ks.Len())
+
+	assert.True(t, ks.Delete("mango"))
+	assert.False(t, ks.Delete("mango"))
+	assert.Equal(t, 0, ks.Len())
+}
+
+func TestKeyspace_Update(t *testing.T) {
+	ks := NewKeyspace()
+
+	err := ks.Update("counter", func(obj *Object) (*Object, error) {
+		assert.Nil(t, obj)
+		return &Object{Value: 1, Expiration: -1}, nil
+	})
+	assert.Nil(t, err)
+
+	// a failing update leaves the key untouched
+	err = ks.Update("counter", func(obj *Object) (*Object, error) {
+		return nil, ErrWrongType
+	})
+	assert.Equal(t, ErrWrongType, err)
+	obj, _ := ks.Lookup("counter")
+	assert.Equal(t, 1, obj.Value)
+
+	// returning nil deletes the key
+	err = ks.Update("counter", func(obj *Object) (*Object, error) {
+		return nil, nil
+	})
+	assert.Nil(t, err)
+	_, exists := ks.Lookup("counter")
+	assert.False(t, exists)
+}
+
+func TestKeyspace_Unlink(t *testing.T) {
+	ks := NewKeyspace()
+
+	list := NewQuicklist()
+	for i := 0; i < 100; i++ {
+		list.PushBack([]byte(fmt.Sprint(i)))
+	}
+	ks.Set("list", &Object{Value: list, Expiration: -1})
+	ks.Set("expired", &Object{Value: []byte("v"), Expiration: time.Now().UnixMilli() - 1})
+
+	obj, existed := ks.Unlink("list")
+	assert.True(t, existed)
+	assert.Equal(t, 100, FreeEffort(obj))
+	_, exists := ks.Lookup("list")
+	assert.False(t, exists)
+
+	// expired values are handed back for release but not counted as removed
+	obj, existed = ks.Unlink("expired")
+	assert.False(t, existed)
+	assert.Equal(t, 1, FreeEffort(obj))
+
+	obj, existed = ks.Unlink("missing")
+	assert.Nil(t, obj)
+	assert.False(t, existed)
+	assert.Equal(t, 0, ks.Len())
+
+	list = NewQuicklist()
+	list.PushBack([]byte("a"))
+	obj = &Object{Value: list, Expiration: -1}
+	Release(obj)
+	assert.Nil(t, obj.Value)
+	assert.Equal(t, 0, list.Len())
+}
+
+func TestDB_Types(t *testing.T) {
+	s := NewDB(0)
+
+	assert.Nil(t, s.KVStore.Set("mango", []byte("raspberry"), -1))
+	_, err := s.StreamStore.SetEntry("mango", "1-1", []StreamEntry{{Key: []byte("foo"), Value: []byte("bar")}})
+	assert.Equal(t, ErrWrongType, err)
+
+	_, err = s.StreamStore.SetEntry("kiwi", "1-1", []StreamEntry{{Key: []byte("foo"), Value: []byte("bar")}})
+	assert.Nil(t, err)
+	_, exists := s.KVStore.Get("kiwi")
+	assert.False(t, exists)
+
+	assert.Equal(t, TypeString, s.Type("mango"))
+	assert.Equal(t, TypeStream, s.Type("kiwi"))
+	assert.Equal(t, TypeNone, s.Type("papaya"))
+
+	// SET replaces a value of any type
+	assert.Nil(t, s.KVStore.Set("kiwi", []byte("green"), -1))
+	assert.Equal(t, TypeString, s.Type("kiwi"))
+}
+
+// run with -race: concurrent writers and readers on overlapping keys
+func TestDB_Concurrent(t *testing.T) {
+	s := NewDB(0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				key := fmt.Sprintf("key:%d", j % 20)
+
+				s.KVStore.Set(key, []byte(fmt.Sprintf("%d-%d", i, j)), int64(j % 3))
+				s.KVStore.Get(key)
+				s.StreamStore.SetEntry("stream", "*", []StreamEntry{{Key: []byte("worker"), Value: []byte(key)}})
+				s.StreamStore.ReadEntry("stream", "0-0")
+				s.ListStore.Push("list", [][]byte{[]byte(key)}, j % 2 == 0, false)
+				s.ListStore.Range("list", 0, -1)
+				s.ListStore.Pop("list", 1, i % 2 == 0)
+				s.HashStore.Set("hash", [][]byte{[]byte(key), []byte("v")})
+				s.HashStore.GetAll("hash")
+				s.HashStore.Delete("hash", []string{key})
+				s.SetStore.Add("set", []string{key})
+				s.SetStore.Union([]string{"set", "other"})
+				s.SetStore.Pop("set", 1)
+				s.ZSetStore.Add("zset", []ZMember{{Member: key, Score: float64(j)}}, ZAddOptions{})
+				s.ZSetStore.Range("zset", ZRangeOptions{Start: 0, Stop: -1})
+				s.ZSetStore.Remove("zset", []string{key})
+				s.KVStore.PFAdd("hll", [][]byte{[]byte(key)})
+				s.KVStore.PFCount([]string{"hll"})
+				s.Keyspace.Keys()
+				s.Keyspace.Delete(key)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stream, err := s.StreamStore.GetStream("stream")
+	assert.Nil(t, err)
+	assert.Equal(t, 8 * 200, len(stream))
+}
+
+// run with -race: checking whether a hash expired as a whole only reads it,
+// since lookups do so under a read lock
+func TestKeyspace_ConcurrentHashLookup(t *testing.T) {
+	ks := NewKeyspace()
+
+	later := time.Now().UnixMilli() + 100000
+	h := NewHash()
+	for i := 0; i < 10; i++ {
+		field := fmt.Sprint(i)
+		h.Set(field, []byte("v"), false, 0, &EncodingConfig{})
+		h.SetExpiration(field, later + int64(i), 0)
+	}
+	// the field with the latest expiration now expires first
+	h.SetExpiration("9", later - 1, 0)
+	ks.Set("hash", &Object{Value: h, Expiration: -1})
+
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, exists := ks.Lookup("hash")
+			assert.True(t, exists)
+			ks.View("hash", func(obj *Object) error {
+				assert.NotNil(t, obj)
+				return nil
+			})
+		}()
+	}
+	close(start)
+	wg.Wait()
+}
+
+func TestStreamStore_AutoGeneratedIDs(t *testing.T) {
+	s := NewDB(0)
+
+	previous := ""
+	for i := 0; i < 100; i++ {
+		entryID, err := s.StreamStore.SetEntry("stream", "*", []StreamEntry{{Key: []byte("foo"), Value: []byte("bar")}})
+		assert.Nil(t, err)
+		if previous != "" {
+			assert.Nil(t, validateEntryID(previous, entryID), entryID)
+		}
+		previous = entryID
+	}
+}
+
+func TestKVStore_Counters(t *testing.T) {
+	s := NewDB(0)
+
+	// counters are kept as integers and still read back as strings
+	value, err := s.KVStore.IncrBy("hits", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), value)
+	obj, _ := s.Keyspace.Lookup("hits")
+	assert.Equal(t, int64(10), obj.Value)
+	str, exists := s.KVStore.Get("hits")
+	assert.True(t, exists)
+	assert.Equal(t, []byte("10"), str)
+	assert.Equal(t, TypeString, s.Type("hits"))
+
+	for _, invalid := range []string{"", "+1", "01", "-0", " 1", "1.5", "99999999999999999999"} {
+		_, ok := ParseStrictInt([]byte(invalid))
+		assert.False(t, ok, invalid)
+	}
+	parsed, ok := ParseStrictInt([]byte("-9223372036854775808"))
+	assert.True(t, ok)
+	assert.Equal(t, int64(-9223372036854775808), parsed)
+
+	half, _ := ParseLongDouble([]byte("0.5"))
+	float, err := s.KVStore.IncrByFloat("hits", half)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("10.5"), float)
+	_, err = s.KVStore.IncrBy("hits", 1)
+	assert.Equal(t, ErrNotInteger, err)
+}
+
+func TestFormatLongDouble(t *testing.T) {
+	for text, formatted := range map[string]string{
+		"0": "0",
+		"-0": "0",
+		"10.50": "10.5",
+		"-2.5": "-2.5",
+		"5.0e3": "5000",
+		"1700000000000.25": "1700000000000.25",
+		"1e20": "100000000000000000000",
+		"1.5e-7": "0.00000015",
+		"0.30000000000000004": "0.30000000000000004",
+	} {
+		value, ok := ParseLongDouble([]byte(text))
+		assert.True(t, ok, text)
+		assert.Equal(t, formatted, string(FormatLongDouble(value)), text)
+	}
+
+	// a tenth and two tenths add up to three tenths at 17 significant digits
+	tenth, _ := ParseLongDouble([]byte("0.1"))
+	fifth, _ := ParseLongDouble([]byte("0.2"))
+	sum, err := addLongDouble(tenth, fifth)
+	assert.Nil(t, err)
+	assert.Equal(t, "0.3", string(sum))
+
+	_, ok := ParseLongDouble([]byte("inf"))
+	assert.False(t, ok)
+}
+
+func TestKeyspace_ExpireSample(t *testing.T) {
+	ks := NewKeyspace()
+
+	past := time.Now().UnixMilli() - 1
+	for i := 0; i < 100; i++ {
+		ks.Set(fmt.Sprintf("expired:%d", i), &Object{Value: []byte("v"), Expiration: past})
+		ks.Set(fmt.Sprintf("persistent:%d", i), &Object{Value: []byte("v"), Expiration: -1})
+	}
+	ks.Set("future", &Object{Value: []byte("v"), Expiration: past + 100000})
+	assert.Equal(t, 101, ks.VolatileLen())
+
+	// only keys with an expiration are sampled
+	deleted := 0
+	for deleted < 100 {
+		sampled, expired := ks.ExpireSample(20)
+		assert.LessOrEqual(t, sampled, 20)
+		assert.Greater(t, sampled, 0)
+		deleted += len(expired)
+	}
+	assert.Equal(t, 100, deleted)
+	assert.Equal(t, 101, ks.Len())
+	assert.Equal(t, 1, ks.VolatileLen())
+
+	sampled, expired := ks.ExpireSample(20)
+	assert.Equal(t, 1, sampled)
+	assert.Empty(t, expired)
+
+	// removing the expiration or the key stops tracking it
+	ks.Set("future", &Object{Value: []byte("v"), Expiration: -1})
+	assert.Equal(t, 0, ks.VolatileLen())
+	ks.Set("future", &Object{Value: []byte("v"), Expiration: past + 100000})
+	ks.Delete("future")
+	assert.Equal(t, 0, ks.VolatileLen())
+}
@@ -1,191 +1,104 @@
 package store
 
 import (
-	"bufio"
 	"encoding/base64"
-	"encoding/binary"
-	"fmt"
-	"io"
-	"os"
+	"strconv"
 	"time"
 )
 
-type OpCode byte
-
-const (
-	RdbEmptyFileBase64 = "UkVESVMwMDEx+glyZWRpcy12ZXIFNy4yLjD6CnJlZGlzLWJpdHPAQPoFY3RpbWXCbQi8ZfoIdXNlZC1tZW3CsMQQAPoIYW9mLWJhc2XAAP/wbjv+wP9aog=="
-
-	// OpCode
-	OpAUX 			OpCode = 0xFA
-	OpResizeDB 		OpCode = 0xFB
-	OpExpireTimeMs 	OpCode = 0xFC
-	OpExpireTime 	OpCode = 0xFD
-	OpSelectDB 		OpCode = 0xFE
-	OpEOF 			OpCode = 0xFF
-
-)
-
-func (kv *KVStoreImpl) Set(key string, val string, expDur int64) error {
+func (kv *KVStoreImpl) Set(key string, val []byte, expDur int64) error {
 	var expiration int64 = -1 
 
 	if expDur > 0 {
 		expiration = time.Now().UnixMilli() + expDur
 	}
 
-	value := &Values{
+	kv.Keyspace.Set(key, &Object{
 		Value:      val,
 		Expiration: expiration,
-	}
-
-	kv.DataStore[key] = value
+	})
 
 	return nil
 }
 
-func (kv *KVStoreImpl) Get(key string) (string, error) {
-	val, exists := kv.DataStore[key]; if !exists {
-		return "", nil
-	}
-
-	if val.Expiration > 0 && time.Now().UnixMilli() > val.Expiration {
-		// if value is expired, delete from store
-		delete(kv.DataStore, key)
-		return "", nil
-	}
-
-	return val.Value, nil
-}
-
-func (kv *KVStoreImpl) GetKeys() []string {
-	keys := make([]string, 0, len(kv.DataStore))
-
-	for k := range kv.DataStore {
-		keys = append(keys, k)
-	}
+// SetOptions are the conditions and expiration of a SET
+type SetOptions struct {
+	// NX only writes keys that do not exist, XX only keys that do
+	NX bool
+	XX bool
 
-	return keys
-}
+	// Expiration is the absolute expiration in unix milliseconds, or -1 for
+	// none. KeepTTL retains the expiration of the previous value instead.
+	Expiration int64
+	KeepTTL    bool
 
-func (kv *KVStoreImpl) ToRDBStore() ([]byte, error) {
-	return base64.StdEncoding.DecodeString(RdbEmptyFileBase64)
+	// Get asks for the previous value, which must then be a string
+	Get bool
 }
 
-func (kv *KVStoreImpl) InitializeDB() {
-	fmt.Println("Initializing DB", kv.Config)
-
-	file, err := os.Open(fmt.Sprintf("%s/%s", kv.Config.Dir, kv.Config.DbFileName))
-	if err != nil {
-		kv.DataStore = make(KVDataStore)
-	}
-	reader := bufio.NewReader(file)
-
-	// skip to 0xFE opcode
-	reader.ReadBytes(0xFE)
-	reader.UnreadByte()
-
-	kv.DataStore = kv.ParseRdbFile(reader)
-}
-
-func (kv *KVStoreImpl) ParseRdbFile(reader *bufio.Reader) KVDataStore {
-	main:
-		for {
-			opCode, err := reader.ReadByte()
-			if err != nil {
-				if err == io.EOF {
-					fmt.Println("EOF???")
-					break
-				}
-				return make(KVDataStore)
+// SetWithOptions stores val at key under the conditions of opts, replacing a
+// value of any type. It returns the previous value when opts.Get is set, and
+// whether the key was written. The check and the write are atomic.
+func (kv *KVStoreImpl) SetWithOptions(key string, val []byte, opts SetOptions) (old []byte, oldExists bool, written bool, err error) {
+	err = kv.Keyspace.Update(key, func(obj *Object) (*Object, error) {
+		if obj != nil && opts.Get {
+			value, isString := stringValue(obj)
+			if !isString {
+				return nil, ErrWrongType
 			}
+			old, oldExists = value, true
+		}
 
-			// getStringVal(reader)
+		if (opts.NX && obj != nil) || (opts.XX && obj == nil) {
+			return obj, nil
+		}
 
-			switch OpCode(opCode) {
-				case 0xFF: // EOF
-					break main
-				case 0xFE:
-					bufJump(reader, 2)
-					lengthParser(reader)
-					lengthParser(reader)
-					continue
-			}
+		expiration := opts.Expiration
+		if opts.KeepTTL && obj != nil {
+			expiration = obj.Expiration
+		}
 
-			expiry := int64(-1)
-			valueType := opCode
-			if opCode == 0xFD {
-				expiry = int64(binary.LittleEndian.Uint32(readBytes(reader, 4))) * 1000
-				valueType, _ = reader.ReadByte()
-			} else if opCode == 0xFC {
-				expiry = int64(binary.LittleEndian.Uint32(readBytes(reader, 8))) * 1000
-				valueType, _ = reader.ReadByte()
-			}
+		written = true
+		return &Object{
+			Value:      val,
+			Expiration: expiration,
+		}, nil
+	})
 
-			if valueType != 0x00 {
-				fmt.Printf("RedisRDB.Load: opcode not implemented: 0x%x\n", valueType)
-				continue
-			}
+	return old, oldExists, written, err
+}
 
-			keyLength := lengthParser(reader)
-			key := make([]byte, keyLength)
-			reader.Read(key)
-			
-			valueLength := lengthParser(reader)
-			value := make([]byte, valueLength)
-			reader.Read(value)
-			
-			fmt.Printf("RedisRDB.Load: Key: %s, Value: %s, expiry: %d\n", string(key), string(value), expiry)
-			kv.DataStore[string(key)] = &Values{
-				Value:  string(value),
-				Expiration: expiry,
-			}
-		}		
+// Get returns the string stored at key. exists is false for missing and
+// expired keys, and for keys holding another type, so an empty value can be
+// told apart from no value.
+func (kv *KVStoreImpl) Get(key string) (value []byte, exists bool) {
+	obj, exists := kv.Keyspace.Lookup(key)
+	if !exists {
+		return nil, false
+	}
 
-	return kv.DataStore
+	return stringValue(obj)
 }
 
-func bufJump(buf *bufio.Reader, x int) error {
-	a := make([]byte, x)
-	_, err := buf.Read(a)
-	return err
+// stringValue returns the value of a string object, whatever its encoding
+func stringValue(obj *Object) ([]byte, bool) {
+	switch value := obj.Value.(type) {
+		case []byte:
+			return value, true
+		case int64:
+			return []byte(strconv.FormatInt(value, 10)), true
+	}
+	return nil, false
 }
 
-func readBytes(reader *bufio.Reader, x int) []byte {
-	buf := make([]byte, x)
-	reader.Read(buf)
-	return buf
+func (kv *KVStoreImpl) GetKeys() []string {
+	return kv.Keyspace.Keys()
 }
 
-func lengthParser(reader *bufio.Reader) int {
-	lenByte, _ := reader.ReadByte()
-	switch lenByte >> 6 {
-	case 0b00:
-		return int(binary.LittleEndian.Uint16([]byte{lenByte, 00}))
-	case 0b01:
-		additionalByte, _ := reader.ReadByte()
-		return int(binary.LittleEndian.Uint16([]byte{lenByte & 0b00111111, additionalByte}))
-	case 0b10:
-		fmt.Println("hello???")
-	case 0b11:
-		switch lenByte & 0b00111111 {
-		case 0:
-			buf := make([]byte, 1)
-			reader.Read(buf)
-			fmt.Printf("wow??? 0x%02x", buf)
-			return int(binary.LittleEndian.Uint16([]byte{buf[0], 00}))
-		case 1:
-			buf := make([]byte, 2)
-			reader.Read(buf)
-			return int(binary.LittleEndian.Uint16(buf))
-		case 2:
-			buf := make([]byte, 4)
-			reader.Read(buf)
-			return int(binary.LittleEndian.Uint32(buf))
-		}
-	}
-
-	return -1
+func (s *Store) ToRDBStore() ([]byte, error) {
+	return base64.StdEncoding.DecodeString(RdbEmptyFileBase64)
 }
 
-func (kv *KVStoreImpl) EmptyRedisFile() []byte {
+func (s *Store) EmptyRedisFile() []byte {
 	return []byte("UkVESVMwMDEx+glyZWRpcy12ZXIFNy4yLjD6CnJlZGlzLWJpdHPAQPoFY3RpbWXCbQi8ZfoIdXNlZC1tZW3CsMQQAPoIYW9mLWJhc2XAAP/wbjv+wP9aog==")
 }
\ No newline at end of file
@@ -0,0 +1,362 @@
+package store
+
+// listOf returns the list of a list object, nil for a missing key
+func listOf(obj *Object) (*Quicklist, error) {
+	if obj == nil {
+		return nil, nil
+	}
+
+	list, isList := obj.Value.(*Quicklist)
+	if !isList {
+		return nil, ErrWrongType
+	}
+	return list, nil
+}
+
+// update changes the list stored at key in place with fn, which receives nil
+// when the key is missing. An empty list left by fn is deleted, as redis
+// never keeps empty aggregates.
+func (l *ListStoreImpl) update(key string, fn func(list *Quicklist) (*Quicklist, error)) error {
+	return l.Keyspace.Update(key, func(obj *Object) (*Object, error) {
+		list, err := listOf(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		list, err = fn(list)
+		if err != nil {
+			return nil, err
+		}
+
+		if list == nil || list.Len() == 0 {
+			return nil, nil
+		}
+		if obj != nil && obj.Value == list {
+			return obj, nil
+		}
+		return &Object{
+			Value:      list,
+			Expiration: -1,
+		}, nil
+	})
+}
+
+// view calls fn with the list stored at key, nil when the key is missing
+func (l *ListStoreImpl) view(key string, fn func(list *Quicklist) error) error {
+	return l.Keyspace.View(key, func(obj *Object) error {
+		list, err := listOf(obj)
+		if err != nil {
+			return err
+		}
+		return fn(list)
+	})
+}
+
+// Push inserts values at the head of the list stored at key, one after the
+// other, or at its tail when front is false, and returns the new length. The
+// list is created when missing, unless onlyExisting is set.
+func (l *ListStoreImpl) Push(key string, values [][]byte, front bool, onlyExisting bool) (int, error) {
+	length := 0
+
+	err := l.update(key, func(list *Quicklist) (*Quicklist, error) {
+		if list == nil {
+			if onlyExisting {
+				return nil, nil
+			}
+			list = NewQuicklist()
+		}
+
+		for _, value := range values {
+			if front {
+				list.PushFront(value)
+			} else {
+				list.PushBack(value)
+			}
+		}
+		length = list.Len()
+		return list, nil
+	})
+
+	return length, err
+}
+
+// Pop removes up to count elements from the head of the list stored at key,
+// or from its tail when front is false, and returns them. It returns nil when
+// the key is missing.
+func (l *ListStoreImpl) Pop(key string, count int, front bool) ([][]byte, error) {
+	var values [][]byte
+
+	err := l.update(key, func(list *Quicklist) (*Quicklist, error) {
+		if list == nil {
+			return nil, nil
+		}
+
+		values = make([][]byte, 0, min(count, list.Len()))
+		for len(values) < count {
+			var value []byte
+			var popped bool
+			if front {
+				value, popped = list.PopFront()
+			} else {
+				value, popped = list.PopBack()
+			}
+			if !popped {
+				break
+			}
+			values = append(values, value)
+		}
+		return list, nil
+	})
+
+	return values, err
+}
+
+// Len returns the length of the list stored at key, 0 when it is missing
+func (l *ListStoreImpl) Len(key string) (int, error) {
+	length := 0
+
+	err := l.view(key, func(list *Quicklist) error {
+		if list != nil {
+			length = list.Len()
+		}
+		return nil
+	})
+
+	return length, err
+}
+
+// Range returns the elements of the list stored at key from index start to
+// stop, both included. Negative indexes count from the tail, and the range is
+// clamped to the list, like LRANGE.
+func (l *ListStoreImpl) Range(key string, start, stop int) ([][]byte, error) {
+	values := make([][]byte, 0)
+
+	err := l.view(key, func(list *Quicklist) error {
+		if list == nil {
+			return nil
+		}
+
+		start, stop, empty := clampRange(start, stop, list.Len())
+		if !empty {
+			values = list.Range(start, stop)
+		}
+		return nil
+	})
+
+	return values, err
+}
+
+// clampRange turns a range of indexes that may be negative or past the ends
+// of a list of length elements into indexes in range, and reports whether the
+// range is empty
+func clampRange(start, stop, length int) (int, int, bool) {
+	if start < 0 {
+		start = max(start + length, 0)
+	}
+	if stop < 0 {
+		stop += length
+	}
+	stop = min(stop, length - 1)
+
+	return start, stop, start > stop || start >= length
+}
+
+// Index returns the element at index of the list stored at key
+func (l *ListStoreImpl) Index(key string, index int) (value []byte, exists bool, err error) {
+	err = l.view(key, func(list *Quicklist) error {
+		if list != nil {
+			value, exists = list.Index(index)
+		}
+		return nil
+	})
+
+	return value, exists, err
+}
+
+// SetIndex replaces the element at index of the list stored at key
+func (l *ListStoreImpl) SetIndex(key string, index int, value []byte) error {
+	return l.update(key, func(list *Quicklist) (*Quicklist, error) {
+		if list == nil {
+			return nil, ErrNoSuchKey
+		}
+		if !list.Set(index, value) {
+			return nil, ErrIndexOutOfRange
+		}
+		return list, nil
+	})
+}
+
+// Insert inserts value before the first element equal to pivot in the list
+// stored at key, or after it when after is set. It returns the new length,
+// -1 when pivot was not found and 0 when the key is missing.
+func (l *ListStoreImpl) Insert(key string, pivot, value []byte, after bool) (int, error) {
+	length := 0
+
+	err := l.update(key, func(list *Quicklist) (*Quicklist, error) {
+		if list == nil {
+			return nil, nil
+		}
+
+		found := -1
+		list.Iterate(0, false, func(index int, element []byte) bool {
+			if string(element) == string(pivot) {
+				found = index
+				return false
+			}
+			return true
+		})
+
+		if found < 0 {
+			length = -1
+			return list, nil
+		}
+		if after {
+			found++
+		}
+		list.Insert(found, value)
+		length = list.Len()
+		return list, nil
+	})
+
+	return length, err
+}
+
+// Remove removes up to count elements equal to value from the list stored at
+// key, starting from the tail when count is negative, or all of them when
+// count is 0. It returns how many were removed.
+func (l *ListStoreImpl) Remove(key string, count int, value []byte) (int, error) {
+	removed := 0
+
+	err := l.update(key, func(list *Quicklist) (*Quicklist, error) {
+		if list != nil {
+			removed = list.Remove(value, count)
+		}
+		return list, nil
+	})
+
+	return removed, err
+}
+
+// Trim keeps only the elements from index start to stop of the list stored
+// at key, with the indexes of Range. An empty range deletes the key.
+func (l *ListStoreImpl) Trim(key string, start, stop int) error {
+	return l.update(key, func(list *Quicklist) (*Quicklist, error) {
+		if list == nil {
+			return nil, nil
+		}
+
+		start, stop, empty := clampRange(start, stop, list.Len())
+		if empty {
+			return nil, nil
+		}
+		list.Trim(start, stop)
+		return list, nil
+	})
+}
+
+// PosOptions select which matches Pos returns
+type PosOptions struct {
+	// Rank is the first match to return, counting from 1 at the head, or from
+	// -1 at the tail to search from the tail
+	Rank int
+	// Count is the number of matches to return, or 0 for all of them
+	Count int
+	// MaxLen is the number of elements to compare, or 0 for all of them
+	MaxLen int
+}
+
+// Pos returns the indexes of the elements equal to value in the list stored
+// at key, in the order they are found
+func (l *ListStoreImpl) Pos(key string, value []byte, opts PosOptions) ([]int, error) {
+	matches := make([]int, 0)
+
+	err := l.view(key, func(list *Quicklist) error {
+		if list == nil {
+			return nil
+		}
+
+		reverse, skip := opts.Rank < 0, opts.Rank - 1
+		start := 0
+		if reverse {
+			skip, start = -opts.Rank - 1, -1
+		}
+
+		compared := 0
+		list.Iterate(start, reverse, func(index int, element []byte) bool {
+			if opts.MaxLen > 0 && compared == opts.MaxLen {
+				return false
+			}
+			compared++
+
+			if string(element) != string(value) {
+				return true
+			}
+			if skip > 0 {
+				skip--
+				return true
+			}
+			matches = append(matches, index)
+			return opts.Count == 0 || len(matches) < opts.Count
+		})
+		return nil
+	})
+
+	return matches, err
+}
+
+// Move pops an element from the head of the list stored at src, or its tail
+// when fromFront is false, and pushes it at the head of the list stored at
+// dst, or its tail when toFront is false, creating it when missing. It
+// returns the element moved, and false when src is missing. dst must hold a
+// list or be missing even when src is, and may be the same key as src.
+func (l *ListStoreImpl) Move(src, dst string, fromFront, toFront bool) (value []byte, moved bool, err error) {
+	push := func(list *Quicklist) {
+		if toFront {
+			list.PushFront(value)
+		} else {
+			list.PushBack(value)
+		}
+	}
+	pop := func(list *Quicklist) {
+		if fromFront {
+			value, moved = list.PopFront()
+		} else {
+			value, moved = list.PopBack()
+		}
+	}
+
+	if src == dst {
+		err = l.update(src, func(list *Quicklist) (*Quicklist, error) {
+			if list == nil {
+				return nil, nil
+			}
+			pop(list)
+			push(list)
+			return list, nil
+		})
+		return value, moved, err
+	}
+
+	if err := l.view(dst, func(list *Quicklist) error { return nil }); err != nil {
+		return nil, false, err
+	}
+
+	err = l.update(src, func(list *Quicklist) (*Quicklist, error) {
+		if list != nil {
+			pop(list)
+		}
+		return list, nil
+	})
+	if err != nil || !moved {
+		return nil, false, err
+	}
+
+	err = l.update(dst, func(list *Quicklist) (*Quicklist, error) {
+		if list == nil {
+			list = NewQuicklist()
+		}
+		push(list)
+		return list, nil
+	})
+	return value, moved, err
+}
@@ -0,0 +1,343 @@
+package store
+
+const (
+	// QuicklistNodeMaxEntries and QuicklistNodeMaxBytes bound the size of a
+	// quicklist node, which is split once it would exceed either
+	QuicklistNodeMaxEntries = 128
+	QuicklistNodeMaxBytes   = 8 * 1024
+)
+
+// Quicklist is a list built like the redis quicklist: a doubly linked list of
+// nodes, each holding a small slice of consecutive elements. Pushes and pops
+// at both ends touch a single bounded node, and lookups by index skip whole
+// nodes. It is not safe for concurrent use.
+type Quicklist struct {
+	head  *quicklistNode
+	tail  *quicklistNode
+	count int
+}
+
+type quicklistNode struct {
+	prev    *quicklistNode
+	next    *quicklistNode
+	entries [][]byte
+	// size is the number of bytes of the entries
+	size    int
+}
+
+// NewQuicklist() Creates a new empty Quicklist
+func NewQuicklist() *Quicklist {
+	return &Quicklist{}
+}
+
+// Len returns the number of elements
+func (ql *Quicklist) Len() int {
+	return ql.count
+}
+
+// release removes every element, unlinking the nodes one by one
+func (ql *Quicklist) release() {
+	for node := ql.head; node != nil; {
+		next := node.next
+		node.prev, node.next, node.entries = nil, nil, nil
+		node = next
+	}
+	*ql = Quicklist{}
+}
+
+func (node *quicklistNode) hasRoomFor(value []byte) bool {
+	return len(node.entries) < QuicklistNodeMaxEntries &&
+		(len(node.entries) == 0 || node.size + len(value) <= QuicklistNodeMaxBytes)
+}
+
+// insertNode links node after prev, or at the head when prev is nil
+func (ql *Quicklist) insertNode(prev *quicklistNode, node *quicklistNode) {
+	node.prev = prev
+	if prev == nil {
+		node.next = ql.head
+		ql.head = node
+	} else {
+		node.next = prev.next
+		prev.next = node
+	}
+
+	if node.next == nil {
+		ql.tail = node
+	} else {
+		node.next.prev = node
+	}
+}
+
+func (ql *Quicklist) unlinkNode(node *quicklistNode) {
+	if node.prev == nil {
+		ql.head = node.next
+	} else {
+		node.prev.next = node.next
+	}
+	if node.next == nil {
+		ql.tail = node.prev
+	} else {
+		node.next.prev = node.prev
+	}
+}
+
+// PushFront inserts value at the head of the list
+func (ql *Quicklist) PushFront(value []byte) {
+	if ql.head == nil || !ql.head.hasRoomFor(value) {
+		ql.insertNode(nil, &quicklistNode{})
+	}
+	ql.insertInNode(ql.head, 0, value)
+}
+
+// PushBack inserts value at the tail of the list
+func (ql *Quicklist) PushBack(value []byte) {
+	if ql.tail == nil || !ql.tail.hasRoomFor(value) {
+		ql.insertNode(ql.tail, &quicklistNode{})
+	}
+	ql.insertInNode(ql.tail, len(ql.tail.entries), value)
+}
+
+// insertInNode inserts value at offset of a node that has room for it
+func (ql *Quicklist) insertInNode(node *quicklistNode, offset int, value []byte) {
+	node.entries = append(node.entries, nil)
+	copy(node.entries[offset + 1:], node.entries[offset:])
+	node.entries[offset] = value
+	node.size += len(value)
+	ql.count++
+}
+
+// PopFront removes and returns the element at the head of the list
+func (ql *Quicklist) PopFront() ([]byte, bool) {
+	if ql.head == nil {
+		return nil, false
+	}
+	return ql.deleteAt(ql.head, 0), true
+}
+
+// PopBack removes and returns the element at the tail of the list
+func (ql *Quicklist) PopBack() ([]byte, bool) {
+	if ql.tail == nil {
+		return nil, false
+	}
+	return ql.deleteAt(ql.tail, len(ql.tail.entries) - 1), true
+}
+
+// deleteAt removes the element at offset of node, and the node once empty
+func (ql *Quicklist) deleteAt(node *quicklistNode, offset int) []byte {
+	value := node.entries[offset]
+	node.entries = append(node.entries[:offset], node.entries[offset + 1:]...)
+	// drop the reference left in the spare capacity
+	node.entries[:len(node.entries) + 1][len(node.entries)] = nil
+	node.size -= len(value)
+	ql.count--
+
+	if len(node.entries) == 0 {
+		ql.unlinkNode(node)
+	}
+	return value
+}
+
+// locate returns the node holding the element at index, which must be in
+// range, and its offset in the node. It walks from the closest end.
+func (ql *Quicklist) locate(index int) (*quicklistNode, int) {
+	if index < ql.count / 2 {
+		node := ql.head
+		for index >= len(node.entries) {
+			index -= len(node.entries)
+			node = node.next
+		}
+		return node, index
+	}
+
+	node := ql.tail
+	fromTail := ql.count - 1 - index
+	for fromTail >= len(node.entries) {
+		fromTail -= len(node.entries)
+		node = node.prev
+	}
+	return node, len(node.entries) - 1 - fromTail
+}
+
+// normalizeIndex turns a negative index, counting from the tail, into an
+// index from the head, and reports whether it is in range
+func (ql *Quicklist) normalizeIndex(index int) (int, bool) {
+	if index < 0 {
+		index += ql.count
+	}
+	return index, index >= 0 && index < ql.count
+}
+
+// Index returns the element at index. Negative indexes count from the tail,
+// -1 being the last element.
+func (ql *Quicklist) Index(index int) ([]byte, bool) {
+	index, inRange := ql.normalizeIndex(index)
+	if !inRange {
+		return nil, false
+	}
+
+	node, offset := ql.locate(index)
+	return node.entries[offset], true
+}
+
+// Set replaces the element at index, and reports whether index is in range
+func (ql *Quicklist) Set(index int, value []byte) bool {
+	index, inRange := ql.normalizeIndex(index)
+	if !inRange {
+		return false
+	}
+
+	node, offset := ql.locate(index)
+	node.size += len(value) - len(node.entries[offset])
+	node.entries[offset] = value
+	return true
+}
+
+// Insert inserts value at index, in 0..Len(), shifting the following
+// elements. A full node is split in two.
+func (ql *Quicklist) Insert(index int, value []byte) {
+	if index == ql.count {
+		ql.PushBack(value)
+		return
+	}
+
+	node, offset := ql.locate(index)
+	if !node.hasRoomFor(value) {
+		half := len(node.entries) / 2
+		split := &quicklistNode{entries: append([][]byte(nil), node.entries[half:]...)}
+		for _, entry := range split.entries {
+			split.size += len(entry)
+		}
+		clear(node.entries[half:])
+		node.entries = node.entries[:half]
+		node.size -= split.size
+		ql.insertNode(node, split)
+
+		if offset >= half {
+			node, offset = split, offset - half
+		}
+	}
+	ql.insertInNode(node, offset, value)
+}
+
+// Iterate calls fn with the elements from index start on, towards the tail or
+// the head when reverse is set, until it returns false
+func (ql *Quicklist) Iterate(start int, reverse bool, fn func(index int, value []byte) bool) {
+	start, inRange := ql.normalizeIndex(start)
+	if !inRange {
+		return
+	}
+
+	node, offset := ql.locate(start)
+	for index := start; node != nil; {
+		if !fn(index, node.entries[offset]) {
+			return
+		}
+
+		if reverse {
+			index--
+			offset--
+			if offset < 0 {
+				node = node.prev
+				if node != nil {
+					offset = len(node.entries) - 1
+				}
+			}
+		} else {
+			index++
+			offset++
+			if offset == len(node.entries) {
+				node, offset = node.next, 0
+			}
+		}
+	}
+}
+
+// Range returns the elements from index start to stop, both included, which
+// must be in range
+func (ql *Quicklist) Range(start, stop int) [][]byte {
+	values := make([][]byte, 0, stop - start + 1)
+	ql.Iterate(start, false, func(index int, value []byte) bool {
+		values = append(values, value)
+		return index < stop
+	})
+	return values
+}
+
+// Remove removes up to count elements equal to value, from the head when
+// count is positive and from the tail when negative, or all of them when
+// count is 0. It returns how many were removed.
+func (ql *Quicklist) Remove(value []byte, count int) int {
+	reverse := count < 0
+	if reverse {
+		count = -count
+	}
+
+	removed := 0
+	node := ql.head
+	if reverse {
+		node = ql.tail
+	}
+	for node != nil && (count == 0 || removed < count) {
+		next := node.next
+		if reverse {
+			next = node.prev
+		}
+
+		for i := 0; i < len(node.entries) && (count == 0 || removed < count); i++ {
+			offset := i
+			if reverse {
+				offset = len(node.entries) - 1 - i
+			}
+			if string(node.entries[offset]) == string(value) {
+				ql.deleteAt(node, offset)
+				removed++
+				if !reverse {
+					i--
+				}
+			}
+		}
+		node = next
+	}
+
+	return removed
+}
+
+// Trim keeps only the elements from index start to stop, both included,
+// which must be in range
+func (ql *Quicklist) Trim(start, stop int) {
+	for removed := 0; removed < start; {
+		node := ql.head
+		if start - removed >= len(node.entries) {
+			removed += len(node.entries)
+			ql.count -= len(node.entries)
+			ql.unlinkNode(node)
+			continue
+		}
+		ql.deleteAt(node, 0)
+		removed++
+	}
+
+	for ql.count > stop - start + 1 {
+		node := ql.tail
+		if ql.count - len(node.entries) >= stop - start + 1 {
+			ql.count -= len(node.entries)
+			ql.unlinkNode(node)
+			continue
+		}
+		ql.deleteAt(node, len(node.entries) - 1)
+	}
+}
+
+// Clone returns a copy of the list sharing no node with it
+func (ql *Quicklist) Clone() *Quicklist {
+	clone := NewQuicklist()
+	for node := ql.head; node != nil; node = node.next {
+		copied := &quicklistNode{
+			entries: append([][]byte(nil), node.entries...),
+			size:    node.size,
+		}
+		clone.insertNode(clone.tail, copied)
+	}
+	clone.count = ql.count
+	return clone
+}
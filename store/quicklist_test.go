@@ -0,0 +1,111 @@
+package store
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func quicklistValues(ql *Quicklist) []string {
+	values := make([]string, 0)
+	ql.Iterate(0, false, func(index int, value []byte) bool {
+		values = append(values, string(value))
+		return true
+	})
+	return values
+}
+
+// random operations on a quicklist and on a plain slice give the same list
+func TestQuicklist(t *testing.T) {
+	ql := NewQuicklist()
+	expected := make([]string, 0)
+	rng := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 5000; i++ {
+		value := fmt.Sprintf("v%d", rng.Intn(50))
+		if rng.Intn(20) == 0 {
+			// large values fill nodes by size rather than by count
+			value = strings.Repeat(value, 1000)
+		}
+
+		switch op := rng.Intn(8); {
+			case op < 2:
+				ql.PushFront([]byte(value))
+				expected = append([]string{value}, expected...)
+			case op < 4:
+				ql.PushBack([]byte(value))
+				expected = append(expected, value)
+			case op == 4:
+				popped, ok := ql.PopFront()
+				assert.Equal(t, len(expected) > 0, ok)
+				if ok {
+					assert.Equal(t, expected[0], string(popped))
+					expected = expected[1:]
+				}
+			case op == 5:
+				popped, ok := ql.PopBack()
+				assert.Equal(t, len(expected) > 0, ok)
+				if ok {
+					assert.Equal(t, expected[len(expected) - 1], string(popped))
+					expected = expected[:len(expected) - 1]
+				}
+			case op == 6:
+				index := rng.Intn(len(expected) + 1)
+				ql.Insert(index, []byte(value))
+				expected = append(expected[:index], append([]string{value}, expected[index:]...)...)
+			case op == 7 && len(expected) > 0:
+				index := rng.Intn(len(expected))
+				assert.True(t, ql.Set(index - len(expected), []byte(value)))
+				expected[index] = value
+		}
+		assert.Equal(t, len(expected), ql.Len())
+	}
+	assert.Equal(t, expected, quicklistValues(ql))
+
+	for i := range expected {
+		value, ok := ql.Index(i)
+		assert.True(t, ok)
+		assert.Equal(t, expected[i], string(value))
+	}
+	_, ok := ql.Index(len(expected))
+	assert.False(t, ok)
+
+	clone := ql.Clone()
+	clone.PushBack([]byte("clone"))
+	assert.Equal(t, expected, quicklistValues(ql))
+
+	assert.Equal(t, expected[10:20], toStrings(ql.Range(10, 19)))
+
+	// the last two v1 and every v2
+	removed := 0
+	for i := len(expected) - 1; i >= 0 && removed < 2; i-- {
+		if expected[i] == "v1" {
+			expected = append(expected[:i], expected[i + 1:]...)
+			removed++
+		}
+	}
+	assert.Equal(t, removed, ql.Remove([]byte("v1"), -2))
+	filtered := make([]string, 0)
+	for _, value := range expected {
+		if value != "v2" {
+			filtered = append(filtered, value)
+		}
+	}
+	assert.Equal(t, len(expected) - len(filtered), ql.Remove([]byte("v2"), 0))
+	assert.Equal(t, filtered, quicklistValues(ql))
+
+	ql.Trim(200, 299)
+	assert.Equal(t, filtered[200:300], quicklistValues(ql))
+	assert.Equal(t, 100, ql.Len())
+}
+
+func toStrings(values [][]byte) []string {
+	strs := make([]string, 0, len(values))
+	for _, value := range values {
+		strs = append(strs, string(value))
+	}
+	return strs
+}
@@ -0,0 +1,307 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+type OpCode byte
+
+const (
+	RdbEmptyFileBase64 = "UkVESVMwMDEx+glyZWRpcy12ZXIFNy4yLjD6CnJlZGlzLWJpdHPAQPoFY3RpbWXCbQi8ZfoIdXNlZC1tZW3CsMQQAPoIYW9mLWJhc2XAAP/wbjv+wP9aog=="
+
+	RdbMagic = "REDIS"
+	RdbVersionLength = 4
+
+	// OpCode
+	OpAUX 			OpCode = 0xFA
+	OpResizeDB 		OpCode = 0xFB
+	OpExpireTimeMs 	OpCode = 0xFC
+	OpExpireTime 	OpCode = 0xFD
+	OpSelectDB 		OpCode = 0xFE
+	OpEOF 			OpCode = 0xFF
+
+	// value types
+	RdbTypeString byte = 0x00
+
+	// special string encodings, flagged by the two high bits of a length
+	RdbEncInt8  = 0
+	RdbEncInt16 = 1
+	RdbEncInt32 = 2
+	RdbEncLZF   = 3
+)
+
+var ErrInvalidRdbFile = errors.New("invalid rdb file")
+
+func (s *Store) InitializeDB() {
+	fmt.Println("Initializing DB", s.Config)
+
+	file, err := os.Open(filepath.Join(s.Config.Dir, s.Config.DbFileName))
+	if err != nil {
+		fmt.Println("skipping rdb load: ", err.Error())
+		return
+	}
+	defer file.Close()
+
+	if err := s.ParseRdbFile(bufio.NewReader(file)); err != nil {
+		fmt.Println("error loading rdb file: ", err.Error())
+	}
+}
+
+// ParseRdbFile loads the string keys of an RDB file into the store, each in
+// the database selected before it. Keys and values are read by their encoded
+// length, so they may hold arbitrary bytes.
+func (s *Store) ParseRdbFile(reader *bufio.Reader) error {
+	header := make([]byte, len(RdbMagic) + RdbVersionLength)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidRdbFile, err.Error())
+	}
+	if string(header[:len(RdbMagic)]) != RdbMagic {
+		return fmt.Errorf("%w: wrong signature %q", ErrInvalidRdbFile, header)
+	}
+
+	db := s.DB(0)
+	for {
+		opCode, err := reader.ReadByte()
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidRdbFile, err.Error())
+		}
+
+		expiry := int64(-1)
+		valueType := opCode
+
+		switch OpCode(opCode) {
+			case OpEOF:
+				return nil
+
+			case OpAUX:
+				if _, err := readRdbString(reader); err != nil {
+					return err
+				}
+				if _, err := readRdbString(reader); err != nil {
+					return err
+				}
+				continue
+
+			case OpSelectDB:
+				index, _, err := readRdbLength(reader)
+				if err != nil {
+					return err
+				}
+				if index >= uint64(len(s.DBs)) {
+					return fmt.Errorf("%w: database %d is out of range, only %d are configured", ErrInvalidRdbFile, index, len(s.DBs))
+				}
+				db = s.DB(int(index))
+				continue
+
+			case OpResizeDB:
+				if _, _, err := readRdbLength(reader); err != nil {
+					return err
+				}
+				if _, _, err := readRdbLength(reader); err != nil {
+					return err
+				}
+				continue
+
+			case OpExpireTime:
+				buf, err := readRdbBytes(reader, 4)
+				if err != nil {
+					return err
+				}
+				expiry = int64(binary.LittleEndian.Uint32(buf)) * 1000
+				valueType, err = reader.ReadByte()
+				if err != nil {
+					return err
+				}
+
+			case OpExpireTimeMs:
+				buf, err := readRdbBytes(reader, 8)
+				if err != nil {
+					return err
+				}
+				expiry = int64(binary.LittleEndian.Uint64(buf))
+				valueType, err = reader.ReadByte()
+				if err != nil {
+					return err
+				}
+		}
+
+		// values of other types cannot be skipped without decoding them
+		if valueType != RdbTypeString {
+			return fmt.Errorf("%w: value type not implemented: 0x%x", ErrInvalidRdbFile, valueType)
+		}
+
+		key, err := readRdbString(reader)
+		if err != nil {
+			return err
+		}
+
+		value, err := readRdbString(reader)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("RedisRDB.Load: DB: %d, Key: %q, Value: %q, expiry: %d\n", db.ID, key, value, expiry)
+		db.Keyspace.Set(string(key), &Object{
+			Value:  value,
+			Expiration: expiry,
+		})
+	}
+}
+
+// readRdbLength decodes an RDB length. When encoded is true the value is the
+// special string encoding type instead of a length.
+func readRdbLength(reader *bufio.Reader) (length uint64, encoded bool, err error) {
+	lenByte, err := reader.ReadByte()
+	if err != nil {
+		return 0, false, err
+	}
+
+	switch lenByte >> 6 {
+		case 0b00:
+			return uint64(lenByte & 0b00111111), false, nil
+
+		case 0b01:
+			additionalByte, err := reader.ReadByte()
+			if err != nil {
+				return 0, false, err
+			}
+			return uint64(lenByte & 0b00111111) << 8 | uint64(additionalByte), false, nil
+
+		case 0b10:
+			switch lenByte {
+				case 0x80:
+					buf, err := readRdbBytes(reader, 4)
+					if err != nil {
+						return 0, false, err
+					}
+					return uint64(binary.BigEndian.Uint32(buf)), false, nil
+
+				case 0x81:
+					buf, err := readRdbBytes(reader, 8)
+					if err != nil {
+						return 0, false, err
+					}
+					return binary.BigEndian.Uint64(buf), false, nil
+			}
+			return 0, false, fmt.Errorf("%w: unknown length encoding 0x%x", ErrInvalidRdbFile, lenByte)
+
+		default:
+			return uint64(lenByte & 0b00111111), true, nil
+	}
+}
+
+func readRdbString(reader *bufio.Reader) ([]byte, error) {
+	length, encoded, err := readRdbLength(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if !encoded {
+		return readRdbBytes(reader, int(length))
+	}
+
+	switch length {
+		case RdbEncInt8:
+			buf, err := readRdbBytes(reader, 1)
+			if err != nil {
+				return nil, err
+			}
+			return []byte(strconv.FormatInt(int64(int8(buf[0])), 10)), nil
+
+		case RdbEncInt16:
+			buf, err := readRdbBytes(reader, 2)
+			if err != nil {
+				return nil, err
+			}
+			return []byte(strconv.FormatInt(int64(int16(binary.LittleEndian.Uint16(buf))), 10)), nil
+
+		case RdbEncInt32:
+			buf, err := readRdbBytes(reader, 4)
+			if err != nil {
+				return nil, err
+			}
+			return []byte(strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(buf))), 10)), nil
+
+		case RdbEncLZF:
+			compressedLength, _, err := readRdbLength(reader)
+			if err != nil {
+				return nil, err
+			}
+			length, _, err := readRdbLength(reader)
+			if err != nil {
+				return nil, err
+			}
+			compressed, err := readRdbBytes(reader, int(compressedLength))
+			if err != nil {
+				return nil, err
+			}
+			return lzfDecompress(compressed, int(length))
+	}
+
+	return nil, fmt.Errorf("%w: unknown string encoding %v", ErrInvalidRdbFile, length)
+}
+
+func readRdbBytes(reader *bufio.Reader, x int) ([]byte, error) {
+	buf := make([]byte, x)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRdbFile, err.Error())
+	}
+	return buf, nil
+}
+
+// lzfDecompress expands an LZF compressed string as written by redis
+func lzfDecompress(in []byte, length int) ([]byte, error) {
+	out := make([]byte, 0, length)
+
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+
+		if ctrl < 32 {
+			// literal run of ctrl + 1 bytes
+			ctrl++
+			if i + ctrl > len(in) {
+				return nil, fmt.Errorf("%w: corrupt lzf literal", ErrInvalidRdbFile)
+			}
+			out = append(out, in[i:i + ctrl]...)
+			i += ctrl
+			continue
+		}
+
+		// back reference
+		refLength := ctrl >> 5
+		if refLength == 7 {
+			if i >= len(in) {
+				return nil, fmt.Errorf("%w: corrupt lzf reference", ErrInvalidRdbFile)
+			}
+			refLength += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, fmt.Errorf("%w: corrupt lzf reference", ErrInvalidRdbFile)
+		}
+		ref := len(out) - ((ctrl & 0x1f) << 8) - int(in[i]) - 1
+		i++
+		if ref < 0 {
+			return nil, fmt.Errorf("%w: corrupt lzf reference", ErrInvalidRdbFile)
+		}
+
+		// copy byte by byte, the reference may overlap the output being written
+		for j := 0; j < refLength + 2; j++ {
+			out = append(out, out[ref + j])
+		}
+	}
+
+	if len(out) != length {
+		return nil, fmt.Errorf("%w: lzf length mismatch", ErrInvalidRdbFile)
+	}
+
+	return out, nil
+}
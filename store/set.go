@@ -0,0 +1,186 @@
+package store
+
+import (
+	"math/rand"
+	"slices"
+	"strconv"
+)
+
+const (
+	// DefaultSetMaxIntsetEntries is the number of members past which a set of
+	// integers converts to a hash table, as the redis set-max-intset-entries
+	// setting
+	DefaultSetMaxIntsetEntries = 512
+
+	SetEncodingIntset    = "intset"
+	SetEncodingHashtable = "hashtable"
+)
+
+// Set is an unordered collection of distinct members. Sets whose members
+// are all integers keep them in a sorted slice, like the redis intset
+// encoding: a set of IDs takes eight bytes per member and is searched in
+// O(log N). Adding a member that is not an integer, or more members than
+// the configured limit, converts the set to a Dict for good.
+//
+// It is not safe for concurrent use.
+type Set struct {
+	intset []int64
+	dict   *Dict[struct{}]
+}
+
+// NewSet() Creates a new empty Set in the intset encoding
+func NewSet() *Set {
+	return &Set{}
+}
+
+// Encoding returns the name of the encoding, as OBJECT ENCODING reports it
+func (s *Set) Encoding() string {
+	if s.dict != nil {
+		return SetEncodingHashtable
+	}
+	return SetEncodingIntset
+}
+
+// Len returns the number of members
+func (s *Set) Len() int {
+	if s.dict != nil {
+		return s.dict.Len()
+	}
+	return len(s.intset)
+}
+
+// Contains reports whether member belongs to the set
+func (s *Set) Contains(member string) bool {
+	if s.dict != nil {
+		_, exists := s.dict.Get(member)
+		return exists
+	}
+
+	value, isInt := ParseStrictInt([]byte(member))
+	if !isInt {
+		return false
+	}
+	_, found := slices.BinarySearch(s.intset, value)
+	return found
+}
+
+// Add inserts member and reports whether it was added. The set converts to
+// a hash table once it exceeds the limits of config.
+func (s *Set) Add(member string, config *EncodingConfig) bool {
+	if s.dict != nil {
+		return s.dict.Set(member, struct{}{})
+	}
+
+	value, isInt := ParseStrictInt([]byte(member))
+	if !isInt {
+		s.convert()
+		return s.dict.Set(member, struct{}{})
+	}
+
+	i, found := slices.BinarySearch(s.intset, value)
+	if found {
+		return false
+	}
+	s.intset = slices.Insert(s.intset, i, value)
+	if len(s.intset) > config.SetMaxIntsetEntries {
+		s.convert()
+	}
+	return true
+}
+
+// convert moves the members to a Dict
+func (s *Set) convert() {
+	s.dict = NewDict[struct{}]()
+	for _, value := range s.intset {
+		s.dict.Set(strconv.FormatInt(value, 10), struct{}{})
+	}
+	s.intset = nil
+}
+
+// Remove deletes member and reports whether it belonged to the set
+func (s *Set) Remove(member string) bool {
+	if s.dict != nil {
+		_, removed := s.dict.Delete(member)
+		return removed
+	}
+
+	value, isInt := ParseStrictInt([]byte(member))
+	if !isInt {
+		return false
+	}
+	i, found := slices.BinarySearch(s.intset, value)
+	if found {
+		s.intset = slices.Delete(s.intset, i, i + 1)
+	}
+	return found
+}
+
+// Range calls fn for every member until it returns false. Members of an
+// intset come in ascending order.
+func (s *Set) Range(fn func(member string) bool) {
+	if s.dict != nil {
+		s.dict.Range(func(member string, _ struct{}) bool {
+			return fn(member)
+		})
+		return
+	}
+
+	for _, value := range s.intset {
+		if !fn(strconv.FormatInt(value, 10)) {
+			return
+		}
+	}
+}
+
+// Members returns every member
+func (s *Set) Members() []string {
+	members := make([]string, 0, s.Len())
+	s.Range(func(member string) bool {
+		members = append(members, member)
+		return true
+	})
+	return members
+}
+
+// Random returns a member picked at random, and false when the set is empty
+func (s *Set) Random() (string, bool) {
+	if s.dict != nil {
+		member, _, exists := s.dict.Random()
+		return member, exists
+	}
+
+	if len(s.intset) == 0 {
+		return "", false
+	}
+	return strconv.FormatInt(s.intset[rand.Intn(len(s.intset))], 10), true
+}
+
+// Scan calls fn for the members in the buckets at cursor, like Dict.Scan.
+// An intset is returned whole, with a 0 cursor.
+func (s *Set) Scan(cursor uint64, fn func(member string)) uint64 {
+	if s.dict == nil {
+		s.Range(func(member string) bool {
+			fn(member)
+			return true
+		})
+		return 0
+	}
+
+	return s.dict.Scan(cursor, func(member string, _ struct{}) {
+		fn(member)
+	})
+}
+
+// Clone returns a copy of the set
+func (s *Set) Clone() *Set {
+	if s.dict == nil {
+		return &Set{intset: slices.Clone(s.intset)}
+	}
+
+	clone := &Set{dict: NewDict[struct{}]()}
+	s.dict.Range(func(member string, _ struct{}) bool {
+		clone.dict.Set(member, struct{}{})
+		return true
+	})
+	return clone
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSet_Encoding(t *testing.T) {
+	config := &EncodingConfig{SetMaxIntsetEntries: 4}
+
+	// integers are kept sorted, whatever the order they are added in
+	s := NewSet()
+	for _, member := range []string{"3", "-1", "10", "3"} {
+		s.Add(member, config)
+	}
+	assert.Equal(t, SetEncodingIntset, s.Encoding())
+	assert.Equal(t, []string{"-1", "3", "10"}, s.Members())
+	assert.True(t, s.Contains("10"))
+	// only the canonical form of an integer is a member
+	assert.False(t, s.Contains("010"))
+	assert.False(t, s.Remove("+3"))
+	assert.True(t, s.Remove("3"))
+
+	// a member that is not an integer converts the set
+	assert.True(t, s.Add("x", config))
+	assert.Equal(t, SetEncodingHashtable, s.Encoding())
+	assert.ElementsMatch(t, []string{"-1", "10", "x"}, s.Members())
+	assert.True(t, s.Contains("-1"))
+
+	// so do too many members
+	s = NewSet()
+	for i := 0; i < 5; i++ {
+		s.Add(fmt.Sprint(i), config)
+	}
+	assert.Equal(t, SetEncodingHashtable, s.Encoding())
+	assert.Equal(t, 5, s.Len())
+	clone := s.Clone()
+	clone.Remove("0")
+	assert.Equal(t, 5, s.Len())
+}
+
+func TestSetStore_Algebra(t *testing.T) {
+	db := NewDB(0)
+
+	db.SetStore.Add("a", []string{"1", "2", "3", "x"})
+	db.SetStore.Add("b", []string{"2", "3", "4"})
+	db.SetStore.Add("c", []string{"3", "x"})
+	db.KVStore.Set("str", []byte("v"), -1)
+
+	inter, err := db.SetStore.Inter([]string{"a", "b", "c"}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"3"}, inter)
+	inter, _ = db.SetStore.Inter([]string{"a", "missing"}, 0)
+	assert.Empty(t, inter)
+	inter, _ = db.SetStore.Inter([]string{"a", "b"}, 1)
+	assert.Equal(t, 1, len(inter))
+
+	union, _ := db.SetStore.Union([]string{"a", "b", "missing"})
+	assert.ElementsMatch(t, []string{"1", "2", "3", "4", "x"}, union)
+	diff, _ := db.SetStore.Diff([]string{"a", "b", "missing"})
+	assert.ElementsMatch(t, []string{"1", "x"}, diff)
+	diff, _ = db.SetStore.Diff([]string{"missing", "a"})
+	assert.Empty(t, diff)
+
+	// a key of another type fails even after a missing one
+	_, err = db.SetStore.Inter([]string{"missing", "str"}, 0)
+	assert.Equal(t, ErrWrongType, err)
+
+	// storing an empty result deletes the destination
+	assert.Equal(t, 0, db.SetStore.Replace("str", nil))
+	assert.Equal(t, TypeNone, db.Type("str"))
+	assert.Equal(t, 2, db.SetStore.Replace("dst", []string{"1", "1", "2"}))
+	assert.Equal(t, TypeSet, db.Type("dst"))
+}
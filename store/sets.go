@@ -0,0 +1,350 @@
+package store
+
+import (
+	"math/rand"
+	"slices"
+)
+
+// setOf returns the set of a set object, nil for a missing key
+func setOf(obj *Object) (*Set, error) {
+	if obj == nil {
+		return nil, nil
+	}
+
+	set, isSet := obj.Value.(*Set)
+	if !isSet {
+		return nil, ErrWrongType
+	}
+	return set, nil
+}
+
+// update changes the set stored at key in place with fn, which receives nil
+// when the key is missing. An empty set left by fn is deleted.
+func (ss *SetStoreImpl) update(key string, fn func(set *Set) (*Set, error)) error {
+	return ss.Keyspace.Update(key, func(obj *Object) (*Object, error) {
+		set, err := setOf(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		set, err = fn(set)
+		if err != nil {
+			return nil, err
+		}
+
+		if set == nil || set.Len() == 0 {
+			return nil, nil
+		}
+		if obj != nil && obj.Value == set {
+			return obj, nil
+		}
+		return &Object{
+			Value:      set,
+			Expiration: -1,
+		}, nil
+	})
+}
+
+// view calls fn with the set stored at key, nil when the key is missing
+func (ss *SetStoreImpl) view(key string, fn func(set *Set) error) error {
+	return ss.Keyspace.View(key, func(obj *Object) error {
+		set, err := setOf(obj)
+		if err != nil {
+			return err
+		}
+		return fn(set)
+	})
+}
+
+// Add inserts members in the set stored at key, creating it when missing,
+// and returns how many were not already members
+func (ss *SetStoreImpl) Add(key string, members []string) (int, error) {
+	added := 0
+
+	err := ss.update(key, func(set *Set) (*Set, error) {
+		if set == nil {
+			set = NewSet()
+		}
+		for _, member := range members {
+			if set.Add(member, ss.Config) {
+				added++
+			}
+		}
+		return set, nil
+	})
+
+	return added, err
+}
+
+// Remove deletes members from the set stored at key, deleting it once it
+// has none left, and returns how many were members
+func (ss *SetStoreImpl) Remove(key string, members []string) (int, error) {
+	removed := 0
+
+	err := ss.update(key, func(set *Set) (*Set, error) {
+		if set == nil {
+			return nil, nil
+		}
+		for _, member := range members {
+			if set.Remove(member) {
+				removed++
+			}
+		}
+		return set, nil
+	})
+
+	return removed, err
+}
+
+// Members returns the members of the set stored at key
+func (ss *SetStoreImpl) Members(key string) ([]string, error) {
+	members := make([]string, 0)
+
+	err := ss.view(key, func(set *Set) error {
+		if set != nil {
+			members = set.Members()
+		}
+		return nil
+	})
+
+	return members, err
+}
+
+// IsMember reports for each of members whether it belongs to the set stored
+// at key
+func (ss *SetStoreImpl) IsMember(key string, members []string) ([]bool, error) {
+	found := make([]bool, len(members))
+
+	err := ss.view(key, func(set *Set) error {
+		if set == nil {
+			return nil
+		}
+		for i, member := range members {
+			found[i] = set.Contains(member)
+		}
+		return nil
+	})
+
+	return found, err
+}
+
+// Card returns the number of members of the set stored at key
+func (ss *SetStoreImpl) Card(key string) (int, error) {
+	length := 0
+
+	err := ss.view(key, func(set *Set) error {
+		if set != nil {
+			length = set.Len()
+		}
+		return nil
+	})
+
+	return length, err
+}
+
+// Pop removes up to count members picked at random from the set stored at
+// key and returns them, nil when the key is missing
+func (ss *SetStoreImpl) Pop(key string, count int) ([]string, error) {
+	var popped []string
+
+	err := ss.update(key, func(set *Set) (*Set, error) {
+		if set == nil {
+			return nil, nil
+		}
+
+		popped = make([]string, 0, min(count, set.Len()))
+		if count >= set.Len() {
+			popped = append(popped, set.Members()...)
+			return nil, nil
+		}
+		for len(popped) < count {
+			member, _ := set.Random()
+			set.Remove(member)
+			popped = append(popped, member)
+		}
+		return set, nil
+	})
+
+	return popped, err
+}
+
+// RandomMembers returns count members of the set stored at key picked at
+// random. Members are distinct, so fewer are returned when the set is
+// smaller, unless allowDuplicates is set.
+func (ss *SetStoreImpl) RandomMembers(key string, count int, allowDuplicates bool) ([]string, error) {
+	picked := make([]string, 0)
+
+	err := ss.view(key, func(set *Set) error {
+		if set == nil || count == 0 {
+			return nil
+		}
+
+		if allowDuplicates {
+			for i := 0; i < count; i++ {
+				member, _ := set.Random()
+				picked = append(picked, member)
+			}
+			return nil
+		}
+
+		picked = set.Members()
+		rand.Shuffle(len(picked), func(i, j int) {
+			picked[i], picked[j] = picked[j], picked[i]
+		})
+		picked = picked[:min(count, len(picked))]
+		return nil
+	})
+
+	return picked, err
+}
+
+// Move moves member from the set stored at src to the set stored at dst,
+// creating it when missing, and reports whether member belonged to src.
+// Nothing is checked when src is missing; otherwise dst must hold a set or
+// be missing.
+func (ss *SetStoreImpl) Move(src, dst string, member string) (bool, error) {
+	srcExists := false
+	err := ss.view(src, func(set *Set) error {
+		srcExists = set != nil
+		return nil
+	})
+	if err != nil || !srcExists {
+		return false, err
+	}
+	if err := ss.view(dst, func(set *Set) error { return nil }); err != nil {
+		return false, err
+	}
+
+	if src == dst {
+		found, err := ss.IsMember(src, []string{member})
+		return found[0], err
+	}
+
+	moved := false
+	err = ss.update(src, func(set *Set) (*Set, error) {
+		if set != nil {
+			moved = set.Remove(member)
+		}
+		return set, nil
+	})
+	if err != nil || !moved {
+		return false, err
+	}
+
+	_, err = ss.Add(dst, []string{member})
+	return true, err
+}
+
+// snapshot returns a copy of the sets stored at keys, nil for the missing
+// ones, so they can be combined without holding the lock of every key.
+// Every key must hold a set or be missing.
+func (ss *SetStoreImpl) snapshot(keys []string) ([]*Set, error) {
+	sets := make([]*Set, len(keys))
+	for i, key := range keys {
+		err := ss.view(key, func(set *Set) error {
+			if set != nil {
+				sets[i] = set.Clone()
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sets, nil
+}
+
+// Inter returns the members of every set stored at keys, stopping after
+// limit members unless limit is 0. A missing key is an empty set.
+func (ss *SetStoreImpl) Inter(keys []string, limit int) ([]string, error) {
+	sets, err := ss.snapshot(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]string, 0)
+	if slices.Contains(sets, nil) {
+		return members, nil
+	}
+
+	// iterate the smallest set, checking the others from the smallest
+	slices.SortFunc(sets, func(a, b *Set) int { return a.Len() - b.Len() })
+	sets[0].Range(func(member string) bool {
+		for _, set := range sets[1:] {
+			if !set.Contains(member) {
+				return true
+			}
+		}
+		members = append(members, member)
+		return limit == 0 || len(members) < limit
+	})
+	return members, nil
+}
+
+// Union returns the members of any set stored at keys
+func (ss *SetStoreImpl) Union(keys []string) ([]string, error) {
+	sets, err := ss.snapshot(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]string, 0)
+	seen := make(map[string]struct{})
+	for _, set := range sets {
+		if set == nil {
+			continue
+		}
+		set.Range(func(member string) bool {
+			if _, exists := seen[member]; !exists {
+				seen[member] = struct{}{}
+				members = append(members, member)
+			}
+			return true
+		})
+	}
+	return members, nil
+}
+
+// Diff returns the members of the set stored at the first key that are not
+// members of the sets stored at the other keys
+func (ss *SetStoreImpl) Diff(keys []string) ([]string, error) {
+	sets, err := ss.snapshot(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]string, 0)
+	if sets[0] == nil {
+		return members, nil
+	}
+	sets[0].Range(func(member string) bool {
+		for _, set := range sets[1:] {
+			if set != nil && set.Contains(member) {
+				return true
+			}
+		}
+		members = append(members, member)
+		return true
+	})
+	return members, nil
+}
+
+// Replace stores a set of members at dst, replacing any previous value
+// whatever its type, or deletes dst when members is empty. It returns the
+// number of members stored.
+func (ss *SetStoreImpl) Replace(dst string, members []string) int {
+	if len(members) == 0 {
+		ss.Keyspace.Delete(dst)
+		return 0
+	}
+
+	set := NewSet()
+	for _, member := range members {
+		set.Add(member, ss.Config)
+	}
+	ss.Keyspace.Set(dst, &Object{
+		Value:      set,
+		Expiration: -1,
+	})
+	return set.Len()
+}
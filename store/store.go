@@ -1,69 +1,308 @@
 package store
 
+import "errors"
+
+// ErrWrongType is returned when a key holds a value of another type than the
+// one the operation works on
+var ErrWrongType = errors.New("key holds the wrong kind of value")
+
+// errors of the counter operations, worded as the replies sent to clients
+var (
+	ErrNotInteger = errors.New("value is not an integer or out of range")
+	ErrNotFloat = errors.New("value is not a valid float")
+	ErrOverflow = errors.New("increment or decrement would overflow")
+	ErrNaNOrInfinity = errors.New("increment would produce NaN or Infinity")
+)
+
+// errors of the list operations, worded as the replies sent to clients
+var (
+	ErrNoSuchKey = errors.New("no such key")
+	ErrIndexOutOfRange = errors.New("index out of range")
+)
+
+// type names as reported by TYPE
+const (
+	TypeNone   = "none"
+	TypeString = "string"
+	TypeList   = "list"
+	TypeSet    = "set"
+	TypeZSet   = "zset"
+	TypeHash   = "hash"
+	TypeStream = "stream"
+)
+
+// TypeNames are the names TYPE replies with for existing keys
+var TypeNames = []string{TypeString, TypeList, TypeSet, TypeZSet, TypeHash, TypeStream}
+
 type StoreIFace interface {
 	InitializeDB()
-	Set(key string, value string, expiration int64) error
-	Get(key string) (interface{}, error)
+	Set(key string, value []byte, expiration int64) error
+	Get(key string) ([]byte, bool)
 	GetKeys() []string
 }
 
-type Values struct {
-	Value      string
-	Expiration int64
-}
-
 type StreamValues struct {
 	ID    string
 	Entry []StreamEntry
 }
 
 type StreamEntry struct {
-	Key   string
-	Value string
+	Key   []byte
+	Value []byte
 }
 
-type KVDataStore map[string]*Values
-
-type StreamDataStore map[string][]StreamValues
-
 type RDBConfig struct {
 	Dir        string
 	DbFileName string
 }
 
+// DefaultDatabases is the number of logical databases when none is configured
+const DefaultDatabases = 16
+
+// EncodingConfig holds the limits past which small aggregates convert from
+// their compact encoding to a hash table, and sparse HyperLogLogs to dense
+// ones
+type EncodingConfig struct {
+	HashMaxListpackEntries int
+	HashMaxListpackValue   int
+	SetMaxIntsetEntries    int
+	HllSparseMaxBytes      int
+}
+
+// DefaultEncodingConfig are the limits redis uses by default
+var DefaultEncodingConfig = EncodingConfig{
+	HashMaxListpackEntries: DefaultHashMaxListpackEntries,
+	HashMaxListpackValue:   DefaultHashMaxListpackValue,
+	SetMaxIntsetEntries:    DefaultSetMaxIntsetEntries,
+	HllSparseMaxBytes:      DefaultHllSparseMaxBytes,
+}
+
 type StoreOpts struct {
 	Config RDBConfig
+	// Databases is the number of logical databases, selected by index
+	Databases int
+	// Encoding defaults to DefaultEncodingConfig when left empty
+	Encoding EncodingConfig
 }
 
+// Store holds the logical databases, numbered from 0
 type Store struct {
+	StoreOpts
+	DBs []*DB
+}
+
+// DB gives typed access to a keyspace shared by every value type, so a key
+// holds a single value whatever its type
+type DB struct {
+	ID          int
+	Keyspace    *Keyspace
 	KVStore     KVStoreImpl
+	ListStore   ListStoreImpl
+	HashStore   HashStoreImpl
+	SetStore    SetStoreImpl
+	ZSetStore   ZSetStoreImpl
 	StreamStore StreamDataStoreImpl
 }
 
 type KVStoreImpl struct {
-	StoreOpts
-	DataStore KVDataStore
+	Keyspace *Keyspace
+	Config   *EncodingConfig
 }
 
-type StreamDataStoreImpl struct {
-	StoreOpts
-	DataStore StreamDataStore
+type ListStoreImpl struct {
+	Keyspace *Keyspace
 }
 
-type KVStore struct {
-	StoreOpts
-	KVStore KVDataStore
+type HashStoreImpl struct {
+	Keyspace *Keyspace
+	Config   *EncodingConfig
+}
+
+type SetStoreImpl struct {
+	Keyspace *Keyspace
+	Config   *EncodingConfig
+}
+
+type ZSetStoreImpl struct {
+	Keyspace *Keyspace
+}
+
+type StreamDataStoreImpl struct {
+	Keyspace *Keyspace
 }
 
 func NewStore(opts StoreOpts) Store {
+	if opts.Databases <= 0 {
+		opts.Databases = DefaultDatabases
+	}
+	if opts.Encoding == (EncodingConfig{}) {
+		opts.Encoding = DefaultEncodingConfig
+	}
+
+	dbs := make([]*DB, opts.Databases)
+	for i := range dbs {
+		dbs[i] = newDB(i, &opts.Encoding)
+	}
+
 	return Store{
+		StoreOpts: opts,
+		DBs: dbs,
+	}
+}
+
+// NewDB() Creates a new empty DB with the default encoding limits
+func NewDB(id int) *DB {
+	config := DefaultEncodingConfig
+	return newDB(id, &config)
+}
+
+func newDB(id int, config *EncodingConfig) *DB {
+	keyspace := NewKeyspace()
+
+	return &DB{
+		ID: id,
+		Keyspace: keyspace,
 		KVStore: KVStoreImpl{
-			StoreOpts: opts,
-			DataStore: make(KVDataStore),
+			Keyspace: keyspace,
+			Config: config,
+		},
+		ListStore: ListStoreImpl{
+			Keyspace: keyspace,
+		},
+		HashStore: HashStoreImpl{
+			Keyspace: keyspace,
+			Config: config,
+		},
+		SetStore: SetStoreImpl{
+			Keyspace: keyspace,
+			Config: config,
+		},
+		ZSetStore: ZSetStoreImpl{
+			Keyspace: keyspace,
 		},
 		StreamStore: StreamDataStoreImpl{
-			StoreOpts: opts,
-			DataStore: make(StreamDataStore),
+			Keyspace: keyspace,
 		},
 	}
 }
+
+// DB returns the database at index, which callers must have validated
+func (s *Store) DB(index int) *DB {
+	return s.DBs[index]
+}
+
+// ValidDB reports whether index names one of the databases
+func (s *Store) ValidDB(index int) bool {
+	return index >= 0 && index < len(s.DBs)
+}
+
+// SwapDB exchanges the contents of two databases, so clients connected to
+// one of them see the data of the other
+func (s *Store) SwapDB(i, j int) {
+	s.DBs[i], s.DBs[j] = s.DBs[j], s.DBs[i]
+	s.DBs[i].ID, s.DBs[j].ID = i, j
+}
+
+// FlushAll removes every key of every database
+func (s *Store) FlushAll() {
+	for _, db := range s.DBs {
+		db.Keyspace.Flush()
+	}
+}
+
+// Type returns the type name of the value stored at key
+func (db *DB) Type(key string) string {
+	obj, exists := db.Keyspace.Lookup(key)
+	if !exists {
+		return TypeNone
+	}
+	return TypeOf(obj)
+}
+
+// Clone returns a copy of an object that shares nothing mutable with it, so
+// either can be written to without affecting the other
+func (o *Object) Clone() *Object {
+	clone := &Object{
+		Value:      o.Value,
+		Expiration: o.Expiration,
+	}
+
+	switch value := o.Value.(type) {
+		case []byte:
+			clone.Value = append([]byte(nil), value...)
+		case *Quicklist:
+			clone.Value = value.Clone()
+		case *Hash:
+			clone.Value = value.Clone()
+		case *Set:
+			clone.Value = value.Clone()
+		case *ZSet:
+			clone.Value = value.Clone()
+		case []StreamValues:
+			// appends may reuse the spare capacity of the backing array
+			clone.Value = append([]StreamValues(nil), value...)
+	}
+	return clone
+}
+
+// FreeEffort estimates the work releasing the value of obj takes, the way
+// redis decides whether to release a value in the background: the number of
+// elements of an aggregate, and 1 for a string
+func FreeEffort(obj *Object) int {
+	switch value := obj.Value.(type) {
+		case *Quicklist:
+			return value.Len()
+		case *Hash:
+			return value.rawLen()
+		case *Set:
+			return value.Len()
+		case *ZSet:
+			return value.Len()
+		case []StreamValues:
+			return len(value)
+	}
+	return 1
+}
+
+// Release drops the contents of obj, which must no longer be reachable from
+// a keyspace, walking its containers so that nothing is left for the garbage
+// collector to trace through. It takes time proportional to FreeEffort.
+func Release(obj *Object) {
+	switch value := obj.Value.(type) {
+		case *Quicklist:
+			value.release()
+		case *Hash:
+			if value.dict != nil {
+				value.dict.release()
+			}
+			*value = Hash{}
+		case *Set:
+			if value.dict != nil {
+				value.dict.release()
+			}
+			*value = Set{}
+		case *ZSet:
+			value.dict.release()
+			value.zsl = newZskiplist()
+	}
+	obj.Value = nil
+}
+
+// TypeOf returns the type name of an object
+func TypeOf(obj *Object) string {
+	switch obj.Value.(type) {
+		case []byte, int64:
+			return TypeString
+		case *Quicklist:
+			return TypeList
+		case *Hash:
+			return TypeHash
+		case *Set:
+			return TypeSet
+		case *ZSet:
+			return TypeZSet
+		case []StreamValues:
+			return TypeStream
+	}
+	return TypeNone
+}
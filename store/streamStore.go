@@ -12,43 +12,101 @@ import (
 var ErrInvalidEntryID = errors.New("entry ID is invalid")
 
 func (s *StreamDataStoreImpl) Set(streamKey string, entryID string, entry []StreamEntry) error {
-
-	val, exists := s.DataStore[streamKey]; if exists {
-		prevEntry := val[len(val)-1]
-		err := validateEntryID(prevEntry.ID, entryID)
+	return s.Keyspace.Update(streamKey, func(obj *Object) (*Object, error) {
+		val, err := streamOf(obj)
 		if err != nil {
-			return err
+			return nil, err
 		}
-	}
 
-	streamVal := StreamValues{
-		ID: entryID,
-		Entry: entry,
-	}
+		if len(val) > 0 {
+			prevEntry := val[len(val)-1]
+			err := validateEntryID(prevEntry.ID, entryID)
+			if err != nil {
+				return nil, err
+			}
+		}
 
-	s.DataStore[streamKey] = append(s.DataStore[streamKey], streamVal)
-	return nil
+		streamVal := StreamValues{
+			ID: entryID,
+			Entry: entry,
+		}
+
+		return appendStream(obj, val, streamVal), nil
+	})
 }
 
+// SetEntry appends an entry to the stream, generating the parts of entryID
+// given as *. It returns the ID the entry was stored with.
 func (s *StreamDataStoreImpl) SetEntry(streamKey string, entryID string, entry []StreamEntry) (string, error) {
+	var updatedEntryID string
 
-	var prevEntryID string
-	val, exists := s.DataStore[streamKey]; if exists {
-		prevEntryID = val[len(val)-1].ID
-	}
+	err := s.Keyspace.Update(streamKey, func(obj *Object) (*Object, error) {
+		val, err := streamOf(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		var prevEntryID string
+		if len(val) > 0 {
+			prevEntryID = val[len(val)-1].ID
+		}
 
-	updatedEntryID, err := getUpdatedEntryID(prevEntryID, entryID)
+		updatedEntryID, err = getUpdatedEntryID(prevEntryID, entryID)
+		if err != nil {
+			return nil, err
+		}
+
+		streamVal := StreamValues{
+			ID: updatedEntryID,
+			Entry: entry,
+		}
+
+		return appendStream(obj, val, streamVal), nil
+	})
 	if err != nil {
 		return "", err
 	}
 
-	streamVal := StreamValues{
-		ID: updatedEntryID,
-		Entry: entry,
+	return updatedEntryID, nil
+}
+
+// streamOf returns the entries of a stream object, nil for a missing key
+func streamOf(obj *Object) ([]StreamValues, error) {
+	if obj == nil {
+		return nil, nil
 	}
 
-	s.DataStore[streamKey] = append(s.DataStore[streamKey], streamVal)
-	return updatedEntryID, nil
+	val, isStream := obj.Value.([]StreamValues)
+	if !isStream {
+		return nil, ErrWrongType
+	}
+	return val, nil
+}
+
+// appendStream returns a new object holding the stream with streamVal appended.
+// Readers may still hold the previous slice, which only ever sees its own
+// length, so appending in place to the shared backing array is safe.
+func appendStream(obj *Object, val []StreamValues, streamVal StreamValues) *Object {
+	var expiration int64 = -1
+	if obj != nil {
+		expiration = obj.Expiration
+	}
+
+	return &Object{
+		Value: append(val, streamVal),
+		Expiration: expiration,
+	}
+}
+
+// lookup returns the entries of the stream stored at streamKey
+func (s *StreamDataStoreImpl) lookup(streamKey string) ([]StreamValues, bool) {
+	obj, exists := s.Keyspace.Lookup(streamKey)
+	if !exists {
+		return nil, false
+	}
+
+	val, isStream := obj.Value.([]StreamValues)
+	return val, isStream
 }
 
 // func (s *StreamDataStoreImpl) Get(key string) (interface{}, error) {
@@ -66,7 +124,7 @@ func (s *StreamDataStoreImpl) SetEntry(streamKey string, entryID string, entry [
 // }
 
 func (s *StreamDataStoreImpl) GetStream(streamKey string) ([]StreamValues, error) {
-	val, exists := s.DataStore[streamKey]; if !exists {
+	val, exists := s.lookup(streamKey); if !exists {
 		return nil, nil
 	}
 
@@ -74,7 +132,7 @@ func (s *StreamDataStoreImpl) GetStream(streamKey string) ([]StreamValues, error
 }
 
 func (s *StreamDataStoreImpl) GetEntry(streamKey string, entryID string) StreamValues {
-	val, exists := s.DataStore[streamKey]; if !exists {
+	val, exists := s.lookup(streamKey); if !exists {
 		return StreamValues{}
 	}
 
@@ -103,60 +161,32 @@ func (s *StreamDataStoreImpl) GetEntryRange(streamKey string, startEntryID strin
 		return nil
 	}
 
-	streamValues, exists := s.DataStore[streamKey]; if !exists {
+	streamValues, exists := s.lookup(streamKey); if !exists {
 		return nil
 	}
 
 	resp := make([]StreamValues, 0)
 
-	startTs, startSeq := parseEntryID(startEntryID)
-	endTs, endSeq := parseEntryID(endEntryID)
-
 	for _, val := range streamValues {
-		currTs, currSeq := parseEntryID(val.ID)
-
-		if (startTs <= currTs && currTs <= endTs) {
-			if startTs == endTs && startSeq <= currSeq && currSeq <= endSeq {
-				resp = append(resp, val)
-			} else if startTs != endTs && startTs == currTs && startSeq <= currSeq {
-				resp = append(resp, val)
-			} else if startTs != endTs && currTs == endTs && currSeq <= endSeq {
-				resp = append(resp, val)
-			}
+		if compareEntryIDs(startEntryID, val.ID) <= 0 && compareEntryIDs(val.ID, endEntryID) <= 0 {
+			resp = append(resp, val)
 		}
 	}
 	
 	return resp
 }
 
+// ReadEntry returns the entries of the stream with IDs greater than startEntryID
 func (s *StreamDataStoreImpl) ReadEntry(streamKey string, startEntryID string) []StreamValues {
-	startTs, startSeq := parseEntryID(startEntryID)
-	endEntryID := fmt.Sprintf("%v-%v", startTs, time.Now().UnixMilli())
-
-	err := validateEntryID(startEntryID, endEntryID)
-	if err != nil {
-		return nil
-	}
-
-	streamValues, exists := s.DataStore[streamKey]; if !exists {
+	streamValues, exists := s.lookup(streamKey); if !exists {
 		return nil
 	}
 
 	resp := make([]StreamValues, 0)
 
-	endTs, endSeq := parseEntryID(endEntryID)
-
 	for _, val := range streamValues {
-		currTs, currSeq := parseEntryID(val.ID)
-
-		if (startTs <= currTs && currTs <= endTs) {
-			if startTs == endTs && startSeq < currSeq && currSeq < endSeq {
-				resp = append(resp, val)
-			} else if startTs != endTs && startTs == currTs && startSeq < currSeq {
-				resp = append(resp, val)
-			} else if startTs != endTs && currTs == endTs && currSeq < endSeq {
-				resp = append(resp, val)
-			}
+		if compareEntryIDs(startEntryID, val.ID) < 0 {
+			resp = append(resp, val)
 		}
 	}
 
@@ -164,7 +194,7 @@ func (s *StreamDataStoreImpl) ReadEntry(streamKey string, startEntryID string) [
 }
 
 func (s *StreamDataStoreImpl) GetTopItemEntryID(streamKey string) string {
-	values, exists := s.DataStore[streamKey]
+	values, exists := s.lookup(streamKey)
 	if !exists {
 		fmt.Println("stream does not exist")
 		return "0-1"
@@ -192,7 +222,14 @@ func getUpdatedEntryID(prevEntryID string, entryID string) (string, error) {
 
 	currTs, currSeq := parseEntryID(entryID)
 	if currTs == math.MaxInt {
-		return fmt.Sprintf("%v-0", time.Now().UnixMilli()), nil
+		// entries added within the same millisecond get increasing sequence numbers
+		now := int(time.Now().UnixMilli())
+		if prevEntryID != "" {
+			if prevTs, prevSeq := parseEntryID(prevEntryID); prevTs >= now {
+				return fmt.Sprintf("%v-%v", prevTs, prevSeq + 1), nil
+			}
+		}
+		return fmt.Sprintf("%v-0", now), nil
 	}
 	
 	if currTs == 0 && currSeq == math.MaxInt {
@@ -242,6 +279,20 @@ func parseEntryID(entryID string) (int, int) {
 	return timestamp, sequenceNum
 }
 
+// compareEntryIDs returns -1, 0 or 1 as a is smaller than, equal to or greater than b
+func compareEntryIDs(a, b string) int {
+	aTs, aSeq := parseEntryID(a)
+	bTs, bSeq := parseEntryID(b)
+
+	switch {
+		case aTs < bTs || (aTs == bTs && aSeq < bSeq):
+			return -1
+		case aTs == bTs && aSeq == bSeq:
+			return 0
+	}
+	return 1
+}
+
 func validateEntryID(prevEntryID, entryID string) error {
 	if prevEntryID == "" {
 		return nil
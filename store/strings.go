@@ -0,0 +1,114 @@
+package store
+
+// GetString returns the string stored at key, failing with ErrWrongType when
+// the key holds another type
+func (kv *KVStoreImpl) GetString(key string) (value []byte, exists bool, err error) {
+	obj, exists := kv.Keyspace.Lookup(key)
+	if !exists {
+		return nil, false, nil
+	}
+
+	value, isString := stringValue(obj)
+	if !isString {
+		return nil, false, ErrWrongType
+	}
+	return value, true, nil
+}
+
+// Append appends suffix to the string stored at key, creating it when it is
+// missing, and returns the new length. The expiration of the key is kept.
+func (kv *KVStoreImpl) Append(key string, suffix []byte) (int, error) {
+	return kv.updateString(key, func(value []byte) []byte {
+		updated := make([]byte, len(value) + len(suffix))
+		copy(updated, value)
+		copy(updated[len(value):], suffix)
+		return updated
+	})
+}
+
+// SetRange overwrites the string stored at key from offset on with value,
+// padding it with zero bytes when it is shorter than offset, and returns the
+// new length. An empty value leaves the key untouched.
+func (kv *KVStoreImpl) SetRange(key string, offset int, value []byte) (int, error) {
+	if len(value) == 0 {
+		current, _, err := kv.GetString(key)
+		return len(current), err
+	}
+
+	return kv.updateString(key, func(current []byte) []byte {
+		length := max(len(current), offset + len(value))
+		updated := make([]byte, length)
+		copy(updated, current)
+		copy(updated[offset:], value)
+		return updated
+	})
+}
+
+// updateString replaces the string stored at key, or an empty string when it
+// is missing, with the result of fn, keeping its expiration. It returns the
+// length of the new value.
+func (kv *KVStoreImpl) updateString(key string, fn func(value []byte) []byte) (int, error) {
+	var length int
+
+	err := kv.Keyspace.Update(key, func(obj *Object) (*Object, error) {
+		var current []byte
+		expiration := int64(-1)
+
+		if obj != nil {
+			value, isString := stringValue(obj)
+			if !isString {
+				return nil, ErrWrongType
+			}
+			current, expiration = value, obj.Expiration
+		}
+
+		updated := fn(current)
+		length = len(updated)
+		return &Object{
+			Value:      updated,
+			Expiration: expiration,
+		}, nil
+	})
+
+	return length, err
+}
+
+// GetDel deletes the string stored at key and returns it
+func (kv *KVStoreImpl) GetDel(key string) (value []byte, exists bool, err error) {
+	err = kv.Keyspace.Update(key, func(obj *Object) (*Object, error) {
+		if obj == nil {
+			return nil, nil
+		}
+
+		current, isString := stringValue(obj)
+		if !isString {
+			return nil, ErrWrongType
+		}
+		value, exists = current, true
+		return nil, nil
+	})
+
+	return value, exists, err
+}
+
+// GetEx returns the string stored at key and sets its absolute expiration in
+// unix milliseconds, or removes it when expiration is -1
+func (kv *KVStoreImpl) GetEx(key string, expiration int64) (value []byte, exists bool, err error) {
+	err = kv.Keyspace.Update(key, func(obj *Object) (*Object, error) {
+		if obj == nil {
+			return nil, nil
+		}
+
+		current, isString := stringValue(obj)
+		if !isString {
+			return nil, ErrWrongType
+		}
+		value, exists = current, true
+		return &Object{
+			Value:      obj.Value,
+			Expiration: expiration,
+		}, nil
+	})
+
+	return value, exists, err
+}
@@ -0,0 +1,529 @@
+package store
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ZSkiplistMaxLevel is enough for 2^64 elements, and ZSkiplistP the
+	// probability a node reaches the next level, as in redis
+	ZSkiplistMaxLevel = 32
+	ZSkiplistP        = 0.25
+
+	ZSetEncodingSkiplist = "skiplist"
+)
+
+// ZSet is a sorted set: distinct members ordered by score, then by member
+// when scores are equal. A Dict maps members to their score, and a skiplist
+// keeps them in order, where every link records how many nodes it spans so
+// ranks are found in O(log N) too.
+//
+// It is not safe for concurrent use.
+type ZSet struct {
+	dict *Dict[float64]
+	zsl  *zskiplist
+}
+
+// ZMember is a member of a sorted set with its score
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+type zskiplist struct {
+	header *zskiplistNode
+	tail   *zskiplistNode
+	length int
+	level  int
+}
+
+type zskiplistNode struct {
+	member   string
+	score    float64
+	backward *zskiplistNode
+	level    []zskiplistLevel
+}
+
+type zskiplistLevel struct {
+	forward *zskiplistNode
+	// span is the number of nodes between this node and forward, counting
+	// forward itself
+	span int
+}
+
+// NewZSet() Creates a new empty ZSet
+func NewZSet() *ZSet {
+	return &ZSet{
+		dict: NewDict[float64](),
+		zsl:  newZskiplist(),
+	}
+}
+
+func newZskiplist() *zskiplist {
+	return &zskiplist{
+		header: &zskiplistNode{level: make([]zskiplistLevel, ZSkiplistMaxLevel)},
+		level:  1,
+	}
+}
+
+// randomLevel returns the level of a new node, levels being exponentially
+// less likely
+func randomLevel() int {
+	level := 1
+	for level < ZSkiplistMaxLevel && rand.Float64() < ZSkiplistP {
+		level++
+	}
+	return level
+}
+
+// before reports whether node comes before the element of score and member
+func (node *zskiplistNode) before(score float64, member string) bool {
+	return node.score < score || (node.score == score && node.member < member)
+}
+
+// insert adds a member that is not in the skiplist yet
+func (zsl *zskiplist) insert(score float64, member string) {
+	var update [ZSkiplistMaxLevel]*zskiplistNode
+	var rank [ZSkiplistMaxLevel]int
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		if i < zsl.level - 1 {
+			rank[i] = rank[i + 1]
+		}
+		for x.level[i].forward != nil && x.level[i].forward.before(score, member) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	level := randomLevel()
+	if level > zsl.level {
+		for i := zsl.level; i < level; i++ {
+			update[i] = zsl.header
+			update[i].level[i].span = zsl.length
+		}
+		zsl.level = level
+	}
+
+	x = &zskiplistNode{member: member, score: score, level: make([]zskiplistLevel, level)}
+	for i := 0; i < level; i++ {
+		x.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = x
+		x.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = rank[0] - rank[i] + 1
+	}
+	// the levels above the new node now span one more node
+	for i := level; i < zsl.level; i++ {
+		update[i].level[i].span++
+	}
+
+	if update[0] != zsl.header {
+		x.backward = update[0]
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x
+	} else {
+		zsl.tail = x
+	}
+	zsl.length++
+}
+
+// delete removes the element of score and member, and reports whether it
+// was found
+func (zsl *zskiplist) delete(score float64, member string) bool {
+	var update [ZSkiplistMaxLevel]*zskiplistNode
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && x.level[i].forward.before(score, member) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.level[0].forward
+	if x == nil || x.score != score || x.member != member {
+		return false
+	}
+
+	for i := 0; i < zsl.level; i++ {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		zsl.tail = x.backward
+	}
+	for zsl.level > 1 && zsl.header.level[zsl.level - 1].forward == nil {
+		zsl.level--
+	}
+	zsl.length--
+	return true
+}
+
+// rank returns the 1-based rank of the element of score and member, 0 when
+// it is missing
+func (zsl *zskiplist) rank(score float64, member string) int {
+	rank := 0
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil &&
+			(x.level[i].forward.before(score, member) || (x.level[i].forward.score == score && x.level[i].forward.member == member)) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+		if x != zsl.header && x.member == member {
+			return rank
+		}
+	}
+	return 0
+}
+
+// byRank returns the node at a 1-based rank, nil when out of range
+func (zsl *zskiplist) byRank(rank int) *zskiplistNode {
+	traversed := 0
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed + x.level[i].span <= rank {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		if traversed == rank && x != zsl.header {
+			return x
+		}
+	}
+	return nil
+}
+
+// zrangeSpec is a range of a skiplist, by score or by member
+type zrangeSpec interface {
+	// gteMin and lteMax report whether node is past the start of the range
+	// and before its end
+	gteMin(node *zskiplistNode) bool
+	lteMax(node *zskiplistNode) bool
+}
+
+// firstInRange returns the first node in spec, nil when there is none
+func (zsl *zskiplist) firstInRange(spec zrangeSpec) *zskiplistNode {
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !spec.gteMin(x.level[i].forward) {
+			x = x.level[i].forward
+		}
+	}
+
+	x = x.level[0].forward
+	if x == nil || !spec.lteMax(x) {
+		return nil
+	}
+	return x
+}
+
+// lastInRange returns the last node in spec, nil when there is none
+func (zsl *zskiplist) lastInRange(spec zrangeSpec) *zskiplistNode {
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && spec.lteMax(x.level[i].forward) {
+			x = x.level[i].forward
+		}
+	}
+
+	if x == zsl.header || !spec.gteMin(x) {
+		return nil
+	}
+	return x
+}
+
+// ScoreRange is a range of scores, each end included unless it is exclusive
+type ScoreRange struct {
+	Min, Max                   float64
+	MinExclusive, MaxExclusive bool
+}
+
+func (r ScoreRange) gteMin(node *zskiplistNode) bool {
+	if r.MinExclusive {
+		return node.score > r.Min
+	}
+	return node.score >= r.Min
+}
+
+func (r ScoreRange) lteMax(node *zskiplistNode) bool {
+	if r.MaxExclusive {
+		return node.score < r.Max
+	}
+	return node.score <= r.Max
+}
+
+// ParseScoreRange parses the ends of a range of scores, such as (1 or -inf
+func ParseScoreRange(minArg, maxArg []byte) (ScoreRange, bool) {
+	var r ScoreRange
+	var ok bool
+	if r.Min, r.MinExclusive, ok = parseScoreBound(minArg); !ok {
+		return r, false
+	}
+	r.Max, r.MaxExclusive, ok = parseScoreBound(maxArg)
+	return r, ok
+}
+
+func parseScoreBound(b []byte) (float64, bool, bool) {
+	exclusive := len(b) > 0 && b[0] == '('
+	if exclusive {
+		b = b[1:]
+	}
+	score, ok := ParseScore(b)
+	return score, exclusive, ok
+}
+
+// ParseScore parses the score of a sorted set member, which may be infinite
+// but not NaN
+func ParseScore(b []byte) (float64, bool) {
+	s := string(b)
+	if len(s) == 0 || strings.TrimSpace(s) != s {
+		return 0, false
+	}
+
+	score, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, false
+	}
+	return score, true
+}
+
+// LexRange is a range of members, compared byte by byte. An end may also be
+// infinite, the minimum one being written - and the maximum one +.
+type LexRange struct {
+	Min, Max lexBound
+}
+
+type lexBound struct {
+	value     string
+	exclusive bool
+	// infinite is -1 for -, 1 for + and 0 for a member
+	infinite  int
+}
+
+// compare orders member relative to the bound
+func (b lexBound) compare(member string) int {
+	if b.infinite != 0 {
+		return -b.infinite
+	}
+	return strings.Compare(member, b.value)
+}
+
+func (r LexRange) gteMin(node *zskiplistNode) bool {
+	if r.Min.exclusive {
+		return r.Min.compare(node.member) > 0
+	}
+	return r.Min.compare(node.member) >= 0
+}
+
+func (r LexRange) lteMax(node *zskiplistNode) bool {
+	if r.Max.exclusive {
+		return r.Max.compare(node.member) < 0
+	}
+	return r.Max.compare(node.member) <= 0
+}
+
+// ParseLexRange parses the ends of a range of members: - or + or a member
+// prefixed with [ when included or ( when excluded
+func ParseLexRange(minArg, maxArg []byte) (LexRange, bool) {
+	var r LexRange
+	var ok bool
+	if r.Min, ok = parseLexBound(minArg); !ok {
+		return r, false
+	}
+	r.Max, ok = parseLexBound(maxArg)
+	return r, ok
+}
+
+func parseLexBound(b []byte) (lexBound, bool) {
+	switch {
+		case string(b) == "-":
+			return lexBound{infinite: -1}, true
+		case string(b) == "+":
+			return lexBound{infinite: 1}, true
+		case len(b) > 0 && b[0] == '[':
+			return lexBound{value: string(b[1:])}, true
+		case len(b) > 0 && b[0] == '(':
+			return lexBound{value: string(b[1:]), exclusive: true}, true
+	}
+	return lexBound{}, false
+}
+
+// Encoding returns the name of the encoding, as OBJECT ENCODING reports it
+func (z *ZSet) Encoding() string {
+	return ZSetEncodingSkiplist
+}
+
+// Len returns the number of members
+func (z *ZSet) Len() int {
+	return z.zsl.length
+}
+
+// Score returns the score of member
+func (z *ZSet) Score(member string) (float64, bool) {
+	return z.dict.Get(member)
+}
+
+// Set adds member with score, or moves it to score when it is a member
+// already, and reports whether it was added
+func (z *ZSet) Set(member string, score float64) bool {
+	current, exists := z.dict.Get(member)
+	if exists {
+		if current != score {
+			z.zsl.delete(current, member)
+			z.zsl.insert(score, member)
+			z.dict.Set(member, score)
+		}
+		return false
+	}
+
+	z.zsl.insert(score, member)
+	z.dict.Set(member, score)
+	return true
+}
+
+// Remove deletes member and reports whether it was a member
+func (z *ZSet) Remove(member string) bool {
+	score, exists := z.dict.Delete(member)
+	if !exists {
+		return false
+	}
+	z.zsl.delete(score, member)
+	return true
+}
+
+// Rank returns the 0-based rank of member, counted from the highest score
+// when reverse is set, and its score
+func (z *ZSet) Rank(member string, reverse bool) (int, float64, bool) {
+	score, exists := z.dict.Get(member)
+	if !exists {
+		return 0, 0, false
+	}
+
+	rank := z.zsl.rank(score, member) - 1
+	if reverse {
+		rank = z.zsl.length - 1 - rank
+	}
+	return rank, score, true
+}
+
+// RangeByRank returns the members between two 0-based ranks, both included
+// and within bounds, counted from the highest score when reverse is set
+func (z *ZSet) RangeByRank(start, stop int, reverse bool) []ZMember {
+	members := make([]ZMember, 0, stop - start + 1)
+
+	var x *zskiplistNode
+	if reverse {
+		x = z.zsl.byRank(z.zsl.length - start)
+	} else {
+		x = z.zsl.byRank(start + 1)
+	}
+	for ; x != nil && len(members) < stop - start + 1; x = z.next(x, reverse) {
+		members = append(members, ZMember{Member: x.member, Score: x.score})
+	}
+	return members
+}
+
+// RangeByScore returns the members whose score is in r, from the highest
+// score when reverse is set, skipping offset of them and returning no more
+// than count unless it is negative
+func (z *ZSet) RangeByScore(r ScoreRange, reverse bool, offset int, count int) []ZMember {
+	return z.rangeBy(r, reverse, offset, count)
+}
+
+// RangeByLex is RangeByScore for members in r. It is only meaningful when
+// all members have the same score.
+func (z *ZSet) RangeByLex(r LexRange, reverse bool, offset int, count int) []ZMember {
+	return z.rangeBy(r, reverse, offset, count)
+}
+
+// Range returns the members selected by opts
+func (z *ZSet) Range(opts ZRangeOptions) []ZMember {
+	switch {
+		case opts.ByScore != nil:
+			return z.RangeByScore(*opts.ByScore, opts.Reverse, opts.Offset, opts.Count)
+		case opts.ByLex != nil:
+			return z.RangeByLex(*opts.ByLex, opts.Reverse, opts.Offset, opts.Count)
+	}
+
+	start, stop, empty := clampRange(opts.Start, opts.Stop, z.Len())
+	if empty {
+		return make([]ZMember, 0)
+	}
+	return z.RangeByRank(start, stop, opts.Reverse)
+}
+
+func (z *ZSet) rangeBy(spec zrangeSpec, reverse bool, offset int, count int) []ZMember {
+	members := make([]ZMember, 0)
+
+	var x *zskiplistNode
+	if reverse {
+		x = z.zsl.lastInRange(spec)
+	} else {
+		x = z.zsl.firstInRange(spec)
+	}
+	for ; x != nil && offset > 0; offset-- {
+		x = z.next(x, reverse)
+	}
+
+	for ; x != nil && count != 0; x = z.next(x, reverse) {
+		if (reverse && !spec.gteMin(x)) || (!reverse && !spec.lteMax(x)) {
+			break
+		}
+		members = append(members, ZMember{Member: x.member, Score: x.score})
+		count--
+	}
+	return members
+}
+
+func (z *ZSet) next(x *zskiplistNode, reverse bool) *zskiplistNode {
+	if reverse {
+		return x.backward
+	}
+	return x.level[0].forward
+}
+
+// Pop removes up to count members with the lowest scores, or the highest
+// ones when max is set, and returns them in that order
+func (z *ZSet) Pop(count int, max bool) []ZMember {
+	members := z.RangeByRank(0, min(count, z.Len()) - 1, max)
+	for _, m := range members {
+		z.Remove(m.Member)
+	}
+	return members
+}
+
+// Count returns the number of members whose score is in r
+func (z *ZSet) Count(r ScoreRange) int {
+	first := z.zsl.firstInRange(r)
+	if first == nil {
+		return 0
+	}
+	last := z.zsl.lastInRange(r)
+	return z.zsl.rank(last.score, last.member) - z.zsl.rank(first.score, first.member) + 1
+}
+
+// Scan calls fn for the members in the buckets at cursor, like Dict.Scan
+func (z *ZSet) Scan(cursor uint64, fn func(member string, score float64)) uint64 {
+	return z.dict.Scan(cursor, fn)
+}
+
+// Clone returns a copy of the sorted set
+func (z *ZSet) Clone() *ZSet {
+	clone := NewZSet()
+	for x := z.zsl.header.level[0].forward; x != nil; x = x.level[0].forward {
+		clone.Set(x.member, x.score)
+	}
+	return clone
+}
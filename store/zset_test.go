@@ -0,0 +1,139 @@
+package store
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// compares ranks and ranges of the skiplist against a sorted slice
+func TestZSet_Skiplist(t *testing.T) {
+	z := NewZSet()
+	scores := make(map[string]float64)
+
+	for i := 0; i < 2000; i++ {
+		member := fmt.Sprintf("m%d", rand.Intn(500))
+		if rand.Intn(4) == 0 {
+			z.Remove(member)
+			delete(scores, member)
+			continue
+		}
+		score := float64(rand.Intn(50))
+		_, exists := scores[member]
+		assert.Equal(t, !exists, z.Set(member, score))
+		scores[member] = score
+	}
+
+	sorted := make([]ZMember, 0, len(scores))
+	for member, score := range scores {
+		sorted = append(sorted, ZMember{Member: member, Score: score})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Score != sorted[j].Score {
+			return sorted[i].Score < sorted[j].Score
+		}
+		return sorted[i].Member < sorted[j].Member
+	})
+	assert.Equal(t, len(sorted), z.Len())
+
+	for i, m := range sorted {
+		rank, score, exists := z.Rank(m.Member, false)
+		assert.True(t, exists)
+		assert.Equal(t, i, rank)
+		assert.Equal(t, m.Score, score)
+		rank, _, _ = z.Rank(m.Member, true)
+		assert.Equal(t, len(sorted) - 1 - i, rank)
+	}
+	assert.Equal(t, sorted, z.Range(ZRangeOptions{Start: 0, Stop: -1}))
+	assert.Equal(t, sorted[10:21], z.Range(ZRangeOptions{Start: 10, Stop: 20}))
+
+	reversed := make([]ZMember, len(sorted))
+	for i, m := range sorted {
+		reversed[len(sorted) - 1 - i] = m
+	}
+	assert.Equal(t, reversed[:5], z.Range(ZRangeOptions{Start: 0, Stop: 4, Reverse: true}))
+
+	// (10 20] skipping 3 members and returning 5
+	r := ScoreRange{Min: 10, Max: 20, MinExclusive: true}
+	var inRange []ZMember
+	for _, m := range sorted {
+		if m.Score > 10 && m.Score <= 20 {
+			inRange = append(inRange, m)
+		}
+	}
+	assert.Equal(t, len(inRange), z.Count(r))
+	assert.Equal(t, inRange, z.RangeByScore(r, false, 0, -1))
+	assert.Equal(t, inRange[3:8], z.RangeByScore(r, false, 3, 5))
+	assert.Equal(t, inRange[len(inRange) - 1], z.RangeByScore(r, true, 0, 1)[0])
+	assert.Empty(t, z.RangeByScore(ScoreRange{Min: 60, Max: math.Inf(1)}, false, 0, -1))
+}
+
+func TestZSet_Lex(t *testing.T) {
+	z := NewZSet()
+	for _, member := range []string{"e", "a", "c", "b", "d"} {
+		z.Set(member, 0)
+	}
+
+	r, ok := ParseLexRange([]byte("(b"), []byte("[d"))
+	assert.True(t, ok)
+	assert.Equal(t, []ZMember{{Member: "c"}, {Member: "d"}}, z.RangeByLex(r, false, 0, -1))
+	assert.Equal(t, []ZMember{{Member: "d"}, {Member: "c"}}, z.RangeByLex(r, true, 0, -1))
+
+	r, _ = ParseLexRange([]byte("-"), []byte("+"))
+	assert.Equal(t, 5, len(z.RangeByLex(r, false, 0, -1)))
+	r, _ = ParseLexRange([]byte("+"), []byte("-"))
+	assert.Empty(t, z.RangeByLex(r, false, 0, -1))
+
+	for _, invalid := range [][2]string{{"a", "[b"}, {"[a", ""}} {
+		_, ok = ParseLexRange([]byte(invalid[0]), []byte(invalid[1]))
+		assert.False(t, ok, invalid)
+	}
+	for _, invalid := range []string{"nan", "abc", ""} {
+		_, ok = ParseScore([]byte(invalid))
+		assert.False(t, ok, invalid)
+	}
+	score, ok := ParseScore([]byte("-inf"))
+	assert.True(t, ok)
+	assert.Equal(t, math.Inf(-1), score)
+}
+
+func TestZSetStore_Algebra(t *testing.T) {
+	s := NewDB(0)
+
+	s.ZSetStore.Add("a", []ZMember{{Member: "x", Score: 1}, {Member: "y", Score: 2}, {Member: "z", Score: math.Inf(1)}}, ZAddOptions{})
+	s.ZSetStore.Add("b", []ZMember{{Member: "y", Score: 10}, {Member: "z", Score: math.Inf(-1)}}, ZAddOptions{})
+	s.SetStore.Add("s", []string{"x", "w"})
+
+	// sets count as sorted sets whose members score 1, and inf - inf is 0
+	union, err := s.ZSetStore.Union([]string{"a", "b", "s", "missing"}, nil, ZAggregateSum)
+	assert.Nil(t, err)
+	assert.Equal(t, []ZMember{{Member: "z", Score: 0}, {Member: "w", Score: 1}, {Member: "x", Score: 2}, {Member: "y", Score: 12}}, union)
+
+	inter, err := s.ZSetStore.Inter([]string{"a", "b"}, []float64{2, 0.5}, ZAggregateMax)
+	assert.Nil(t, err)
+	assert.Equal(t, []ZMember{{Member: "y", Score: 5}, {Member: "z", Score: math.Inf(1)}}, inter)
+	inter, err = s.ZSetStore.Inter([]string{"a", "missing"}, nil, ZAggregateSum)
+	assert.Nil(t, err)
+	assert.Empty(t, inter)
+
+	diff, err := s.ZSetStore.Diff([]string{"a", "s", "missing"})
+	assert.Nil(t, err)
+	assert.Equal(t, []ZMember{{Member: "y", Score: 2}, {Member: "z", Score: math.Inf(1)}}, diff)
+
+	s.KVStore.Set("str", []byte("v"), -1)
+	_, err = s.ZSetStore.Union([]string{"a", "str"}, nil, ZAggregateSum)
+	assert.Equal(t, ErrWrongType, err)
+
+	// popping the last members deletes the key
+	popped, err := s.ZSetStore.Pop("b", 5, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []ZMember{{Member: "y", Score: 10}, {Member: "z", Score: math.Inf(-1)}}, popped)
+	assert.Equal(t, TypeNone, s.Type("b"))
+	popped, err = s.ZSetStore.Pop("b", 1, false)
+	assert.Nil(t, err)
+	assert.Nil(t, popped)
+}
@@ -0,0 +1,442 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"slices"
+)
+
+// ErrScoreNaN is returned when an increment would make a score NaN, such as
+// adding -inf to +inf
+var ErrScoreNaN = errors.New("resulting score is not a number (NaN)")
+
+// zsetOf returns the sorted set of a sorted set object, nil for a missing key
+func zsetOf(obj *Object) (*ZSet, error) {
+	if obj == nil {
+		return nil, nil
+	}
+
+	zset, isZSet := obj.Value.(*ZSet)
+	if !isZSet {
+		return nil, ErrWrongType
+	}
+	return zset, nil
+}
+
+// update changes the sorted set stored at key in place with fn, which
+// receives nil when the key is missing. An empty sorted set left by fn is
+// deleted.
+func (zs *ZSetStoreImpl) update(key string, fn func(zset *ZSet) (*ZSet, error)) error {
+	return zs.Keyspace.Update(key, func(obj *Object) (*Object, error) {
+		zset, err := zsetOf(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		zset, err = fn(zset)
+		if err != nil {
+			return nil, err
+		}
+
+		if zset == nil || zset.Len() == 0 {
+			return nil, nil
+		}
+		if obj != nil && obj.Value == zset {
+			return obj, nil
+		}
+		return &Object{
+			Value:      zset,
+			Expiration: -1,
+		}, nil
+	})
+}
+
+// view calls fn with the sorted set stored at key, nil when the key is missing
+func (zs *ZSetStoreImpl) view(key string, fn func(zset *ZSet) error) error {
+	return zs.Keyspace.View(key, func(obj *Object) error {
+		zset, err := zsetOf(obj)
+		if err != nil {
+			return err
+		}
+		return fn(zset)
+	})
+}
+
+// ZAddOptions are the conditions of a ZADD
+type ZAddOptions struct {
+	// NX only adds new members, XX only updates existing ones
+	NX bool
+	XX bool
+	// GT only updates a score to a greater one, LT to a lower one
+	GT bool
+	LT bool
+	// Incr adds the given score to the current one instead of replacing it
+	Incr bool
+}
+
+// ZAddResult tells what a ZADD did. Score is the score of the last member
+// after an Incr, and Applied whether it was written.
+type ZAddResult struct {
+	Added   int
+	Updated int
+	Score   float64
+	Applied bool
+}
+
+// Add sets the scores of members of the sorted set stored at key under the
+// conditions of opts, creating it when missing
+func (zs *ZSetStoreImpl) Add(key string, members []ZMember, opts ZAddOptions) (ZAddResult, error) {
+	var result ZAddResult
+
+	err := zs.update(key, func(zset *ZSet) (*ZSet, error) {
+		if zset == nil {
+			if opts.XX {
+				return nil, nil
+			}
+			zset = NewZSet()
+		}
+
+		for _, m := range members {
+			current, exists := zset.Score(m.Member)
+			if !exists {
+				if opts.XX {
+					continue
+				}
+				zset.Set(m.Member, m.Score)
+				result.Added++
+				result.Score, result.Applied = m.Score, true
+				continue
+			}
+
+			if opts.NX {
+				continue
+			}
+			score := m.Score
+			if opts.Incr {
+				score += current
+				if math.IsNaN(score) {
+					return nil, ErrScoreNaN
+				}
+			}
+			if (opts.GT && score <= current) || (opts.LT && score >= current) {
+				continue
+			}
+
+			result.Score, result.Applied = score, true
+			if score != current {
+				zset.Set(m.Member, score)
+				result.Updated++
+			}
+		}
+		return zset, nil
+	})
+
+	return result, err
+}
+
+// Remove deletes members from the sorted set stored at key, deleting it once
+// it has none left, and returns how many were members
+func (zs *ZSetStoreImpl) Remove(key string, members []string) (int, error) {
+	removed := 0
+
+	err := zs.update(key, func(zset *ZSet) (*ZSet, error) {
+		if zset == nil {
+			return nil, nil
+		}
+		for _, member := range members {
+			if zset.Remove(member) {
+				removed++
+			}
+		}
+		return zset, nil
+	})
+
+	return removed, err
+}
+
+// Scores returns the scores of members of the sorted set stored at key, and
+// for each whether it is a member
+func (zs *ZSetStoreImpl) Scores(key string, members []string) ([]float64, []bool, error) {
+	scores := make([]float64, len(members))
+	found := make([]bool, len(members))
+
+	err := zs.view(key, func(zset *ZSet) error {
+		if zset == nil {
+			return nil
+		}
+		for i, member := range members {
+			scores[i], found[i] = zset.Score(member)
+		}
+		return nil
+	})
+
+	return scores, found, err
+}
+
+// Card returns the number of members of the sorted set stored at key
+func (zs *ZSetStoreImpl) Card(key string) (int, error) {
+	length := 0
+
+	err := zs.view(key, func(zset *ZSet) error {
+		if zset != nil {
+			length = zset.Len()
+		}
+		return nil
+	})
+
+	return length, err
+}
+
+// Rank returns the 0-based rank of member in the sorted set stored at key,
+// counted from the highest score when reverse is set, and its score
+func (zs *ZSetStoreImpl) Rank(key string, member string, reverse bool) (rank int, score float64, exists bool, err error) {
+	err = zs.view(key, func(zset *ZSet) error {
+		if zset != nil {
+			rank, score, exists = zset.Rank(member, reverse)
+		}
+		return nil
+	})
+
+	return rank, score, exists, err
+}
+
+// Count returns the number of members of the sorted set stored at key whose
+// score is in r
+func (zs *ZSetStoreImpl) Count(key string, r ScoreRange) (int, error) {
+	count := 0
+
+	err := zs.view(key, func(zset *ZSet) error {
+		if zset != nil {
+			count = zset.Count(r)
+		}
+		return nil
+	})
+
+	return count, err
+}
+
+// ZRangeOptions select the members returned by Range: by rank between Start
+// and Stop when neither ByScore nor ByLex is set, in which case Offset and
+// Count apply. Ranks may be negative to count from the end.
+type ZRangeOptions struct {
+	Start, Stop int
+	ByScore     *ScoreRange
+	ByLex       *LexRange
+	Reverse     bool
+	// Count is negative for no limit
+	Offset, Count int
+}
+
+// Range returns the members of the sorted set stored at key selected by opts
+func (zs *ZSetStoreImpl) Range(key string, opts ZRangeOptions) ([]ZMember, error) {
+	members := make([]ZMember, 0)
+
+	err := zs.view(key, func(zset *ZSet) error {
+		if zset != nil {
+			members = zset.Range(opts)
+		}
+		return nil
+	})
+
+	return members, err
+}
+
+// Pop removes up to count members with the lowest scores, or the highest ones
+// when max is set, from the sorted set stored at key, deleting it once it has
+// none left. It returns nil when the key is missing.
+func (zs *ZSetStoreImpl) Pop(key string, count int, max bool) ([]ZMember, error) {
+	var members []ZMember
+
+	err := zs.update(key, func(zset *ZSet) (*ZSet, error) {
+		if zset == nil {
+			return nil, nil
+		}
+		members = zset.Pop(count, max)
+		return zset, nil
+	})
+
+	return members, err
+}
+
+// ZAggregate is how the weighted scores of a member in several sorted sets
+// combine in a union or an intersection
+type ZAggregate int
+
+const (
+	ZAggregateSum ZAggregate = iota
+	ZAggregateMin
+	ZAggregateMax
+)
+
+func (a ZAggregate) apply(acc, score float64) float64 {
+	switch a {
+		case ZAggregateMin:
+			return min(acc, score)
+		case ZAggregateMax:
+			return max(acc, score)
+	}
+	return zeroNaN(acc + score)
+}
+
+// zeroNaN returns 0 for NaN, which adding or weighting infinite scores can
+// give, the way redis does
+func zeroNaN(score float64) float64 {
+	if math.IsNaN(score) {
+		return 0
+	}
+	return score
+}
+
+// snapshot returns copies of the sorted sets stored at keys, nil for missing
+// keys. Sets are read as sorted sets whose members all have a score of 1.
+func (zs *ZSetStoreImpl) snapshot(keys []string) ([]*ZSet, error) {
+	zsets := make([]*ZSet, len(keys))
+	for i, key := range keys {
+		err := zs.Keyspace.View(key, func(obj *Object) error {
+			if obj == nil {
+				return nil
+			}
+
+			switch value := obj.Value.(type) {
+				case *ZSet:
+					zsets[i] = value.Clone()
+				case *Set:
+					zset := NewZSet()
+					value.Range(func(member string) bool {
+						zset.Set(member, 1)
+						return true
+					})
+					zsets[i] = zset
+				default:
+					return ErrWrongType
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return zsets, nil
+}
+
+// weight returns the weight of the i-th input, 1 when weights is nil
+func weight(weights []float64, i int) float64 {
+	if weights == nil {
+		return 1
+	}
+	return weights[i]
+}
+
+// Union returns, ordered by score, the members of any sorted set stored at
+// keys. A member's score is its score in each of them multiplied by the
+// weight of that key, combined with aggregate. weights is nil or has a weight
+// per key. A missing key is an empty sorted set.
+func (zs *ZSetStoreImpl) Union(keys []string, weights []float64, aggregate ZAggregate) ([]ZMember, error) {
+	zsets, err := zs.snapshot(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	result := NewZSet()
+	for i, zset := range zsets {
+		if zset == nil {
+			continue
+		}
+		for _, m := range zset.RangeByRank(0, zset.Len() - 1, false) {
+			score := zeroNaN(m.Score * weight(weights, i))
+			if current, exists := result.Score(m.Member); exists {
+				score = aggregate.apply(current, score)
+			}
+			result.Set(m.Member, score)
+		}
+	}
+	return result.RangeByRank(0, result.Len() - 1, false), nil
+}
+
+// Inter returns, ordered by score, the members of every sorted set stored at
+// keys, with scores combined like Union
+func (zs *ZSetStoreImpl) Inter(keys []string, weights []float64, aggregate ZAggregate) ([]ZMember, error) {
+	zsets, err := zs.snapshot(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	if slices.Contains(zsets, nil) {
+		return make([]ZMember, 0), nil
+	}
+
+	// iterate the smallest sorted set, checking the others from the smallest
+	order := make([]int, len(zsets))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortFunc(order, func(a, b int) int { return zsets[a].Len() - zsets[b].Len() })
+
+	result := NewZSet()
+	smallest := zsets[order[0]]
+	for _, m := range smallest.RangeByRank(0, smallest.Len() - 1, false) {
+		score := zeroNaN(m.Score * weight(weights, order[0]))
+		inAll := true
+		for _, i := range order[1:] {
+			other, exists := zsets[i].Score(m.Member)
+			if !exists {
+				inAll = false
+				break
+			}
+			score = aggregate.apply(score, zeroNaN(other * weight(weights, i)))
+		}
+		if inAll {
+			result.Set(m.Member, score)
+		}
+	}
+	return result.RangeByRank(0, result.Len() - 1, false), nil
+}
+
+// Diff returns, ordered by score, the members of the sorted set stored at the
+// first key that are not members of the ones stored at the other keys
+func (zs *ZSetStoreImpl) Diff(keys []string) ([]ZMember, error) {
+	zsets, err := zs.snapshot(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]ZMember, 0)
+	if zsets[0] == nil {
+		return members, nil
+	}
+	for _, m := range zsets[0].RangeByRank(0, zsets[0].Len() - 1, false) {
+		found := false
+		for _, zset := range zsets[1:] {
+			if zset == nil {
+				continue
+			}
+			if _, found = zset.Score(m.Member); found {
+				break
+			}
+		}
+		if !found {
+			members = append(members, m)
+		}
+	}
+	return members, nil
+}
+
+// Replace stores a sorted set of members at dst, replacing any previous value
+// whatever its type, or deletes dst when members is empty. It returns the
+// number of members stored.
+func (zs *ZSetStoreImpl) Replace(dst string, members []ZMember) int {
+	if len(members) == 0 {
+		zs.Keyspace.Delete(dst)
+		return 0
+	}
+
+	zset := NewZSet()
+	for _, m := range members {
+		zset.Set(m.Member, m.Score)
+	}
+	zs.Keyspace.Set(dst, &Object{
+		Value:      zset,
+		Expiration: -1,
+	})
+	return zset.Len()
+}